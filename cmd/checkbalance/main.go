@@ -8,13 +8,15 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"math"
+	"math/big"
 	"os"
 
 	"strings"
 	"time"
 )
 
-var coin, addr, mode, rpcJsonFileName, porCsvFileName string
+var coin, addr, mode, rpcJsonFileName, porCsvFileName, porIndexFileName, blockHashFileName string
+var keepExtracted bool
 
 var porCoinTotalBalance map[string]decimal.Decimal
 
@@ -28,8 +30,17 @@ var rootCmd = &cobra.Command{
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		exit(1)
 	}
+	exit(0)
+}
+
+// exit removes the csv copies extracted from bundles, unless --keep-extracted is set, and exits
+func exit(code int) {
+	if !keepExtracted {
+		common.RemoveExtractedPorCsv()
+	}
+	os.Exit(code)
 }
 
 func init() {
@@ -38,6 +49,9 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&mode, "mode", "", "")
 	rootCmd.PersistentFlags().StringVar(&rpcJsonFileName, "rpc_json_filename", "rpc.json", "")
 	rootCmd.PersistentFlags().StringVar(&porCsvFileName, "por_csv_filename", "", "")
+	rootCmd.PersistentFlags().BoolVar(&keepExtracted, "keep-extracted", false, "keep the csv extracted from a .zip or .gz bundle, and its index, in the temp directory for later runs")
+	rootCmd.PersistentFlags().StringVar(&porIndexFileName, "por_index_filename", "", "por csv index file, built on first use, default is the por csv filename with an .idx suffix")
+	rootCmd.PersistentFlags().StringVar(&blockHashFileName, "block_hash_filename", "", "expected block hash list, every line is coin,snapshot height,block hash")
 	// set decimal precision
 	decimal.DivisionPrecision = 18
 }
@@ -50,43 +64,38 @@ func CoinAddressBalanceValidator(cmd *cobra.Command, args []string) {
 	client.HttpClient = client.NewHTTPClient()
 	// init rpc client
 	client.RpcClient = client.NewJsonRPCClient()
-	// init por csv data
-	log.Info("loading por csv data...")
-	var err error
-	common.PorCoinDataMap, err = common.InitPorCsvDataMap(porCsvFileName)
+	// resolve .zip/.gz bundles to the csv that is verified
+	source, err := common.OpenPorCsvSource(porCsvFileName)
 	if err != nil {
 		log.Errorf("load por csv data failed, error: %v", err)
 		return
 	}
+	log.Infof("por csv data: %s", source)
+	porCsvFileName = source.Path
+
+	// index por csv data, rows are read from the file on demand
+	log.Info("indexing por csv data...")
+	common.PorCoinDataIndex, err = common.OpenPorCsvIndex(porCsvFileName, porIndexFileName)
+	if err != nil {
+		log.Errorf("load por csv data failed, error: %v", err)
+		return
+	}
+	defer common.PorCoinDataIndex.Close()
 
 	porCoinTotalBalance = make(map[string]decimal.Decimal)
 	// scan por data
-	for k, v := range common.PorCoinDataMap {
-		keys := strings.Split(k, ":")
-		coinName := keys[0]
+	err = common.ForEachPorCoinData(porCsvFileName, func(v *common.CoinData) error {
 		if v.Balance == "" {
-			log.Errorf("balance is null, coin: %s, address: %s", coinName, v.Address)
-			continue
+			log.Errorf("balance is null, coin: %s, address: %s", v.Coin, v.Address)
+			return nil
 		}
 		b, _ := decimal.NewFromString(v.Balance)
-		if _, exist := porCoinTotalBalance[coinName]; exist {
-			porCoinTotalBalance[coinName] = porCoinTotalBalance[coinName].Add(b)
-		} else {
-			porCoinTotalBalance[coinName] = b
-		}
-
-		// recover btc P2PKH address pubkey
-		if coinName == "BTC" {
-			addrTye := common.GuessUtxoCoinAddressType(v.Address)
-			if addrTye == "P2PKH" {
-				// recover pubKey
-				pubkey := common.RecoveryPubKeyFromSign(v.Address, v.Message, v.Sign1)
-				v.Script = pubkey
-				if pubkey == "" {
-					log.Errorf("recovery pubkey from sign msg failed, coin: %s, address: %s", coinName, v.Address)
-				}
-			}
-		}
+		porCoinTotalBalance[v.Coin] = porCoinTotalBalance[v.Coin].Add(b)
+		return nil
+	})
+	if err != nil {
+		log.Errorf("load por csv data failed, error: %v", err)
+		return
 	}
 
 	// init Validator
@@ -95,6 +104,13 @@ func CoinAddressBalanceValidator(cmd *cobra.Command, args []string) {
 		log.Errorf("init rpc.json failed, error: %v, please check the rpc json file", err)
 		return
 	}
+	if blockHashFileName != "" {
+		if err = validator.LoadExpectedBlockHashes(blockHashFileName); err != nil {
+			log.Errorf("load expected block hash file failed, error: %v", err)
+			return
+		}
+	}
+	defer printBlockHashPins(validator)
 
 	coin = strings.ToUpper(coin)
 	mode = strings.ToLower(mode)
@@ -117,7 +133,7 @@ func CoinAddressBalanceValidator(cmd *cobra.Command, args []string) {
 			log.Error("you must set the coin_name")
 			return
 		} else {
-			if _, exist := common.PorCoinDataMap[fmt.Sprintf("%s:%s", coin, addr)]; !exist {
+			if len(findPorCoinData(coin, addr)) == 0 {
 				log.Errorf("por data not support the coin %s, address %s, please set the correct one!", coin, addr)
 				return
 			}
@@ -179,121 +195,147 @@ func CoinAddressBalanceValidator(cmd *cobra.Command, args []string) {
 	}
 }
 
+// findPorCoinData returns the rows of an address on every network and type.
+func findPorCoinData(coin, addr string) []*common.CoinData {
+	values, err := common.PorCoinDataIndex.Find(coin, addr)
+	if err != nil {
+		log.Errorf("look up coin %s, address %s in por index failed, error: %v", coin, addr, err)
+	}
+	return values
+}
+
 func VerifySingleAddressBalance(validator *common.AddressBalanceValidator, coin, addr string) {
-	value, exist := common.PorCoinDataMap[fmt.Sprintf("%s:%s", coin, addr)]
-	if !exist {
+	values := findPorCoinData(coin, addr)
+	if len(values) == 0 {
 		log.Errorf("unsupport the coin %s, please check the coin_name!", coin)
 		return
 	}
-	height := value.SnapshotHeight
-	balance, err := validator.GetCoinAddressBalanceInfo(strings.ToLower(coin), addr, height)
-	if err != nil {
-		log.Errorf("get coin %s, address %s balance from blockchain failed!", coin, addr)
-		return
-	}
+	for _, value := range values {
+		height := value.SnapshotHeight
+		balance, err := validator.GetCoinAddressBalanceInfo(value.Key(), height)
+		if err != nil {
+			log.Errorf("get coin %s, network %s, address %s balance from blockchain failed!", coin, value.Network, addr)
+			continue
+		}
 
-	balance = convertCoinBalanceToBaseUnit(coin, balance, -1)
-	// compare
-	if isCoinBalanceEqual(balance, value.Balance) {
-		log.Infof("verify coin %s, address %s balance success, in chain balance: %s, in por balance: %s", coin, addr, balance, value.Balance)
-	} else {
-		log.Infof("verify coin %s, address %s balance failed, in chain balance: %s, in por balance: %s", coin, addr, balance, value.Balance)
+		balance = convertCoinBalanceToBaseUnit(coin, balance, -1)
+		// compare
+		if isCoinBalanceEqual(balance, value.Balance) {
+			log.Infof("verify coin %s, network %s, address %s balance success, in chain balance: %s, in por balance: %s", coin, value.Network, addr, balance, value.Balance)
+		} else {
+			log.Infof("verify coin %s, network %s, address %s balance failed, in chain balance: %s, in por balance: %s", coin, value.Network, addr, balance, value.Balance)
+		}
 	}
 }
 
 func VerifySingleCoinAllAddressBalance(validator *common.AddressBalanceValidator, coin string) {
 	destCoins := getDestCoinList(coin)
-	coinDataList := make([]*common.CoinData, 0)
-	for _, value := range common.PorCoinDataMap {
+	err := common.ForEachPorCoinData(porCsvFileName, func(v *common.CoinData) error {
 		for _, destCoin := range destCoins {
-			if destCoin == value.Coin {
-				coinDataList = append(coinDataList, value)
-			}
-		}
-	}
-
-	for _, v := range coinDataList {
-		balance, err := validator.GetCoinAddressBalanceInfo(strings.ToLower(v.Coin), v.Address, v.SnapshotHeight)
-		if err != nil {
-			log.Errorf("get address %s balance from blockchain failed, error: %v", v.Address, err)
-			continue
-		}
-		balance = convertCoinBalanceToBaseUnit(v.Coin, balance, -1)
-		// compare
-		if value, exist := common.PorCoinDataMap[fmt.Sprintf("%s:%s", v.Coin, v.Address)]; exist {
-			if isCoinBalanceEqual(balance, value.Balance) {
-				log.Infof("verify coin %s, address %s balance success, in chain balance: %s, in por balance: %s", v.Coin, v.Address, balance, value.Balance)
-			} else {
-				log.Infof("verify coin %s, address %s balance failed, in chain balance:%s, in por balance:%s", v.Coin, v.Address, balance, value.Balance)
+			if destCoin == v.Coin {
+				verifyAddressBalance(validator, v)
+				time.Sleep(500 * time.Millisecond)
 			}
 		}
-		time.Sleep(500 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		log.Errorf("read por csv data failed, error: %v", err)
 	}
 }
 
 func VerifyAllCoinAddressBalance(validator *common.AddressBalanceValidator) {
-	for _, v := range common.PorCoinDataMap {
+	err := common.ForEachPorCoinData(porCsvFileName, func(v *common.CoinData) error {
 		// check coin black list
 		if common.IsCheckBalanceBannedCoin(coin) {
-			continue
-		}
-		balance, err := validator.GetCoinAddressBalanceInfo(strings.ToLower(v.Coin), v.Address, v.SnapshotHeight)
-		if err != nil {
-			log.Errorf("get address %s balance from blockchain failed, error: %v", v.Address, err)
-			continue
-		}
-		balance = convertCoinBalanceToBaseUnit(v.Coin, balance, -1)
-		// compare
-		if isCoinBalanceEqual(balance, v.Balance) {
-			log.Infof("verify coin %s, address %s balance success, in chain balance: %s, in por balance: %s", v.Coin, v.Address, balance, v.Balance)
-		} else {
-			log.Infof("verify coin %s, address %s balance failed, in chain balance: %s, in por balance: %s", v.Coin, v.Address, balance, v.Balance)
+			return nil
 		}
+		verifyAddressBalance(validator, v)
 		time.Sleep(500 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		log.Errorf("read por csv data failed, error: %v", err)
+	}
+}
+
+func verifyAddressBalance(validator *common.AddressBalanceValidator, v *common.CoinData) {
+	balance, err := validator.GetCoinAddressBalanceInfo(v.Key(), v.SnapshotHeight)
+	if err != nil {
+		log.Errorf("get address %s balance from blockchain failed, error: %v", v.Address, err)
+		return
+	}
+	balance = convertCoinBalanceToBaseUnit(v.Coin, balance, -1)
+	// compare
+	if isCoinBalanceEqual(balance, v.Balance) {
+		log.Infof("verify coin %s, address %s balance success, in chain balance: %s, in por balance: %s", v.Coin, v.Address, balance, v.Balance)
+	} else {
+		log.Infof("verify coin %s, address %s balance failed, in chain balance: %s, in por balance: %s", v.Coin, v.Address, balance, v.Balance)
 	}
 }
 
 func VerifyCoinAddressTotalBalance(validator *common.AddressBalanceValidator, coin string) {
 	totalBalance, totalPorBalance := decimal.NewFromInt(0), decimal.NewFromInt(0)
-	coinAddressListMap, coinSnapshotHeightMap := make(map[string][]string), make(map[string]string)
+	// addresses are streamed from the file and queried one chunk at a time, only the current
+	// chunk of every coin is held in memory
+	coinAddressChunkMap, coinSnapshotHeightMap := make(map[string][]common.PorCoinKey), make(map[string]string)
+	coinChunkCountMap, coinAmountMap := make(map[string]int), make(map[string]*big.Int)
+	flush := func(coinTemp string) error {
+		addressList := coinAddressChunkMap[coinTemp]
+		if len(addressList) == 0 {
+			return nil
+		}
+		chunkBalance, err := validator.GetCoinAddressChunkBalance(strings.ToLower(coinTemp), coinSnapshotHeightMap[coinTemp], addressList, coinChunkCountMap[coinTemp])
+		if err != nil {
+			return fmt.Errorf("get coin %s total address balance from blockchain failed, error: %v", coinTemp, err)
+		}
+		amount := coinAmountMap[coinTemp].Add(coinAmountMap[coinTemp], chunkBalance)
+		log.Infof("coin %s, chunk %d, chunk balance %s, total balance %s", coinTemp, coinChunkCountMap[coinTemp]+1, chunkBalance.String(), amount.String())
+		coinAddressChunkMap[coinTemp] = addressList[:0]
+		coinChunkCountMap[coinTemp]++
+		return nil
+	}
 	// get dest coins
 	destCoins := getDestCoinList(coin)
-	for _, value := range common.PorCoinDataMap {
+	err := common.ForEachPorCoinData(porCsvFileName, func(value *common.CoinData) error {
 		for index := range destCoins {
 			if value.Coin == destCoins[index] {
 				if value.Address == "" {
 					continue
 				}
 
-				if coin == "BTC" && value.Script == "" {
+				// P2PKH rows carry no script, their public key is recovered from the signature
+				if coin == "BTC" && value.Script == "" && common.GuessUtxoCoinAddressType(value.Address) != "P2PKH" {
 					continue
 				}
 
-				if _, exist := coinAddressListMap[value.Coin]; exist {
-					coinAddressListMap[value.Coin] = append(coinAddressListMap[value.Coin], value.Address)
-				} else {
-					coinAddressListMap[value.Coin] = []string{value.Address}
-				}
-
 				if _, exist := coinSnapshotHeightMap[value.Coin]; !exist {
 					coinSnapshotHeightMap[value.Coin] = value.SnapshotHeight
+					coinAmountMap[value.Coin] = big.NewInt(0)
+				}
+				coinAddressChunkMap[value.Coin] = append(coinAddressChunkMap[value.Coin], value.Key())
+				if len(coinAddressChunkMap[value.Coin]) >= common.AddressChunkSize(strings.ToLower(value.Coin)) {
+					return flush(value.Coin)
 				}
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("verify coin %s total address balance failed, error: %v", coin, err)
+		return
+	}
+	if len(coinAmountMap) == 0 {
+		log.Errorf("no address to verify coin %s total balance", coin)
+		return
 	}
 
-	for coinTemp, addressList := range coinAddressListMap {
-		height := coinSnapshotHeightMap[coinTemp]
-		if len(addressList) == 0 {
-			log.Errorf("no address to verify coin %s total balance", coin)
+	for coinTemp := range coinAmountMap {
+		if err = flush(coinTemp); err != nil {
+			log.Error(err)
 			return
 		}
-		amount, err := validator.GetCoinAddressTotalBalance(strings.ToLower(coinTemp), height, addressList)
-		if err != nil {
-			log.Errorf("get coin %s total address balance from blockchain failed, error: %v", coin, err)
-			return
-		}
-		coinAmount, _ := decimal.NewFromString(amount)
+		coinAmount := decimal.NewFromBigInt(coinAmountMap[coinTemp], 0)
 		// USDC-OKC20/USDT-OKC20 precision is 18, convert to 6
 		if coinTemp == "USDC-OKC20" || coinTemp == "USDT-OKC20" {
 			coinAmountDecimal, _ := decimal.NewFromString(convertCoinBalanceToBaseUnit(coinTemp, coinAmount.String(), -1))
@@ -326,6 +368,21 @@ func VerifyAllCoinAddressTotalBalance(validator *common.AddressBalanceValidator)
 	}
 }
 
+func printBlockHashPins(validator *common.AddressBalanceValidator) {
+	pins := validator.BlockHashPins()
+	if len(pins) == 0 {
+		return
+	}
+	log.Info("queried blocks:")
+	for _, pin := range pins {
+		if pin.Expected != "" {
+			log.Infof("coin %s, snapshot height %s, block hash %s, matches expected hash", pin.Coin, pin.Height, pin.Hash)
+		} else {
+			log.Infof("coin %s, snapshot height %s, block hash %s", pin.Coin, pin.Height, pin.Hash)
+		}
+	}
+}
+
 func convertCoinBalanceToBaseUnit(coin, amount string, round int32) string {
 	precision, exist := common.PorCoinBaseUnitPrecisionMap[coin]
 	if !exist {
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/okx/proof-of-reserves/common"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+var oldCsvFileName, newCsvFileName, output string
+var keepExtracted bool
+
+var rootCmd = &cobra.Command{
+	Use:   "PorDiff",
+	Short: "Diff two PoR snapshot files",
+	Long:  ``,
+	Run:   PorDiff,
+}
+
+func Execute() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Println(err)
+		exit(1)
+	}
+	exit(0)
+}
+
+// exit removes the csv copies extracted from bundles, unless --keep-extracted is set, and exits
+func exit(code int) {
+	if !keepExtracted {
+		common.RemoveExtractedPorCsv()
+	}
+	os.Exit(code)
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&oldCsvFileName, "old_por_csv_filename", "", "the previous snapshot")
+	rootCmd.PersistentFlags().StringVar(&newCsvFileName, "new_por_csv_filename", "", "the current snapshot")
+	rootCmd.PersistentFlags().BoolVar(&keepExtracted, "keep-extracted", false, "keep the csv extracted from a .zip or .gz bundle, and its index, in the temp directory for later runs")
+	rootCmd.PersistentFlags().StringVar(&output, "output", "text", "output format, text or json")
+}
+
+func PorDiff(cmd *cobra.Command, args []string) {
+	if oldCsvFileName == "" || newCsvFileName == "" {
+		fmt.Println("Fail to diff snapshots, --old_por_csv_filename and --new_por_csv_filename must be set")
+		exit(1)
+	}
+	// resolve .zip/.gz bundles to the csv that is compared
+	oldSource, err := common.OpenPorCsvSource(oldCsvFileName)
+	if err != nil {
+		fmt.Println("Fail to load the previous snapshot, error:", err)
+		exit(1)
+	}
+	newSource, err := common.OpenPorCsvSource(newCsvFileName)
+	if err != nil {
+		fmt.Println("Fail to load the current snapshot, error:", err)
+		exit(1)
+	}
+	oldData, err := common.InitPorCsvDataMap(oldSource.Path)
+	if err != nil {
+		fmt.Println("Fail to load the previous snapshot, error:", err)
+		exit(1)
+	}
+	newData, err := common.InitPorCsvDataMap(newSource.Path)
+	if err != nil {
+		fmt.Println("Fail to load the current snapshot, error:", err)
+		exit(1)
+	}
+
+	diff := common.DiffPorCsvData(oldData, newData)
+	diff.OldFile, diff.NewFile = oldSource, newSource
+	switch strings.ToLower(output) {
+	case "json":
+		b, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			fmt.Println("Fail to encode the diff, error:", err)
+			exit(1)
+		}
+		fmt.Println(string(b))
+	case "text":
+		fmt.Printf("Diff %s -> %s\n", oldCsvFileName, newCsvFileName)
+		fmt.Printf("Old file: %s\n", oldSource)
+		fmt.Printf("New file: %s\n", newSource)
+		diff.WriteText(os.Stdout)
+	default:
+		fmt.Printf("Fail to diff snapshots, unsupported output format %s\n", output)
+		exit(1)
+	}
+	// a row whose balance cannot be read makes the totals of its coin incomplete
+	if len(diff.ParseErrors) > 0 {
+		exit(1)
+	}
+}
+
+func main() {
+	Execute()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/okx/proof-of-reserves/common"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+var (
+	csvFileName, seed, message  string
+	amount, snapshotHeight, typ string
+	coins, keys                 []string
+	rowsPerCoin, columns        int
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "PorSign",
+	Short: "Sign a synthetic PoR file with test keys",
+	Long:  ``,
+	Run:   PorSign,
+}
+
+func Execute() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&csvFileName, "por_csv_filename", "", "write the PoR file to this file, default is stdout")
+	rootCmd.PersistentFlags().StringSliceVar(&coins, "coins", nil, "coins of the file, default is every published coin the verifiers support")
+	rootCmd.PersistentFlags().IntVar(&rowsPerCoin, "rows", 1, "number of addresses per coin")
+	rootCmd.PersistentFlags().IntVar(&columns, "columns", 12, "detail layout, 9 or 12 columns")
+	rootCmd.PersistentFlags().StringSliceVar(&keys, "keys", nil, "hex private keys the rows are signed with in order, the keys after them are derived from --seed")
+	rootCmd.PersistentFlags().StringVar(&seed, "seed", "porsign", "seed of the derived test keys")
+	rootCmd.PersistentFlags().StringVar(&message, "message", "I am an OKX address", "message every row signs")
+	rootCmd.PersistentFlags().StringVar(&amount, "amount", "1", "amount of every row")
+	rootCmd.PersistentFlags().StringVar(&snapshotHeight, "snapshot_height", "1", "snapshot height of every row")
+	rootCmd.PersistentFlags().StringVar(&typ, "type", "Non Staking", "type of every row of the 12-column layout")
+}
+
+func PorSign(cmd *cobra.Command, args []string) {
+	if _, exist := common.PorCsvColumns[columns]; !exist {
+		fmt.Printf("Fail to sign the PoR file, --columns must be 9 or 12, got %d\n", columns)
+		os.Exit(1)
+	}
+	if rowsPerCoin < 1 {
+		fmt.Printf("Fail to sign the PoR file, --rows must be at least 1, got %d\n", rowsPerCoin)
+		os.Exit(1)
+	}
+	testKeys, err := parseKeys()
+	if err != nil {
+		fmt.Println("Fail to sign the PoR file.The error is ", err)
+		os.Exit(1)
+	}
+	// unsupported coins are skipped unless they are asked for
+	explicit := len(coins) != 0
+	if !explicit {
+		for coin := range common.PorCoinTypeMap {
+			if _, exist := common.PorCoinUnitMap[coin]; exist {
+				coins = append(coins, coin)
+			}
+		}
+		sort.Strings(coins)
+	}
+
+	var rows []*common.CoinData
+	index := 0
+	for _, coin := range coins {
+		coin = strings.ToUpper(strings.TrimSpace(coin))
+		if _, exist := common.PorCoinUnitMap[coin]; !exist {
+			fmt.Printf("Fail to sign the PoR file, invalid coin name %s\n", coin)
+			os.Exit(1)
+		}
+		network := common.PorCoinAddressTypeMap[coin]
+		if network == "" {
+			network = coin
+		}
+		for i := 0; i < rowsPerCoin; i++ {
+			row := &common.CoinData{Coin: coin, Network: network, SnapshotHeight: snapshotHeight, Balance: amount, Message: message}
+			if columns == 12 {
+				row.Type = typ
+			}
+			err := common.SignPorRow(testKeys, index, row)
+			index += common.PorSignKeys
+			if errors.Is(err, common.ErrUnsupportedCoin) && !explicit {
+				fmt.Fprintf(os.Stderr, "Skip %s, %v\n", coin, err)
+				break
+			}
+			if err != nil {
+				fmt.Println("Fail to sign the PoR file.The error is ", err)
+				os.Exit(1)
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if csvFileName != "" {
+		file, err := os.Create(csvFileName)
+		if err != nil {
+			fmt.Println("Fail to sign the PoR file.The error is ", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		w = file
+	}
+	if err = common.WritePorCsv(w, rows, columns); err != nil {
+		fmt.Println("Fail to write the PoR file.The error is ", err)
+		os.Exit(1)
+	}
+	if csvFileName != "" {
+		fmt.Printf("Signed %d rows of %d coins to %s\n", len(rows), len(rows)/rowsPerCoin, csvFileName)
+	}
+}
+
+// parseKeys reads --keys, 32 byte hex private keys.
+func parseKeys() (*common.PorTestKeys, error) {
+	var privateKeys [][]byte
+	for _, k := range keys {
+		b, err := common.Decode(strings.TrimSpace(k))
+		if err != nil || len(b) != 32 {
+			return nil, fmt.Errorf("invalid private key %q, expected 32 bytes of hex", k)
+		}
+		privateKeys = append(privateKeys, b)
+	}
+	return common.NewPorTestKeys(seed, privateKeys...), nil
+}
+
+func main() {
+	Execute()
+}
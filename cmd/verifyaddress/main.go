@@ -1,19 +1,35 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"github.com/okx/proof-of-reserves/client"
 	"github.com/okx/proof-of-reserves/common"
 	"github.com/shopspring/decimal"
 	"github.com/spf13/cobra"
-	"io"
 	"os"
+	"sort"
 	"strings"
+	"time"
 )
 
 var (
-	cfgFile, csvFileName string
-	coinTotalBalance     = make(map[string]decimal.Decimal)
+	cfgFile, csvFileName                string
+	coinName, address, porIndexFileName string
+	failedOutFileName, rpcJsonFileName  string
+	expectedMessage, messagePolicyFile  string
+	messagePolicy                       *common.MessagePolicy
+	eip1271, checkOwners                bool
+	checkAccounts, checkStarknet        bool
+	tonSubwallets, tonProofSince        string
+	tonProofUntil                       string
+	tonProofDomains, depositDataFiles   []string
+	workers, batchSize, cacheSize       int
+	resume, exactSummary, keepExtracted bool
+	coinTotalBalance                    = make(map[string]decimal.Decimal)
+	// coinDetailBalance is the exact sum of the detail rows per coin, reconciled against the summary section
+	coinDetailBalance = make(map[string]decimal.Decimal)
 )
 
 var rootCmd = &cobra.Command{
@@ -26,104 +42,84 @@ var rootCmd = &cobra.Command{
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		exit(1)
 	}
+	exit(0)
+}
+
+// exit removes the csv copies extracted from bundles, unless --keep-extracted is set, and exits
+func exit(code int) {
+	if !keepExtracted {
+		common.RemoveExtractedPorCsv()
+	}
+	os.Exit(code)
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().StringVar(&csvFileName, "por_csv_filename", "", "")
+	rootCmd.PersistentFlags().BoolVar(&keepExtracted, "keep-extracted", false, "keep the csv extracted from a .zip or .gz bundle, and its index, in the temp directory for later runs")
+	rootCmd.PersistentFlags().StringVar(&coinName, "coin_name", "", "verify only this coin's rows of --address")
+	rootCmd.PersistentFlags().StringVar(&address, "address", "", "verify only the rows of this address, looked up in the por csv index")
+	rootCmd.PersistentFlags().StringVar(&porIndexFileName, "por_index_filename", "", "por csv index file, built on first use, default is the por csv filename with an .idx suffix")
+	rootCmd.PersistentFlags().IntVar(&workers, "workers", 1, "number of goroutines verifying signatures")
+	rootCmd.PersistentFlags().IntVar(&batchSize, "batch_size", 64, "number of rows handed to a worker at once")
+	rootCmd.PersistentFlags().IntVar(&cacheSize, "cache_size", common.DefaultVerifyCacheSize, "number of signature checks cached for the rows repeating a signer, message and signature, 0 disables the cache")
+	rootCmd.PersistentFlags().BoolVar(&exactSummary, "exact_summary", false, "require every summary amount to equal the sum of its detail rows, by default a rounded amount may differ by half a unit of its last decimal place")
+	rootCmd.PersistentFlags().BoolVar(&resume, "resume", false, "resume from the checkpoint of an earlier run, only its failed rows and the rows after it are verified")
+	rootCmd.PersistentFlags().BoolVar(&eip1271, "eip1271", false, "verify EVM signatures that no EOA produced against the contract wallet at the address (EIP-1271, ERC-6492)")
+	rootCmd.PersistentFlags().BoolVar(&checkOwners, "check_owners", false, "require the EOA1/EOA2 signers of an EVM row to be owners of its Safe address, or of a SOL row to be voting members of its Squads multisig, and meet the threshold")
+	rootCmd.PersistentFlags().BoolVar(&checkAccounts, "check_accounts", false, "bind the signing key of named NEAR accounts and Hedera 0.0.x accounts by looking up their keys")
+	rootCmd.PersistentFlags().BoolVar(&checkStarknet, "check_starknet", false, "verify STARKNET signatures against the account contract at the address (is_valid_signature)")
+	rootCmd.PersistentFlags().StringVar(&rpcJsonFileName, "rpc_json_filename", "rpc.json", "rpc json file with the nodes used by --eip1271, --check_owners, --check_accounts and --check_starknet")
+	rootCmd.PersistentFlags().StringVar(&expectedMessage, "expected-message", "", "fail the rows that sign another message than this one")
+	rootCmd.PersistentFlags().StringVar(&messagePolicyFile, "message-policy", "", "json file with the messages of the snapshot and of earlier snapshots, rows signing an earlier message are flagged as reused")
+	rootCmd.PersistentFlags().StringVar(&tonSubwallets, "ton_subwallets", "", "subwallet ids and ranges tried with every TON wallet contract besides its default, e.g. 0-9,4269")
+	rootCmd.PersistentFlags().StringSliceVar(&tonProofDomains, "ton_proof_domains", common.DefaultTonProofPolicy.Domains, "domains, with their subdomains, a TON ton_proof may be signed for")
+	rootCmd.PersistentFlags().StringVar(&tonProofSince, "ton_proof_since", "", "fail the TON ton_proof rows signed before this date, 2024-10-01")
+	rootCmd.PersistentFlags().StringVar(&tonProofUntil, "ton_proof_until", "", "fail the TON ton_proof rows signed after this date, 2024-10-01")
+	rootCmd.PersistentFlags().StringSliceVar(&depositDataFiles, "deposit_data", nil, "deposit_data json files of the validators, the ETH staking rows must have a deposit signed by their validator key that withdraws to EOA1 or EOA2")
+	rootCmd.PersistentFlags().StringVar(&failedOutFileName, "failed-out", "", "write the failed rows with their reason codes to this file, json when it ends with .json, csv otherwise")
 }
 
 func initConfig() {}
 
-func parseLine(line string) []string {
-	var result []string
-	var part string
-	inBrackets := false
-
-	for i := 0; i < len(line); i++ {
-		char := line[i]
-
-		switch char {
-		case '[':
-			inBrackets = true
-			part += string(char)
-		case ']':
-			inBrackets = false
-			part += string(char)
-		case ',':
-			if inBrackets {
-				part += string(char)
-			} else {
-				result = append(result, part)
-				part = ""
-			}
-		default:
-			part += string(char)
-		}
-	}
-
-	result = append(result, part)
-
-	return result
-}
-
-// detectFormatOffset inspects a detail-section header and returns the column offset for the
-// report format: 1 when a "Type" column is present (the 12-column format that inserts a Type
-// column right after coin), otherwise 0 for the legacy 11-column format. Every column after
-// coin shifts right by this offset; a missing Type column means the section is parsed exactly
-// as before and each row is treated as non-staking.
-func detectFormatOffset(header []string) int {
-	for _, col := range header {
-		if strings.EqualFold(strings.TrimSpace(col), "Type") {
-			return 1
-		}
+func handle(row *common.CoinData) (coin string, success bool) {
+	coin, msg, verify := accumulate(row)
+	if msg != "" {
+		fmt.Println(msg)
+		return coin, false
 	}
-	return 0
-}
-
-func handle(i int, line string, off int) (coin string, success bool) {
-	if len(line) == 0 {
-		return "", true
+	if !verify {
+		return coin, true
 	}
-	as := parseLine(line)
-	if len(as) < 9+off {
-		fmt.Println(fmt.Sprintf("Fail to verify address signature.The line %d has fewer columns than the report header.", i+1))
-		return "", false
+	if _, msg = verifySignature(row, coin); msg != "" {
+		fmt.Println(msg)
+		return coin, false
 	}
-	coin, addr, balance, message, sign1, sign2, script := as[0], as[3+off], as[4+off], as[5+off], as[6+off], as[7+off], as[8+off]
+	return coin, true
+}
 
-	// Recover from panic and print detailed error info
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("PANIC at line %d: %v | coin=%s, addr=%s, balance=%s, message=%s, sign1=%s, sign2=%s, script=%s\n", i+1, r, coin, addr, balance, message, sign1, sign2, script)
-			success = false
-		}
-	}()
-	var eoa1, eoa2 string
-	if len(as) > 10+off {
-		eoa1 = as[9+off]
-		eoa2 = as[10+off]
-	}
+// accumulate adds the balance of a row to the totals. It returns the failure message of an invalid
+// row, and whether the signature of a valid row still has to be verified.
+func accumulate(row *common.CoinData) (coin, msg string, verify bool) {
+	i := row.Line - 1
+	coin = row.Coin
 
-	// Eigenlayer Staking rows fill EOA2 with the EigenPod contract address; a contract
-	// cannot produce a signature (signature2 is empty), so only EOA1 is verifiable.
-	if off == 1 && strings.EqualFold(strings.TrimSpace(as[1]), "Eigenlayer Staking") {
-		eoa2 = ""
+	// the digitalAsset layout publishes addresses and signatures only, there is no balance to add
+	if row.DigitalAsset != "" && row.Balance == "" {
+		return strings.ToUpper(coin), "", true
 	}
 
-	val, err := decimal.NewFromString(balance)
+	val, err := decimal.NewFromString(row.Balance)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("Fail to verify address signature.The line %d  has invalid balance number.", i+1))
-		return coin, false
+		return coin, fmt.Sprintf("Fail to verify address signature.The line %d  has invalid balance number.", i+1), false
 	}
 
 	coin = strings.ToUpper(coin)
 	totalCoin, exist := common.PorCoinUnitMap[coin]
 	if !exist {
-		fmt.Println(fmt.Sprintf("Fail to verify address signature.The line %d  has invalid coin name, %s", i+1, coin))
-		return coin, false
+		return coin, fmt.Sprintf("Fail to verify address signature.The line %d  has invalid coin name, %s", i+1, coin), false
 	}
 	_, exist = coinTotalBalance[totalCoin]
 	if exist {
@@ -131,173 +127,202 @@ func handle(i int, line string, off int) (coin string, success bool) {
 	} else {
 		coinTotalBalance[totalCoin] = val
 	}
+	coinDetailBalance[coin] = coinDetailBalance[coin].Add(val)
 
-	if common.IsVerifyAddressBannedCoin(coin) {
-		return coin, true
-	}
+	return coin, "", !common.IsVerifyAddressBannedCoin(coin)
+}
 
-	if addr == "" || message == "" || sign1 == "" {
-		fmt.Println(fmt.Sprintf("Fail to verify address signature.The line %d is missing some parameters. coin:%s, addr: %s", i+1, coin, addr))
-		return coin, false
+// verifySignature returns the result and the failure message of a row whose signature does not
+// verify. It is safe for concurrent use by the workers.
+func verifySignature(row *common.CoinData, coin string) (*common.SignatureResult, string) {
+	i := row.Line - 1
+	if messagePolicy != nil {
+		if err := messagePolicy.Check(row.Message); err != nil {
+			result := &common.SignatureResult{Coin: row.Coin, Verifier: "message", Address: row.Address, Signer: common.SignerAddress, Err: err}
+			return result, fmt.Sprintf("Fail to verify address %s signature.The line %d  has error:%s.", row.Address, i+1, err)
+		}
 	}
+	result := common.VerifyRowSignature(row)
+	switch {
+	case result.OK():
+		return result, ""
+	case errors.Is(result.Err, common.ErrMissingSignatureParams):
+		return result, fmt.Sprintf("Fail to verify address signature.The line %d is missing some parameters. coin:%s, addr: %s", i+1, coin, row.Address)
+	case errors.Is(result.Err, common.ErrUnsupportedCoin):
+		return result, fmt.Sprintf("Fail to verify address %s signature. Invaild coin type:%s", row.Address, coin)
+	case errors.Is(result.Err, common.ErrVerifierPanic):
+		return result, fmt.Sprintf("PANIC at line %d: %v | coin=%s, addr=%s, balance=%s, message=%s, sign1=%s, sign2=%s, script=%s", i+1, result.Err, coin, row.Address, row.Balance, row.Message, row.Sign1, row.Sign2, row.Script)
+	default:
+		return result, fmt.Sprintf("Fail to verify address %s signature.The line %d  has error:%s.", result.Address, i+1, result.Err)
+	}
+}
 
-	switch common.PorCoinTypeMap[coin] {
-	case common.EvmCoinTye:
-		if eoa1 != "" && eoa2 != "" {
-			if err := common.VerifyEvmCoin(coin, eoa1, message, sign1); err != nil {
-				fmt.Println(fmt.Sprintf("Fail to verify address %s signature.The line %d  has error:%s.", addr, i+1, err))
-				return coin, false
-			}
-			if err := common.VerifyEvmCoin(coin, eoa2, message, sign2); err != nil {
-				fmt.Println(fmt.Sprintf("Fail to verify address %s signature.The line %d  has error:%s.", addr, i+1, err))
-				return coin, false
-			}
-		} else if eoa1 != "" {
-			if err := common.VerifyEvmCoin(coin, eoa1, message, sign1); err != nil {
-				fmt.Println(fmt.Sprintf("Fail to verify address %s signature.The line %d  has error:%s.", eoa1, i+1, err))
-				return coin, false
-			}
-		} else {
-			if err := common.VerifyEvmCoin(coin, addr, message, sign1); err != nil {
-				fmt.Println(fmt.Sprintf("Fail to verify address %s signature.The line %d  has error:%s.", addr, i+1, err))
-				return coin, false
-			}
-		}
-	case common.EcdsaCoinType:
-		if eoa1 != "" && eoa2 != "" {
-			if err := common.VerifyEcdsaCoin(coin, eoa1, message, sign1); err != nil {
-				fmt.Println(fmt.Sprintf("Fail to verify address %s signature.The line %d  has error:%s.", addr, i+1, err))
-				return coin, false
-			}
-			if err := common.VerifyEcdsaCoin(coin, eoa2, message, sign2); err != nil {
-				fmt.Println(fmt.Sprintf("Fail to verify address %s signature.The line %d  has error:%s.", addr, i+1, err))
-				return coin, false
-			}
-		} else if eoa1 != "" {
-			if err := common.VerifyEcdsaCoin(coin, eoa1, message, sign1); err != nil {
-				fmt.Println(fmt.Sprintf("Fail to verify address %s signature.The line %d  has error:%s.", addr, i+1, err))
-				return coin, false
-			}
-		} else {
-			if err := common.VerifyEcdsaCoin(coin, addr, message, sign1); err != nil {
-				fmt.Println(fmt.Sprintf("Fail to verify address %s signature.The line %d  has error:%s.", addr, i+1, err))
-				return coin, false
-			}
-		}
-	case common.Ed25519CoinType:
-		// owner mode: when eoa1 (current authentication key, e.g. a rotated APTOS account)
-		// is present, verify against eoa1 instead of the claimed address (mirrors EVM owner mode).
-		if eoa1 != "" {
-			if err := common.VerifyEd25519Coin(coin, eoa1, message, sign1, script); err != nil {
-				fmt.Println(fmt.Sprintf("Fail to verify address %s signature.The line %d  has error:%s.", eoa1, i+1, err))
-				return coin, false
-			}
+// VerifySingleAddress verifies the rows of one address on every network, read through the index
+// instead of scanning the file.
+func VerifySingleAddress() {
+	if coinName == "" {
+		fmt.Println("Fail to verify address signature.You must set the coin_name")
+		exit(1)
+	}
+	index, err := common.OpenPorCsvIndex(csvFileName, porIndexFileName)
+	if err != nil {
+		fmt.Println("Fail to verify address signature.The error is ", err)
+		exit(1)
+	}
+	defer index.Close()
+	rows, err := index.Find(coinName, address)
+	if err != nil {
+		fmt.Println("Fail to verify address signature.The error is ", err)
+		exit(1)
+	}
+	if len(rows) == 0 {
+		fmt.Println(fmt.Sprintf("Fail to verify address signature.The file has no %s address %s", strings.ToUpper(coinName), address))
+		exit(1)
+	}
+	allPass := true
+	for _, row := range rows {
+		if _, ok := handle(row); ok {
+			fmt.Println(fmt.Sprintf("Verify %s address %s on %s at line %d passed", row.Coin, row.Address, row.Network, row.Line))
 		} else {
-			if err := common.VerifyEd25519Coin(coin, addr, message, sign1, script); err != nil {
-				fmt.Println(fmt.Sprintf("Fail to verify address %s signature.The line %d  has error:%s.", addr, i+1, err))
-				return coin, false
-			}
-		}
-	case common.TrxCoinType:
-		if err := common.VerifyTRX(addr, message, sign1); err != nil {
-			fmt.Println(fmt.Sprintf("Fail to verify address %s signature.The line %d  has error:%s.", addr, i+1, err))
-			return coin, false
-		}
-	case common.BethCoinType:
-		if err := common.VerifyBETH(addr, message, sign1); err != nil {
-			fmt.Println(fmt.Sprintf("Fail to verify address %s signature.The line %d  has error:%s.", addr, i+1, err))
-			return coin, false
-		}
-	case common.UTXOCoinType:
-		if err := common.VerifyUtxoCoin(coin, addr, message, sign1, sign2, script); err != nil {
-			fmt.Println(fmt.Sprintf("Fail to verify address %s signature.The line %d  has error:%s.", addr, i+1, err))
-			return coin, false
-		}
-	case common.StarkCoinType:
-		if err := common.VerifyStarkCoin(coin, addr, message, sign1, script); err != nil {
-			fmt.Println(fmt.Sprintf("Fail to verify address %s signature.The line %d  has error:%s.", addr, i+1, err))
-			return coin, false
+			allPass = false
 		}
-	default:
-		fmt.Println(fmt.Sprintf("Fail to verify address %s signature. Invaild coin type:%s", addr, coin))
-		return coin, false
 	}
-	return coin, true
+	if !allPass {
+		exit(1)
+	}
 }
 
 func AddressVerify(cmd *cobra.Command, args []string) {
 	fmt.Println("Verify address signature start")
 	fmt.Println("Your input csv filename: " + csvFileName)
-	f, err := os.Open(csvFileName)
-	defer f.Close()
+	// resolve .zip/.gz bundles to the csv that is verified
+	source, err := common.OpenPorCsvSource(csvFileName)
 	if err != nil {
 		fmt.Println("Fail to verify address signature.The error is ", err)
-		return
+		exit(1)
 	}
-	buf := bufio.NewReader(f)
-	count, lineSize, flag := 0, 0, 2
-	off := 0
-	success, fail := make(map[string]uint64), make(map[string]uint64)
-	for {
-		line, _, err := buf.ReadLine()
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
+	fmt.Println("Verified file: " + source.String())
+	if err := loadMessagePolicy(); err != nil {
+		fmt.Println("Fail to verify address signature.The error is ", err)
+		exit(1)
+	}
+	if err := loadTonSettings(); err != nil {
+		fmt.Println("Fail to verify address signature.The error is ", err)
+		exit(1)
+	}
+	common.SetVerifyCacheSize(cacheSize)
+	if eip1271 || checkOwners || checkAccounts || checkStarknet {
+		if err := registerContractVerifiers(); err != nil {
 			fmt.Println("Fail to verify address signature.The error is ", err)
-			return
+			exit(1)
 		}
-		lineSize++
-		temp := string(line)
-		if temp == "" {
-			flag--
-			continue
-		}
-		if lineSize == 1 {
-			continue
-		}
-		as := strings.Split(temp, ",")
-		if flag > 1 {
-			fmt.Println(fmt.Sprintf("%s's total balance is %s.", as[0], as[1]))
-		}
-
-		if flag > 0 {
-			if flag == 1 {
-				flag--
-				// Resolve the detail-section column layout from its header.
-				off = detectFormatOffset(strings.Split(temp, ","))
+	}
+	if err := registerDepositVerifier(); err != nil {
+		fmt.Println("Fail to verify address signature.The error is ", err)
+		exit(1)
+	}
+	// the checkpoint sits next to the file passed on the command line, not the extracted copy
+	checkpointFileName := csvFileName + ".checkpoint"
+	csvFileName = source.Path
+	if address != "" {
+		VerifySingleAddress()
+		return
+	}
+	collector := common.NewResultCollector()
+	verifier := &common.PorCsvVerifier{
+		Workers:            workers,
+		BatchSize:          batchSize,
+		CheckpointFileName: checkpointFileName,
+		Verify: func(row *common.CoinData) common.VerifyResult {
+			coin := strings.ToUpper(row.Coin)
+			result, msg := verifySignature(row, coin)
+			if msg != "" {
+				fmt.Println(msg)
 			}
-			continue
-		}
-		coin, ok := handle(count, strings.TrimSpace(temp), off)
-
-		if common.IsVerifyAddressBannedCoin(coin) {
-			continue
-		}
-
-		if _, exist := fail[coin]; !exist {
-			fail[coin] = 0
+			return common.VerifyResult{Row: row, Success: msg == "", Coin: coin, Error: msg, Reason: result.Reason(), Signer: result.Signer, Verifier: result.Verifier, Quorum: result.Quorum}
+		},
+		// balances are added for every row, the summary is reconciled against all of them
+		Prepare: func(row *common.CoinData) (*common.VerifyResult, bool) {
+			coin, msg, verify := accumulate(row)
+			if msg == "" {
+				return nil, verify // a banned coin is left out
+			}
+			return &common.VerifyResult{Row: row, Coin: coin, Error: msg, Reason: common.ReasonInvalidRow}, false
+		},
+		// the summary section precedes the detail rows, print it once it has been read
+		Summary: func(reader *common.PorCsvReader) {
+			for _, w := range reader.Warnings() {
+				fmt.Println("Warning:", w)
+			}
+			for _, s := range reader.Summary().Rows {
+				fmt.Println(fmt.Sprintf("%s's total balance is %s.", s.Name(), s.Amount.String()))
+			}
+		},
+		Log: func(msg string) { fmt.Println(msg) },
+	}
+	if resume {
+		if verifier.Checkpoint, err = common.LoadVerifyCheckpoint(checkpointFileName, source.SHA256); err != nil {
+			fmt.Println("Fail to resume address signature verification.The error is ", err)
+			exit(1)
 		}
-
-		if _, exist := success[coin]; !exist {
-			success[coin] = 0
+		if checkpoint := verifier.Checkpoint; checkpoint != nil {
+			fmt.Println(fmt.Sprintf("Resume from line %d of %s, %d failed lines are verified again", checkpoint.Line, checkpointFileName, len(checkpoint.Failed)))
 		}
-
-		if !ok {
-			fail[coin]++
-		} else {
-			success[coin]++
+	}
+	var progressBar *common.ProgressBar
+	if workers > 1 {
+		if lines := countLines(csvFileName); lines > 1000 { // Only show progress bar for large files
+			progressBar = common.NewProgressBar(lines)
+			verifier.Progress = progressBar.Update
 		}
-		count++
 	}
+	reader, count, err := verifier.Run(source, collector)
+	if progressBar != nil {
+		progressBar.Finish()
+	}
+	if err != nil {
+		fmt.Println("Fail to verify address signature.The error is ", err)
+		exit(1)
+	}
+
 	if count == 0 {
 		fmt.Println("Verify address signature end.The file is empty.")
 	}
-	var allPass = true
-	for k, v := range success {
-		fmt.Println(fmt.Sprintf("%s  %d accoounts, %d verified, %d failed", k, v+fail[k], v, fail[k]))
-		if fail[k] != 0 {
-			allPass = false
+	_, failCount, skipCount, _, coinStats := collector.GetStats()
+	if skipCount > 0 {
+		fmt.Println(fmt.Sprintf("%d rows were verified by an earlier run and skipped", skipCount))
+	}
+	verified, elapsed, rowsPerSecond := collector.Throughput()
+	hits, misses := common.VerifyCacheStats()
+	fmt.Println(fmt.Sprintf("%d rows verified in %v, %.1f rows/s, %d of %d signature checks cached", verified, elapsed.Round(time.Millisecond), rowsPerSecond, hits, hits+misses))
+	var allPass = failCount == 0
+	for k, stats := range coinStats {
+		fmt.Println(fmt.Sprintf("%s  %d accoounts, %d verified, %d failed", k, stats["success"]+stats["fail"], stats["success"], stats["fail"]))
+	}
+	reasonStats := collector.ReasonStats()
+	reasons := make([]string, 0, len(reasonStats))
+	for reason := range reasonStats {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Println(fmt.Sprintf("%s  %d failed", reason, reasonStats[reason]))
+	}
+	quorumStats := collector.QuorumStats()
+	quorums := make([]string, 0, len(quorumStats))
+	for quorum := range quorumStats {
+		quorums = append(quorums, quorum)
+	}
+	sort.Strings(quorums)
+	for _, quorum := range quorums {
+		fmt.Println(fmt.Sprintf("%s multisig  %d verified", quorum, quorumStats[quorum]))
+	}
+	if failedOutFileName != "" {
+		report := collector.Report()
+		if err := report.Write(failedOutFileName); err != nil {
+			fmt.Println("Fail to write the failed rows.The error is ", err)
+		} else {
+			fmt.Println(fmt.Sprintf("%d failed rows are written to %s", len(report.Lines), failedOutFileName))
 		}
 	}
 
@@ -307,9 +332,146 @@ func AddressVerify(cmd *cobra.Command, args []string) {
 	}
 	fmt.Printf("Total balance: [%s]\n", strings.Join(coinTotalBalanceResult, ","))
 
-	if allPass {
+	// the summary rows must match the detail rows within half a unit of their last published decimal place,
+	// or exactly with --exact_summary
+	mismatches := reader.Summary().Reconcile(coinDetailBalance, exactSummary)
+	for _, m := range mismatches {
+		fmt.Println(fmt.Sprintf("Fail to reconcile the total balance. %s.", m.Error()))
+	}
+
+	if allPass && len(mismatches) == 0 {
 		fmt.Println("Verify address signature end, all address passed")
 	}
+	if failCount > 0 {
+		fmt.Println(fmt.Sprintf("Verify address signature end, %d rows failed", failCount))
+	}
+	if len(mismatches) != 0 {
+		fmt.Println(fmt.Sprintf("Verify address signature end, %d summary rows do not match the detail rows", len(mismatches)))
+	}
+	// the exit status tells scripts whether every row verified and every summary row matched
+	if !allPass || len(mismatches) != 0 {
+		exit(1)
+	}
+}
+
+// registerContractVerifiers wraps the EVM verifier with the contract checks, through the nodes of
+// rpc.json: --eip1271 falls back to the contract wallet at the address, --check_owners requires
+// the owner signers to own the Safe at the address, or to be voting members of the Squads
+// multisig of a SOL vault through the sol node. --check_accounts wraps the ed25519 verifier
+// with the key lookup of named accounts, through the near node and the hbar mirror node.
+// --check_starknet wraps the stark verifier with is_valid_signature of the account contract.
+func registerContractVerifiers() error {
+	validator, err := common.NewAddressBalanceValidator(rpcJsonFileName)
+	if err != nil {
+		return err
+	}
+	client.RpcClient = client.NewJsonRPCClient()
+	client.HttpClient = client.NewHTTPClient()
+	endpoints := validator.EvmRPCEndpoints()
+	if checkAccounts {
+		lookups := make(map[string]common.AccountKeyLookup)
+		if endpoint, exist := endpoints["near"]; exist {
+			lookups["NEAR"] = common.NewNearAccessKeyLookup(endpoint)
+		}
+		if endpoint, exist := endpoints["hbar"]; exist {
+			lookups["HBAR"] = common.NewHederaMirrorKeyLookup(endpoint)
+		}
+		ed25519, _ := common.RegisteredSignatureVerifier(common.Ed25519CoinType)
+		common.RegisterSignatureVerifier(common.Ed25519CoinType, common.NewAccountKeyVerifier(ed25519, lookups))
+	}
+	if checkOwners {
+		ed25519, _ := common.RegisteredSignatureVerifier(common.Ed25519CoinType)
+		common.RegisterSignatureVerifier(common.Ed25519CoinType, common.NewSquadsOwnerVerifier(ed25519, endpoints))
+	}
+	if checkStarknet {
+		stark, _ := common.RegisteredSignatureVerifier(common.StarkCoinType)
+		common.RegisterSignatureVerifier(common.StarkCoinType, common.NewStarknetAccountVerifier(stark, endpoints))
+	}
+	evm, _ := common.RegisteredSignatureVerifier(common.EvmCoinTye)
+	if eip1271 {
+		evm = common.NewEip1271Verifier(evm, endpoints)
+	}
+	if checkOwners {
+		evm = common.NewOwnerVerifier(evm, common.NewSafeOwnerLookup(endpoints))
+	}
+	common.RegisterSignatureVerifier(common.EvmCoinTye, evm)
+	return nil
+}
+
+// registerDepositVerifier wraps the EVM verifier with the deposits of --deposit_data, which tie
+// the validator keys of the staking rows to their withdrawal addresses.
+func registerDepositVerifier() error {
+	if len(depositDataFiles) == 0 {
+		return nil
+	}
+	deposits, err := common.LoadDepositData(depositDataFiles...)
+	if err != nil {
+		return err
+	}
+	evm, _ := common.RegisteredSignatureVerifier(common.EvmCoinTye)
+	common.RegisterSignatureVerifier(common.EvmCoinTye, common.NewDepositVerifier(evm, deposits))
+	return nil
+}
+
+// loadMessagePolicy reads --message-policy, --expected-message is accepted in addition to its
+// messages. Without either flag any message is accepted.
+func loadMessagePolicy() (err error) {
+	if messagePolicyFile != "" {
+		if messagePolicy, err = common.LoadMessagePolicy(messagePolicyFile); err != nil {
+			return err
+		}
+	}
+	if expectedMessage == "" {
+		return nil
+	}
+	if messagePolicy == nil {
+		messagePolicy, err = common.NewMessagePolicy([]string{expectedMessage}, "", nil)
+		return err
+	}
+	messagePolicy, err = common.NewMessagePolicy(append(messagePolicy.Messages, expectedMessage), messagePolicy.Pattern, messagePolicy.Previous)
+	return err
+}
+
+// loadTonSettings sets the TON subwallet ranges and the ton_proof bindings of the flags, a date
+// bounds the proofs signed from its start to the end of the until date.
+func loadTonSettings() error {
+	ranges, err := common.ParseTonSubwalletRanges(tonSubwallets)
+	if err != nil {
+		return err
+	}
+	common.SetTonSubwalletRanges(ranges)
+	policy := common.TonProofPolicy{Domains: tonProofDomains}
+	if tonProofSince != "" {
+		if policy.NotBefore, err = time.Parse("2006-01-02", tonProofSince); err != nil {
+			return fmt.Errorf("invalid --ton_proof_since %s: %w", tonProofSince, err)
+		}
+	}
+	if tonProofUntil != "" {
+		until, err := time.Parse("2006-01-02", tonProofUntil)
+		if err != nil {
+			return fmt.Errorf("invalid --ton_proof_until %s: %w", tonProofUntil, err)
+		}
+		policy.NotAfter = until.Add(24*time.Hour - time.Second)
+	}
+	common.SetTonProofPolicy(policy)
+	return nil
+}
+
+// countLines counts the lines of a file for the progress bar
+func countLines(fileName string) int {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	lines, buf := 0, make([]byte, 1<<20)
+	for {
+		n, err := f.Read(buf)
+		lines += bytes.Count(buf[:n], []byte{'\n'})
+		if err != nil {
+			return lines
+		}
+	}
 }
 
 func main() {
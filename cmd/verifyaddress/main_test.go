@@ -1,6 +1,11 @@
 package main
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	"github.com/okx/proof-of-reserves/common"
+)
 
 // Real, public ETH address + signature reused from example/okx_por_example.csv (this address
 // self-signs the OKX message). No private keys or generated crypto — just a fixed public vector.
@@ -8,30 +13,37 @@ const (
 	okxMsg  = "I am an OKX address"
 	ethAddr = "0x0cdcdb19a857c2ac24818ca4fdfe38cce071483e"
 	ethSig  = "0x07f19879aa28d51c97cddfdfecffe7ed96525545d041aee4f4386b0bf4c1a26924b637fb02ccbb97305c13daa51a0f50b8896fb25ecbaf60020cde920d227a221b"
+
+	legacyHeader = "coin,Network,Snapshot Height,address,amount,message,signature1,signature2,redeem script/ public key, eoa1, eoa2"
+	typedHeader  = "coin,Type,Network,Snapshot Height,address,amount,message,signature1,signature2,redeem script/public key,EOA1,EOA2"
 )
 
-// FR-6: format is detected from the header — a "Type" column marks the 12-column layout.
-func TestDetectFormatOffset(t *testing.T) {
-	oldHeader := []string{"coin", "Network", "Snapshot Height", "address", "amount", "message", "signature1", "signature2", "redeem script/ public key", " eoa1", " eoa2"}
-	if got := detectFormatOffset(oldHeader); got != 0 {
-		t.Errorf("legacy header offset = %d, want 0", got)
-	}
-	newHeader := []string{"coin", "Type", "Network", "Snapshot Height", "address", "amount", "message", "signature1", "signature2", "redeem script/public key", "EOA1", "EOA2"}
-	if got := detectFormatOffset(newHeader); got != 1 {
-		t.Errorf("12-column header offset = %d, want 1", got)
-	}
+// readRow reads the single detail row of a header and a row through the shared CSV reader.
+func readRow(t *testing.T, header, line string) (*common.CoinData, error) {
+	t.Helper()
+	reader := common.NewPorCsvReader(strings.NewReader(header + "\n" + line + "\n"))
+	return reader.Read()
 }
 
-// FR-6 / AC-1: the same ETH row verifies under both the legacy 11-column layout (off=0) and the
-// new 12-column layout with a Type column inserted after coin (off=1), proving the header-adaptive
-// column mapping selects the right fields in both formats.
+// FR-6 / AC-1: the same ETH row verifies under both the legacy 11-column layout and the new
+// 12-column layout with a Type column inserted after coin, proving the header-driven column
+// mapping selects the right fields in both formats.
 func TestHandleParsesBothFormats(t *testing.T) {
-	oldRow := "ETH,ETH,20914735," + ethAddr + ",0.0589," + okxMsg + "," + ethSig + ",,"
-	if _, ok := handle(0, oldRow, 0); !ok {
+	oldRow, err := readRow(t, legacyHeader, "ETH,ETH,20914735,"+ethAddr+",0.0589,"+okxMsg+","+ethSig+",,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := handle(oldRow); !ok {
 		t.Fatalf("legacy 11-column row should verify")
 	}
-	newRow := "ETH,Non Staking,ETH,20914735," + ethAddr + ",0.0589," + okxMsg + "," + ethSig + ",,,,"
-	if _, ok := handle(1, newRow, 1); !ok {
+	newRow, err := readRow(t, typedHeader, "ETH,Non Staking,ETH,20914735,"+ethAddr+",0.0589,"+okxMsg+","+ethSig+",,,,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newRow.Type != "Non Staking" {
+		t.Fatalf("type = %q", newRow.Type)
+	}
+	if _, ok := handle(newRow); !ok {
 		t.Fatalf("12-column row should verify (column shift handled)")
 	}
 }
@@ -40,15 +52,64 @@ func TestHandleParsesBothFormats(t *testing.T) {
 // the EXISTING EVM eoa1 owner-mode branch — no staking-specific verification code is added.
 func TestHandleStakingRowUsesExistingEoaBranch(t *testing.T) {
 	validatorPub := "0x" + "ab" // display-only placeholder; never used for verification
-	nativeRow := "ETH,Native ETH Staking,ETH,20914735," + validatorPub + ",32," + okxMsg + "," + ethSig + ",,," + ethAddr + ","
-	if _, ok := handle(2, nativeRow, 1); !ok {
+	row, err := readRow(t, typedHeader, "ETH,Native ETH Staking,ETH,20914735,"+validatorPub+",32,"+okxMsg+","+ethSig+",,,"+ethAddr+",")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := handle(row); !ok {
 		t.Fatalf("Native ETH Staking row should verify via the existing eoa1 branch")
 	}
 }
 
-// A row with fewer columns than the detected format fails cleanly (no panic).
-func TestHandleTooFewColumns(t *testing.T) {
-	if _, ok := handle(3, "ETH,Non Staking,ETH", 1); ok {
-		t.Fatalf("a short row must fail, not panic")
+// A row with fewer columns than the header is reported with its line number (no panic).
+func TestReadTooFewColumns(t *testing.T) {
+	_, err := readRow(t, typedHeader, "ETH,Non Staking,ETH")
+	csvErr, ok := err.(*common.CsvError)
+	if !ok || csvErr.Line != 2 {
+		t.Fatalf("a short row must be reported at line 2, got %v", err)
+	}
+}
+
+// The digitalAsset layout has no amount column: its rows are verified by signature only and add
+// nothing to the totals.
+func TestHandleDigitalAssetRow(t *testing.T) {
+	row, err := readRow(t, "digitalAsset,network,address,signedMessage,signedMessage2,message,publicKey,owner1,owner2",
+		"ETH,ETH,"+ethAddr+","+ethSig+",null,"+okxMsg+",,,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := coinDetailBalance["ETH"]
+	coin, ok := handle(row)
+	if !ok || coin != "ETH" {
+		t.Fatalf("digitalAsset row should verify, got %s %v", coin, ok)
+	}
+	if !coinDetailBalance["ETH"].Equal(before) {
+		t.Fatalf("digitalAsset row must not add a balance, got %s", coinDetailBalance["ETH"])
+	}
+}
+
+// --expected-message fails a row that signs another message, even with a valid signature.
+func TestHandleExpectedMessage(t *testing.T) {
+	defer func() { expectedMessage, messagePolicy = "", nil }()
+	row, err := readRow(t, legacyHeader, "ETH,ETH,20914735,"+ethAddr+",0.0589,"+okxMsg+","+ethSig+",,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedMessage = "OKC_DTT_AUP2025"
+	if err = loadMessagePolicy(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := handle(row); ok {
+		t.Fatalf("a row signing another message should fail")
+	}
+	if result, _ := verifySignature(row, "ETH"); result.Reason() != common.ReasonMessageMismatch {
+		t.Fatalf("expected message_mismatch, got %s", result.Reason())
+	}
+	expectedMessage = okxMsg
+	if err = loadMessagePolicy(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := handle(row); !ok {
+		t.Fatalf("a row signing the expected message should verify")
 	}
 }
@@ -0,0 +1,189 @@
+package common
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/martinboehm/btcutil/base58"
+	"github.com/okx/proof-of-reserves/client"
+)
+
+// AccountKeyLookup returns the ed25519 public keys, in lower case hex, with full control of a named
+// account at the snapshot of its row. An adapter is written per chain, NEAR and Hedera are built in.
+type AccountKeyLookup interface {
+	AccountKeys(row *CoinData, account string) ([]string, error)
+}
+
+// AccountKeyLookupFunc adapts a function to AccountKeyLookup.
+type AccountKeyLookupFunc func(row *CoinData, account string) ([]string, error)
+
+func (f AccountKeyLookupFunc) AccountKeys(row *CoinData, account string) ([]string, error) {
+	return f(row, account)
+}
+
+// NearAccessKeyLookup lists the full access keys of a NEAR account through the json-rpc node of
+// rpc.json, at the snapshot block.
+type NearAccessKeyLookup struct {
+	endpoint *EvmRPCEndpoint
+}
+
+// NewNearAccessKeyLookup returns a lookup through the node, client.HttpClient must be initialized.
+func NewNearAccessKeyLookup(endpoint *EvmRPCEndpoint) *NearAccessKeyLookup {
+	return &NearAccessKeyLookup{endpoint: endpoint}
+}
+
+func (l *NearAccessKeyLookup) AccountKeys(row *CoinData, account string) ([]string, error) {
+	params := map[string]interface{}{"request_type": "view_access_key_list", "account_id": account}
+	if height, err := strconv.ParseUint(row.SnapshotHeight, 10, 64); err == nil {
+		params["block_id"] = height
+	} else {
+		params["finality"] = "final"
+	}
+	request, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": "por", "method": "query", "params": params})
+	body, err := client.HttpClient.Post(l.endpoint.Endpoint, bytes.NewReader(request), l.endpoint.CustomHeaders)
+	if err != nil {
+		return nil, withReason(ReasonRPCError, fmt.Errorf("%w, method:view_access_key_list, error:%v", ErrRPC, err))
+	}
+	var response struct {
+		Result *struct {
+			Keys []struct {
+				PublicKey string `json:"public_key"`
+				AccessKey struct {
+					Permission json.RawMessage `json:"permission"`
+				} `json:"access_key"`
+			} `json:"keys"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+			Cause   struct {
+				Name string `json:"name"`
+			} `json:"cause"`
+		} `json:"error"`
+	}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return nil, withReason(ReasonRPCError, fmt.Errorf("%w, method:view_access_key_list, error:%v", ErrRPC, err))
+	}
+	if response.Error != nil {
+		if response.Error.Cause.Name == "UNKNOWN_ACCOUNT" {
+			return nil, withReason(ReasonAddressMismatch, fmt.Errorf("NEAR account %s does not exist at block %s", account, row.SnapshotHeight))
+		}
+		return nil, withReason(ReasonRPCError, fmt.Errorf("%w, method:view_access_key_list, error:%s %s", ErrRPC, response.Error.Cause.Name, response.Error.Message))
+	}
+	if response.Result == nil {
+		return nil, withReason(ReasonRPCError, fmt.Errorf("%w, method:view_access_key_list, empty result", ErrRPC))
+	}
+	var keys []string
+	for _, key := range response.Result.Keys {
+		// function call keys cannot move funds, they do not prove control of the account
+		if string(key.AccessKey.Permission) != `"FullAccess"` || !strings.HasPrefix(key.PublicKey, "ed25519:") {
+			continue
+		}
+		keys = append(keys, hex.EncodeToString(base58.Decode(strings.TrimPrefix(key.PublicKey, "ed25519:"))))
+	}
+	return keys, nil
+}
+
+// HederaMirrorKeyLookup reads the key of a Hedera account from a mirror node, whose base url is
+// the rpc endpoint of rpc.json, at the consensus time of the snapshot block.
+type HederaMirrorKeyLookup struct {
+	endpoint *EvmRPCEndpoint
+}
+
+// NewHederaMirrorKeyLookup returns a lookup through the mirror node, client.HttpClient must be
+// initialized.
+func NewHederaMirrorKeyLookup(endpoint *EvmRPCEndpoint) *HederaMirrorKeyLookup {
+	return &HederaMirrorKeyLookup{endpoint: endpoint}
+}
+
+func (l *HederaMirrorKeyLookup) AccountKeys(row *CoinData, account string) ([]string, error) {
+	base := strings.TrimSuffix(l.endpoint.Endpoint, "/")
+	// the checksum of 0.0.x-abcde is not part of the id
+	url := base + "/api/v1/accounts/" + strings.SplitN(account, "-", 2)[0]
+	if _, err := strconv.ParseUint(row.SnapshotHeight, 10, 64); err == nil {
+		var block struct {
+			Timestamp struct {
+				To string `json:"to"`
+			} `json:"timestamp"`
+		}
+		if err = l.get(base+"/api/v1/blocks/"+row.SnapshotHeight, &block); err != nil {
+			return nil, err
+		}
+		if block.Timestamp.To == "" {
+			return nil, withReason(ReasonRPCError, fmt.Errorf("%w, mirror node has no block %s", ErrRPC, row.SnapshotHeight))
+		}
+		url += "?timestamp=" + block.Timestamp.To
+	}
+	var acct struct {
+		Account string `json:"account"`
+		Key     *struct {
+			Type string `json:"_type"`
+			Key  string `json:"key"`
+		} `json:"key"`
+	}
+	if err := l.get(url, &acct); err != nil {
+		return nil, err
+	}
+	if acct.Account == "" {
+		return nil, withReason(ReasonAddressMismatch, fmt.Errorf("HBAR account %s does not exist at block %s", account, row.SnapshotHeight))
+	}
+	if acct.Key == nil || acct.Key.Type != "ED25519" {
+		// key lists and threshold keys are protobuf encoded, they are not supported
+		return nil, withReason(ReasonUnboundAccount, fmt.Errorf("HBAR account %s has no single ed25519 key", account))
+	}
+	return []string{strings.ToLower(strings.TrimPrefix(acct.Key.Key, hederaEd25519DerPrefix))}, nil
+}
+
+func (l *HederaMirrorKeyLookup) get(url string, result interface{}) error {
+	body, err := client.HttpClient.Get(url, l.endpoint.CustomHeaders)
+	if err != nil {
+		return withReason(ReasonRPCError, fmt.Errorf("%w, url:%s, error:%v", ErrRPC, url, err))
+	}
+	if err = json.Unmarshal(body, result); err != nil {
+		return withReason(ReasonRPCError, fmt.Errorf("%w, url:%s, error:%v", ErrRPC, url, err))
+	}
+	return nil
+}
+
+// AccountKeyVerifier binds the signing key of a named account, which the ed25519 verifier leaves
+// unbound, by looking up the keys of the account. The lookups are keyed by address type, NEAR or
+// HBAR.
+type AccountKeyVerifier struct {
+	next    SignatureVerifier
+	lookups map[string]AccountKeyLookup
+}
+
+func NewAccountKeyVerifier(next SignatureVerifier, lookups map[string]AccountKeyLookup) *AccountKeyVerifier {
+	return &AccountKeyVerifier{next: next, lookups: lookups}
+}
+
+func (v *AccountKeyVerifier) Verify(row *CoinData) *SignatureResult {
+	result := v.next.Verify(row)
+	if result.Reason() != ReasonUnboundAccount {
+		return result
+	}
+	lookup, exist := v.lookups[PorCoinAddressTypeMap[row.Coin]]
+	if !exist {
+		return result
+	}
+	result.Verifier += "+account keys"
+	keys, err := lookup.AccountKeys(row, result.Address)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	// the signature has been verified against the public key column already
+	pubkeyBytes, _ := Decode(row.Script)
+	pubkey := hex.EncodeToString(pubkeyBytes)
+	for _, key := range keys {
+		if key == pubkey {
+			result.Err = nil
+			return result
+		}
+	}
+	result.Err = withReason(ReasonAddressMismatch, fmt.Errorf("public key %s has no full access to account %s, keys:%v", pubkey, result.Address, keys))
+	return result
+}
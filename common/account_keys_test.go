@@ -0,0 +1,161 @@
+package common
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/dchest/blake2b"
+	"github.com/martinboehm/btcutil/base58"
+	"github.com/okx/proof-of-reserves/client"
+)
+
+// the NEAR vector of crypto_test.go, the key of the implicit account b1e2...3fba
+const (
+	ed25519TestMsg  = "OKC_DTT_AUP2025"
+	ed25519TestSig  = "0x0583df7d07e242e1240a97b6322bfa1df7203a09d10e8a219442ebb17064ae978024df47a58551f61afd9b10774688c0c217aa319eddeb9285b252006edb3c07"
+	ed25519TestPub  = "0xb1e2af21d50c8940aaebe9650bd3e09eb49f3945c6ec2d917de0d64cdfaf3fba"
+	ed25519OtherPub = "0xd80dba993da70e4721c12f1e5499fe0d06ddc06465889c6ce9a573ee99817b53"
+)
+
+func ed25519Row(coin, addr string) *CoinData {
+	return &CoinData{Coin: coin, SnapshotHeight: "100", Address: addr, Message: ed25519TestMsg, Sign1: ed25519TestSig, Script: ed25519TestPub}
+}
+
+// newNearNode answers view_access_key_list of okx.near at block 100 with the keys and permissions.
+func newNearNode(t *testing.T, keys map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Method string                 `json:"method"`
+			Params map[string]interface{} `json:"params"`
+		}
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		if body.Method != "query" || body.Params["request_type"] != "view_access_key_list" || body.Params["block_id"] != float64(100) {
+			t.Fatalf("unexpected request %+v", body)
+		}
+		switch body.Params["account_id"] {
+		case "okx.near":
+			var list []string
+			for pub, permission := range keys {
+				list = append(list, fmt.Sprintf(`{"public_key":"ed25519:%s","access_key":{"nonce":1,"permission":%s}}`, base58.Encode(MustDecode(pub)), permission))
+			}
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"por","result":{"block_height":100,"keys":[%s]}}`, strings.Join(list, ","))
+		case "missing.near":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":"por","error":{"name":"HANDLER_ERROR","cause":{"name":"UNKNOWN_ACCOUNT"},"message":"account missing.near does not exist"}}`)
+		default:
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":"por","error":{"name":"HANDLER_ERROR","cause":{"name":"GARBAGE_COLLECTED_BLOCK"},"message":"block is gone"}}`)
+		}
+	}))
+}
+
+func TestAccountKeyVerifierNear(t *testing.T) {
+	functionCall := `{"FunctionCall":{"allowance":null,"receiver_id":"app.near","method_names":[]}}`
+	tests := []struct {
+		name   string
+		addr   string
+		keys   map[string]string
+		reason string
+	}{
+		{"implicit account", strings.TrimPrefix(ed25519TestPub, "0x"), nil, ""},
+		{"full access key", "okx.near", map[string]string{ed25519OtherPub: `"FullAccess"`, ed25519TestPub: `"FullAccess"`}, ""},
+		{"function call key", "okx.near", map[string]string{ed25519TestPub: functionCall}, ReasonAddressMismatch},
+		{"unknown account", "missing.near", nil, ReasonAddressMismatch},
+		{"node error", "gone.near", nil, ReasonRPCError},
+	}
+	client.HttpClient = client.NewHTTPClient()
+	ed25519, _ := RegisteredSignatureVerifier(Ed25519CoinType)
+	for _, test := range tests {
+		node := newNearNode(t, test.keys)
+		verifier := NewAccountKeyVerifier(ed25519, map[string]AccountKeyLookup{"NEAR": NewNearAccessKeyLookup(&EvmRPCEndpoint{Endpoint: node.URL})})
+		result := verifier.Verify(ed25519Row("NEAR", test.addr))
+		node.Close()
+		if result.Reason() != test.reason {
+			t.Errorf("%s: expected reason %q, got %q (%v)", test.name, test.reason, result.Reason(), result.Err)
+		}
+	}
+	if err := VerifyEd25519Coin("NEAR", "okx.near", ed25519TestMsg, ed25519TestSig, ed25519TestPub); FailureReason(err) != ReasonUnboundAccount {
+		t.Errorf("expected a named account to stay unbound without a lookup, got %v", err)
+	}
+}
+
+func TestAccountKeyVerifierHedera(t *testing.T) {
+	client.HttpClient = client.NewHTTPClient()
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/v1/blocks/100":
+			fmt.Fprint(w, `{"number":100,"timestamp":{"from":"1700000000.000000000","to":"1700000001.999999999"}}`)
+		case "/api/v1/accounts/0.0.1234":
+			if req.URL.Query().Get("timestamp") != "1700000001.999999999" {
+				t.Fatalf("account read at %s, want the snapshot block", req.URL.Query().Get("timestamp"))
+			}
+			fmt.Fprintf(w, `{"account":"0.0.1234","key":{"_type":"ED25519","key":"%s%s"}}`, hederaEd25519DerPrefix, strings.TrimPrefix(ed25519TestPub, "0x"))
+		case "/api/v1/accounts/0.0.5678":
+			fmt.Fprint(w, `{"account":"0.0.5678","key":{"_type":"ProtobufEncoded","key":"2a0a0801"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"_status":{"messages":[{"message":"Not found"}]}}`)
+		}
+	}))
+	defer mirror.Close()
+
+	tests := []struct {
+		addr   string
+		reason string
+	}{
+		{"0.0.1234", ""},
+		{"0.0.1234-vfmkw", ""},
+		{"0.0.5678", ReasonUnboundAccount},
+		{"0.0.9999", ReasonAddressMismatch},
+		{hederaEd25519DerPrefix + strings.TrimPrefix(ed25519TestPub, "0x"), ""},
+		{ed25519OtherPub, ReasonAddressMismatch},
+	}
+	ed25519, _ := RegisteredSignatureVerifier(Ed25519CoinType)
+	verifier := NewAccountKeyVerifier(ed25519, map[string]AccountKeyLookup{"HBAR": NewHederaMirrorKeyLookup(&EvmRPCEndpoint{Endpoint: mirror.URL})})
+	for _, test := range tests {
+		if result := verifier.Verify(ed25519Row("HBAR", test.addr)); result.Reason() != test.reason {
+			t.Errorf("%s: expected reason %q, got %q (%v)", test.addr, test.reason, result.Reason(), result.Err)
+		}
+	}
+}
+
+func TestVerifyEd25519SiaAndIota(t *testing.T) {
+	pub := MustDecode(ed25519TestPub)
+	siaAddr, err := GetSiaAddressFromPublicKey(ed25519TestPub)
+	if err != nil || len(siaAddr) != 76 {
+		t.Fatalf("unexpected sia address %s, %v", siaAddr, err)
+	}
+	unlockHash, _ := hex.DecodeString(siaAddr[:64])
+	if checksum := blake2b.Sum256(unlockHash); siaAddr[64:] != hex.EncodeToString(checksum[:6]) {
+		t.Fatalf("unexpected sia checksum %s", siaAddr)
+	}
+	iotaAddrs, err := GetIotaAddressesFromPublicKey(ed25519TestPub)
+	if err != nil || len(iotaAddrs) != 3 {
+		t.Fatalf("unexpected iota addresses %v, %v", iotaAddrs, err)
+	}
+	hrp, data, err := bech32.DecodeToBase256(iotaAddrs[0])
+	if keyHash := blake2b.Sum256(pub); err != nil || hrp != "iota" || data[0] != 0 || hex.EncodeToString(data[1:]) != hex.EncodeToString(keyHash[:]) {
+		t.Fatalf("unexpected stardust address %s", iotaAddrs[0])
+	}
+
+	tests := []struct {
+		coin, addr string
+		reason     string
+	}{
+		{"SC", siaAddr, ""},
+		{"SC", strings.Repeat("0", 76), ReasonAddressMismatch},
+		{"IOTA", iotaAddrs[0], ""},
+		{"IOTA", iotaAddrs[1], ""},
+		{"IOTA", iotaAddrs[2], ""},
+		{"IOTA", "0x" + strings.Repeat("0", 64), ReasonAddressMismatch},
+	}
+	for _, test := range tests {
+		if err = VerifyEd25519Coin(test.coin, test.addr, ed25519TestMsg, ed25519TestSig, ed25519TestPub); FailureReason(err) != test.reason {
+			t.Errorf("%s %s: expected reason %q, got %v", test.coin, test.addr, test.reason, err)
+		}
+	}
+}
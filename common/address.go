@@ -22,7 +22,11 @@ type AddressBalanceValidator struct {
 	once                        sync.Once
 	coinJSONConfig              string
 	confMap                     map[string]*coin
-	confCoinAddressWhiteListMap map[string]*coinAddress
+	confCoinAddressWhiteListMap map[PorCoinKey]*coinAddress
+
+	blockHashMu         sync.Mutex
+	blockHashPins       map[string]*BlockHashPin
+	expectedBlockHashes map[string]string
 }
 
 type coin struct {
@@ -33,6 +37,7 @@ type coin struct {
 		JSONPattern   string            `json:"jsonPattern"`
 		DefaultUnit   string            `json:"defaultUnit"`
 		TokenAddress  string            `json:"tokenAddress"`
+		BlockEndpoint string            `json:"blockEndpoint"`
 		CustomHeaders map[string]string `json:"customHeaders"`
 		Enabled       bool              `json:"enabled"`
 	} `json:"api"`
@@ -54,6 +59,9 @@ type coinAddress struct {
 	ProjectFullName string `json:"projectFullName"`
 	Address         string `json:"address"`
 	TokenAddress    string `json:"tokenAddress"`
+	// Network and Type narrow the entry to one PoR row, empty matches every network and type
+	Network string `json:"network"`
+	Type    string `json:"type"`
 }
 
 func NewAddressBalanceValidator(coinJSONConfig string) (*AddressBalanceValidator, error) {
@@ -89,7 +97,7 @@ func (r *AddressBalanceValidator) loadCoinJSON(content []byte) error {
 		return err
 	}
 	coinMap := make(map[string]*coin)
-	addressWhiteListMap := make(map[string]*coinAddress)
+	addressWhiteListMap := make(map[PorCoinKey]*coinAddress)
 	for _, value := range data.Coins {
 		if _, exist := coinMap[value.Name]; !exist {
 			coinMap[value.Name] = value
@@ -103,7 +111,7 @@ func (r *AddressBalanceValidator) loadCoinJSON(content []byte) error {
 				if addr.ProjectFullName == "" {
 					addr.ProjectFullName = addr.Project
 				}
-				key := fmt.Sprintf("%s:%s", value.Name, addr.Address)
+				key := PorCoinKey{Coin: strings.ToUpper(value.Name), Network: strings.ToUpper(addr.Network), Address: addr.Address, Type: addr.Type}
 				if _, exist := addressWhiteListMap[key]; !exist {
 					addressWhiteListMap[key] = addr
 				}
@@ -116,17 +124,28 @@ func (r *AddressBalanceValidator) loadCoinJSON(content []byte) error {
 	return err
 }
 
-func (r *AddressBalanceValidator) GetCoinAddressBalanceInfo(coin, address, height string) (result string, err error) {
-	pConf, exist := r.confMap[coin]
+// whiteListAddress returns the whitelist entry of a PoR row, an entry without network and type
+// matches the address on every network.
+func (r *AddressBalanceValidator) whiteListAddress(key PorCoinKey) (*coinAddress, bool) {
+	if addr, exist := r.confCoinAddressWhiteListMap[key]; exist {
+		return addr, true
+	}
+	addr, exist := r.confCoinAddressWhiteListMap[PorCoinKey{Coin: key.Coin, Address: key.Address}]
+	return addr, exist
+}
+
+func (r *AddressBalanceValidator) GetCoinAddressBalanceInfo(key PorCoinKey, height string) (result string, err error) {
+	pConf, exist := r.confMap[strings.ToLower(key.Coin)]
 	if !exist {
-		err = errors.New(fmt.Sprintf("coin %s not exist in rpc json file, please check the json file!", coin))
+		err = errors.New(fmt.Sprintf("coin %s not exist in rpc json file, please check the json file!", key.Coin))
 		log.Error(err)
 		return
 	}
-	return r.GetCoinAddressBalanceInfoByJSONFormat(address, height, pConf)
+	return r.GetCoinAddressBalanceInfoByJSONFormat(key, height, pConf)
 }
 
-func (r *AddressBalanceValidator) GetCoinAddressBalanceInfoByJSONFormat(address, height string, pConf *coin) (result string, err error) {
+func (r *AddressBalanceValidator) GetCoinAddressBalanceInfoByJSONFormat(key PorCoinKey, height string, pConf *coin) (result string, err error) {
+	address := key.Address
 	if !pConf.RPC.Enabled && !pConf.API.Enabled {
 		err = errors.New(fmt.Sprintf("coin %s, rpc or api method must be enabled at leasr one in rpc json file, please check the json file!", pConf.Name))
 		log.Error(err)
@@ -138,24 +157,30 @@ func (r *AddressBalanceValidator) GetCoinAddressBalanceInfoByJSONFormat(address,
 	if pConf.RPC.Enabled {
 		// get address balance from white list
 		// the address in white list doesn't support node RPC query, if RPC config enable, return the balance in por data.
-		key := fmt.Sprintf("%s:%s", strings.ToUpper(pConf.Name), address)
-		if _, exist := r.confCoinAddressWhiteListMap[key]; exist {
+		if whiteListAddr, exist := r.whiteListAddress(key); exist {
 			log.Infof("notice: the address %s in project %s doesn't support node rpc method to query, "+
-				"if rpc config enable, return the balance in por data.", address, r.confCoinAddressWhiteListMap[key].ProjectFullName)
-			if _, exist = PorCoinDataMap[key]; exist {
-				result = PorCoinDataMap[key].Balance
+				"if rpc config enable, return the balance in por data.", address, whiteListAddr.ProjectFullName)
+			if value, exist := LookupPorCoinData(key); exist {
+				result = value.Balance
 			} else {
 				result = "0"
 			}
 			return result, nil
 		}
 
+		// pin the snapshot height to one exact block, evm nodes are then queried by block hash (EIP-1898)
+		blockHash, err := r.PinBlockHash(pConf, height)
+		if err != nil {
+			log.Error(err)
+			return result, err
+		}
+
 		var request *client.JsonRpcRequest
 		switch pConf.Name {
 		case "btc":
 			params := make([]interface{}, 0)
 			descriptorList := make([]interface{}, 0)
-			descriptor, err := r.generateAddressDescriptor(pConf.Name, address)
+			descriptor, err := r.generateAddressDescriptor(key)
 			if err != nil {
 				return result, err
 			}
@@ -164,14 +189,7 @@ func (r *AddressBalanceValidator) GetCoinAddressBalanceInfoByJSONFormat(address,
 			request, _ = client.RpcClient.MakeJsonRPCRequestParams(1, "scantxoutset", params)
 		case "eth", "eth-optimism", "eth-arbitrum":
 			params := make([]interface{}, 0)
-			var blockHeightHex string
-			if height != "latest" {
-				h, _ := strconv.ParseInt(height, 10, 64)
-				blockHeightHex = fmt.Sprintf("0x%s", strconv.FormatInt(h, 16))
-			} else {
-				blockHeightHex = height
-			}
-			params = append(params, address, blockHeightHex)
+			params = append(params, address, blockParam(height, blockHash))
 			request, _ = client.RpcClient.MakeJsonRPCRequestParams(1, "eth_getBalance", params)
 		default:
 			var cutAddress string
@@ -187,14 +205,7 @@ func (r *AddressBalanceValidator) GetCoinAddressBalanceInfoByJSONFormat(address,
 				To:   pConf.RPC.TokenAddress,
 			}
 			params := make([]interface{}, 0)
-			var blockHeightHex string
-			if height != "latest" {
-				h, _ := strconv.ParseInt(height, 10, 64)
-				blockHeightHex = fmt.Sprintf("0x%s", strconv.FormatInt(h, 16))
-			} else {
-				blockHeightHex = height
-			}
-			params = append(params, requestParam, blockHeightHex)
+			params = append(params, requestParam, blockParam(height, blockHash))
 			request, _ = client.RpcClient.MakeJsonRPCRequestParams(1, "eth_call", params)
 		}
 		body, err := client.RpcClient.Post(pConf.RPC.Endpoint, request, pConf.RPC.AuthUser, pConf.RPC.AuthPassword, pConf.RPC.CustomHeaders)
@@ -212,6 +223,13 @@ func (r *AddressBalanceValidator) GetCoinAddressBalanceInfoByJSONFormat(address,
 			return result, err
 		}
 
+		if pConf.Name == "btc" {
+			if err = checkScanTxOutSetBlock(object, pConf.Name, height, blockHash); err != nil {
+				log.Error(err)
+				return result, err
+			}
+		}
+
 		// parse address balance
 		balanceRes, err = jsonpath.JsonPathLookup(object, pConf.RPC.JSONPattern)
 		if err != nil {
@@ -227,13 +245,18 @@ func (r *AddressBalanceValidator) GetCoinAddressBalanceInfoByJSONFormat(address,
 			log.Error(err)
 			return result, err
 		}
+		// the api is queried by height, the block hash is recorded so the balance is tied to one block
+		if _, err := r.PinBlockHash(pConf, height); err != nil {
+			log.Error(err)
+			return result, err
+		}
+
 		var project, tokenAddress string
 		// get address coin name from white list
 		// add request params
-		key := fmt.Sprintf("%s:%s", pConf.Name, address)
-		if _, exist := r.confCoinAddressWhiteListMap[key]; exist {
-			project = r.confCoinAddressWhiteListMap[key].Project
-			tokenAddress = r.confCoinAddressWhiteListMap[key].TokenAddress
+		if whiteListAddr, exist := r.whiteListAddress(key); exist {
+			project = whiteListAddr.Project
+			tokenAddress = whiteListAddr.TokenAddress
 		} else {
 			project = ""
 			tokenAddress = pConf.API.TokenAddress
@@ -306,7 +329,15 @@ func (r *AddressBalanceValidator) GetCoinAddressBalanceInfoByJSONFormat(address,
 	return result, nil
 }
 
-func (r *AddressBalanceValidator) GetCoinAddressTotalBalance(coin, height string, addresses []string) (result string, err error) {
+// AddressChunkSize is the number of addresses of a coin queried for their total balance at once.
+func AddressChunkSize(coin string) int {
+	if coin == "btc" {
+		return 10000
+	}
+	return 1000
+}
+
+func (r *AddressBalanceValidator) GetCoinAddressTotalBalance(coin, height string, addresses []PorCoinKey) (result string, err error) {
 	pConf, exist := r.confMap[coin]
 	if !exist {
 		err = errors.New(fmt.Sprintf("coin %s not exist in rpc json file, please check the json file!", coin))
@@ -314,12 +345,7 @@ func (r *AddressBalanceValidator) GetCoinAddressTotalBalance(coin, height string
 		return
 	}
 
-	var chunkSize int
-	if coin == "btc" {
-		chunkSize = 10000
-	} else {
-		chunkSize = 1000
-	}
+	chunkSize := AddressChunkSize(coin)
 	if len(addresses) < chunkSize {
 		chunkSize = len(addresses)
 	}
@@ -333,91 +359,122 @@ func (r *AddressBalanceValidator) GetCoinAddressTotalBalance(coin, height string
 
 	totalBalance := big.NewInt(0)
 	for i, items := range divided {
-		log.Infof("chunk %d, scanning address total balance, this may take a while...", i+1)
-		addressList := make([]interface{}, 0)
-		if pConf.Name == "btc" && pConf.RPC.Enabled {
-			for _, item := range items {
-				address := item.(string)
-				// ignore white list address
-				key := fmt.Sprintf("%s:%s", strings.ToUpper(pConf.Name), address)
-				if _, exist := r.confCoinAddressWhiteListMap[key]; exist {
-					log.Infof("notice: the address %s in project %s doesn't support node rpc method to query, "+
-						"if rpc config enable, return the balance in por data", address, r.confCoinAddressWhiteListMap[key].ProjectFullName)
-					balance := "0"
-					if _, exist = PorCoinDataMap[key]; exist {
-						balance = PorCoinDataMap[key].Balance
-					}
-					balanceInt, _ := big.NewInt(0).SetString(balance, 10)
-					totalBalance = totalBalance.Add(totalBalance, balanceInt)
-					continue
-				}
+		chunkBalance, err := r.fetchChunkTotalBalance(pConf, height, items, i)
+		if err != nil {
+			return result, err
+		}
+		totalBalance = totalBalance.Add(totalBalance, chunkBalance)
+		log.Infof("chunk %d, chunk balance %s, total balance %s", i+1, chunkBalance.String(), totalBalance.String())
+	}
+
+	return totalBalance.String(), nil
+}
 
-				descriptor, err := r.generateAddressDescriptor(pConf.Name, address)
-				if err != nil {
-					return result, err
+// GetCoinAddressChunkBalance returns the total balance of one chunk of at most AddressChunkSize
+// addresses, so a file of any size can be streamed through it chunk by chunk.
+func (r *AddressBalanceValidator) GetCoinAddressChunkBalance(coin, height string, addresses []PorCoinKey, chunk int) (*big.Int, error) {
+	pConf, exist := r.confMap[coin]
+	if !exist {
+		err := errors.New(fmt.Sprintf("coin %s not exist in rpc json file, please check the json file!", coin))
+		log.Error(err)
+		return nil, err
+	}
+	items := make([]interface{}, 0, len(addresses))
+	for _, v := range addresses {
+		items = append(items, v)
+	}
+	return r.fetchChunkTotalBalance(pConf, height, items, chunk)
+}
+
+func (r *AddressBalanceValidator) fetchChunkTotalBalance(pConf *coin, height string, items []interface{}, i int) (*big.Int, error) {
+	log.Infof("chunk %d, scanning address total balance, this may take a while...", i+1)
+	totalBalance := big.NewInt(0)
+	addressList := make([]interface{}, 0)
+	if pConf.Name == "btc" && pConf.RPC.Enabled {
+		for _, item := range items {
+			key := item.(PorCoinKey)
+			// ignore white list address
+			if whiteListAddr, exist := r.whiteListAddress(key); exist {
+				log.Infof("notice: the address %s in project %s doesn't support node rpc method to query, "+
+					"if rpc config enable, return the balance in por data", key.Address, whiteListAddr.ProjectFullName)
+				balance := "0"
+				if value, exist := LookupPorCoinData(key); exist {
+					balance = value.Balance
 				}
-				addressList = append(addressList, descriptor)
+				balanceInt, _ := big.NewInt(0).SetString(balance, 10)
+				totalBalance = totalBalance.Add(totalBalance, balanceInt)
+				continue
 			}
-		} else {
-			addressList = items
-		}
 
-		chunkBalance := big.NewInt(0)
-		if pConf.Name == "btc" && pConf.RPC.Enabled {
-			retryNums := 3
-			chunkBalance, err = r.BatchFetchBTCTotalAddressBalanceFromNode(height, addressList, pConf)
+			descriptor, err := r.generateAddressDescriptor(key)
 			if err != nil {
-				for retryNums > 0 {
-					log.Infof("get chunk %d coin total address balance failed, retry...", i+1)
-					chunkBalance, err = r.BatchFetchBTCTotalAddressBalanceFromNode(height, addressList, pConf)
-					if err == nil {
-						break
-					}
-					retryNums--
+				return nil, err
+			}
+			addressList = append(addressList, descriptor)
+		}
+	} else {
+		addressList = items
+	}
+
+	chunkBalance := big.NewInt(0)
+	var err error
+	if pConf.Name == "btc" && pConf.RPC.Enabled {
+		retryNums := 3
+		chunkBalance, err = r.BatchFetchBTCTotalAddressBalanceFromNode(height, addressList, pConf)
+		if err != nil {
+			for retryNums > 0 {
+				log.Infof("get chunk %d coin total address balance failed, retry...", i+1)
+				chunkBalance, err = r.BatchFetchBTCTotalAddressBalanceFromNode(height, addressList, pConf)
+				if err == nil {
+					break
 				}
-				if retryNums == 0 {
-					log.Infof("chunk %d, try to cut the size and rertry...", i+1)
-					reChunkSize := chunkSize
-					chunkBalance = big.NewInt(0)
-					for {
-						reChunkSize = reChunkSize / 2
-						log.Infof("chunk %d, cut chunk size to %d", i+1, reChunkSize)
-						// divided address list
-						reDivided := r.DividedAddressList(addressList, reChunkSize)
-						var errs error
-						for _, item := range reDivided {
-							b, err := r.BatchFetchBTCTotalAddressBalanceFromNode(height, item, pConf)
-							if err != nil {
-								errs = err
-								chunkBalance = big.NewInt(0)
-								break
-							}
-							chunkBalance = chunkBalance.Add(chunkBalance, b)
-						}
-						if errs == nil {
+				retryNums--
+			}
+			if retryNums == 0 {
+				log.Infof("chunk %d, try to cut the size and rertry...", i+1)
+				reChunkSize := len(addressList)
+				chunkBalance = big.NewInt(0)
+				for {
+					reChunkSize = reChunkSize / 2
+					log.Infof("chunk %d, cut chunk size to %d", i+1, reChunkSize)
+					// divided address list
+					reDivided := r.DividedAddressList(addressList, reChunkSize)
+					var errs error
+					for _, item := range reDivided {
+						b, err := r.BatchFetchBTCTotalAddressBalanceFromNode(height, item, pConf)
+						if err != nil {
+							errs = err
+							chunkBalance = big.NewInt(0)
 							break
 						}
-						if reChunkSize <= 100 {
-							log.Errorf("get chunk %d coin total address balance from blockchain failed, please check rpc json config.", i+1)
-							return result, errs
-						}
+						chunkBalance = chunkBalance.Add(chunkBalance, b)
+					}
+					if errs == nil {
+						break
+					}
+					if reChunkSize <= 100 {
+						log.Errorf("get chunk %d coin total address balance from blockchain failed, please check rpc json config.", i+1)
+						return nil, errs
 					}
 				}
 			}
-		} else {
-			chunkBalance, err = r.BatchFetchCoinTotalAddressBalance(height, addressList, pConf)
 		}
-
-		totalBalance = totalBalance.Add(totalBalance, chunkBalance)
-		log.Infof("chunk %d, chunk balance %s, total balance %s", i+1, chunkBalance.String(), totalBalance.String())
+	} else {
+		chunkBalance, err = r.BatchFetchCoinTotalAddressBalance(height, addressList, pConf)
 	}
 
-	return totalBalance.String(), nil
+	return totalBalance.Add(totalBalance, chunkBalance), nil
 }
 
 func (r *AddressBalanceValidator) BatchFetchBTCTotalAddressBalanceFromNode(height string, addresses []interface{}, pConf *coin) (result *big.Int, err error) {
 	result = big.NewInt(0)
 
+	blockHash, err := r.PinBlockHash(pConf, height)
+	if err != nil {
+		log.Error(err)
+		return result, err
+	}
+
 	var request *client.JsonRpcRequest
 	params := make([]interface{}, 0)
 	descriptors := addresses
@@ -438,6 +495,10 @@ func (r *AddressBalanceValidator) BatchFetchBTCTotalAddressBalanceFromNode(heigh
 		log.Error(err)
 		return result, err
 	}
+	if err = checkScanTxOutSetBlock(object, pConf.Name, height, blockHash); err != nil {
+		log.Error(err)
+		return result, err
+	}
 
 	// parse address balance
 	balance, err := jsonpath.JsonPathLookup(object, pConf.RPC.JSONPattern)
@@ -466,22 +527,22 @@ func (r *AddressBalanceValidator) BatchFetchCoinTotalAddressBalance(height strin
 	result = big.NewInt(0)
 
 	for _, address := range addresses {
-		addressStr := address.(string)
-		balance, err := r.GetCoinAddressBalanceInfoByJSONFormat(addressStr, height, pConf)
+		key := address.(PorCoinKey)
+		balance, err := r.GetCoinAddressBalanceInfoByJSONFormat(key, height, pConf)
 		if err != nil {
 			retryNum := 3
 			for retryNum > 0 {
 				// some api limit rate is low...
 				time.Sleep(10 * time.Second)
 
-				balance, err = r.GetCoinAddressBalanceInfoByJSONFormat(addressStr, height, pConf)
+				balance, err = r.GetCoinAddressBalanceInfoByJSONFormat(key, height, pConf)
 				if err == nil {
 					break
 				}
 				retryNum--
 			}
 
-			log.Errorf("get coin %s address %s balance failed..", pConf.Name, address)
+			log.Errorf("get coin %s address %s balance failed..", pConf.Name, key.Address)
 			balance = "0"
 		}
 
@@ -529,7 +590,8 @@ func (r *AddressBalanceValidator) DividedAddressList(addresses []interface{}, ch
 	return
 }
 
-func (r *AddressBalanceValidator) generateAddressDescriptor(coin, address string) (result string, err error) {
+func (r *AddressBalanceValidator) generateAddressDescriptor(key PorCoinKey) (result string, err error) {
+	coin, address := key.Coin, key.Address
 	addrType := GuessUtxoCoinAddressType(address)
 	if addrType == "" {
 		err = errors.New(fmt.Sprintf("coin:%s, invalid address %s", coin, address))
@@ -537,14 +599,34 @@ func (r *AddressBalanceValidator) generateAddressDescriptor(coin, address string
 		return result, err
 	}
 	var redeemScript string
-	if value, exist := PorCoinDataMap[fmt.Sprintf("%s:%s", strings.ToUpper(coin), address)]; exist {
+	if value, exist := LookupPorCoinData(key); exist {
 		redeemScript = value.Script
+		// P2PKH rows carry no script, the public key is recovered from the signature
+		if addrType == "P2PKH" && redeemScript == "" {
+			redeemScript = RecoveryPubKeyFromSign(value.Address, value.Message, value.Sign1)
+			if redeemScript == "" {
+				err = errors.New(fmt.Sprintf("coin:%s, recovery pubkey from sign msg failed, address %s", coin, address))
+				log.Error(err)
+				return result, err
+			}
+		}
 	} else {
 		err = errors.New(fmt.Sprintf("coin:%s, por data not support the address %s", coin, address))
 		log.Error(err)
 		return result, err
 	}
-	descriptor, err := CreateAddressDescriptor(addrType, redeemScript, 2, 3)
+	// descriptors of multisig addresses carry the m-of-n of their redeem script
+	mSigns, nKeys := 1, 1
+	if addrType != "P2PKH" {
+		ms, err := ParseMultisigScript(redeemScript)
+		if err != nil {
+			err = errors.New(fmt.Sprintf("coin:%s, address %s, invalid redeem script: %v", coin, address, err))
+			log.Error(err)
+			return result, err
+		}
+		mSigns, nKeys = ms.M, ms.N
+	}
+	descriptor, err := CreateAddressDescriptor(addrType, redeemScript, mSigns, nKeys)
 	if err != nil {
 		err = errors.New(fmt.Sprintf("coin:%s, address %s, create address output descriptor failed.", coin, address))
 		log.Error(err)
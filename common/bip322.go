@@ -0,0 +1,178 @@
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	mtxscript "github.com/martinboehm/btcd/txscript"
+	"github.com/martinboehm/btcutil"
+	"github.com/martinboehm/btcutil/chaincfg"
+)
+
+// Bip322MessageTag tags the message hash of a BIP-322 signature.
+const Bip322MessageTag = "BIP0322-signed-message"
+
+// bip322CoinParams are the networks that accept BIP-322 signatures.
+var bip322CoinParams = map[string]func() *chaincfg.Params{
+	"BTC": GetBTCMainNetParams,
+	"LTC": GetLTCMainNetParams,
+}
+
+// IsBip322Coin reports whether the signatures of a coin may be BIP-322 signatures.
+func IsBip322Coin(coin string) bool {
+	_, ok := bip322CoinParams[coin]
+	return ok
+}
+
+// IsBip322Signature reports whether a base64 signature is a BIP-322 one, i.e. neither a legacy
+// signmessage signature (65 bytes with a 27-42 header) nor a 0x hex signature.
+func IsBip322Signature(sign string) bool {
+	if sign == "" || has0xPrefix(sign) {
+		return false
+	}
+	b, err := base64.StdEncoding.DecodeString(sign)
+	if err != nil {
+		return false
+	}
+	return !(len(b) == 65 && b[0] >= 27 && b[0] <= 42)
+}
+
+// Bip322MessageHash returns the tagged hash of the message that to_spend commits to.
+func Bip322MessageHash(msg string) []byte {
+	return chainhash.TaggedHash([]byte(Bip322MessageTag), []byte(msg))[:]
+}
+
+// Bip322ToSpend builds the virtual to_spend transaction of the message and the script of the
+// address.
+func Bip322ToSpend(pkScript []byte, msg string) *wire.MsgTx {
+	tx := wire.NewMsgTx(0)
+	scriptSig := append([]byte{txscript.OP_0, txscript.OP_DATA_32}, Bip322MessageHash(msg)...)
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Index: 0xffffffff}, SignatureScript: scriptSig, Sequence: 0})
+	tx.AddTxOut(wire.NewTxOut(0, pkScript))
+	return tx
+}
+
+// Bip322ToSign builds the virtual to_sign transaction that spends to_spend with the witness.
+func Bip322ToSign(toSpend *wire.MsgTx, witness wire.TxWitness) *wire.MsgTx {
+	tx := wire.NewMsgTx(0)
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: toSpend.TxHash(), Index: 0}, Witness: witness, Sequence: 0})
+	tx.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN}))
+	return tx
+}
+
+// VerifyBip322 verifies a BIP-322 "simple" signature, the base64 witness stack, or a "full"
+// signature, the base64 to_sign transaction, by running the script of the address on to_sign.
+// Proofs of funds, to_sign transactions with more than one input, are not supported.
+func VerifyBip322(coin, addr, msg, sign string) error {
+	pkScript, err := bip322AddressScript(coin, addr)
+	if err != nil {
+		return err
+	}
+	b, err := base64.StdEncoding.DecodeString(sign)
+	if err != nil {
+		return fmt.Errorf("invalid BIP-322 signature encoding, coin:%s, addr:%s, error:%v", coin, addr, err)
+	}
+	toSpend := Bip322ToSpend(pkScript, msg)
+	toSign, err := decodeBip322ToSign(toSpend, b)
+	if err != nil {
+		return fmt.Errorf("invalid BIP-322 signature, coin:%s, addr:%s, error:%v", coin, addr, err)
+	}
+
+	prevOuts := txscript.NewCannedPrevOutputFetcher(pkScript, 0)
+	engine, err := txscript.NewEngine(pkScript, toSign, 0, txscript.StandardVerifyFlags, nil, txscript.NewTxSigHashes(toSign, prevOuts), 0, prevOuts)
+	if err != nil {
+		return fmt.Errorf("BIP-322 script engine failed, coin:%s, addr:%s, error:%v", coin, addr, err)
+	}
+	if err = engine.Execute(); err != nil {
+		return fmt.Errorf("BIP-322 signature does not verify, coin:%s, addr:%s, error:%v", coin, addr, err)
+	}
+	return nil
+}
+
+// decodeBip322ToSign returns the to_sign transaction of a full signature, or the one built from
+// the witness stack of a simple signature.
+func decodeBip322ToSign(toSpend *wire.MsgTx, b []byte) (*wire.MsgTx, error) {
+	tx, r := wire.NewMsgTx(0), bytes.NewReader(b)
+	if err := tx.Deserialize(r); err == nil && r.Len() == 0 && len(tx.TxIn) > 0 {
+		if len(tx.TxIn) != 1 {
+			return nil, errors.New("proof of funds inputs are not supported")
+		}
+		if tx.TxIn[0].PreviousOutPoint != (wire.OutPoint{Hash: toSpend.TxHash(), Index: 0}) {
+			return nil, errors.New("to_sign does not spend to_spend")
+		}
+		if len(tx.TxOut) != 1 || tx.TxOut[0].Value != 0 || !bytes.Equal(tx.TxOut[0].PkScript, []byte{txscript.OP_RETURN}) {
+			return nil, errors.New("to_sign must have a single OP_RETURN output")
+		}
+		return tx, nil
+	}
+	witness, err := decodeWitnessStack(b)
+	if err != nil {
+		return nil, err
+	}
+	return Bip322ToSign(toSpend, witness), nil
+}
+
+// decodeWitnessStack reads the consensus encoding of a witness stack, the whole input must be used.
+func decodeWitnessStack(b []byte) (wire.TxWitness, error) {
+	r := bytes.NewReader(b)
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil || count == 0 || count > uint64(len(b)) {
+		return nil, errors.New("not a witness stack")
+	}
+	witness := make(wire.TxWitness, count)
+	for i := range witness {
+		if witness[i], err = wire.ReadVarBytes(r, 0, txscript.MaxScriptSize, "witness item"); err != nil {
+			return nil, errors.New("not a witness stack")
+		}
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("trailing bytes after the witness stack")
+	}
+	return witness, nil
+}
+
+// bip322AddressScript returns the output script of a BTC or LTC address, segwit v0 and v1
+// (taproot) addresses included.
+func bip322AddressScript(coin, addr string) ([]byte, error) {
+	getParams, ok := bip322CoinParams[coin]
+	if !ok {
+		return nil, withReason(ReasonUnsupportedCoin, fmt.Errorf("coin %s does not support BIP-322 signatures", coin))
+	}
+	params := getParams()
+	if strings.HasPrefix(strings.ToLower(addr), params.Bech32HRPSegwit+"1") {
+		hrp, data, encoding, err := bech32.DecodeGeneric(addr)
+		if err != nil || hrp != params.Bech32HRPSegwit || len(data) == 0 {
+			return nil, withReason(ReasonUndecodableAddress, fmt.Errorf("invalid segwit address, coin:%s, addr:%s, error:%v", coin, addr, err))
+		}
+		version := data[0]
+		program, err := bech32.ConvertBits(data[1:], 5, 8, false)
+		// version 0 is bech32 (BIP-173), later versions are bech32m (BIP-350)
+		if err != nil || version > 16 || len(program) < 2 || len(program) > 40 || (version == 0) != (encoding == bech32.Version0) {
+			return nil, withReason(ReasonUndecodableAddress, fmt.Errorf("invalid segwit address, coin:%s, addr:%s", coin, addr))
+		}
+		op := byte(txscript.OP_0)
+		if version > 0 {
+			op = txscript.OP_1 + version - 1
+		}
+		return append([]byte{op, byte(len(program))}, program...), nil
+	}
+	decoded, err := btcutil.DecodeAddress(addr, params)
+	if err == nil && !decoded.IsForNet(params) {
+		err = errors.New("address of another network")
+	}
+	if err != nil {
+		return nil, withReason(ReasonUndecodableAddress, fmt.Errorf("invalid address, coin:%s, addr:%s, error:%v", coin, addr, err))
+	}
+	pkScript, err := mtxscript.PayToAddrScript(decoded)
+	if err != nil {
+		return nil, withReason(ReasonUndecodableAddress, fmt.Errorf("invalid address, coin:%s, addr:%s, error:%v", coin, addr, err))
+	}
+	return pkScript, nil
+}
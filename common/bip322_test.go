@@ -0,0 +1,121 @@
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	btcdutil "github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// test vectors of https://github.com/bitcoin/bips/blob/master/bip-0322.mediawiki
+const (
+	bip322P2WPKH = "bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l"
+	bip322P2TR   = "bc1ppv609nr0vr25u07u95waq5lucwfm6tde4nydujnu8npg4q75mr5sxq8lt3"
+)
+
+func TestBip322MessageHash(t *testing.T) {
+	if h := hex.EncodeToString(Bip322MessageHash("")); h != "c90c269c4f8fcbe6880f72a721ddfbf1914268a794cbb21cfafee13770ae19f1" {
+		t.Errorf("unexpected hash of the empty message %s", h)
+	}
+	if h := hex.EncodeToString(Bip322MessageHash("Hello World")); h != "f0eb03b1a75ac6d9847f55c624a99169b5dccba2a31f5b23bea77ba270de0a7a" {
+		t.Errorf("unexpected hash of Hello World %s", h)
+	}
+	pkScript, _ := bip322AddressScript("BTC", bip322P2WPKH)
+	if txid := Bip322ToSpend(pkScript, "").TxHash().String(); txid != "c5680aa69bb8d860bf82d4e9cd3504b55dde018de765a91bb566283c545a99a7" {
+		t.Errorf("unexpected to_spend txid %s", txid)
+	}
+}
+
+func TestVerifyBip322(t *testing.T) {
+	tests := []struct {
+		name, coin, addr, msg, sign string
+		ok                          bool
+	}{
+		{"p2wpkh empty message", "BTC", bip322P2WPKH, "", "AkcwRAIgM2gBAQqvZX15ZiysmKmQpDrG83avLIT492QBzLnQIxYCIBaTpOaD20qRlEylyxFSeEA2ba9YOixpX8z46TSDtS40ASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=", true},
+		{"p2wpkh", "BTC", bip322P2WPKH, "Hello World", "AkcwRAIgZRfIY3p7/DoVTty6YZbWS71bc5Vct9p9Fia83eRmw2QCICK/ENGfwLtptFluMGs2KsqoNSk89pO7F29zJLUx9a/sASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=", true},
+		{"p2wpkh wrong message", "BTC", bip322P2WPKH, "", "AkcwRAIgZRfIY3p7/DoVTty6YZbWS71bc5Vct9p9Fia83eRmw2QCICK/ENGfwLtptFluMGs2KsqoNSk89pO7F29zJLUx9a/sASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=", false},
+		{"p2tr", "BTC", bip322P2TR, "Hello World", "AUHd69PrJQEv+oKTfZ8l+WROBHuy9HKrbFCJu7U1iK2iiEy1vMU5EfMtjc+VSHM7aU0SDbak5IUZRVno2P5mjSafAQ==", true},
+		{"p2tr wrong address", "BTC", "bc1p5d7rjq7g6rdk2yhzks9smlaqtedr4dekq08ge8ztwac72sfr9rusxg3297", "Hello World", "AUHd69PrJQEv+oKTfZ8l+WROBHuy9HKrbFCJu7U1iK2iiEy1vMU5EfMtjc+VSHM7aU0SDbak5IUZRVno2P5mjSafAQ==", false},
+		{"not a witness", "BTC", bip322P2WPKH, "Hello World", "AQID", false},
+	}
+	for _, test := range tests {
+		if err := VerifyBip322(test.coin, test.addr, test.msg, test.sign); (err == nil) != test.ok {
+			t.Errorf("%s: expected ok %v, got %v", test.name, test.ok, err)
+		}
+	}
+}
+
+func TestVerifyBip322Full(t *testing.T) {
+	pkScript, _ := bip322AddressScript("BTC", bip322P2WPKH)
+	toSpend := Bip322ToSpend(pkScript, "Hello World")
+	simple, _ := base64.StdEncoding.DecodeString("AkcwRAIgZRfIY3p7/DoVTty6YZbWS71bc5Vct9p9Fia83eRmw2QCICK/ENGfwLtptFluMGs2KsqoNSk89pO7F29zJLUx9a/sASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=")
+	witness, err := decodeWitnessStack(simple)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	_ = Bip322ToSign(toSpend, witness).Serialize(&buf)
+	if err = VerifyBip322("BTC", bip322P2WPKH, "Hello World", base64.StdEncoding.EncodeToString(buf.Bytes())); err != nil {
+		t.Fatalf("full signature should verify, got %v", err)
+	}
+
+	// a to_sign with another output is not a BIP-322 signature
+	toSign := Bip322ToSign(toSpend, witness)
+	toSign.AddTxOut(wire.NewTxOut(1000, pkScript))
+	buf.Reset()
+	_ = toSign.Serialize(&buf)
+	if err = VerifyBip322("BTC", bip322P2WPKH, "Hello World", base64.StdEncoding.EncodeToString(buf.Bytes())); err == nil {
+		t.Fatal("expected a to_sign with a payment output to fail")
+	}
+}
+
+func TestVerifyBip322Litecoin(t *testing.T) {
+	const msg = "I am an OKX address"
+	key, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{7}, 32))
+	program, _ := bech32.ConvertBits(btcdutil.Hash160(key.PubKey().SerializeCompressed()), 8, 5, true)
+	addr, _ := bech32.Encode("ltc", append([]byte{0}, program...))
+
+	pkScript, err := bip322AddressScript("LTC", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	toSign := Bip322ToSign(Bip322ToSpend(pkScript, msg), nil)
+	prevOuts := txscript.NewCannedPrevOutputFetcher(pkScript, 0)
+	witness, err := txscript.WitnessSignature(toSign, txscript.NewTxSigHashes(toSign, prevOuts), 0, 0, pkScript, txscript.SigHashAll, key, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	_ = wire.WriteVarInt(&buf, 0, uint64(len(witness)))
+	for _, item := range witness {
+		_ = wire.WriteVarBytes(&buf, 0, item)
+	}
+	sign := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	row := &CoinData{Coin: "LTC", Address: addr, Message: msg, Sign1: sign}
+	if result := VerifyRowSignature(row); !result.OK() || result.Verifier != "UTXO+BIP-322" {
+		t.Fatalf("expected the BIP-322 verifier to accept the row, got %s %v", result.Verifier, result.Err)
+	}
+	if err = VerifyBip322("LTC", addr, "another message", sign); err == nil {
+		t.Fatal("expected another message to fail")
+	}
+	if err = VerifyBip322("BTC", addr, msg, sign); FailureReason(err) != ReasonUndecodableAddress {
+		t.Fatalf("expected a litecoin address to be undecodable as BTC, got %v", err)
+	}
+}
+
+func TestIsBip322Signature(t *testing.T) {
+	legacy := "IA1jDx3zkn4J4F6mCVU68Vm7TwNf+bCsp+hKo3LwV/Y+PlZEoNsajnAHqd/FrEmv5/VAGz7pPiWPOXjmCLRfxIM="
+	if IsBip322Signature(legacy) || IsBip322Signature("0x1234") || IsBip322Signature("") || IsBip322Signature("not base64!") {
+		t.Error("legacy, hex and invalid signatures are not BIP-322 signatures")
+	}
+	if !IsBip322Signature("AUHd69PrJQEv+oKTfZ8l+WROBHuy9HKrbFCJu7U1iK2iiEy1vMU5EfMtjc+VSHM7aU0SDbak5IUZRVno2P5mjSafAQ==") {
+		t.Error("expected a witness stack to be a BIP-322 signature")
+	}
+}
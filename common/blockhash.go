@@ -0,0 +1,212 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/okx/proof-of-reserves/client"
+	"github.com/oliveagle/jsonpath"
+	log "github.com/sirupsen/logrus"
+)
+
+// BlockHashPin ties the snapshot height of a coin to the exact block its balances were queried at.
+type BlockHashPin struct {
+	Coin     string
+	Height   string
+	Hash     string
+	Expected string
+}
+
+// LoadExpectedBlockHashes loads the expected block hash list shipped with a snapshot.
+// Every line is "coin,snapshot height,block hash"; a header line is skipped.
+func (r *AddressBalanceValidator) LoadExpectedBlockHashes(fileName string) error {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	expected := make(map[string]string)
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(strings.ToLower(line), "coin,") {
+			continue
+		}
+		args := strings.Split(line, ",")
+		if len(args) != 3 {
+			return fmt.Errorf("invalid block hash line %d in %s, expected coin,snapshot height,block hash", i+1, fileName)
+		}
+		key := blockHashKey(args[0], args[1])
+		if hash, exist := expected[key]; exist && !isSameBlockHash(hash, args[2]) {
+			return fmt.Errorf("conflicting block hash for %s at line %d in %s", key, i+1, fileName)
+		}
+		expected[key] = strings.TrimSpace(args[2])
+	}
+
+	r.blockHashMu.Lock()
+	defer r.blockHashMu.Unlock()
+	r.expectedBlockHashes = expected
+	return nil
+}
+
+// BlockHashPins returns every block hash resolved so far, sorted by coin and height.
+func (r *AddressBalanceValidator) BlockHashPins() []BlockHashPin {
+	r.blockHashMu.Lock()
+	defer r.blockHashMu.Unlock()
+	pins := make([]BlockHashPin, 0, len(r.blockHashPins))
+	for _, pin := range r.blockHashPins {
+		pins = append(pins, *pin)
+	}
+	sort.Slice(pins, func(i, j int) bool {
+		if pins[i].Coin != pins[j].Coin {
+			return pins[i].Coin < pins[j].Coin
+		}
+		return pins[i].Height < pins[j].Height
+	})
+	return pins
+}
+
+// PinBlockHash resolves the block hash of the snapshot height from the configured node, or from
+// the blockEndpoint of the api, compares it with the expected hash list if one was loaded, and
+// records it. A node that has not reached the height, or that reports a different hash, fails
+// the query. An api coin without a blockEndpoint is queried by height only.
+func (r *AddressBalanceValidator) PinBlockHash(pConf *coin, height string) (string, error) {
+	if height == "" || height == "latest" || height == "-" {
+		return "", nil
+	}
+	if !pConf.RPC.Enabled && pConf.API.BlockEndpoint == "" {
+		return "", nil
+	}
+	key := blockHashKey(pConf.Name, height)
+
+	r.blockHashMu.Lock()
+	if pin, exist := r.blockHashPins[key]; exist {
+		r.blockHashMu.Unlock()
+		return pin.Hash, nil
+	}
+	expected := r.expectedBlockHashes[key]
+	r.blockHashMu.Unlock()
+
+	hash, err := r.fetchBlockHash(pConf, height)
+	if err != nil {
+		return "", err
+	}
+	if expected != "" && !isSameBlockHash(hash, expected) {
+		err = fmt.Errorf("block hash mismatch, coin:%s, height:%s, queried:%s, expected:%s, the node may be on a fork", pConf.Name, height, hash, expected)
+		log.Error(err)
+		return "", err
+	}
+
+	r.blockHashMu.Lock()
+	defer r.blockHashMu.Unlock()
+	if r.blockHashPins == nil {
+		r.blockHashPins = make(map[string]*BlockHashPin)
+	}
+	r.blockHashPins[key] = &BlockHashPin{
+		Coin:     strings.ToUpper(pConf.Name),
+		Height:   height,
+		Hash:     hash,
+		Expected: expected,
+	}
+	log.Infof("coin %s, snapshot height %s, pinned block hash %s", pConf.Name, height, hash)
+	return hash, nil
+}
+
+func (r *AddressBalanceValidator) fetchBlockHash(pConf *coin, height string) (hash string, err error) {
+	h, err := strconv.ParseInt(height, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid snapshot height %s, coin:%s", height, pConf.Name)
+	}
+
+	var object interface{}
+	var pattern string
+	if pConf.RPC.Enabled {
+		var request *client.JsonRpcRequest
+		if pConf.Name == "btc" {
+			request, _ = client.RpcClient.MakeJsonRPCRequestParams(1, "getblockhash", []interface{}{h})
+		} else {
+			request, _ = client.RpcClient.MakeJsonRPCRequestParams(1, "eth_getBlockByNumber", []interface{}{fmt.Sprintf("0x%s", strconv.FormatInt(h, 16)), false})
+		}
+		body, err := client.RpcClient.Post(pConf.RPC.Endpoint, request, pConf.RPC.AuthUser, pConf.RPC.AuthPassword, pConf.RPC.CustomHeaders)
+		if err != nil {
+			return "", fmt.Errorf("get block hash from blockchain node failed, coin:%s, height:%s, error:%v", pConf.Name, height, err)
+		}
+		if err = json.Unmarshal(body, &object); err != nil {
+			return "", fmt.Errorf("unmarshall block data from blockchain node failed, coin:%s, height:%s, error:%v", pConf.Name, height, err)
+		}
+		pattern = "$.result.hash"
+		if pConf.Name == "btc" {
+			pattern = "$.result"
+		}
+	} else {
+		endpoint := pConf.API.BlockEndpoint
+		args := map[string]string{"chainShortName": pConf.Coin, "height": height}
+		body, err := client.HttpClient.Get(client.HttpClient.MakeGetURL(endpoint, args), pConf.API.CustomHeaders)
+		if err != nil {
+			return "", fmt.Errorf("get block hash from api %s failed, coin:%s, height:%s, error:%v", endpoint, pConf.Name, height, err)
+		}
+		if err = json.Unmarshal(body, &object); err != nil {
+			return "", fmt.Errorf("unmarshall block data from api %s failed, coin:%s, height:%s, error:%v", endpoint, pConf.Name, height, err)
+		}
+		pattern = "$.data[0].hash"
+	}
+
+	res, err := jsonpath.JsonPathLookup(object, pattern)
+	if err != nil || res == nil {
+		return "", fmt.Errorf("block %s not found, coin:%s, the node may not be synced to the snapshot height", height, pConf.Name)
+	}
+	hash, ok := res.(string)
+	if !ok || hash == "" {
+		return "", errors.New(fmt.Sprintf("invalid block hash %v, coin:%s, height:%s", res, pConf.Name, height))
+	}
+	return hash, nil
+}
+
+// blockParam returns the EIP-1898 block parameter for a pinned block hash, falling back to the
+// hex block number when the height is "latest".
+func blockParam(height, hash string) interface{} {
+	if hash != "" {
+		return map[string]interface{}{"blockHash": hash, "requireCanonical": true}
+	}
+	if height == "latest" {
+		return height
+	}
+	h, _ := strconv.ParseInt(height, 10, 64)
+	return fmt.Sprintf("0x%s", strconv.FormatInt(h, 16))
+}
+
+// checkScanTxOutSetBlock makes sure a scantxoutset result was computed at the pinned block.
+// scantxoutset always scans the node tip, so a node that has not been rolled back to the
+// snapshot height would otherwise return the tip balance silently.
+func checkScanTxOutSetBlock(object interface{}, coinName, height, hash string) error {
+	if hash == "" {
+		return nil
+	}
+	bestBlock, err := jsonpath.JsonPathLookup(object, "$.result.bestblock")
+	if err != nil {
+		return fmt.Errorf("scantxoutset result has no bestblock, coin:%s, height:%s", coinName, height)
+	}
+	if s, _ := bestBlock.(string); !isSameBlockHash(s, hash) {
+		tip, _ := jsonpath.JsonPathLookup(object, "$.result.height")
+		return fmt.Errorf("scantxoutset was computed at block %v (height %v), not the snapshot block %s (height %s), coin:%s", bestBlock, tip, hash, height, coinName)
+	}
+	return nil
+}
+
+func blockHashKey(coin, height string) string {
+	return fmt.Sprintf("%s:%s", strings.ToUpper(strings.TrimSpace(coin)), strings.TrimSpace(height))
+}
+
+func isSameBlockHash(a, b string) bool {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	if has0xPrefix(a) {
+		a = a[2:]
+	}
+	if has0xPrefix(b) {
+		b = b[2:]
+	}
+	return strings.EqualFold(a, b)
+}
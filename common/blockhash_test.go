@@ -0,0 +1,165 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/okx/proof-of-reserves/client"
+)
+
+const pinnedHash = "0x6f6c5d8a1cfa4b1ab94a2a3c0bf2cbd5a3c5dbf1b6b5d3ef7a8b0f1b5d6e7a8b"
+
+// newPinningNode serves eth_getBlockByNumber and eth_getBalance, and records the block
+// parameter every eth_getBalance request was made with.
+func newPinningNode(t *testing.T, blockParams *[]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		switch body.Method {
+		case "eth_getBlockByNumber":
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":{"number":"0x13f2c2f","hash":"%s"}}`, pinnedHash)
+		case "eth_getBalance":
+			var param interface{}
+			_ = json.Unmarshal(body.Params[1], &param)
+			*blockParams = append(*blockParams, param)
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":"0xde0b6b3a7640000"}`)
+		default:
+			t.Fatalf("unexpected method %s", body.Method)
+		}
+	}))
+}
+
+func newPinningValidator(t *testing.T, endpoint string) *AddressBalanceValidator {
+	client.RpcClient = client.NewJsonRPCClient()
+	r := &AddressBalanceValidator{}
+	conf := fmt.Sprintf(`{"coins":[{"name":"eth","coin":"eth","rpc":{"endpoint":"%s","jsonPattern":"$.result","enabled":true}}]}`, endpoint)
+	if err := r.loadCoinJSON([]byte(conf)); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestGetBalanceQueriesByPinnedBlockHash(t *testing.T) {
+	var blockParams []interface{}
+	node := newPinningNode(t, &blockParams)
+	defer node.Close()
+	r := newPinningValidator(t, node.URL)
+
+	for i := 0; i < 2; i++ {
+		balance, err := r.GetCoinAddressBalanceInfo(PorCoinKey{Coin: "ETH", Network: "ETH", Address: "0x0cdcdb19a857c2ac24818ca4fdfe38cce071483e"}, "20917295")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance != "1000000000000000000" {
+			t.Fatalf("balance = %s", balance)
+		}
+	}
+	for _, param := range blockParams {
+		m, ok := param.(map[string]interface{})
+		if !ok || m["blockHash"] != pinnedHash || m["requireCanonical"] != true {
+			t.Fatalf("eth_getBalance block parameter = %v, want EIP-1898 block hash", param)
+		}
+	}
+	pins := r.BlockHashPins()
+	if len(pins) != 1 || pins[0].Coin != "ETH" || pins[0].Height != "20917295" || pins[0].Hash != pinnedHash {
+		t.Fatalf("pins = %+v", pins)
+	}
+}
+
+func TestExpectedBlockHashMismatch(t *testing.T) {
+	var blockParams []interface{}
+	node := newPinningNode(t, &blockParams)
+	defer node.Close()
+	r := newPinningValidator(t, node.URL)
+
+	fileName := filepath.Join(t.TempDir(), "block_hash.csv")
+	content := "coin,snapshot height,block hash\nETH,20917295,0x" + fmt.Sprintf("%064x", 1) + "\n"
+	if err := ioutil.WriteFile(fileName, []byte(content), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.LoadExpectedBlockHashes(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetCoinAddressBalanceInfo(PorCoinKey{Coin: "ETH", Network: "ETH", Address: "0x0cdcdb19a857c2ac24818ca4fdfe38cce071483e"}, "20917295"); err == nil {
+		t.Fatal("a node reporting another block hash must fail the query")
+	}
+	if len(blockParams) != 0 {
+		t.Fatal("balance must not be queried from a node on a fork")
+	}
+}
+
+func TestCheckScanTxOutSetBlock(t *testing.T) {
+	object := map[string]interface{}{"result": map[string]interface{}{"bestblock": pinnedHash[2:], "height": 800000.0}}
+	if err := checkScanTxOutSetBlock(object, "btc", "800000", pinnedHash); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkScanTxOutSetBlock(object, "btc", "799999", "0x"+fmt.Sprintf("%064x", 2)); err == nil {
+		t.Fatal("a scan at another block must fail")
+	}
+}
+
+func TestRowBlockParamUsesPinnedHash(t *testing.T) {
+	var blockParams []interface{}
+	node := newPinningNode(t, &blockParams)
+	defer node.Close()
+	r := newPinningValidator(t, node.URL)
+
+	block, err := rowBlockParam(r.EvmRPCEndpoints()["eth"], &CoinData{Coin: "ETH", SnapshotHeight: "20917295"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := block.(map[string]interface{}); !ok || m["blockHash"] != pinnedHash {
+		t.Fatalf("block parameter = %v, want EIP-1898 block hash", block)
+	}
+	if block, _ = rowBlockParam(&EvmRPCEndpoint{Endpoint: node.URL}, &CoinData{Coin: "ETH"}); block != "latest" {
+		t.Fatalf("block parameter = %v, want latest", block)
+	}
+}
+
+func TestAPIWithoutBlockEndpointIsNotPinned(t *testing.T) {
+	r := &AddressBalanceValidator{}
+	conf := `{"coins":[{"name":"eth","coin":"eth","api":{"endpoint":"http://127.0.0.1:1","enabled":true}}]}`
+	if err := r.loadCoinJSON([]byte(conf)); err != nil {
+		t.Fatal(err)
+	}
+	if hash, err := r.PinBlockHash(r.confMap["eth"], "20917295"); hash != "" || err != nil {
+		t.Fatalf("an api coin without blockEndpoint must be queried by height, got %q %v", hash, err)
+	}
+	if len(r.BlockHashPins()) != 0 {
+		t.Fatal("expected no pinned block hash")
+	}
+}
+
+func TestGetCoinAddressChunkBalance(t *testing.T) {
+	var blockParams []interface{}
+	node := newPinningNode(t, &blockParams)
+	defer node.Close()
+	r := newPinningValidator(t, node.URL)
+
+	keys := []PorCoinKey{
+		{Coin: "ETH", Network: "ETH", Address: "0x0cdcdb19a857c2ac24818ca4fdfe38cce071483e"},
+		{Coin: "ETH", Network: "ETH", Address: "0x0cdcdb19a857c2ac24818ca4fdfe38cce071483f"},
+	}
+	chunk, err := r.GetCoinAddressChunkBalance("eth", "20917295", keys, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total, err := r.GetCoinAddressTotalBalance("eth", "20917295", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk.String() != "2000000000000000000" || total != chunk.String() {
+		t.Fatalf("chunk balance = %s, total balance = %s", chunk, total)
+	}
+}
@@ -8,28 +8,66 @@ import (
 	"strings"
 )
 
-// CreateAddressDescriptor generate address descriptor
+// MultisigScript is a bare m-of-n OP_CHECKMULTISIG redeem or witness script.
+type MultisigScript struct {
+	M int
+	N int
+	// PubKeys are the hex public keys in script order
+	PubKeys []string
+}
+
+// Quorum returns the m-of-n policy of the script, e.g. 2-of-3.
+func (s *MultisigScript) Quorum() string {
+	return fmt.Sprintf("%d-of-%d", s.M, s.N)
+}
+
+// ParseMultisigScript parses OP_m <pubkey>... OP_n OP_CHECKMULTISIG, the keys are compressed (33
+// bytes) or uncompressed (65 bytes).
+func ParseMultisigScript(script string) (*MultisigScript, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(script, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid multisig script %s, error:%v", script, err)
+	}
+	// OP_m, at least one key, OP_n and OP_CHECKMULTISIG
+	if len(b) < 37 || b[len(b)-1] != 0xae || !isSmallIntOp(b[0]) || !isSmallIntOp(b[len(b)-2]) {
+		return nil, fmt.Errorf("not a multisig script %s", script)
+	}
+	ms := &MultisigScript{M: int(b[0] - 0x50), N: int(b[len(b)-2] - 0x50)}
+	for keys := b[1 : len(b)-2]; len(keys) > 0; {
+		size := int(keys[0])
+		if (size != 33 && size != 65) || len(keys) < 1+size {
+			return nil, fmt.Errorf("invalid public key push in multisig script %s", script)
+		}
+		ms.PubKeys = append(ms.PubKeys, hex.EncodeToString(keys[1:1+size]))
+		keys = keys[1+size:]
+	}
+	if len(ms.PubKeys) != ms.N || ms.M > ms.N {
+		return nil, fmt.Errorf("multisig script %s is %d-of-%d with %d public keys", script, ms.M, ms.N, len(ms.PubKeys))
+	}
+	return ms, nil
+}
+
+// isSmallIntOp reports whether op is OP_1 to OP_16.
+func isSmallIntOp(op byte) bool {
+	return op >= 0x51 && op <= 0x60
+}
+
+// CreateAddressDescriptor generate address descriptor, mSigns and nKeys must match the m-of-n of
+// a multisig redeemScript
 // https://github.com/bitcoin/bitcoin/blob/master/doc/descriptors.md
 func CreateAddressDescriptor(addrType, redeemScript string, mSigns, nKeys int) (descriptor string, err error) {
-	var orderedPubKeys []string
-	var pubKeyLen int
-	pubKeyLen = 33 * 2
 	if addrType == "P2PKH" {
-		orderedPubKeys = append(orderedPubKeys, redeemScript)
-	} else {
-		redeemScript = redeemScript[2:]
-		for i := 0; i < nKeys; i++ {
-			pubKey := redeemScript[2 : 2+pubKeyLen]
-			orderedPubKeys = append(orderedPubKeys, pubKey)
-			redeemScript = redeemScript[2+pubKeyLen:]
-		}
+		return fmt.Sprintf("pkh(%s)", redeemScript), nil
 	}
-	orderedPubKeysJoin := strings.Join(orderedPubKeys, ",")
+	ms, err := ParseMultisigScript(redeemScript)
+	if err != nil {
+		return "", err
+	}
+	if ms.M != mSigns || ms.N != nKeys {
+		return "", fmt.Errorf("redeem script is %s, not %d-of-%d", ms.Quorum(), mSigns, nKeys)
+	}
+	orderedPubKeysJoin := strings.Join(ms.PubKeys, ",")
 	switch addrType {
-	case "P2PKH":
-		descriptor = fmt.Sprintf("pkh(%s)", orderedPubKeysJoin)
-	case "P2SH":
-		descriptor = fmt.Sprintf("sh(multi(%d,%s))", mSigns, orderedPubKeysJoin)
 	case "P2WSH":
 		descriptor = fmt.Sprintf("wsh(multi(%d,%s))", mSigns, orderedPubKeysJoin)
 	default:
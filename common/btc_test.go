@@ -1,6 +1,17 @@
 package common
 
-import "testing"
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secp_ecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/martinboehm/btcutil"
+)
 
 func TestCreateAddressDescriptor(t *testing.T) {
 	args := []struct {
@@ -46,3 +57,85 @@ func TestCreateAddressDescriptor(t *testing.T) {
 		}
 	}
 }
+
+func TestCreateAddressDescriptorQuorum(t *testing.T) {
+	script := multisigScript(1, testPrivKeys(2)...)
+	descriptor, err := CreateAddressDescriptor("P2WSH", script, 1, 2)
+	if err != nil || !strings.HasPrefix(descriptor, "wsh(multi(1,") {
+		t.Fatalf("unexpected 1-of-2 descriptor %s, %v", descriptor, err)
+	}
+	if _, err = CreateAddressDescriptor("P2WSH", script, 2, 3); err == nil {
+		t.Fatalf("expected a 1-of-2 script to fail as 2-of-3")
+	}
+}
+
+func TestParseMultisigScript(t *testing.T) {
+	ms, err := ParseMultisigScript("52210251c789f59bc870ae263db2fac71c1625bb16bff840eee169420bcba14443f20b210343f2d97938abfcf8201adf46ce50cf7119bb419684268c145902ef5cb7c3e76321027d8ddf369f5dbd880f6e8e04a74b728454445704d844c9042bc43bdc9cea3f6e53ae")
+	if err != nil || ms.Quorum() != "2-of-3" || ms.PubKeys[1] != "0343f2d97938abfcf8201adf46ce50cf7119bb419684268c145902ef5cb7c3e763" {
+		t.Fatalf("unexpected multisig script %+v, %v", ms, err)
+	}
+	for _, script := range []string{"", "zz", "51ae", "5121020000ae", "5221" + strings.Repeat("02", 33) + "52ae", "76a914" + strings.Repeat("00", 20) + "88ac"} {
+		if _, err = ParseMultisigScript(script); err == nil {
+			t.Errorf("expected script %s to fail", script)
+		}
+	}
+}
+
+func TestVerifyUtxoCoinQuorum(t *testing.T) {
+	const msg = "I am an OKX address"
+	keys := testPrivKeys(4)
+	sign := func(key *secp256k1.PrivateKey) string {
+		sig := secp_ecdsa.SignCompact(key, HashUtxoCoinTypeMsg(PorCoinMessageSignatureHeaderMap["BTC"], msg), true)
+		return base64.StdEncoding.EncodeToString(sig)
+	}
+	p2sh := func(script string) string {
+		addr, _ := btcutil.NewAddressScriptHash(MustDecode(script), GetBTCMainNetParams())
+		return addr.EncodeAddress()
+	}
+	p2wsh := func(script string) string {
+		h := sha256.Sum256(MustDecode(script))
+		addr, _ := btcutil.NewAddressWitnessScriptHash(h[:], GetBTCMainNetParams())
+		return addr.EncodeAddress()
+	}
+	twoOfFour, oneOfTwo, threeOfThree, twoOfThree := multisigScript(2, keys...), multisigScript(1, keys[:2]...), multisigScript(3, keys[:3]...), multisigScript(2, keys[:3]...)
+	tests := []struct {
+		name         string
+		addr         string
+		sign1, sign2 string
+		script       string
+		quorum       string
+		reason       string
+	}{
+		{"2-of-4 P2WSH", p2wsh(twoOfFour), sign(keys[0]), sign(keys[3]), twoOfFour, "2-of-4", ""},
+		{"1-of-2 P2SH", p2sh(oneOfTwo), sign(keys[1]), "", oneOfTwo, "1-of-2", ""},
+		{"3-of-3 with two signatures", p2sh(threeOfThree), sign(keys[0]), sign(keys[1]), threeOfThree, "3-of-3", ReasonBelowThreshold},
+		{"2-of-3 signed twice by one key", p2wsh(twoOfThree), sign(keys[2]), sign(keys[2]), twoOfThree, "2-of-3", ReasonBelowThreshold},
+		{"signer outside the script", p2sh(twoOfThree), sign(keys[0]), sign(keys[3]), twoOfThree, "2-of-3", ReasonAddressMismatch},
+	}
+	for _, test := range tests {
+		quorum, err := VerifyUtxoCoinQuorum("BTC", test.addr, msg, test.sign1, test.sign2, test.script)
+		if quorum != test.quorum || (err == nil) != (test.reason == "") || (err != nil && FailureReason(err) != test.reason) {
+			t.Errorf("%s: expected %s %q, got %s %q (%v)", test.name, test.quorum, test.reason, quorum, FailureReason(err), err)
+		}
+	}
+}
+
+// testPrivKeys returns n deterministic keys, 0x01..01, 0x02..02 and so on.
+func testPrivKeys(n int) []*secp256k1.PrivateKey {
+	keys := make([]*secp256k1.PrivateKey, n)
+	for i := range keys {
+		keys[i] = secp256k1.PrivKeyFromBytes(bytes.Repeat([]byte{byte(i + 1)}, 32))
+	}
+	return keys
+}
+
+// multisigScript returns the hex OP_m <keys> OP_n OP_CHECKMULTISIG script of compressed keys.
+func multisigScript(m int, keys ...*secp256k1.PrivateKey) string {
+	script := []byte{byte(0x50 + m)}
+	for _, key := range keys {
+		script = append(script, 33)
+		script = append(script, key.PubKey().SerializeCompressed()...)
+	}
+	script = append(script, byte(0x50+len(keys)), 0xae)
+	return hex.EncodeToString(script)
+}
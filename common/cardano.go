@@ -0,0 +1,534 @@
+package common
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+)
+
+// Shelley address types, the high nibble of the header byte.
+const (
+	cardanoBaseKeyKey        = 0
+	cardanoBaseScriptKey     = 1
+	cardanoBaseKeyScript     = 2
+	cardanoBaseScriptScript  = 3
+	cardanoPointerKey        = 4
+	cardanoPointerScript     = 5
+	cardanoEnterpriseKey     = 6
+	cardanoEnterpriseScript  = 7
+	cardanoRewardKey         = 14
+	cardanoRewardScript      = 15
+	cardanoCredentialHashLen = 28
+)
+
+// CardanoAddress is a decoded Shelley address: the payment credential and, for base and reward
+// addresses, the stake credential, each a key hash or a script hash.
+type CardanoAddress struct {
+	Raw           []byte
+	Type          byte
+	Payment       []byte
+	PaymentScript bool
+	Stake         []byte
+	StakeScript   bool
+}
+
+// DecodeCardanoAddress decodes a bech32 Shelley address, addr1... or stake1.... Byron addresses
+// are not supported.
+func DecodeCardanoAddress(addr string) (*CardanoAddress, error) {
+	hrp, data, err := bech32.DecodeNoLimit(addr)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(hrp, "addr") && !strings.HasPrefix(hrp, "stake") {
+		return nil, fmt.Errorf("unexpected cardano address prefix %s", hrp)
+	}
+	raw, err := bech32.ConvertBits(data, 5, 8, false)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCardanoAddress(raw)
+}
+
+// ParseCardanoAddress reads the credentials of the raw bytes of a Shelley address.
+func ParseCardanoAddress(raw []byte) (*CardanoAddress, error) {
+	if len(raw) < 1+cardanoCredentialHashLen {
+		return nil, fmt.Errorf("cardano address of %d bytes is too short", len(raw))
+	}
+	a := &CardanoAddress{Raw: raw, Type: raw[0] >> 4}
+	first := raw[1 : 1+cardanoCredentialHashLen]
+	switch a.Type {
+	case cardanoBaseKeyKey, cardanoBaseScriptKey, cardanoBaseKeyScript, cardanoBaseScriptScript:
+		if len(raw) != 1+2*cardanoCredentialHashLen {
+			return nil, fmt.Errorf("cardano base address of %d bytes", len(raw))
+		}
+		a.Payment, a.PaymentScript = first, a.Type&1 == 1
+		a.Stake, a.StakeScript = raw[1+cardanoCredentialHashLen:], a.Type&2 == 2
+	case cardanoPointerKey, cardanoPointerScript, cardanoEnterpriseKey, cardanoEnterpriseScript:
+		if a.Type >= cardanoEnterpriseKey && len(raw) != 1+cardanoCredentialHashLen {
+			return nil, fmt.Errorf("cardano enterprise address of %d bytes", len(raw))
+		}
+		a.Payment, a.PaymentScript = first, a.Type&1 == 1
+	case cardanoRewardKey, cardanoRewardScript:
+		if len(raw) != 1+cardanoCredentialHashLen {
+			return nil, fmt.Errorf("cardano reward address of %d bytes", len(raw))
+		}
+		a.Stake, a.StakeScript = first, a.Type == cardanoRewardScript
+	default:
+		return nil, fmt.Errorf("unsupported cardano address type %d", a.Type)
+	}
+	return a, nil
+}
+
+// Script reports whether the address is controlled by a script, the payment credential of a
+// payment address or the stake credential of a reward address.
+func (a *CardanoAddress) Script() bool {
+	if a.Payment == nil {
+		return a.StakeScript
+	}
+	return a.PaymentScript
+}
+
+// credential returns the credential that signs for the address: the payment credential, or
+// the stake credential of a reward address.
+func (a *CardanoAddress) credential() []byte {
+	if a.Payment == nil {
+		return a.Stake
+	}
+	return a.Payment
+}
+
+// verifyCardanoAddressKey checks that the public key hashes to the key credential of the address.
+func verifyCardanoAddressKey(addr string, pub []byte) error {
+	a, err := DecodeCardanoAddress(addr)
+	if err != nil {
+		return withReason(ReasonUndecodableAddress, fmt.Errorf("invalid cardano address %s: %v", addr, err))
+	}
+	if a.Script() {
+		return withReason(ReasonMissingScript, fmt.Errorf("cardano address %s is a script address, its native script is needed", addr))
+	}
+	if !bytes.Equal(calculateBlake2b224(pub), a.credential()) {
+		return withReason(ReasonAddressMismatch, fmt.Errorf("public key %x is not the key credential of %s", pub, addr))
+	}
+	return nil
+}
+
+// COSE labels of CIP-8 message signing.
+const (
+	coseHeaderAlg = 1
+	coseAlgEdDSA  = -8
+	coseKeyX      = -2
+	coseSign1Tag  = 18
+	// CIP-8 headers
+	cip8HeaderAddress = "address"
+	cip8HeaderHashed  = "hashed"
+)
+
+// CoseSign1 is a COSE_Sign1 message, the signature of CIP-30 signData.
+type CoseSign1 struct {
+	// Protected is the serialized protected header map, as signed
+	Protected   []byte
+	Headers     cborMapValue
+	Unprotected cborMapValue
+	// Payload is nil for a detached payload
+	Payload   []byte
+	Signature []byte
+}
+
+// ParseCoseSign1 decodes a COSE_Sign1 message, tagged or not.
+func ParseCoseSign1(b []byte) (*CoseSign1, error) {
+	v, err := decodeCBOR(b)
+	if err != nil {
+		return nil, err
+	}
+	if tag, ok := v.(cborTagValue); ok && tag.Tag == coseSign1Tag {
+		v = tag.Value
+	}
+	items, ok := v.([]interface{})
+	if !ok || len(items) != 4 {
+		return nil, errors.New("COSE_Sign1 is not an array of 4 items")
+	}
+	s := &CoseSign1{}
+	if s.Protected, ok = items[0].([]byte); !ok {
+		return nil, errors.New("COSE_Sign1 protected header is not a byte string")
+	}
+	if len(s.Protected) > 0 {
+		headers, err := decodeCBOR(s.Protected)
+		if err != nil {
+			return nil, fmt.Errorf("COSE_Sign1 protected header: %v", err)
+		}
+		if s.Headers, ok = headers.(cborMapValue); !ok {
+			return nil, errors.New("COSE_Sign1 protected header is not a map")
+		}
+	}
+	if s.Unprotected, ok = items[1].(cborMapValue); !ok {
+		return nil, errors.New("COSE_Sign1 unprotected header is not a map")
+	}
+	if items[2] != nil {
+		if s.Payload, ok = items[2].([]byte); !ok {
+			return nil, errors.New("COSE_Sign1 payload is not a byte string")
+		}
+	}
+	if s.Signature, ok = items[3].([]byte); !ok || len(s.Signature) != ed25519.SignatureSize {
+		return nil, errors.New("COSE_Sign1 signature is not an ed25519 signature")
+	}
+	return s, nil
+}
+
+// Address returns the raw address of the CIP-8 address header, nil without it.
+func (s *CoseSign1) Address() []byte {
+	addr, _ := s.Headers.get(cip8HeaderAddress)
+	b, _ := addr.([]byte)
+	return b
+}
+
+// Hashed reports whether the payload is the blake2b-224 hash of the message.
+func (s *CoseSign1) Hashed() bool {
+	hashed, _ := s.Unprotected.get(cip8HeaderHashed)
+	b, _ := hashed.(bool)
+	return b
+}
+
+// SigStructure returns the Sig_structure the signature signs,
+// ["Signature1", protected, external_aad, payload].
+func (s *CoseSign1) SigStructure(payload []byte) []byte {
+	b := appendCBORHead(nil, cborArray, 4)
+	b = appendCBORText(b, "Signature1")
+	b = appendCBORBytes(b, s.Protected)
+	b = appendCBORBytes(b, nil)
+	return appendCBORBytes(b, payload)
+}
+
+// ParseCoseKey returns the ed25519 public key of a COSE_Key, or of 32 raw bytes.
+func ParseCoseKey(b []byte) (ed25519.PublicKey, error) {
+	if len(b) == ed25519.PublicKeySize {
+		return b, nil
+	}
+	v, err := decodeCBOR(b)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := v.(cborMapValue)
+	if !ok {
+		return nil, errors.New("COSE_Key is not a map")
+	}
+	x, _ := key.get(coseKeyX)
+	pub, ok := x.([]byte)
+	if !ok || len(pub) != ed25519.PublicKeySize {
+		return nil, errors.New("COSE_Key has no ed25519 public key")
+	}
+	return pub, nil
+}
+
+// CardanoDataSignature is the result of CIP-30 signData, a COSE_Sign1 and a COSE_Key in hex.
+type CardanoDataSignature struct {
+	Signature string `json:"signature"`
+	Key       string `json:"key"`
+}
+
+// VerifyCardanoDataSignature verifies a COSE_Sign1 of the message with the key and returns the
+// address of its CIP-8 address header, nil without it.
+func VerifyCardanoDataSignature(msg string, sig CardanoDataSignature) (ed25519.PublicKey, []byte, error) {
+	raw, err := Decode(sig.Signature)
+	if err != nil {
+		return nil, nil, withReason(ReasonBadSignature, fmt.Errorf("invalid COSE_Sign1: %v", err))
+	}
+	sign1, err := ParseCoseSign1(raw)
+	if err != nil {
+		return nil, nil, withReason(ReasonBadSignature, err)
+	}
+	key, err := Decode(sig.Key)
+	if err != nil {
+		return nil, nil, withReason(ReasonMissingScript, fmt.Errorf("invalid COSE_Key: %v", err))
+	}
+	pub, err := ParseCoseKey(key)
+	if err != nil {
+		return nil, nil, withReason(ReasonMissingScript, err)
+	}
+	if alg, ok := sign1.Headers.get(coseHeaderAlg); ok && alg != int64(coseAlgEdDSA) {
+		return nil, nil, withReason(ReasonBadSignature, fmt.Errorf("COSE_Sign1 algorithm %v is not EdDSA", alg))
+	}
+	payload, signed := []byte(msg), []byte(msg)
+	if sign1.Hashed() {
+		signed = calculateBlake2b224(payload)
+	}
+	if sign1.Payload != nil {
+		if !bytes.Equal(sign1.Payload, signed) {
+			return nil, nil, withReason(ReasonMessageMismatch, fmt.Errorf("COSE_Sign1 payload %q is not the message %q", sign1.Payload, msg))
+		}
+	}
+	if !ed25519.Verify(pub, sign1.SigStructure(signed), sign1.Signature) {
+		return nil, nil, errors.New("COSE_Sign1 signature verification failed")
+	}
+	return pub, sign1.Address(), nil
+}
+
+// parseCardanoDataSignatures reads the CIP-30 signatures of a signature column, an object or an
+// array of them, or a COSE_Sign1 in hex whose key is the public key column.
+func parseCardanoDataSignatures(sign, publicKey string) ([]CardanoDataSignature, error) {
+	sign = strings.TrimSpace(sign)
+	switch {
+	case strings.HasPrefix(sign, "{"):
+		var sig CardanoDataSignature
+		if err := json.Unmarshal([]byte(sign), &sig); err != nil {
+			return nil, fmt.Errorf("invalid CIP-30 signature: %v", err)
+		}
+		if sig.Key == "" {
+			sig.Key = publicKey
+		}
+		return []CardanoDataSignature{sig}, nil
+	case strings.HasPrefix(sign, "["):
+		var sigs []CardanoDataSignature
+		if err := json.Unmarshal([]byte(sign), &sigs); err != nil {
+			return nil, fmt.Errorf("invalid CIP-30 signatures: %v", err)
+		}
+		return sigs, nil
+	}
+	return []CardanoDataSignature{{Signature: sign, Key: publicKey}}, nil
+}
+
+// isCoseSign1 reports whether the signature column holds CIP-30 signatures rather than an
+// ed25519 signature: json, or CBOR of a COSE_Sign1 array or tag.
+func isCoseSign1(sign string) bool {
+	sign = strings.TrimSpace(sign)
+	if strings.HasPrefix(sign, "{") || strings.HasPrefix(sign, "[") {
+		return true
+	}
+	b, err := Decode(sign)
+	return err == nil && len(b) > ed25519.SignatureSize && (b[0] == 0x84 || b[0] == 0xd2)
+}
+
+// NativeScript is a Cardano native (multisig) script.
+type NativeScript struct {
+	Type     int64
+	KeyHash  []byte
+	Required int
+	Scripts  []*NativeScript
+}
+
+// Native script types.
+const (
+	nativeScriptPubkey = iota
+	nativeScriptAll
+	nativeScriptAny
+	nativeScriptNofK
+	nativeScriptInvalidBefore
+	nativeScriptInvalidHereafter
+)
+
+// ParseNativeScript decodes the CBOR of a native script.
+func ParseNativeScript(b []byte) (*NativeScript, error) {
+	v, err := decodeCBOR(b)
+	if err != nil {
+		return nil, err
+	}
+	return nativeScript(v)
+}
+
+func nativeScript(v interface{}) (*NativeScript, error) {
+	items, ok := v.([]interface{})
+	if !ok || len(items) < 2 {
+		return nil, errors.New("native script is not an array")
+	}
+	s := &NativeScript{}
+	if s.Type, ok = items[0].(int64); !ok {
+		return nil, errors.New("native script type is not an integer")
+	}
+	scripts := func(v interface{}) error {
+		list, ok := v.([]interface{})
+		if !ok {
+			return errors.New("native script list is not an array")
+		}
+		for _, item := range list {
+			script, err := nativeScript(item)
+			if err != nil {
+				return err
+			}
+			s.Scripts = append(s.Scripts, script)
+		}
+		return nil
+	}
+	switch s.Type {
+	case nativeScriptPubkey:
+		if s.KeyHash, ok = items[1].([]byte); !ok || len(s.KeyHash) != cardanoCredentialHashLen {
+			return nil, errors.New("native script key hash is not 28 bytes")
+		}
+	case nativeScriptAll, nativeScriptAny:
+		if err := scripts(items[1]); err != nil {
+			return nil, err
+		}
+	case nativeScriptNofK:
+		required, ok := items[1].(int64)
+		if !ok || len(items) != 3 || required < 0 {
+			return nil, errors.New("invalid native script n of k")
+		}
+		s.Required = int(required)
+		if err := scripts(items[2]); err != nil {
+			return nil, err
+		}
+	case nativeScriptInvalidBefore, nativeScriptInvalidHereafter:
+	default:
+		return nil, fmt.Errorf("unknown native script type %d", s.Type)
+	}
+	return s, nil
+}
+
+// NativeScriptHash returns the script hash of the CBOR of a native script, blake2b-224 of the
+// native script tag 0 and the script.
+func NativeScriptHash(script []byte) []byte {
+	return calculateBlake2b224([]byte{0}, script)
+}
+
+// Satisfied reports whether the key hashes that signed satisfy the script. Time locks do not bound
+// the control of the keys and are satisfied.
+func (s *NativeScript) Satisfied(signed map[string]bool) bool {
+	count := 0
+	for _, script := range s.Scripts {
+		if script.Satisfied(signed) {
+			count++
+		}
+	}
+	switch s.Type {
+	case nativeScriptPubkey:
+		return signed[hex.EncodeToString(s.KeyHash)]
+	case nativeScriptAll:
+		return count == len(s.Scripts)
+	case nativeScriptAny:
+		return count > 0
+	case nativeScriptNofK:
+		return count >= s.Required
+	}
+	return true
+}
+
+// Quorum returns the m-of-n policy of the script: the fewest keys that satisfy it of its
+// distinct keys.
+func (s *NativeScript) Quorum() string {
+	keys := make(map[string]bool)
+	var collect func(*NativeScript)
+	collect = func(s *NativeScript) {
+		if s.Type == nativeScriptPubkey {
+			keys[hex.EncodeToString(s.KeyHash)] = true
+		}
+		for _, script := range s.Scripts {
+			collect(script)
+		}
+	}
+	collect(s)
+	return fmt.Sprintf("%d-of-%d", s.requiredKeys(), len(keys))
+}
+
+// requiredKeys returns the fewest signatures that satisfy the script.
+func (s *NativeScript) requiredKeys() int {
+	required := make([]int, 0, len(s.Scripts))
+	for _, script := range s.Scripts {
+		required = append(required, script.requiredKeys())
+	}
+	sort.Ints(required)
+	sum := func(n int) int {
+		total := 0
+		for i := 0; i < n && i < len(required); i++ {
+			total += required[i]
+		}
+		return total
+	}
+	switch s.Type {
+	case nativeScriptPubkey:
+		return 1
+	case nativeScriptAll:
+		return sum(len(required))
+	case nativeScriptAny:
+		return sum(1)
+	case nativeScriptNofK:
+		return sum(s.Required)
+	}
+	return 0
+}
+
+// verifyCardanoRow verifies an ADA row by the format of its signature: an ed25519 signature of the
+// PoR message, or CIP-30 signData. A script address holds its native script in the public key
+// column and is signed by the keys of the script in signature1 and signature2, whose CIP-30
+// signatures carry their keys.
+func verifyCardanoRow(row *CoinData) *SignatureResult {
+	result := &SignatureResult{Address: row.Address, Signer: SignerAddress}
+	if !isCoseSign1(row.Sign1) {
+		result.Err = VerifyEd25519Coin(row.Coin, row.Address, row.Message, row.Sign1, row.Script)
+		return result
+	}
+	result.Verifier = "+cip30"
+	addr, err := DecodeCardanoAddress(row.Address)
+	if err != nil {
+		result.Err = withReason(ReasonUndecodableAddress, fmt.Errorf("invalid cardano address %s: %v", row.Address, err))
+		return result
+	}
+	var script *NativeScript
+	publicKey := row.Script
+	if addr.Script() {
+		result.Verifier = "+native script"
+		if script, err = verifyNativeScript(addr, row.Script); err != nil {
+			result.Err = err
+			return result
+		}
+		result.Quorum, publicKey = script.Quorum(), ""
+	}
+	signed := make(map[string]bool)
+	for _, sign := range []string{row.Sign1, row.Sign2} {
+		if sign == "" {
+			continue
+		}
+		sigs, err := parseCardanoDataSignatures(sign, publicKey)
+		if err != nil {
+			result.Err = withReason(ReasonBadSignature, err)
+			return result
+		}
+		for _, sig := range sigs {
+			pub, signedAddr, err := VerifyCardanoDataSignature(row.Message, sig)
+			if err != nil {
+				result.Err = fmt.Errorf("%w, coin:%s, addr:%s", err, row.Coin, row.Address)
+				return result
+			}
+			if signedAddr != nil && !bytes.Equal(signedAddr, addr.Raw) {
+				result.Err = withReason(ReasonAddressMismatch, fmt.Errorf("CIP-8 address header %x is not the address %s", signedAddr, row.Address))
+				return result
+			}
+			signed[hex.EncodeToString(calculateBlake2b224(pub))] = true
+			if script == nil {
+				result.Err = verifyCardanoAddressKey(row.Address, pub)
+				return result
+			}
+		}
+	}
+	if len(signed) == 0 {
+		result.Err = withReason(ReasonBadSignature, fmt.Errorf("no CIP-30 signature to verify, coin:%s, addr:%s", row.Coin, row.Address))
+		return result
+	}
+	if script != nil && !script.Satisfied(signed) {
+		result.Err = withReason(ReasonBelowThreshold, fmt.Errorf("%d keys do not satisfy the %s native script of %s", len(signed), result.Quorum, row.Address))
+	}
+	return result
+}
+
+// verifyNativeScript decodes the native script of a script address and checks its hash.
+func verifyNativeScript(addr *CardanoAddress, scriptHex string) (*NativeScript, error) {
+	if scriptHex == "" {
+		return nil, withReason(ReasonMissingScript, errors.New("cardano script address needs its native script"))
+	}
+	raw, err := Decode(scriptHex)
+	if err != nil {
+		return nil, withReason(ReasonMissingScript, fmt.Errorf("invalid native script: %v", err))
+	}
+	script, err := ParseNativeScript(raw)
+	if err != nil {
+		return nil, withReason(ReasonMissingScript, fmt.Errorf("invalid native script: %v", err))
+	}
+	if !bytes.Equal(NativeScriptHash(raw), addr.credential()) {
+		return nil, withReason(ReasonMissingScript, fmt.Errorf("native script hash %x is not the script credential %x", NativeScriptHash(raw), addr.credential()))
+	}
+	return script, nil
+}
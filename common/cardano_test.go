@@ -0,0 +1,207 @@
+package common
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	// {1: -8, "address": h'01', "hashed": [true, null, 24(h'')]}
+	v, err := decodeCBOR(MustDecode("a30127676164647265737341016668617368656483f5f6d81840"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := v.(cborMapValue)
+	if !ok || len(m) != 3 {
+		t.Fatalf("unexpected map %v", v)
+	}
+	if alg, _ := m.get(1); alg != int64(-8) {
+		t.Fatalf("unexpected alg %v", alg)
+	}
+	if addr, _ := m.get("address"); !bytes.Equal(addr.([]byte), []byte{1}) {
+		t.Fatalf("unexpected address %v", addr)
+	}
+	if list, _ := m.get("hashed"); len(list.([]interface{})) != 3 || list.([]interface{})[0] != true || list.([]interface{})[1] != nil {
+		t.Fatalf("unexpected list %v", list)
+	}
+	for _, b := range []string{"", "a1", "5820", "8201", "820102ff", "9f01ff", "1b8000000000000000"} {
+		if _, err = decodeCBOR(MustDecode("0x" + b)); err == nil {
+			t.Errorf("expected %q to fail", b)
+		}
+	}
+	if b := appendCBORHead(nil, cborBytes, 1<<32); hex.EncodeToString(b) != "5b0000000100000000" {
+		t.Fatalf("unexpected head %x", b)
+	}
+}
+
+// cardanoAddress encodes a Shelley address of the header and credentials.
+func cardanoAddress(header byte, credentials ...[]byte) string {
+	raw := []byte{header}
+	for _, c := range credentials {
+		raw = append(raw, c...)
+	}
+	hrp := "addr"
+	if header>>4 >= cardanoRewardKey {
+		hrp = "stake"
+	}
+	addr, _ := encodeBech32(hrp, raw)
+	return addr
+}
+
+// cip30Sign signs the message as CIP-30 signData does for the address.
+func cip30Sign(key ed25519.PrivateKey, addr, msg string, hashed, detached bool) CardanoDataSignature {
+	protected := appendCBORHead(nil, cborMap, 2)
+	protected = appendCBORHead(protected, cborUint, coseHeaderAlg)
+	protected = appendCBORHead(protected, cborNegint, -1-coseAlgEdDSA)
+	protected = appendCBORText(protected, cip8HeaderAddress)
+	a, _ := DecodeCardanoAddress(addr)
+	protected = appendCBORBytes(protected, a.Raw)
+
+	payload := []byte(msg)
+	if hashed {
+		payload = calculateBlake2b224(payload)
+	}
+	sign1 := &CoseSign1{Protected: protected}
+	signature := ed25519.Sign(key, sign1.SigStructure(payload))
+
+	b := appendCBORHead(nil, cborArray, 4)
+	b = appendCBORBytes(b, protected)
+	b = appendCBORHead(b, cborMap, 1)
+	b = appendCBORText(b, cip8HeaderHashed)
+	b = append(b, 0xf4)
+	if hashed {
+		b[len(b)-1] = 0xf5
+	}
+	if detached {
+		b = append(b, 0xf6)
+	} else {
+		b = appendCBORBytes(b, payload)
+	}
+	b = appendCBORBytes(b, signature)
+
+	// COSE_Key {1: 1, 3: -8, -1: 6, -2: x}
+	coseKey := append(MustDecode("0xa40101032720062158"), 32)
+	return CardanoDataSignature{Signature: hex.EncodeToString(b), Key: hex.EncodeToString(append(coseKey, key.Public().(ed25519.PublicKey)...))}
+}
+
+func cardanoTestKey(seed byte) (ed25519.PrivateKey, []byte) {
+	key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, 32))
+	return key, calculateBlake2b224(key.Public().(ed25519.PublicKey))
+}
+
+func TestVerifyCardanoRow(t *testing.T) {
+	key, keyHash := cardanoTestKey(1)
+	stakeKey, stakeHash := cardanoTestKey(2)
+	_, otherHash := cardanoTestKey(3)
+	enterprise := cardanoAddress(0x61, keyHash)
+	base := cardanoAddress(0x01, keyHash, stakeHash)
+	baseScriptStake := cardanoAddress(0x21, keyHash, otherHash)
+	reward := cardanoAddress(0xe1, stakeHash)
+	other := cardanoAddress(0x01, otherHash, stakeHash)
+
+	if s := (&CoseSign1{}).SigStructure(nil); !bytes.HasPrefix(s, MustDecode("0x846a5369676e61747572653140")) {
+		t.Fatalf("unexpected Sig_structure %x", s)
+	}
+	jsonSign := func(sig CardanoDataSignature) string {
+		b, _ := json.Marshal(sig)
+		return string(b)
+	}
+	pub := hex.EncodeToString(key.Public().(ed25519.PublicKey))
+	legacy := Encode(ed25519.Sign(key, HashEd25519Msg(OKXMessageSignatureHeader, okxTestMessage)))
+	coseOnly := cip30Sign(key, base, okxTestMessage, false, false)
+
+	tests := []struct {
+		name, addr, sign, script string
+		verifier, reason         string
+	}{
+		{"legacy enterprise", enterprise, legacy, pub, "", ""},
+		{"legacy base", base, legacy, pub, "", ""},
+		{"legacy other payment key", other, legacy, pub, "", ReasonAddressMismatch},
+		{"cip30 base", base, jsonSign(cip30Sign(key, base, okxTestMessage, false, false)), "", "+cip30", ""},
+		{"cip30 base with script stake", baseScriptStake, jsonSign(cip30Sign(key, baseScriptStake, okxTestMessage, false, false)), "", "+cip30", ""},
+		{"cip30 hashed", enterprise, jsonSign(cip30Sign(key, enterprise, okxTestMessage, true, false)), "", "+cip30", ""},
+		{"cip30 detached", enterprise, jsonSign(cip30Sign(key, enterprise, okxTestMessage, false, true)), "", "+cip30", ""},
+		{"cip30 reward", reward, jsonSign(cip30Sign(stakeKey, reward, okxTestMessage, false, false)), "", "+cip30", ""},
+		{"cose hex and key column", base, coseOnly.Signature, coseOnly.Key, "+cip30", ""},
+		{"cose hex and public key column", base, coseOnly.Signature, pub, "+cip30", ""},
+		{"other message", base, jsonSign(cip30Sign(key, base, "OKC_DTT_AUP2024", false, false)), "", "+cip30", ReasonMessageMismatch},
+		{"signed for another address", other, jsonSign(cip30Sign(key, base, okxTestMessage, false, false)), "", "+cip30", ReasonAddressMismatch},
+		{"key of another address", other, jsonSign(cip30Sign(key, other, okxTestMessage, false, false)), "", "+cip30", ReasonAddressMismatch},
+		{"stake key of a base address", base, jsonSign(cip30Sign(stakeKey, base, okxTestMessage, false, false)), "", "+cip30", ReasonAddressMismatch},
+		{"empty cip30 array", base, "[]", "", "+cip30", ReasonBadSignature},
+	}
+	for _, test := range tests {
+		row := &CoinData{Coin: "ADA", Address: test.addr, Message: okxTestMessage, Sign1: test.sign, Script: test.script}
+		result := VerifyRowSignature(row)
+		if result.Reason() != test.reason || result.Verifier != Ed25519CoinType+test.verifier {
+			t.Errorf("%s: expected %q %q, got %q %q (%v)", test.name, test.verifier, test.reason, result.Verifier, result.Reason(), result.Err)
+		}
+	}
+}
+
+func TestVerifyCardanoNativeScript(t *testing.T) {
+	keys := make([]ed25519.PrivateKey, 3)
+	script := appendCBORHead(nil, cborArray, 2)
+	script = appendCBORHead(script, cborUint, nativeScriptAll)
+	script = appendCBORHead(script, cborArray, 2)
+	// a 2-of-3 of the keys, and a time lock
+	script = appendCBORHead(script, cborArray, 3)
+	script = appendCBORHead(script, cborUint, nativeScriptNofK)
+	script = appendCBORHead(script, cborUint, 2)
+	script = appendCBORHead(script, cborArray, 3)
+	for i := range keys {
+		var keyHash []byte
+		keys[i], keyHash = cardanoTestKey(byte(10 + i))
+		script = appendCBORHead(script, cborArray, 2)
+		script = appendCBORHead(script, cborUint, nativeScriptPubkey)
+		script = appendCBORBytes(script, keyHash)
+	}
+	script = append(script, MustDecode("0x82051a05f5e100")...)
+	_, stakeHash := cardanoTestKey(2)
+	addr := cardanoAddress(0x11, NativeScriptHash(script), stakeHash)
+
+	parsed, err := ParseNativeScript(script)
+	if err != nil || parsed.Quorum() != "2-of-3" || parsed.Scripts[1].Quorum() != "0-of-0" {
+		t.Fatalf("unexpected script %+v %v", parsed, err)
+	}
+	sign := func(keys ...ed25519.PrivateKey) string {
+		var sigs []CardanoDataSignature
+		for _, key := range keys {
+			sigs = append(sigs, cip30Sign(key, addr, okxTestMessage, false, false))
+		}
+		b, _ := json.Marshal(sigs)
+		return string(b)
+	}
+	single, _ := json.Marshal(cip30Sign(keys[2], addr, okxTestMessage, false, false))
+	outsider, _ := cardanoTestKey(20)
+	tests := []struct {
+		name, sign1, sign2, script string
+		reason                     string
+	}{
+		{"two of three", sign(keys[0], keys[1]), "", hex.EncodeToString(script), ""},
+		{"signature1 and signature2", sign(keys[0]), string(single), hex.EncodeToString(script), ""},
+		{"one of three", sign(keys[0]), "", hex.EncodeToString(script), ReasonBelowThreshold},
+		{"twice the same key", sign(keys[0], keys[0]), "", hex.EncodeToString(script), ReasonBelowThreshold},
+		{"a key outside the script", sign(keys[0], outsider), "", hex.EncodeToString(script), ReasonBelowThreshold},
+		{"without the script", sign(keys[0], keys[1]), "", "", ReasonMissingScript},
+		{"no signature", "[]", "", hex.EncodeToString(script), ReasonBadSignature},
+		{"another script", sign(keys[0], keys[1]), "", hex.EncodeToString(script[:len(script)-7]) + "8204" + "1a05f5e100", ReasonMissingScript},
+	}
+	for _, test := range tests {
+		row := &CoinData{Coin: "ADA", Address: addr, Message: okxTestMessage, Sign1: test.sign1, Sign2: test.sign2, Script: test.script}
+		result := VerifyRowSignature(row)
+		if result.Reason() != test.reason {
+			t.Errorf("%s: expected reason %q, got %q (%v)", test.name, test.reason, result.Reason(), result.Err)
+		}
+		if test.reason == "" && (result.Quorum != "2-of-3" || result.Verifier != Ed25519CoinType+"+native script") {
+			t.Errorf("%s: unexpected quorum %s and verifier %s", test.name, result.Quorum, result.Verifier)
+		}
+	}
+	if fmt.Sprint(parsed.Satisfied(map[string]bool{})) != "false" {
+		t.Fatal("expected no key to fail the script")
+	}
+}
@@ -0,0 +1,187 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// CBOR major types.
+const (
+	cborUint   = 0
+	cborNegint = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+)
+
+// cborMaxDepth bounds the nesting of a decoded item.
+const cborMaxDepth = 32
+
+var errCBORTruncated = errors.New("cbor item is truncated")
+
+// cborPair is a key and value of a CBOR map, maps keep their order and key types.
+type cborPair struct {
+	Key, Value interface{}
+}
+
+// cborMapValue is a decoded CBOR map.
+type cborMapValue []cborPair
+
+// get returns the value of an integer or text key.
+func (m cborMapValue) get(key interface{}) (interface{}, bool) {
+	if k, ok := key.(int); ok {
+		key = int64(k)
+	}
+	for _, p := range m {
+		if p.Key == key {
+			return p.Value, true
+		}
+	}
+	return nil, false
+}
+
+// cborTagValue is a tagged CBOR item.
+type cborTagValue struct {
+	Tag   uint64
+	Value interface{}
+}
+
+// decodeCBOR decodes one definite length CBOR item, which must fill data. Integers decode to
+// int64, byte and text strings to []byte and string, arrays to []interface{}, maps to
+// cborMapValue, true, false and null to bool and nil.
+func decodeCBOR(data []byte) (interface{}, error) {
+	v, n, err := decodeCBORItem(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(data) {
+		return nil, fmt.Errorf("cbor item has %d trailing bytes", len(data)-n)
+	}
+	return v, nil
+}
+
+// decodeCBORItem decodes the item at the start of data and returns its length.
+func decodeCBORItem(data []byte, depth int) (interface{}, int, error) {
+	if depth > cborMaxDepth {
+		return nil, 0, errors.New("cbor item is nested too deep")
+	}
+	if len(data) == 0 {
+		return nil, 0, errCBORTruncated
+	}
+	major, info := data[0]>>5, data[0]&0x1f
+	arg, n, err := decodeCBORArgument(data, info)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch major {
+	case cborUint, cborNegint:
+		if arg > math.MaxInt64 {
+			return nil, 0, errors.New("cbor integer overflows int64")
+		}
+		if major == cborNegint {
+			return -1 - int64(arg), n, nil
+		}
+		return int64(arg), n, nil
+	case cborBytes, cborText:
+		if arg > uint64(len(data)-n) {
+			return nil, 0, errCBORTruncated
+		}
+		b := data[n : n+int(arg)]
+		if major == cborText {
+			return string(b), n + int(arg), nil
+		}
+		return append([]byte{}, b...), n + int(arg), nil
+	case cborArray, cborMap:
+		// every item takes a byte at least, a larger count is truncated
+		if arg > uint64(len(data)-n) {
+			return nil, 0, errCBORTruncated
+		}
+		items := int(arg)
+		if major == cborMap {
+			items *= 2
+		}
+		values := make([]interface{}, 0, items)
+		for i := 0; i < items; i++ {
+			v, m, err := decodeCBORItem(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			values = append(values, v)
+			n += m
+		}
+		if major == cborArray {
+			return values, n, nil
+		}
+		m := make(cborMapValue, 0, arg)
+		for i := 0; i < len(values); i += 2 {
+			m = append(m, cborPair{Key: values[i], Value: values[i+1]})
+		}
+		return m, n, nil
+	case cborTag:
+		v, m, err := decodeCBORItem(data[n:], depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		return cborTagValue{Tag: arg, Value: v}, n + m, nil
+	default:
+		switch info {
+		case 20:
+			return false, n, nil
+		case 21:
+			return true, n, nil
+		case 22:
+			return nil, n, nil
+		}
+		return nil, 0, fmt.Errorf("unsupported cbor simple value %d", info)
+	}
+}
+
+// decodeCBORArgument reads the argument of an initial byte, indefinite lengths are not supported.
+func decodeCBORArgument(data []byte, info byte) (uint64, int, error) {
+	switch {
+	case info < 24:
+		return uint64(info), 1, nil
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(data) < 1+size {
+			return 0, 0, errCBORTruncated
+		}
+		b := make([]byte, 8)
+		copy(b[8-size:], data[1:1+size])
+		return binary.BigEndian.Uint64(b), 1 + size, nil
+	}
+	return 0, 0, fmt.Errorf("unsupported cbor additional information %d", info)
+}
+
+// appendCBORHead appends the initial byte and argument of an item.
+func appendCBORHead(b []byte, major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return append(b, major<<5|byte(arg))
+	case arg <= math.MaxUint8:
+		return append(b, major<<5|24, byte(arg))
+	case arg <= math.MaxUint16:
+		return append(b, major<<5|25, byte(arg>>8), byte(arg))
+	case arg <= math.MaxUint32:
+		return append(b, major<<5|26, byte(arg>>24), byte(arg>>16), byte(arg>>8), byte(arg))
+	}
+	b = append(b, major<<5|27)
+	var arg64 [8]byte
+	binary.BigEndian.PutUint64(arg64[:], arg)
+	return append(b, arg64[:]...)
+}
+
+// appendCBORBytes appends a byte string.
+func appendCBORBytes(b, data []byte) []byte {
+	return append(appendCBORHead(b, cborBytes, uint64(len(data))), data...)
+}
+
+// appendCBORText appends a text string.
+func appendCBORText(b []byte, text string) []byte {
+	return append(appendCBORHead(b, cborText, uint64(len(text))), text...)
+}
@@ -227,10 +227,12 @@ var (
 		"TRON":       "TRX",
 
 		// ECDSA
-		"FIL":  "FIL",
-		"CFX":  "CFX",
-		"ELF":  "ELF",
-		"LUNC": "LUNC",
+		"FIL":    "FIL",
+		"CFX":    "CFX",
+		"ELF":    "ELF",
+		"LUNC":   "LUNC",
+		"XRP":    "XRP",
+		"RIPPLE": "XRP",
 
 		// ED25519
 		"SOL":           "SOL",
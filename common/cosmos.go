@@ -0,0 +1,396 @@
+package common
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secp_ecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"golang.org/x/crypto/ripemd160"
+	"golang.org/x/crypto/sha3"
+)
+
+// CosmosBech32Prefixes maps the address types of Cosmos SDK coins to their bech32 prefix.
+var CosmosBech32Prefixes = map[string]string{
+	"ATOM":  "cosmos",
+	"TIA":   "celestia",
+	"CRO":   "cro",
+	"DORA":  "dora",
+	"DYDX":  "dydx",
+	"TERRA": "terra",
+	"LUNC":  "terra",
+	"INJ":   "inj",
+}
+
+// Amino names of the public keys a Cosmos SDK account may have.
+const (
+	aminoSecp256k1       = "tendermint/PubKeySecp256k1"
+	aminoEthSecp256k1    = "ethermint/PubKeyEthSecp256k1"
+	aminoInjSecp256k1    = "injective/PubKeyEthSecp256k1"
+	aminoMultisig        = "tendermint/PubKeyMultisigThreshold"
+	protoMultisig        = "/cosmos.crypto.multisig.LegacyAminoPubKey"
+	maxCosmosMultisigKey = 20
+)
+
+// CosmosPubKey is the public key of a Cosmos SDK account: a secp256k1 key, an ethsecp256k1 key
+// of an Ethermint chain such as INJ or EVMOS, or a LegacyAminoPubKey threshold multisig.
+type CosmosPubKey struct {
+	// Type is the amino name of the key
+	Type string
+	// Key is the compressed key of a single key
+	Key       []byte
+	Threshold int
+	PubKeys   []*CosmosPubKey
+}
+
+// cosmosPubKeyJSON is a public key in amino json, {"type":...,"value":...}, or in proto json,
+// {"@type":...,"key":...} or {"@type":...,"threshold":...,"public_keys":[...]}.
+type cosmosPubKeyJSON struct {
+	Type       string             `json:"type"`
+	Value      json.RawMessage    `json:"value"`
+	ProtoType  string             `json:"@type"`
+	Key        []byte             `json:"key"`
+	Threshold  json.Number        `json:"threshold"`
+	PubKeys    []cosmosPubKeyJSON `json:"pubkeys"`
+	PublicKeys []cosmosPubKeyJSON `json:"public_keys"`
+}
+
+// ParseCosmosPubKey decodes a public key in amino or proto json.
+func ParseCosmosPubKey(s string) (*CosmosPubKey, error) {
+	var j cosmosPubKeyJSON
+	if err := json.Unmarshal([]byte(s), &j); err != nil {
+		return nil, fmt.Errorf("invalid cosmos public key: %v", err)
+	}
+	return j.pubKey(0)
+}
+
+func (j *cosmosPubKeyJSON) pubKey(depth int) (*CosmosPubKey, error) {
+	if depth > 1 {
+		return nil, errors.New("nested cosmos multisig keys are not supported")
+	}
+	name := j.Type
+	if name == "" {
+		name = j.ProtoType
+	}
+	lower := strings.ToLower(name)
+	switch {
+	case name == aminoMultisig || name == protoMultisig:
+		if name == aminoMultisig {
+			var value cosmosPubKeyJSON
+			if err := json.Unmarshal(j.Value, &value); err != nil {
+				return nil, fmt.Errorf("invalid cosmos multisig key: %v", err)
+			}
+			j = &value
+		}
+		members := j.PubKeys
+		if name == protoMultisig {
+			members = j.PublicKeys
+		}
+		threshold, err := strconv.Atoi(j.Threshold.String())
+		if err != nil || threshold < 1 || threshold > len(members) || len(members) > maxCosmosMultisigKey {
+			return nil, fmt.Errorf("invalid cosmos multisig threshold %s of %d keys", j.Threshold, len(members))
+		}
+		k := &CosmosPubKey{Type: aminoMultisig, Threshold: threshold}
+		for i := range members {
+			member, err := members[i].pubKey(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			k.PubKeys = append(k.PubKeys, member)
+		}
+		return k, nil
+	case strings.Contains(lower, "ethsecp256k1"):
+		name = aminoEthSecp256k1
+		if strings.Contains(lower, "injective") {
+			name = aminoInjSecp256k1
+		}
+	case name == aminoSecp256k1 || name == "/cosmos.crypto.secp256k1.PubKey":
+		name = aminoSecp256k1
+	default:
+		return nil, fmt.Errorf("unsupported cosmos public key type %q", name)
+	}
+	key := j.Key
+	if len(j.Value) != 0 {
+		if err := json.Unmarshal(j.Value, &key); err != nil {
+			return nil, fmt.Errorf("invalid cosmos public key: %v", err)
+		}
+	}
+	if _, err := secp256k1.ParsePubKey(key); err != nil || len(key) != secp256k1.PubKeyBytesLenCompressed {
+		return nil, fmt.Errorf("invalid cosmos public key %x", key)
+	}
+	return &CosmosPubKey{Type: name, Key: key}, nil
+}
+
+// Eth reports whether the key is an ethsecp256k1 key, which signs the keccak-256 of a message and
+// whose address is the one of its Ethereum account.
+func (k *CosmosPubKey) Eth() bool {
+	return k.Type == aminoEthSecp256k1 || k.Type == aminoInjSecp256k1
+}
+
+// Quorum returns the threshold of a multisig, e.g. 2-of-3.
+func (k *CosmosPubKey) Quorum() string {
+	return fmt.Sprintf("%d-of-%d", k.Threshold, len(k.PubKeys))
+}
+
+// Address returns the bech32 address of the key: ripemd160(sha256) of a secp256k1 key, the last 20
+// bytes of the keccak-256 of an ethsecp256k1 key, and the first 20 bytes of the sha256 of the amino
+// encoding of a multisig.
+func (k *CosmosPubKey) Address(prefix string) (string, error) {
+	var hash []byte
+	switch {
+	case k.Type == aminoMultisig:
+		sum := sha256.Sum256(k.aminoBytes())
+		hash = sum[:20]
+	case k.Eth():
+		pub, err := secp256k1.ParsePubKey(k.Key)
+		if err != nil {
+			return "", err
+		}
+		h := sha3.NewLegacyKeccak256()
+		h.Write(pub.SerializeUncompressed()[1:])
+		hash = h.Sum(nil)[12:]
+	default:
+		sum := sha256.Sum256(k.Key)
+		h := ripemd160.New()
+		h.Write(sum[:])
+		hash = h.Sum(nil)
+	}
+	data, err := bech32.ConvertBits(hash, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	return bech32.Encode(prefix, data)
+}
+
+// aminoBytes returns the amino binary encoding of the key, its type prefix and its fields.
+func (k *CosmosPubKey) aminoBytes() []byte {
+	b := aminoPrefix(k.Type)
+	if k.Type != aminoMultisig {
+		return append(append(b, byte(len(k.Key))), k.Key...)
+	}
+	// field 1, the threshold as a varint, and field 2, every key length prefixed
+	b = append(b, 0x08)
+	b = appendUvarint(b, uint64(k.Threshold))
+	for _, member := range k.PubKeys {
+		m := member.aminoBytes()
+		b = append(b, 0x12)
+		b = appendUvarint(b, uint64(len(m)))
+		b = append(b, m...)
+	}
+	return b
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+// aminoPrefix returns the 4 byte prefix amino derives from the sha256 of a type name, after its
+// leading zero bytes and the 3 disambiguation bytes.
+func aminoPrefix(name string) []byte {
+	hash := sha256.Sum256([]byte(name))
+	b := bytes.TrimLeft(hash[:], "\x00")[3:]
+	b = bytes.TrimLeft(b, "\x00")
+	return append([]byte{}, b[:4]...)
+}
+
+// Verify verifies a signature of the sign bytes, the sha256 of them for a secp256k1 key and the
+// keccak-256 for an ethsecp256k1 key. The signature is r || s with s in the lower form, an
+// ethsecp256k1 signature may carry the recovery id as well.
+func (k *CosmosPubKey) Verify(signBytes, sig []byte) error {
+	if k.Type == aminoMultisig {
+		return errors.New("a cosmos multisig key signs with its member keys")
+	}
+	if k.Eth() && len(sig) == 65 {
+		sig = sig[:64]
+	}
+	if len(sig) != 64 {
+		return fmt.Errorf("invalid cosmos signature length %d", len(sig))
+	}
+	var hash []byte
+	if k.Eth() {
+		h := sha3.NewLegacyKeccak256()
+		h.Write(signBytes)
+		hash = h.Sum(nil)
+	} else {
+		sum := sha256.Sum256(signBytes)
+		hash = sum[:]
+	}
+	pub, err := secp256k1.ParsePubKey(k.Key)
+	if err != nil {
+		return fmt.Errorf("invalid cosmos public key: %v", err)
+	}
+	var r, s secp256k1.ModNScalar
+	if r.SetByteSlice(sig[:32]) || s.SetByteSlice(sig[32:]) || s.IsOverHalfOrder() {
+		return errors.New("cosmos signature is out of range or not in the lower s form")
+	}
+	if !secp_ecdsa.NewSignature(&r, &s).Verify(hash, pub) {
+		return errors.New("cosmos signature verification failed")
+	}
+	return nil
+}
+
+// ADR036SignBytes returns the amino json sign doc of an ADR-036 signArbitrary of the message by the
+// signer: a sign/MsgSignData with an empty chain id, zero account number, sequence and fee.
+func ADR036SignBytes(signer, msg string) []byte {
+	type msgSignData struct {
+		Type  string `json:"type"`
+		Value struct {
+			Data   string `json:"data"`
+			Signer string `json:"signer"`
+		} `json:"value"`
+	}
+	// the fields are in the sorted order of the amino json
+	doc := struct {
+		AccountNumber string `json:"account_number"`
+		ChainID       string `json:"chain_id"`
+		Fee           struct {
+			Amount []struct{} `json:"amount"`
+			Gas    string     `json:"gas"`
+		} `json:"fee"`
+		Memo     string        `json:"memo"`
+		Msgs     []msgSignData `json:"msgs"`
+		Sequence string        `json:"sequence"`
+	}{AccountNumber: "0", Sequence: "0", Msgs: make([]msgSignData, 1)}
+	doc.Fee.Amount, doc.Fee.Gas = []struct{}{}, "0"
+	doc.Msgs[0].Type = "sign/MsgSignData"
+	doc.Msgs[0].Value.Data = base64.StdEncoding.EncodeToString([]byte(msg))
+	doc.Msgs[0].Value.Signer = signer
+	b, _ := json.Marshal(doc)
+	return b
+}
+
+// CosmosSignature is the StdSignature a wallet such as Keplr returns for signArbitrary.
+type CosmosSignature struct {
+	PubKey    json.RawMessage `json:"pub_key"`
+	Signature string          `json:"signature"`
+}
+
+// parseCosmosSignatures decodes a signature column, a StdSignature or an array of them.
+func parseCosmosSignatures(sign string) ([]CosmosSignature, error) {
+	sign = strings.TrimSpace(sign)
+	if strings.HasPrefix(sign, "[") {
+		var sigs []CosmosSignature
+		if err := json.Unmarshal([]byte(sign), &sigs); err != nil {
+			return nil, fmt.Errorf("invalid ADR-036 signatures: %v", err)
+		}
+		return sigs, nil
+	}
+	var sig CosmosSignature
+	if err := json.Unmarshal([]byte(sign), &sig); err != nil {
+		return nil, fmt.Errorf("invalid ADR-036 signature: %v", err)
+	}
+	return []CosmosSignature{sig}, nil
+}
+
+// verify verifies the signature of the sign bytes and returns its key, or the public key column's
+// when the signature has none.
+func (sig *CosmosSignature) verify(signBytes []byte, publicKey *CosmosPubKey) (*CosmosPubKey, error) {
+	pub := publicKey
+	if len(sig.PubKey) != 0 && string(sig.PubKey) != "null" {
+		var err error
+		if pub, err = ParseCosmosPubKey(string(sig.PubKey)); err != nil {
+			return nil, err
+		}
+	}
+	if pub == nil || pub.Type == aminoMultisig {
+		return nil, withReason(ReasonMissingScript, errors.New("ADR-036 signature has no public key"))
+	}
+	b, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ADR-036 signature %q", sig.Signature)
+	}
+	return pub, pub.Verify(signBytes, b)
+}
+
+// IsCosmosSignArbitrary reports whether a row of a Cosmos SDK coin holds ADR-036 signatures, json
+// rather than the hex signature of the PoR message.
+func IsCosmosSignArbitrary(coin, sign string) bool {
+	if _, exist := CosmosBech32Prefixes[PorCoinAddressTypeMap[coin]]; !exist {
+		return false
+	}
+	sign = strings.TrimSpace(sign)
+	return strings.HasPrefix(sign, "{") || strings.HasPrefix(sign, "[")
+}
+
+// VerifyCosmosSignArbitrary verifies the ADR-036 signatures of the message for the address and
+// returns the m-of-n of a multisig. A single key account signs with the key of its address; a
+// multisig account publishes its LegacyAminoPubKey in the public key column, whose address must be
+// the row's, and at least its threshold of distinct member keys must sign for the multisig address.
+func VerifyCosmosSignArbitrary(coin, addr, msg string, signs []string, publicKey string) (string, error) {
+	prefix := CosmosBech32Prefixes[PorCoinAddressTypeMap[coin]]
+	if hrp, _, err := bech32.Decode(addr); err != nil || hrp != prefix {
+		return "", withReason(ReasonUndecodableAddress, fmt.Errorf("invalid %s address %s", prefix, addr))
+	}
+	var key *CosmosPubKey
+	if strings.TrimSpace(publicKey) != "" {
+		var err error
+		if key, err = ParseCosmosPubKey(publicKey); err != nil {
+			return "", withReason(ReasonMissingScript, err)
+		}
+	}
+	var sigs []CosmosSignature
+	for _, sign := range signs {
+		if sign == "" {
+			continue
+		}
+		s, err := parseCosmosSignatures(sign)
+		if err != nil {
+			return "", withReason(ReasonBadSignature, err)
+		}
+		sigs = append(sigs, s...)
+	}
+	signBytes := ADR036SignBytes(addr, msg)
+
+	if key == nil || key.Type != aminoMultisig {
+		if len(sigs) != 1 {
+			return "", fmt.Errorf("a single key account has %d ADR-036 signatures", len(sigs))
+		}
+		pub, err := sigs[0].verify(signBytes, key)
+		if err != nil {
+			return "", err
+		}
+		if signer, _ := pub.Address(prefix); signer != addr {
+			return "", withReason(ReasonAddressMismatch, fmt.Errorf("ADR-036 key address %s is not %s", signer, addr))
+		}
+		return "", nil
+	}
+
+	quorum := key.Quorum()
+	if multisigAddr, err := key.Address(prefix); err != nil || multisigAddr != addr {
+		return quorum, withReason(ReasonMissingScript, fmt.Errorf("multisig key address %s is not %s", multisigAddr, addr))
+	}
+	signed := make(map[string]bool)
+	for i := range sigs {
+		pub, err := sigs[i].verify(signBytes, nil)
+		if err != nil {
+			return quorum, err
+		}
+		for _, member := range key.PubKeys {
+			if bytes.Equal(member.Key, pub.Key) && member.Eth() == pub.Eth() {
+				signed[string(pub.Key)] = true
+			}
+		}
+	}
+	if len(signed) < key.Threshold {
+		return quorum, withReason(ReasonBelowThreshold, fmt.Errorf("%d member keys signed for the %s multisig %s", len(signed), quorum, addr))
+	}
+	return quorum, nil
+}
+
+// verifyCosmosRow verifies the ADR-036 signatures of a Cosmos SDK row, signature1 and signature2.
+func verifyCosmosRow(row *CoinData) *SignatureResult {
+	result := &SignatureResult{Address: row.Address, Signer: SignerAddress, Verifier: "+ADR-036"}
+	if result.Quorum, result.Err = VerifyCosmosSignArbitrary(row.Coin, row.Address, row.Message, []string{row.Sign1, row.Sign2}, row.Script); result.Err != nil {
+		result.Err = fmt.Errorf("%w, coin:%s, addr:%s", result.Err, row.Coin, row.Address)
+	}
+	return result
+}
@@ -0,0 +1,150 @@
+package common
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secp_ecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/okx/go-wallet-sdk/coins/cosmos"
+	"golang.org/x/crypto/sha3"
+)
+
+func TestADR036SignBytes(t *testing.T) {
+	expected := `{"account_number":"0","chain_id":"","fee":{"amount":[],"gas":"0"},"memo":"","msgs":[{"type":"sign/MsgSignData","value":{"data":"SGVsbG8=","signer":"cosmos1signer"}}],"sequence":"0"}`
+	if doc := string(ADR036SignBytes("cosmos1signer", "Hello")); doc != expected {
+		t.Fatalf("unexpected sign doc %s", doc)
+	}
+	for name, prefix := range map[string]string{aminoSecp256k1: "eb5ae987", aminoMultisig: "22c1f7e2"} {
+		if p := hex.EncodeToString(aminoPrefix(name)); p != prefix {
+			t.Errorf("unexpected amino prefix %s of %s", p, name)
+		}
+	}
+}
+
+// cosmosTestKey is a secp256k1 or ethsecp256k1 key of an ADR-036 signer.
+type cosmosTestKey struct {
+	key  *secp256k1.PrivateKey
+	eth  bool
+	pub  *CosmosPubKey
+	json string
+}
+
+func newCosmosTestKey(seed byte, eth bool) *cosmosTestKey {
+	key := secp256k1.PrivKeyFromBytes(bytes.Repeat([]byte{seed}, 32))
+	k := &cosmosTestKey{key: key, eth: eth, pub: &CosmosPubKey{Type: aminoSecp256k1, Key: key.PubKey().SerializeCompressed()}}
+	if eth {
+		k.pub.Type = aminoInjSecp256k1
+	}
+	k.json = fmt.Sprintf(`{"type":%q,"value":%q}`, k.pub.Type, base64.StdEncoding.EncodeToString(k.pub.Key))
+	return k
+}
+
+// sign returns the StdSignature of the ADR-036 sign doc of the message by the signer.
+func (k *cosmosTestKey) sign(signer, msg string) string {
+	doc := ADR036SignBytes(signer, msg)
+	hash := sha256.Sum256(doc)
+	if k.eth {
+		h := sha3.NewLegacyKeccak256()
+		h.Write(doc)
+		copy(hash[:], h.Sum(nil))
+	}
+	sig := secp_ecdsa.SignCompact(k.key, hash[:], true)[1:]
+	return fmt.Sprintf(`{"pub_key":%s,"signature":%q}`, k.json, base64.StdEncoding.EncodeToString(sig))
+}
+
+func TestCosmosPubKeyAddress(t *testing.T) {
+	k := newCosmosTestKey(1, false)
+	expected, _ := cosmos.GetAddressByPublicKey(hex.EncodeToString(k.pub.Key), "cosmos")
+	if addr, err := k.pub.Address("cosmos"); err != nil || addr != expected {
+		t.Fatalf("expected %s, got %s %v", expected, addr, err)
+	}
+	eth := newCosmosTestKey(1, true)
+	ethAddr := PubkeyToAddress(*eth.key.PubKey().ToECDSA())
+	expected, _ = encodeBech32("inj", ethAddr[:])
+	if addr, err := eth.pub.Address("inj"); err != nil || addr != expected {
+		t.Fatalf("expected %s, got %s %v", expected, addr, err)
+	}
+
+	// the proto json of the same multisig derives the same address
+	keys := []*cosmosTestKey{newCosmosTestKey(1, false), newCosmosTestKey(2, false)}
+	amino := fmt.Sprintf(`{"type":"tendermint/PubKeyMultisigThreshold","value":{"threshold":"2","pubkeys":[%s,%s]}}`, keys[0].json, keys[1].json)
+	proto := fmt.Sprintf(`{"@type":"/cosmos.crypto.multisig.LegacyAminoPubKey","threshold":2,"public_keys":[{"@type":"/cosmos.crypto.secp256k1.PubKey","key":%q},{"@type":"/cosmos.crypto.secp256k1.PubKey","key":%q}]}`,
+		base64.StdEncoding.EncodeToString(keys[0].pub.Key), base64.StdEncoding.EncodeToString(keys[1].pub.Key))
+	aminoKey, err := ParseCosmosPubKey(amino)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protoKey, err := ParseCosmosPubKey(proto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a1, _ := aminoKey.Address("cosmos")
+	a2, _ := protoKey.Address("cosmos")
+	if a1 != a2 || aminoKey.Quorum() != "2-of-2" {
+		t.Fatalf("expected the same multisig address, got %s %s", a1, a2)
+	}
+	// prefix, threshold 2, and two length prefixed keys
+	if b := aminoKey.aminoBytes(); !bytes.HasPrefix(b, MustDecode("0x22c1f7e208021226eb5ae98721")) {
+		t.Fatalf("unexpected amino encoding %x", b)
+	}
+	for _, s := range []string{`{"type":"tendermint/PubKeyMultisigThreshold","value":{"threshold":"3","pubkeys":[]}}`, `{"type":"tendermint/PubKeyEd25519","value":"AA=="}`, `{"type":"tendermint/PubKeySecp256k1","value":"AA=="}`} {
+		if _, err = ParseCosmosPubKey(s); err == nil {
+			t.Errorf("expected %s to fail", s)
+		}
+	}
+}
+
+func TestVerifyCosmosRow(t *testing.T) {
+	atom := newCosmosTestKey(1, false)
+	other := newCosmosTestKey(9, false)
+	inj := newCosmosTestKey(1, true)
+	atomAddr, _ := atom.pub.Address("cosmos")
+	otherAddr, _ := other.pub.Address("cosmos")
+	injAddr, _ := inj.pub.Address("inj")
+
+	members := []*cosmosTestKey{newCosmosTestKey(11, false), newCosmosTestKey(12, false), newCosmosTestKey(13, false)}
+	var memberJSON []string
+	for _, m := range members {
+		memberJSON = append(memberJSON, m.json)
+	}
+	multisig := fmt.Sprintf(`{"type":"tendermint/PubKeyMultisigThreshold","value":{"threshold":"2","pubkeys":[%s]}}`, strings.Join(memberJSON, ","))
+	multisigKey, _ := ParseCosmosPubKey(multisig)
+	multisigAddr, _ := multisigKey.Address("cosmos")
+	both, _ := json.Marshal([]json.RawMessage{json.RawMessage(members[0].sign(multisigAddr, okxTestMessage)), json.RawMessage(members[2].sign(multisigAddr, okxTestMessage))})
+	noKey := strings.Replace(atom.sign(atomAddr, okxTestMessage), `"pub_key":`+atom.json, `"pub_key":null`, 1)
+
+	tests := []struct {
+		name, coin, addr, sign1, sign2, script string
+		quorum, reason                         string
+	}{
+		{"secp256k1", "ATOM", atomAddr, atom.sign(atomAddr, okxTestMessage), "", "", "", ""},
+		{"key in the public key column", "ATOM", atomAddr, noKey, "", atom.json, "", ""},
+		{"ethsecp256k1", "INJ", injAddr, inj.sign(injAddr, okxTestMessage), "", "", "", ""},
+		{"multisig", "ATOM", multisigAddr, members[0].sign(multisigAddr, okxTestMessage), members[1].sign(multisigAddr, okxTestMessage), multisig, "2-of-3", ""},
+		{"multisig array", "ATOM", multisigAddr, string(both), "", multisig, "2-of-3", ""},
+		{"other message", "ATOM", atomAddr, atom.sign(atomAddr, "OKC_DTT_AUP2024"), "", "", "", ReasonBadSignature},
+		{"signed for another signer", "ATOM", atomAddr, atom.sign(otherAddr, okxTestMessage), "", "", "", ReasonBadSignature},
+		{"key of another address", "ATOM", atomAddr, other.sign(atomAddr, okxTestMessage), "", "", "", ReasonAddressMismatch},
+		{"secp256k1 key of an inj address", "INJ", injAddr, newCosmosTestKey(1, false).sign(injAddr, okxTestMessage), "", "", "", ReasonAddressMismatch},
+		{"no public key", "ATOM", atomAddr, noKey, "", "", "", ReasonMissingScript},
+		{"other prefix", "ATOM", injAddr, inj.sign(injAddr, okxTestMessage), "", "", "", ReasonUndecodableAddress},
+		{"multisig of one", "ATOM", multisigAddr, members[0].sign(multisigAddr, okxTestMessage), "", multisig, "2-of-3", ReasonBelowThreshold},
+		{"multisig twice the same key", "ATOM", multisigAddr, members[0].sign(multisigAddr, okxTestMessage), members[0].sign(multisigAddr, okxTestMessage), multisig, "2-of-3", ReasonBelowThreshold},
+		{"multisig and an outsider", "ATOM", multisigAddr, members[0].sign(multisigAddr, okxTestMessage), other.sign(multisigAddr, okxTestMessage), multisig, "2-of-3", ReasonBelowThreshold},
+		{"multisig of another address", "ATOM", atomAddr, members[0].sign(atomAddr, okxTestMessage), members[1].sign(atomAddr, okxTestMessage), multisig, "2-of-3", ReasonMissingScript},
+	}
+	for _, test := range tests {
+		row := &CoinData{Coin: test.coin, Address: test.addr, Message: okxTestMessage, Sign1: test.sign1, Sign2: test.sign2, Script: test.script}
+		result := VerifyRowSignature(row)
+		if result.Reason() != test.reason || result.Quorum != test.quorum || result.Verifier != EcdsaCoinType+"+ADR-036" {
+			t.Errorf("%s: expected %q %q, got %s %q %q (%v)", test.name, test.quorum, test.reason, result.Verifier, result.Quorum, result.Reason(), result.Err)
+		}
+	}
+}
@@ -44,17 +44,27 @@ func Ecrecover(hash, sig []byte) ([]byte, error) {
 	return bytes, err
 }
 
+// sigToPub recovers the key of a signature through the verification cache, the key is shared by
+// the rows of the same signature and must not be modified.
 func sigToPub(hash, sig []byte) (*btcec.PublicKey, error) {
 	if len(sig) != SignatureLength {
 		return nil, errors.New("invalid signature")
 	}
+	key := verifyCacheKey("secp256k1", hash, sig)
+	if pub, hit := signatureCache.get(key); hit {
+		return pub.(*btcec.PublicKey), nil
+	}
 	// Convert to btcec input format with 'recovery id' v at the beginning.
 	btcsig := make([]byte, SignatureLength)
 	btcsig[0] = sig[RecoveryIDOffset]
 	copy(btcsig[1:], sig)
 
 	pub, _, err := btc_ecdsa.RecoverCompact(btcsig, hash)
-	return pub, err
+	if err != nil {
+		return nil, err
+	}
+	signatureCache.put(key, pub)
+	return pub, nil
 }
 
 // SigToPub returns the public key that created the given signature.
@@ -1,7 +1,6 @@
 package common
 
 import (
-	"bufio"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"io"
@@ -9,10 +8,31 @@ import (
 	"strings"
 )
 
-var PorCoinDataMap map[string]*CoinData
+// PorCoinDataIndex is the index of the PoR file CheckBalance verifies.
+var PorCoinDataIndex *PorCsvIndex
+
+// PorCoinKey identifies a PoR row. The same address can hold a coin on several networks and
+// with several types, e.g. an EVM address on ETH and ARBITRUM.
+type PorCoinKey struct {
+	Coin    string
+	Network string
+	Address string
+	Type    string
+}
+
+func (k PorCoinKey) String() string {
+	s := fmt.Sprintf("%s/%s/%s", k.Coin, k.Network, k.Address)
+	if k.Type != "" {
+		s += "/" + k.Type
+	}
+	return s
+}
 
 type CoinData struct {
+	Line           int
 	Coin           string
+	DigitalAsset   string
+	Type           string
 	Network        string
 	SnapshotHeight string
 	Address        string
@@ -21,55 +41,94 @@ type CoinData struct {
 	Sign1          string
 	Sign2          string
 	Script         string
+	EOA1           string
+	EOA2           string
+	Status         string
+	// EigenPod is the EigenPod contract of an Eigenlayer Staking row, VerifyRowSignature moves it
+	// out of EOA2 because it does not sign
+	EigenPod string
 }
 
-func InitPorCsvDataMap(fileName string) (coinData map[string]*CoinData, err error) {
+// Key returns the key of the row in a PorCsvIndex.
+func (d *CoinData) Key() PorCoinKey {
+	return PorCoinKey{Coin: d.Coin, Network: d.Network, Address: d.Address, Type: d.Type}
+}
+
+// ForEachPorCoinData streams the detail rows of a PoR file to fn without loading the file into
+// memory. Malformed rows are logged and skipped, reading stops at the first error fn returns.
+func ForEachPorCoinData(fileName string, fn func(d *CoinData) error) error {
 	fs, err := os.Open(fileName)
 	if err != nil {
-		log.Fatalf("can not open the file, err is %+v", err)
-		return
+		return err
 	}
 	defer fs.Close()
-	coinData = make(map[string]*CoinData)
 
-	buf := bufio.NewReader(fs)
+	reader := NewPorCsvReader(fs)
 	for {
-		line, _, err := buf.ReadLine()
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
+		d, err := reader.Read()
+		if err == io.EOF {
+			break
 		}
-
-		if strings.Contains(string(line), "coin,") {
+		if _, ok := err.(*CsvError); ok {
+			log.Errorf("skip %s: %s", fileName, err)
 			continue
 		}
+		if err != nil {
+			return fmt.Errorf("read %s: %w", fileName, err)
+		}
+		normalizePorCoinData(d)
+		if err = fn(d); err != nil {
+			return err
+		}
+	}
+	for _, w := range reader.Warnings() {
+		log.Warnf("%s: %s", fileName, w)
+	}
+	return nil
+}
 
-		args := strings.Split(string(line), ",")
-		if len(args) == 2 {
-			continue
-		} else if len(args) == 9 {
-			// coin,network,snapshot height,address,balance,message,signature1,signature2,redeem_script
-			d := &CoinData{
-				Coin:           strings.ToUpper(cleanout(args[0])),
-				Network:        strings.ToUpper(cleanout(args[1])),
-				SnapshotHeight: cleanout(args[2]),
-				Address:        cleanout(args[3]),
-				Balance:        cleanout(args[4]),
-				Message:        cleanout(args[5]),
-				Sign1:          cleanout(args[6]),
-				Sign2:          cleanout(args[7]),
-				Script:         cleanout(args[8]),
-			}
-			if _, exist := coinData[fmt.Sprintf("%s:%s", d.Coin, d.Address)]; !exist {
-				coinData[fmt.Sprintf("%s:%s", d.Coin, d.Address)] = d
-			}
+// InitPorCsvDataMap loads the detail rows of a PoR file keyed by coin, network, address and type.
+// Rows that repeat a key are reported as an error. Large files should be read with
+// ForEachPorCoinData or OpenPorCsvIndex instead.
+func InitPorCsvDataMap(fileName string) (coinData map[PorCoinKey]*CoinData, err error) {
+	coinData = make(map[PorCoinKey]*CoinData)
+	duplicates := make([]string, 0)
+	err = ForEachPorCoinData(fileName, func(d *CoinData) error {
+		if first, exist := coinData[d.Key()]; exist {
+			duplicates = append(duplicates, fmt.Sprintf("line %d repeats line %d (%s)", d.Line, first.Line, d.Key()))
+			return nil
 		}
+		coinData[d.Key()] = d
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(duplicates) > 0 {
+		return nil, fmt.Errorf("%s has %d duplicate rows: %s", fileName, len(duplicates), strings.Join(duplicates, "; "))
 	}
 
 	return coinData, nil
 }
 
+// LookupPorCoinData returns a row of the PoR file opened in PorCoinDataIndex.
+func LookupPorCoinData(key PorCoinKey) (*CoinData, bool) {
+	if PorCoinDataIndex == nil {
+		return nil, false
+	}
+	d, err := PorCoinDataIndex.Get(key)
+	if err != nil {
+		log.Errorf("look up %s in por index failed, error: %v", key, err)
+		return nil, false
+	}
+	return d, d != nil
+}
+
+func normalizePorCoinData(d *CoinData) {
+	d.Coin = strings.ToUpper(d.Coin)
+	d.Network = strings.ToUpper(d.Network)
+}
+
 func cleanout(s string) string {
 	if len(s) == 0 {
 		return s
@@ -0,0 +1,366 @@
+package common
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// PorCsvSource is the PoR file a command verifies. Plain csv files are read in place, a .gz file
+// or the PoR member of a .zip bundle is extracted to a file named by its digest in the temp
+// directory. The commands remove the copies they extracted, and their index, when they exit
+// (RemoveExtractedPorCsv) unless --keep-extracted is set; a later run whose content has the same
+// digest and size reuses a kept copy instead of extracting another one.
+type PorCsvSource struct {
+	// Origin is the file passed on the command line
+	Origin string `json:"file"`
+	// Member is the csv selected from a zip bundle
+	Member string `json:"member,omitempty"`
+	// Path is the plain csv file the command reads
+	Path string `json:"-"`
+	// SHA256 is the digest of the csv content that was verified
+	SHA256 string `json:"sha256"`
+	// Manifest is the bundle's SHA-256 manifest the content was checked against
+	Manifest string `json:"manifest,omitempty"`
+}
+
+func (s *PorCsvSource) String() string {
+	name := s.Origin
+	if s.Member != "" {
+		name += "#" + s.Member
+	}
+	result := fmt.Sprintf("%s sha256 %s", name, s.SHA256)
+	if s.Manifest != "" {
+		result += fmt.Sprintf(", matches manifest %s", s.Manifest)
+	}
+	return result
+}
+
+// OpenPorCsvSource resolves a --por_csv_filename value. A zip member can be named explicitly as
+// "bundle.zip#member.csv", otherwise the only member with a PoR header is selected. When the
+// bundle contains a SHA-256 manifest (SHA256SUMS, sha256sum.txt or *.sha256, in sha256sum
+// format) every member it lists must match.
+func OpenPorCsvSource(fileName string) (*PorCsvSource, error) {
+	member := ""
+	if i := strings.LastIndex(fileName, "#"); i > 0 && strings.EqualFold(filepath.Ext(fileName[:i]), ".zip") {
+		fileName, member = fileName[:i], fileName[i+1:]
+	}
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".zip":
+		return openPorZip(fileName, member)
+	case ".gz":
+		return openPorGzip(fileName)
+	default:
+		f, err := os.Open(fileName)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		digest, _, err := digestReader(f)
+		if err != nil {
+			return nil, err
+		}
+		return &PorCsvSource{Origin: fileName, Path: fileName, SHA256: digest}, nil
+	}
+}
+
+func openPorGzip(fileName string) (*PorCsvSource, error) {
+	open := func() (io.ReadCloser, error) {
+		f, err := os.Open(fileName)
+		if err != nil {
+			return nil, err
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("open %s: %w", fileName, err)
+		}
+		return &gzipFile{Reader: gz, f: f}, nil
+	}
+
+	source := &PorCsvSource{Origin: fileName}
+	var err error
+	if source.Path, source.SHA256, err = extractPorCsv(open, fileName); err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+// gzipFile closes the gzip stream and the file under it.
+type gzipFile struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (g *gzipFile) Close() error {
+	err := g.Reader.Close()
+	if ferr := g.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+func openPorZip(fileName, member string) (*PorCsvSource, error) {
+	z, err := zip.OpenReader(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", fileName, err)
+	}
+	defer z.Close()
+
+	manifestName, manifest := "", make(map[string]string)
+	candidates := make([]*zip.File, 0)
+	for _, f := range z.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if isPorManifest(f.Name) {
+			if manifestName != "" {
+				return nil, fmt.Errorf("%s has more than one sha256 manifest, %s and %s", fileName, manifestName, f.Name)
+			}
+			manifestName = f.Name
+			if err = readPorManifest(f, manifest); err != nil {
+				return nil, fmt.Errorf("read manifest %s of %s: %w", f.Name, fileName, err)
+			}
+			continue
+		}
+		if member != "" {
+			if f.Name == member || path.Base(f.Name) == member {
+				candidates = append(candidates, f)
+			}
+			continue
+		}
+		isPor, err := isPorCsvMember(f)
+		if err != nil {
+			return nil, fmt.Errorf("read %s of %s: %w", f.Name, fileName, err)
+		}
+		if isPor {
+			candidates = append(candidates, f)
+		}
+	}
+	if len(candidates) == 0 {
+		if member != "" {
+			return nil, fmt.Errorf("%s has no member %s", fileName, member)
+		}
+		return nil, fmt.Errorf("%s has no csv member with a por header", fileName)
+	}
+	if len(candidates) > 1 {
+		names := make([]string, 0, len(candidates))
+		for _, f := range candidates {
+			names = append(names, f.Name)
+		}
+		return nil, fmt.Errorf("%s has several por csv members (%s), select one with %s#<member>", fileName, strings.Join(names, ", "), fileName)
+	}
+
+	// every member the manifest lists must match, not only the selected one
+	for name, expected := range manifest {
+		f := findZipMember(z.File, name)
+		if f == nil {
+			return nil, fmt.Errorf("manifest %s of %s lists %s, but the bundle has no such member", manifestName, fileName, name)
+		}
+		if f == candidates[0] {
+			continue
+		}
+		digest, err := digestZipMember(f)
+		if err != nil {
+			return nil, fmt.Errorf("read %s of %s: %w", f.Name, fileName, err)
+		}
+		if digest != expected {
+			return nil, fmt.Errorf("%s of %s has sha256 %s, manifest %s expects %s", f.Name, fileName, digest, manifestName, expected)
+		}
+	}
+
+	f := candidates[0]
+	source := &PorCsvSource{Origin: fileName, Member: f.Name}
+	if source.Path, source.SHA256, err = extractPorCsv(f.Open, fileName); err != nil {
+		return nil, fmt.Errorf("read %s of %s: %w", f.Name, fileName, err)
+	}
+	if manifestName != "" {
+		expected, exist := manifest[f.Name]
+		if !exist {
+			expected, exist = manifest[path.Base(f.Name)]
+		}
+		if !exist {
+			return nil, fmt.Errorf("manifest %s of %s does not list %s", manifestName, fileName, f.Name)
+		}
+		if source.SHA256 != expected {
+			return nil, fmt.Errorf("%s of %s has sha256 %s, manifest %s expects %s", f.Name, fileName, source.SHA256, manifestName, expected)
+		}
+		source.Manifest = manifestName
+	}
+	return source, nil
+}
+
+// extractPorCsv returns the path and digest of a copy of the csv content in the temp directory.
+// The content is hashed first, a copy of the same digest from an earlier run is reused. A new
+// copy is written to a temporary file and renamed, so concurrent runs never read a partial copy,
+// and it keeps the archive's modification time, an index built from it stays valid.
+func extractPorCsv(open func() (io.ReadCloser, error), archiveName string) (string, string, error) {
+	stat, err := os.Stat(archiveName)
+	if err != nil {
+		return "", "", err
+	}
+	r, err := open()
+	if err != nil {
+		return "", "", err
+	}
+	digest, size, err := digestReader(r)
+	r.Close()
+	if err != nil {
+		return "", "", fmt.Errorf("extract %s: %w", archiveName, err)
+	}
+	// the copy is renamed to its digest once complete, a copy of the same size is that content
+	extracted := filepath.Join(os.TempDir(), "por-"+digest+".csv")
+	if existing, err := os.Stat(extracted); err == nil && existing.Size() == size {
+		return extracted, digest, nil
+	}
+
+	if r, err = open(); err != nil {
+		return "", "", err
+	}
+	defer r.Close()
+	tmp, err := ioutil.TempFile("", "por-*.csv.tmp")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	w := bufio.NewWriterSize(tmp, 1<<20)
+	if _, err = io.Copy(io.MultiWriter(w, h), r); err != nil {
+		tmp.Close()
+		return "", "", fmt.Errorf("extract %s: %w", archiveName, err)
+	}
+	if err = w.Flush(); err != nil {
+		tmp.Close()
+		return "", "", err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", "", err
+	}
+	// the archive may have been replaced between the two reads
+	if written := hex.EncodeToString(h.Sum(nil)); written != digest {
+		return "", "", fmt.Errorf("extract %s: content changed while it was read", archiveName)
+	}
+	if err = os.Chtimes(tmp.Name(), stat.ModTime(), stat.ModTime()); err != nil {
+		return "", "", err
+	}
+	if err = os.Rename(tmp.Name(), extracted); err != nil {
+		return "", "", err
+	}
+	extractedPorCsv.Lock()
+	extractedPorCsv.files = append(extractedPorCsv.files, extracted)
+	extractedPorCsv.Unlock()
+	return extracted, digest, nil
+}
+
+// extractedPorCsv are the copies extracted by this process
+var extractedPorCsv struct {
+	sync.Mutex
+	files []string
+}
+
+// RemoveExtractedPorCsv removes the copies this process extracted from bundles and their default
+// index. A copy reused from an earlier run is left to it.
+func RemoveExtractedPorCsv() {
+	extractedPorCsv.Lock()
+	defer extractedPorCsv.Unlock()
+	for _, fileName := range extractedPorCsv.files {
+		os.Remove(fileName)
+		os.Remove(fileName + ".idx")
+	}
+	extractedPorCsv.files = nil
+}
+
+func digestReader(r io.Reader) (string, int64, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// isPorCsvMember reports whether a zip member starts with a PoR detail header.
+func isPorCsvMember(f *zip.File) (bool, error) {
+	r, err := f.Open()
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	// the header and first row are enough, a large binary member is not read to the end
+	reader := NewPorCsvReader(io.LimitReader(r, 4<<20))
+	_, err = reader.Read()
+	var csvErr *CsvError
+	if err != nil && err != io.EOF && !errors.As(err, &csvErr) {
+		return false, nil
+	}
+	return reader.Header() != nil && !reader.inHeader, nil
+}
+
+func isPorManifest(name string) bool {
+	base := strings.ToLower(path.Base(name))
+	return base == "sha256sums" || base == "sha256sums.txt" || base == "sha256sum.txt" || strings.HasSuffix(base, ".sha256")
+}
+
+// readPorManifest reads "<hex digest>  <member>" lines, a *.sha256 file may hold only the digest
+// of the member it is named after.
+func readPorManifest(f *zip.File, manifest map[string]string) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		digest := strings.ToLower(fields[0])
+		if b, err := hex.DecodeString(digest); err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("invalid sha256 line %q", scanner.Text())
+		}
+		name := strings.TrimSuffix(path.Base(f.Name), path.Ext(f.Name))
+		if len(fields) > 1 {
+			name = strings.TrimPrefix(strings.Join(fields[1:], " "), "*")
+		}
+		manifest[name] = digest
+	}
+	return scanner.Err()
+}
+
+func findZipMember(files []*zip.File, name string) *zip.File {
+	for _, f := range files {
+		if f.Name == name {
+			return f
+		}
+	}
+	for _, f := range files {
+		if path.Base(f.Name) == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func digestZipMember(f *zip.File) (string, error) {
+	r, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	digest, _, err := digestReader(r)
+	return digest, err
+}
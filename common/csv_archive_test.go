@@ -0,0 +1,133 @@
+package common
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const archiveCsv = diffCsvHeader + "ETH,ETH,100,0xaaa,1,I am an OKX address,0x01,,\n"
+
+func writeTempZip(t *testing.T, members map[string]string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range members {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fileName := filepath.Join(t.TempDir(), "bundle.zip")
+	if err := ioutil.WriteFile(fileName, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func sha256Hex(content string) string {
+	h := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(h[:])
+}
+
+func TestOpenPorCsvSourceZip(t *testing.T) {
+	manifest := fmt.Sprintf("%s  okx_por.csv\n%s *README.txt\n", sha256Hex(archiveCsv), sha256Hex("readme"))
+	fileName := writeTempZip(t, map[string]string{"okx_por.csv": archiveCsv, "README.txt": "readme", "SHA256SUMS": manifest})
+
+	source, err := OpenPorCsvSource(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source.Member != "okx_por.csv" || source.SHA256 != sha256Hex(archiveCsv) || source.Manifest != "SHA256SUMS" {
+		t.Fatalf("source = %+v", source)
+	}
+	if content, _ := ioutil.ReadFile(source.Path); string(content) != archiveCsv {
+		t.Errorf("extracted content = %q", content)
+	}
+
+	// a member that does not match the manifest fails, even if it is not the selected csv
+	fileName = writeTempZip(t, map[string]string{"okx_por.csv": archiveCsv, "README.txt": "changed", "SHA256SUMS": manifest})
+	if _, err = OpenPorCsvSource(fileName); err == nil || !strings.Contains(err.Error(), "README.txt") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestOpenPorCsvSourceSelectMember(t *testing.T) {
+	fileName := writeTempZip(t, map[string]string{"a/okx_por.csv": archiveCsv, "b/okx_por_staking.csv": archiveCsv, "notes.csv": "a,b\n1,2\n"})
+	if _, err := OpenPorCsvSource(fileName); err == nil || !strings.Contains(err.Error(), "several por csv members") {
+		t.Fatalf("err = %v", err)
+	}
+	source, err := OpenPorCsvSource(fileName + "#okx_por_staking.csv")
+	if err != nil || source.Member != "b/okx_por_staking.csv" {
+		t.Fatalf("source = %+v, err = %v", source, err)
+	}
+}
+
+func TestOpenPorCsvSourceGzip(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(archiveCsv))
+	w.Close()
+	fileName := filepath.Join(t.TempDir(), "okx_por.csv.gz")
+	if err := ioutil.WriteFile(fileName, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := OpenPorCsvSource(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := InitPorCsvDataMap(source.Path)
+	if err != nil || len(data) != 1 || source.SHA256 != sha256Hex(archiveCsv) {
+		t.Fatalf("source = %+v, data = %v, err = %v", source, data, err)
+	}
+}
+
+func TestOpenPorCsvSourceReusesCopy(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+	fileName := writeTempZip(t, map[string]string{"okx_por.csv": archiveCsv})
+
+	first, err := OpenPorCsvSource(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := OpenPorCsvSource(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := ioutil.ReadDir(tmpDir); first.Path != second.Path || len(files) != 1 {
+		t.Fatalf("expected one copy, got %s, %s and %d files", first.Path, second.Path, len(files))
+	}
+
+	// a copy of another size is extracted again rather than trusted
+	if err = ioutil.WriteFile(first.Path, []byte("damaged"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = OpenPorCsvSource(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadFile(first.Path); string(content) != archiveCsv {
+		t.Errorf("copy content = %q", content)
+	}
+
+	// the copies extracted by the process are removed with their index
+	if err = ioutil.WriteFile(first.Path+".idx", nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	RemoveExtractedPorCsv()
+	if files, _ := ioutil.ReadDir(tmpDir); len(files) != 0 {
+		t.Fatalf("expected the copy and its index to be removed, got %d files", len(files))
+	}
+}
@@ -1,141 +1,105 @@
 package common
 
 import (
-	"bufio"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"sort"
-	"strings"
-	"sync"
 )
 
-// Thread-safe CSV file writing lock
-var csvFileLock sync.Mutex
-
-// Load verification result file (only read CSV format failed records)
-func loadVerificationResult(resultFileName string) (map[int]FailedLineInfo, int) {
-	failedLines := make(map[int]FailedLineInfo)
-	lastProcessedLine := 0
-
-	// Convert to CSV filename
-	csvFileName := strings.TrimSuffix(resultFileName, "_result") + "_failed.csv"
+// VerifyCheckpoint records how far a verification run got. Every row up to Line has been verified;
+// the successes are restored on resume, the failed rows are verified again.
+type VerifyCheckpoint struct {
+	// SHA256 is the digest of the verified csv, a checkpoint of another file is not resumed
+	SHA256  string           `json:"sha256"`
+	Line    int              `json:"line"`
+	Success map[string]int   `json:"success"`
+	Quorums map[string]int   `json:"quorums,omitempty"`
+	Failed  []FailedLineInfo `json:"failed"`
+
+	failedLines map[int]bool
+}
 
-	file, err := os.Open(csvFileName)
-	if err != nil {
-		return failedLines, lastProcessedLine // Return empty if file doesn't exist
+// IsRetry reports whether a row still has to be verified after resuming from the checkpoint.
+func (cp *VerifyCheckpoint) IsRetry(line int) bool {
+	if line > cp.Line {
+		return true
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	lineCount := 0
-	for scanner.Scan() {
-		lineCount++
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || lineCount == 1 { // Skip empty lines and header
-			continue
-		}
-
-		// Parse CSV format: digitalAsset,network,address,errorMessage
-		parts := strings.Split(line, ",")
-		if len(parts) >= 3 {
-			// Since CSV doesn't have line number info, we use a virtual line number
-			// This is mainly for marking these addresses for re-verification
-			errorMsg := "Need re-verification"
-			if len(parts) >= 4 {
-				// Handle error messages that might be surrounded by quotes
-				errorMsg = strings.TrimSpace(parts[3])
-				if strings.HasPrefix(errorMsg, "\"") && strings.HasSuffix(errorMsg, "\"") {
-					errorMsg = strings.TrimPrefix(strings.TrimSuffix(errorMsg, "\""), "\"")
-					// Restore CSV escaped double quotes
-					errorMsg = strings.ReplaceAll(errorMsg, "\"\"", "\"")
-				}
-			}
-
-			failedLines[lineCount] = FailedLineInfo{
-				LineNumber:   lineCount,
-				Coin:         strings.TrimSpace(parts[1]), // network
-				DigitalAsset: strings.TrimSpace(parts[0]), // digitalAsset
-				Address:      strings.TrimSpace(parts[2]), // address
-				ErrorMessage: errorMsg,
-			}
+	if cp.failedLines == nil {
+		cp.failedLines = make(map[int]bool, len(cp.Failed))
+		for _, f := range cp.Failed {
+			cp.failedLines[f.LineNumber] = true
 		}
 	}
-
-	return failedLines, lastProcessedLine
+	return cp.failedLines[line]
 }
 
-// Save verification result
-func saveVerificationResult(resultFileName string, failedLines map[int]FailedLineInfo, lastProcessedLine int) {
-	// Only save CSV format failed records, no txt suffix
-	csvFileName := strings.TrimSuffix(resultFileName, "_result") + "_failed.csv"
-
-	if len(failedLines) > 0 {
-		saveFailedAsCSV(csvFileName, failedLines)
-	} else {
-		fmt.Printf("No failed records in current batch, processed to line %d\n", lastProcessedLine)
+// Checkpoint returns the checkpoint of the results collected up to line. The caller must make sure
+// that no row after line has been collected yet, e.g. with WorkerPool.Wait.
+func (rc *ResultCollector) Checkpoint(sha256 string, line int) *VerifyCheckpoint {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	cp := &VerifyCheckpoint{SHA256: sha256, Line: line, Success: make(map[string]int), Quorums: make(map[string]int, len(rc.quorumStats)), Failed: make([]FailedLineInfo, 0, len(rc.failedLines))}
+	for coin, stats := range rc.coinStats {
+		if stats["success"] > 0 {
+			cp.Success[coin] = stats["success"]
+		}
 	}
+	for quorum, count := range rc.quorumStats {
+		cp.Quorums[quorum] = count
+	}
+	for _, f := range rc.failedLines {
+		cp.Failed = append(cp.Failed, f)
+	}
+	sort.Slice(cp.Failed, func(i, j int) bool { return cp.Failed[i].LineNumber < cp.Failed[j].LineNumber })
+	return cp
 }
 
-// Save failed records as CSV
-func saveFailedAsCSV(csvFileName string, failedLines map[int]FailedLineInfo) {
-	csvFileLock.Lock()
-	defer csvFileLock.Unlock()
-
-	// Check if file exists and read existing records to avoid duplicates
-	existingRecords := make(map[string]bool)
-	if file, err := os.Open(csvFileName); err == nil {
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
-			if line != "" {
-				existingRecords[line] = true
-			}
+// Restore adds the successes of a checkpoint, the rows it covers are skipped instead of verified again
+func (rc *ResultCollector) Restore(cp *VerifyCheckpoint) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for coin, count := range cp.Success {
+		if rc.coinStats[coin] == nil {
+			rc.coinStats[coin] = make(map[string]int)
 		}
-		file.Close()
+		rc.coinStats[coin]["success"] += count
+		rc.successCount += int64(count)
 	}
+	for quorum, count := range cp.Quorums {
+		rc.quorumStats[quorum] += count
+	}
+}
 
-	// Open file for appending (create if doesn't exist)
-	file, err := os.OpenFile(csvFileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+// LoadVerifyCheckpoint reads a checkpoint, it returns nil without error when the file does not exist.
+func LoadVerifyCheckpoint(fileName, sha256 string) (*VerifyCheckpoint, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
 	if err != nil {
-		fmt.Printf("Failed to create CSV file: %v\n", err)
-		return
+		return nil, err
 	}
-	defer file.Close()
-
-	// Write CSV header if file is empty
-	if len(existingRecords) == 0 {
-		fmt.Fprintf(file, "digitalAsset,network,address,errorMessage\n")
+	cp := &VerifyCheckpoint{}
+	if err = json.Unmarshal(b, cp); err != nil {
+		return nil, fmt.Errorf("read checkpoint %s: %w", fileName, err)
 	}
-
-	// Collect and sort failed line numbers
-	var lineNumbers []int
-	for lineNum := range failedLines {
-		lineNumbers = append(lineNumbers, lineNum)
+	if cp.SHA256 != sha256 {
+		return nil, fmt.Errorf("checkpoint %s was written for sha256 %s, the csv has sha256 %s", fileName, cp.SHA256, sha256)
 	}
-	sort.Ints(lineNumbers)
-
-	// Write failed records, including error information
-	newRecordsCount := 0
-	for _, lineNum := range lineNumbers {
-		failedInfo := failedLines[lineNum]
-		// Escape special characters in CSV (commas, newlines, double quotes)
-		errorMsg := failedInfo.ErrorMessage
-		if strings.Contains(errorMsg, ",") || strings.Contains(errorMsg, "\n") || strings.Contains(errorMsg, "\"") {
-			errorMsg = "\"" + strings.ReplaceAll(errorMsg, "\"", "\"\"") + "\""
-		}
-
-		recordLine := fmt.Sprintf("%s,%s,%s,%s",
-			failedInfo.DigitalAsset,
-			failedInfo.Coin, // network is coin
-			failedInfo.Address,
-			errorMsg)
+	return cp, nil
+}
 
-		// Only write if record doesn't already exist
-		if !existingRecords[recordLine] {
-			fmt.Fprintf(file, "%s\n", recordLine)
-			newRecordsCount++
-		}
+// SaveVerifyCheckpoint writes a checkpoint, replacing the previous one only once it is complete.
+func SaveVerifyCheckpoint(fileName string, cp *VerifyCheckpoint) error {
+	b, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
 	}
-
-	fmt.Printf("Saved failed records CSV file: %s, new failed lines: %d, total: %d\n", csvFileName, newRecordsCount, len(failedLines))
+	tmp := fileName + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fileName)
 }
@@ -0,0 +1,527 @@
+package common
+
+import (
+	"bufio"
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const porIndexVersion = "porindex\tv1"
+
+// porIndexChunkSize is the number of index entries sorted in memory before they are spilled to a
+// temporary file, it bounds the memory used to build the index of a file of any size.
+var porIndexChunkSize = 1 << 20
+
+var porIndexEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`)
+
+// PorCsvIndex maps the rows of a PoR file to their byte offset. The index is a sorted text file,
+// one "coin,address,network,type,offset,line,header offset,header line" entry per line, that is
+// built once next to the PoR file and binary searched on disk, so a lookup reads a few blocks
+// instead of the whole file.
+type PorCsvIndex struct {
+	csv       *os.File
+	csvSize   int64
+	idx       *os.File
+	idxSize   int64
+	dataStart int64
+
+	// mu guards the index file, which is built again when a row does not match its entry
+	mu            sync.RWMutex
+	indexFileName string
+	version       string
+
+	headerMu sync.Mutex
+	headers  map[int64]*PorCsvHeader
+}
+
+type porIndexEntry struct {
+	key          PorCoinKey
+	offset       int64
+	line         int
+	headerOffset int64
+	headerLine   int
+}
+
+// OpenPorCsvIndex opens the index of a PoR file and builds it when it is missing or older than the
+// file, or when a row read through it is not the row of its entry. indexFileName defaults to the
+// PoR file name with an ".idx" suffix.
+func OpenPorCsvIndex(csvFileName, indexFileName string) (*PorCsvIndex, error) {
+	if indexFileName == "" {
+		indexFileName = csvFileName + ".idx"
+	}
+	csv, err := os.Open(csvFileName)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := csv.Stat()
+	if err != nil {
+		csv.Close()
+		return nil, err
+	}
+	version := fmt.Sprintf("%s\t%d\t%d\n", porIndexVersion, stat.Size(), stat.ModTime().UnixNano())
+
+	idx, err := openPorIndexFile(indexFileName, version)
+	if err != nil {
+		csv.Close()
+		return nil, err
+	}
+	if idx == nil {
+		log.Infof("building por index %s, this may take a while...", indexFileName)
+		if err = buildPorCsvIndex(csv, indexFileName, version); err != nil {
+			csv.Close()
+			return nil, err
+		}
+		if idx, err = openPorIndexFile(indexFileName, version); err != nil || idx == nil {
+			csv.Close()
+			return nil, fmt.Errorf("open por index %s failed, error: %v", indexFileName, err)
+		}
+	}
+	idxStat, err := idx.Stat()
+	if err != nil {
+		csv.Close()
+		idx.Close()
+		return nil, err
+	}
+
+	return &PorCsvIndex{
+		csv:           csv,
+		csvSize:       stat.Size(),
+		idx:           idx,
+		idxSize:       idxStat.Size(),
+		dataStart:     int64(len(version)),
+		indexFileName: indexFileName,
+		version:       version,
+		headers:       make(map[int64]*PorCsvHeader),
+	}, nil
+}
+
+// errPorIndexStale is returned by readRow when the row at an offset is not the one of the entry,
+// the file changed without changing its size and modification time.
+var errPorIndexStale = errors.New("por index does not match the file")
+
+// rebuild builds the index again, after a row did not match its entry.
+func (x *PorCsvIndex) rebuild() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	log.Warnf("por index %s does not match %s, building it again", x.indexFileName, x.csv.Name())
+	x.idx.Close()
+	if err := buildPorCsvIndex(x.csv, x.indexFileName, x.version); err != nil {
+		return err
+	}
+	idx, err := openPorIndexFile(x.indexFileName, x.version)
+	if err != nil || idx == nil {
+		return fmt.Errorf("open por index %s failed, error: %v", x.indexFileName, err)
+	}
+	idxStat, err := idx.Stat()
+	if err != nil {
+		idx.Close()
+		return err
+	}
+	x.idx, x.idxSize = idx, idxStat.Size()
+	x.headerMu.Lock()
+	x.headers = make(map[int64]*PorCsvHeader)
+	x.headerMu.Unlock()
+	return nil
+}
+
+// openPorIndexFile returns nil when the index does not exist or was built for another version of
+// the PoR file.
+func openPorIndexFile(indexFileName, version string) (*os.File, error) {
+	idx, err := os.Open(indexFileName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	first, err := bufio.NewReader(idx).ReadString('\n')
+	if err != nil || first != version {
+		idx.Close()
+		return nil, nil
+	}
+	return idx, nil
+}
+
+func (x *PorCsvIndex) Close() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.idx.Close()
+	return x.csv.Close()
+}
+
+// Get returns the row of a key, nil when the file has no such row.
+func (x *PorCsvIndex) Get(key PorCoinKey) (*CoinData, error) {
+	rows, err := x.lookup(encodePorIndexKey(key.Coin, key.Address)+porIndexEscaper.Replace(key.Network)+"\t"+porIndexEscaper.Replace(key.Type)+"\t", true)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return rows[0], nil
+}
+
+// Find returns the rows of an address on every network and type.
+func (x *PorCsvIndex) Find(coin, address string) ([]*CoinData, error) {
+	return x.lookup(encodePorIndexKey(coin, address), false)
+}
+
+// lookup reads the rows of the entries starting with prefix, the first one only when first is
+// set. The index is built again once when a row does not match its entry.
+func (x *PorCsvIndex) lookup(prefix string, first bool) ([]*CoinData, error) {
+	rows, err := x.readRows(prefix, first)
+	if err == errPorIndexStale {
+		if err = x.rebuild(); err != nil {
+			return nil, err
+		}
+		if rows, err = x.readRows(prefix, first); err == errPorIndexStale {
+			return nil, fmt.Errorf("%w, the file is changing", err)
+		}
+	}
+	return rows, err
+}
+
+func (x *PorCsvIndex) readRows(prefix string, first bool) ([]*CoinData, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	entries, err := x.search(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if first && len(entries) > 1 {
+		entries = entries[:1]
+	}
+	rows := make([]*CoinData, 0, len(entries))
+	for _, e := range entries {
+		d, err := x.readRow(e)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, d)
+	}
+	return rows, nil
+}
+
+// search returns the entries starting with prefix.
+func (x *PorCsvIndex) search(prefix string) ([]*porIndexEntry, error) {
+	lo, hi := x.dataStart, x.idxSize
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, line, err := x.lineAt(mid)
+		if err != nil {
+			return nil, err
+		}
+		if start >= hi || line >= prefix {
+			hi = mid
+		} else {
+			lo = start + int64(len(line)) + 1
+		}
+	}
+
+	entries := make([]*porIndexEntry, 0)
+	for pos := lo; pos < x.idxSize; {
+		start, line, err := x.lineAt(pos)
+		if err != nil {
+			return nil, err
+		}
+		if start >= x.idxSize || (line >= prefix && !strings.HasPrefix(line, prefix)) {
+			break
+		}
+		if strings.HasPrefix(line, prefix) {
+			e, err := decodePorIndexEntry(line)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+		}
+		pos = start + int64(len(line)) + 1
+	}
+	return entries, nil
+}
+
+// lineAt returns the first index line starting at or after pos.
+func (x *PorCsvIndex) lineAt(pos int64) (int64, string, error) {
+	start := pos
+	if pos > x.dataStart {
+		start = pos - 1
+	}
+	r := bufio.NewReaderSize(io.NewSectionReader(x.idx, start, x.idxSize-start), 512)
+	if pos > x.dataStart {
+		skipped, err := r.ReadString('\n')
+		if err == io.EOF {
+			return x.idxSize, "", nil
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		start += int64(len(skipped))
+	}
+	line, err := r.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return x.idxSize, "", nil
+	}
+	if err != nil && err != io.EOF {
+		return 0, "", err
+	}
+	return start, strings.TrimSuffix(line, "\n"), nil
+}
+
+func (x *PorCsvIndex) readRow(e *porIndexEntry) (*CoinData, error) {
+	header, err := x.header(e)
+	if err != nil {
+		return nil, err
+	}
+	r := &PorCsvReader{
+		r:       bufio.NewReaderSize(io.NewSectionReader(x.csv, e.offset, x.csvSize-e.offset), 4096),
+		line:    e.line - 1,
+		offset:  e.offset,
+		header:  header,
+		summary: &PorSummary{},
+	}
+	d, err := r.Read()
+	if err != nil {
+		return nil, errPorIndexStale
+	}
+	normalizePorCoinData(d)
+	if d.Key() != e.key {
+		return nil, errPorIndexStale
+	}
+	return d, nil
+}
+
+func (x *PorCsvIndex) header(e *porIndexEntry) (*PorCsvHeader, error) {
+	x.headerMu.Lock()
+	defer x.headerMu.Unlock()
+	if h, exist := x.headers[e.headerOffset]; exist {
+		return h, nil
+	}
+	r := &PorCsvReader{
+		r:       bufio.NewReaderSize(io.NewSectionReader(x.csv, e.headerOffset, x.csvSize-e.headerOffset), 4096),
+		line:    e.headerLine - 1,
+		offset:  e.headerOffset,
+		summary: &PorSummary{},
+	}
+	line, fields, err := r.readRecord()
+	if err != nil {
+		return nil, err
+	}
+	r.readHeader(line, e.headerOffset, fields)
+	if r.err != nil {
+		return nil, r.err
+	}
+	x.headers[e.headerOffset] = r.header
+	return r.header, nil
+}
+
+// buildPorCsvIndex streams the PoR file, sorts the entries in chunks of porIndexChunkSize and
+// merges the chunks into the index. Rows that repeat a key are reported as an error.
+func buildPorCsvIndex(csv *os.File, indexFileName, version string) error {
+	if _, err := csv.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	tmpDir, err := ioutil.TempDir("", "porindex")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	chunkFiles := make([]string, 0)
+	chunk := make([]string, 0)
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		sort.Strings(chunk)
+		fileName := filepath.Join(tmpDir, strconv.Itoa(len(chunkFiles)))
+		if err := ioutil.WriteFile(fileName, []byte(strings.Join(chunk, "\n")+"\n"), 0600); err != nil {
+			return err
+		}
+		chunkFiles = append(chunkFiles, fileName)
+		chunk = chunk[:0]
+		return nil
+	}
+
+	reader := NewPorCsvReader(csv)
+	for {
+		d, offset, err := reader.read()
+		if err == io.EOF {
+			break
+		}
+		if _, ok := err.(*CsvError); ok {
+			log.Errorf("skip %s: %s", csv.Name(), err)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read %s: %w", csv.Name(), err)
+		}
+		normalizePorCoinData(d)
+		h := reader.Header()
+		chunk = append(chunk, encodePorIndexEntry(&porIndexEntry{key: d.Key(), offset: offset, line: d.Line, headerOffset: h.Offset, headerLine: h.Line}))
+		if len(chunk) >= porIndexChunkSize {
+			if err = flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err = flush(); err != nil {
+		return err
+	}
+
+	tmpIndex := indexFileName + ".tmp"
+	if err = mergePorIndexChunks(chunkFiles, tmpIndex, version); err != nil {
+		os.Remove(tmpIndex)
+		return err
+	}
+	return os.Rename(tmpIndex, indexFileName)
+}
+
+type porIndexChunk struct {
+	scanner *bufio.Scanner
+	line    string
+}
+
+type porIndexChunkHeap []*porIndexChunk
+
+func (h porIndexChunkHeap) Len() int            { return len(h) }
+func (h porIndexChunkHeap) Less(i, j int) bool  { return h[i].line < h[j].line }
+func (h porIndexChunkHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *porIndexChunkHeap) Push(x interface{}) { *h = append(*h, x.(*porIndexChunk)) }
+func (h *porIndexChunkHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+func mergePorIndexChunks(chunkFiles []string, indexFileName, version string) error {
+	out, err := os.Create(indexFileName)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	if _, err = w.WriteString(version); err != nil {
+		return err
+	}
+
+	h := make(porIndexChunkHeap, 0, len(chunkFiles))
+	for _, fileName := range chunkFiles {
+		f, err := os.Open(fileName)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		c := &porIndexChunk{scanner: bufio.NewScanner(f)}
+		c.scanner.Buffer(make([]byte, 64*1024), 1<<20)
+		if c.scanner.Scan() {
+			c.line = c.scanner.Text()
+			h = append(h, c)
+		}
+	}
+	heap.Init(&h)
+
+	duplicates := make([]string, 0)
+	var last *porIndexEntry
+	for h.Len() > 0 {
+		c := h[0]
+		e, err := decodePorIndexEntry(c.line)
+		if err != nil {
+			return err
+		}
+		if last != nil && last.key == e.key {
+			first, repeat := last.line, e.line
+			if repeat < first {
+				first, repeat = repeat, first
+			}
+			duplicates = append(duplicates, fmt.Sprintf("line %d repeats line %d (%s)", repeat, first, e.key))
+		} else {
+			if _, err = w.WriteString(c.line + "\n"); err != nil {
+				return err
+			}
+			last = e
+		}
+
+		if c.scanner.Scan() {
+			c.line = c.scanner.Text()
+			heap.Fix(&h, 0)
+		} else {
+			if err = c.scanner.Err(); err != nil {
+				return err
+			}
+			heap.Pop(&h)
+		}
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("%d duplicate rows: %s", len(duplicates), strings.Join(duplicates, "; "))
+	}
+	return w.Flush()
+}
+
+// encodePorIndexKey returns the coin and address prefix of an entry, entries of one address on
+// every network are adjacent in the index.
+func encodePorIndexKey(coin, address string) string {
+	return porIndexEscaper.Replace(strings.ToUpper(coin)) + "\t" + porIndexEscaper.Replace(address) + "\t"
+}
+
+func encodePorIndexEntry(e *porIndexEntry) string {
+	return fmt.Sprintf("%s%s\t%s\t%d\t%d\t%d\t%d", encodePorIndexKey(e.key.Coin, e.key.Address),
+		porIndexEscaper.Replace(e.key.Network), porIndexEscaper.Replace(e.key.Type), e.offset, e.line, e.headerOffset, e.headerLine)
+}
+
+func decodePorIndexEntry(line string) (*porIndexEntry, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 8 {
+		return nil, fmt.Errorf("invalid por index entry %q", line)
+	}
+	numbers := make([]int64, 4)
+	for i := range numbers {
+		n, err := strconv.ParseInt(fields[4+i], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid por index entry %q", line)
+		}
+		numbers[i] = n
+	}
+	return &porIndexEntry{
+		key: PorCoinKey{
+			Coin:    unescapePorIndexField(fields[0]),
+			Address: unescapePorIndexField(fields[1]),
+			Network: unescapePorIndexField(fields[2]),
+			Type:    unescapePorIndexField(fields[3]),
+		},
+		offset:       numbers[0],
+		line:         int(numbers[1]),
+		headerOffset: numbers[2],
+		headerLine:   int(numbers[3]),
+	}, nil
+}
+
+func unescapePorIndexField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 't':
+				b.WriteByte('\t')
+			case 'n':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
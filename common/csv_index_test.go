@@ -0,0 +1,117 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPorCsvIndex(t *testing.T) {
+	defer func(size int) { porIndexChunkSize = size }(porIndexChunkSize)
+	porIndexChunkSize = 7
+
+	var content strings.Builder
+	content.WriteString(diffCsvHeader)
+	for i := 0; i < 200; i++ {
+		content.WriteString(fmt.Sprintf("ETH,ETH,100,0x%04x,%d,I am an OKX address,0x01,,\n", i, i))
+		if i%10 == 0 {
+			content.WriteString(fmt.Sprintf("ETH,ARBITRUM,100,0x%04x,%d.5,\"I am an OKX address, quoted\",0x02,,\n", i, i))
+		}
+	}
+	fileName := writeTempCsv(t, "por.csv", content.String())
+
+	index, err := OpenPorCsvIndex(fileName, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+
+	for i := 0; i < 200; i++ {
+		address := fmt.Sprintf("0x%04x", i)
+		d, err := index.Get(PorCoinKey{Coin: "ETH", Network: "ETH", Address: address})
+		if err != nil || d == nil || d.Balance != fmt.Sprint(i) || d.Line != 5+i+(i+9)/10 {
+			t.Fatalf("get %s = %+v, %v", address, d, err)
+		}
+		rows, err := index.Find("eth", address)
+		if want := 1 + map[bool]int{true: 1}[i%10 == 0]; err != nil || len(rows) != want {
+			t.Fatalf("find %s = %d rows, %v", address, len(rows), err)
+		}
+	}
+	rows, _ := index.Find("ETH", "0x0014")
+	if rows[0].Network != "ARBITRUM" || rows[0].Message != "I am an OKX address, quoted" {
+		t.Errorf("row = %+v", rows[0])
+	}
+	for _, address := range []string{"0x", "0x00c8", "0xffff"} {
+		if rows, err := index.Find("ETH", address); err != nil || len(rows) != 0 {
+			t.Errorf("find %s = %v, %v", address, rows, err)
+		}
+	}
+	if d, err := index.Get(PorCoinKey{Coin: "BTC", Network: "ETH", Address: "0x0001"}); d != nil || err != nil {
+		t.Errorf("get other coin = %+v, %v", d, err)
+	}
+}
+
+func TestPorCsvIndexRebuild(t *testing.T) {
+	fileName := writeTempCsv(t, "por.csv", diffCsvHeader+"ETH,ETH,100,0xaaa,1,I am an OKX address,0x01,,\n")
+	index, err := OpenPorCsvIndex(fileName, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.Close()
+
+	// a changed file is indexed again, a repeated key fails the build
+	content := diffCsvHeader + "ETH,ETH,100,0xbbb,2,I am an OKX address,0x01,,\nETH,ETH,100,0xbbb,2,I am an OKX address,0x01,,\n"
+	if err = ioutil.WriteFile(fileName, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(fileName, time.Now(), time.Now().Add(time.Second))
+	if _, err = OpenPorCsvIndex(fileName, ""); err == nil || !strings.Contains(err.Error(), "line 6 repeats line 5") {
+		t.Fatalf("err = %v", err)
+	}
+
+	content = diffCsvHeader + "ETH,ETH,100,0xbbb,2,I am an OKX address,0x01,,\n"
+	if err = ioutil.WriteFile(fileName, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	index, err = OpenPorCsvIndex(fileName, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	if d, _ := index.Get(PorCoinKey{Coin: "ETH", Network: "ETH", Address: "0xbbb"}); d == nil || d.Balance != "2" {
+		t.Errorf("row = %+v", d)
+	}
+}
+
+func TestPorCsvIndexStaleRow(t *testing.T) {
+	fileName := writeTempCsv(t, "por.csv", diffCsvHeader+"ETH,ETH,100,0xaaa,1,I am an OKX address,0x01,,\n")
+	stat, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := OpenPorCsvIndex(fileName, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.Close()
+
+	// the same size and modification time do not show the change, the row read does
+	if err = ioutil.WriteFile(fileName, []byte(diffCsvHeader+"ETH,ETH,100,0xbbb,2,I am an OKX address,0x01,,\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(fileName, stat.ModTime(), stat.ModTime())
+	index, err = OpenPorCsvIndex(fileName, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	if d, err := index.Get(PorCoinKey{Coin: "ETH", Network: "ETH", Address: "0xaaa"}); d != nil || err != nil {
+		t.Fatalf("expected the replaced row to be gone, got %+v %v", d, err)
+	}
+	if rows, err := index.Find("ETH", "0xbbb"); err != nil || len(rows) != 1 || rows[0].Balance != "2" {
+		t.Fatalf("rows = %v, err = %v", rows, err)
+	}
+}
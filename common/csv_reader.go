@@ -0,0 +1,346 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const utf8BOM = "\uFEFF"
+
+// Canonical column names of the detail section. Headers are matched case-insensitively with
+// spaces, underscores and hyphens removed, see porCsvColumnAliases.
+const (
+	ColumnCoin           = "coin"
+	ColumnDigitalAsset   = "digitalAsset"
+	ColumnType           = "type"
+	ColumnNetwork        = "network"
+	ColumnSnapshotHeight = "snapshotHeight"
+	ColumnAddress        = "address"
+	ColumnBalance        = "amount"
+	ColumnMessage        = "message"
+	ColumnSign1          = "signature1"
+	ColumnSign2          = "signature2"
+	ColumnScript         = "script"
+	ColumnEOA1           = "eoa1"
+	ColumnEOA2           = "eoa2"
+	ColumnStatus         = "status"
+)
+
+var porCsvColumnAliases = map[string]string{
+	"coin":                   ColumnCoin,
+	"digitalasset":           ColumnDigitalAsset,
+	"type":                   ColumnType,
+	"network":                ColumnNetwork,
+	"snapshotheight":         ColumnSnapshotHeight,
+	"height":                 ColumnSnapshotHeight,
+	"address":                ColumnAddress,
+	"amount":                 ColumnBalance,
+	"balance":                ColumnBalance,
+	"message":                ColumnMessage,
+	"signature1":             ColumnSign1,
+	"signedmessage":          ColumnSign1,
+	"signature2":             ColumnSign2,
+	"signedmessage2":         ColumnSign2,
+	"redeemscript/publickey": ColumnScript,
+	"redeemscript":           ColumnScript,
+	"publickey":              ColumnScript,
+	"script":                 ColumnScript,
+	"eoa1":                   ColumnEOA1,
+	"owner1":                 ColumnEOA1,
+	"eoa2":                   ColumnEOA2,
+	"owner2":                 ColumnEOA2,
+	"status":                 ColumnStatus,
+}
+
+// CsvError reports a problem with one line of a PoR file. Row errors are returned by
+// PorCsvReader.Read and reading can continue with the next row.
+type CsvError struct {
+	Line int
+	Msg  string
+}
+
+func (e *CsvError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// CsvHeaderError reports a detail header that lacks a required column. It is sticky, every
+// later Read returns it again.
+type CsvHeaderError struct {
+	Line    int
+	Missing []string
+}
+
+func (e *CsvHeaderError) Error() string {
+	return fmt.Sprintf("line %d: header is missing required columns %s", e.Line, strings.Join(e.Missing, ","))
+}
+
+// CsvQuoteError reports a quoted field that is never closed. The field has consumed the rest of
+// the file, so the error is final and every later Read returns it again.
+type CsvQuoteError struct {
+	Line int
+}
+
+func (e *CsvQuoteError) Error() string {
+	return fmt.Sprintf("line %d: quoted field is not closed", e.Line)
+}
+
+// PorCsvHeader maps canonical column names to their index in a detail section.
+type PorCsvHeader struct {
+	Line    int
+	Offset  int64
+	Names   []string
+	columns map[string]int
+}
+
+// Has reports whether the header contains the canonical column.
+func (h *PorCsvHeader) Has(column string) bool {
+	_, exist := h.columns[column]
+	return exist
+}
+
+func (h *PorCsvHeader) get(fields []string, column string) string {
+	i, exist := h.columns[column]
+	if !exist || i >= len(fields) {
+		return ""
+	}
+	return strings.TrimSpace(fields[i])
+}
+
+// PorCsvReader reads PoR files of every published layout: the PoR report (summary section
+// followed by a 9, 11 or 12-column detail section with an optional Type column) and the
+// digitalAsset/network layout. Columns are mapped by header name, fields follow RFC 4180
+// quoting and may span lines, a leading BOM is ignored, and commas inside unquoted [...] or
+// {...} groups do not split a field.
+type PorCsvReader struct {
+	r        *bufio.Reader
+	line     int
+	offset   int64
+	header   *PorCsvHeader
+	summary  *PorSummary
+	inHeader bool
+	warnings []*CsvError
+	err      error
+}
+
+func NewPorCsvReader(r io.Reader) *PorCsvReader {
+	return &PorCsvReader{r: bufio.NewReaderSize(r, 1<<20), summary: &PorSummary{}}
+}
+
+// Summary returns the summary rows read so far. The summary section precedes the detail
+// section, so it is complete once the first detail row has been returned.
+func (r *PorCsvReader) Summary() *PorSummary {
+	return r.summary
+}
+
+// Header returns the current detail header, nil before one has been read.
+func (r *PorCsvReader) Header() *PorCsvHeader {
+	return r.header
+}
+
+// Warnings returns unknown header columns with their line numbers.
+func (r *PorCsvReader) Warnings() []*CsvError {
+	return r.warnings
+}
+
+// Read returns the next detail row, or io.EOF at the end of the file. A *CsvError only
+// concerns that row, any other error is final.
+func (r *PorCsvReader) Read() (*CoinData, error) {
+	row, _, err := r.read()
+	return row, err
+}
+
+// read also returns the byte offset the row starts at.
+func (r *PorCsvReader) read() (*CoinData, int64, error) {
+	for r.err == nil {
+		offset := r.offset
+		line, fields, err := r.readRecord()
+		if err != nil {
+			r.err = err
+			break
+		}
+		if fields == nil {
+			continue
+		}
+
+		if isPorCsvHeader(fields) {
+			r.readHeader(line, offset, fields)
+			continue
+		}
+		if r.header == nil {
+			return nil, offset, &CsvError{Line: line, Msg: "row before any header"}
+		}
+		if r.inHeader {
+			row, err := ParsePorSummaryRow(line, fields)
+			if err != nil {
+				return nil, offset, &CsvError{Line: line, Msg: err.Error()}
+			}
+			r.summary.Add(row)
+			continue
+		}
+		row, err := r.parseRow(line, fields)
+		return row, offset, err
+	}
+	return nil, r.offset, r.err
+}
+
+func (r *PorCsvReader) readHeader(line int, offset int64, fields []string) {
+	names := make([]string, len(fields))
+	columns := make(map[string]int)
+	for i, field := range fields {
+		names[i] = strings.TrimSpace(field)
+		column, exist := porCsvColumnAliases[normalizeCsvColumn(field)]
+		if !exist {
+			if names[i] != "" {
+				r.warnings = append(r.warnings, &CsvError{Line: line, Msg: fmt.Sprintf("unknown column %q", names[i])})
+			}
+			continue
+		}
+		if _, dup := columns[column]; dup {
+			r.warnings = append(r.warnings, &CsvError{Line: line, Msg: fmt.Sprintf("duplicate column %q", names[i])})
+			continue
+		}
+		columns[column] = i
+	}
+	r.header = &PorCsvHeader{Line: line, Offset: offset, Names: names, columns: columns}
+
+	// "coin,snapshot height,amount" starts the summary section
+	_, hasAddress := columns[ColumnAddress]
+	r.inHeader = !hasAddress && len(fields) == 3
+	if r.inHeader {
+		return
+	}
+
+	missing := make([]string, 0)
+	for _, column := range []string{ColumnAddress, ColumnMessage, ColumnSign1} {
+		if _, exist := columns[column]; !exist {
+			missing = append(missing, column)
+		}
+	}
+	_, hasCoin := columns[ColumnCoin]
+	_, hasNetwork := columns[ColumnNetwork]
+	if !hasCoin && !hasNetwork {
+		missing = append(missing, ColumnCoin)
+	}
+	if len(missing) > 0 {
+		r.err = &CsvHeaderError{Line: line, Missing: missing}
+	}
+}
+
+func (r *PorCsvReader) parseRow(line int, fields []string) (*CoinData, error) {
+	h := r.header
+	if len(fields) > len(h.Names) {
+		return nil, &CsvError{Line: line, Msg: fmt.Sprintf("row has %d columns, the header at line %d has %d", len(fields), h.Line, len(h.Names))}
+	}
+	for _, column := range []string{ColumnCoin, ColumnNetwork, ColumnAddress, ColumnMessage, ColumnSign1} {
+		if i, exist := h.columns[column]; exist && i >= len(fields) {
+			return nil, &CsvError{Line: line, Msg: fmt.Sprintf("row has %d columns, fewer than the header at line %d", len(fields), h.Line)}
+		}
+	}
+
+	d := &CoinData{
+		Line:           line,
+		Coin:           h.get(fields, ColumnCoin),
+		DigitalAsset:   h.get(fields, ColumnDigitalAsset),
+		Type:           h.get(fields, ColumnType),
+		Network:        h.get(fields, ColumnNetwork),
+		SnapshotHeight: h.get(fields, ColumnSnapshotHeight),
+		Address:        h.get(fields, ColumnAddress),
+		Balance:        h.get(fields, ColumnBalance),
+		Message:        h.get(fields, ColumnMessage),
+		Sign1:          h.get(fields, ColumnSign1),
+		Sign2:          h.get(fields, ColumnSign2),
+		Script:         h.get(fields, ColumnScript),
+		EOA1:           h.get(fields, ColumnEOA1),
+		EOA2:           h.get(fields, ColumnEOA2),
+		Status:         h.get(fields, ColumnStatus),
+	}
+	// the digitalAsset layout has no coin column, its network column names the coin to verify
+	if !h.Has(ColumnCoin) {
+		d.Coin = d.Network
+	}
+	return d, nil
+}
+
+// readRecord reads one logical record, which spans several lines when a quoted field contains
+// a line break. Blank lines return nil fields.
+func (r *PorCsvReader) readRecord() (int, []string, error) {
+	var fields []string
+	var field strings.Builder
+	quoted, inQuotes, depth, start := false, false, 0, 0
+
+	for {
+		text, err := r.r.ReadString('\n')
+		if len(text) == 0 && err != nil {
+			if inQuotes {
+				return start, nil, &CsvQuoteError{Line: start}
+			}
+			return start, nil, err
+		}
+		r.line++
+		r.offset += int64(len(text))
+		if start == 0 {
+			start = r.line
+			if r.line == 1 {
+				text = strings.TrimPrefix(text, utf8BOM)
+			}
+			if strings.TrimSpace(text) == "" {
+				return start, nil, nil
+			}
+		}
+		if !inQuotes || err != nil {
+			text = strings.TrimRight(text, "\r\n")
+		}
+
+		for i := 0; i < len(text); i++ {
+			c := text[i]
+			switch {
+			case inQuotes:
+				if c == '"' {
+					if i+1 < len(text) && text[i+1] == '"' {
+						field.WriteByte('"')
+						i++
+					} else {
+						inQuotes = false
+					}
+				} else {
+					field.WriteByte(c)
+				}
+			case c == '"' && field.Len() == 0 && !quoted:
+				inQuotes, quoted = true, true
+			case c == '[' || c == '{':
+				depth++
+				field.WriteByte(c)
+			case (c == ']' || c == '}') && depth > 0:
+				depth--
+				field.WriteByte(c)
+			case c == ',' && depth == 0:
+				fields = append(fields, field.String())
+				field.Reset()
+				quoted = false
+			default:
+				field.WriteByte(c)
+			}
+		}
+		if inQuotes && err == nil {
+			continue
+		}
+		if inQuotes {
+			return start, nil, &CsvQuoteError{Line: start}
+		}
+		fields = append(fields, field.String())
+		return start, fields, nil
+	}
+}
+
+// isPorCsvHeader reports whether a record is a section header, its first column names the coin.
+func isPorCsvHeader(fields []string) bool {
+	column := porCsvColumnAliases[normalizeCsvColumn(fields[0])]
+	return column == ColumnCoin || column == ColumnDigitalAsset
+}
+
+func normalizeCsvColumn(name string) string {
+	name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, utf8BOM)))
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(name)
+}
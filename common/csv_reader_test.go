@@ -0,0 +1,154 @@
+package common
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func readAllRows(t *testing.T, reader *PorCsvReader) ([]*CoinData, []error) {
+	t.Helper()
+	rows, errs := make([]*CoinData, 0), make([]error, 0)
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rows, errs
+		}
+		if _, ok := err.(*CsvError); ok {
+			errs = append(errs, err)
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+}
+
+func TestPorCsvReaderQuoting(t *testing.T) {
+	content := utf8BOM + "coin,snapshot height,amount\r\n" +
+		"ETH(ALL),-,1.5\r\n" +
+		"\r\n" +
+		"coin,Type,Network,Snapshot Height,address,amount,message,signature1,signature2,redeem script/public key,EOA1,EOA2,Comment\r\n" +
+		"ETH,Non Staking,ETH,100,0xaaa,1.5,\"I am an OKX address, \"\"quoted\"\"\",0x01,,,0xeoa1,,\"two\nlines\"\r\n" +
+		"EOS,Non Staking,Vaulta,100,okx,0,msg,[\"SIG_K1_a\",\"SIG_K1_b\"],,{\"threshold\":2,\"keys\":[1,2]},,,\n" +
+		"ETH,Non Staking,ETH\n"
+
+	reader := NewPorCsvReader(strings.NewReader(content))
+	rows, errs := readAllRows(t, reader)
+	if len(rows) != 2 {
+		t.Fatalf("rows = %d", len(rows))
+	}
+	if len(reader.Summary().Rows) != 1 || reader.Summary().Rows[0].Name() != "ETH(ALL)" {
+		t.Fatalf("summary = %+v", reader.Summary().Rows)
+	}
+
+	eth := rows[0]
+	if eth.Line != 5 || eth.Type != "Non Staking" || eth.Message != `I am an OKX address, "quoted"` || eth.EOA1 != "0xeoa1" || eth.Balance != "1.5" {
+		t.Errorf("eth row = %+v", eth)
+	}
+	eos := rows[1]
+	if eos.Line != 7 || eos.Sign1 != `["SIG_K1_a","SIG_K1_b"]` || eos.Script != `{"threshold":2,"keys":[1,2]}` {
+		t.Errorf("eos row = %+v", eos)
+	}
+
+	if len(errs) != 1 || errs[0].(*CsvError).Line != 8 {
+		t.Errorf("errors = %v", errs)
+	}
+	if w := reader.Warnings(); len(w) != 1 || w[0].Line != 4 || !strings.Contains(w[0].Msg, "Comment") {
+		t.Errorf("warnings = %v", w)
+	}
+}
+
+func TestPorCsvReaderDigitalAssetLayout(t *testing.T) {
+	content := "digitalAsset,network,address,signedMessage,signedMessage2,message,publicKey,owner1,owner2,status\n" +
+		"USDT,ETH,0xaaa,0x01,null,OKC_DTT_AUP2025,,0xo1,0xo2,5\n"
+	rows, errs := readAllRows(t, NewPorCsvReader(strings.NewReader(content)))
+	if len(rows) != 1 || len(errs) != 0 {
+		t.Fatalf("rows = %v, errors = %v", rows, errs)
+	}
+	row := rows[0]
+	if row.Coin != "ETH" || row.DigitalAsset != "USDT" || row.Sign2 != "null" || row.EOA2 != "0xo2" || row.Status != "5" {
+		t.Errorf("row = %+v", row)
+	}
+}
+
+func TestPorCsvReaderMissingColumns(t *testing.T) {
+	reader := NewPorCsvReader(strings.NewReader("coin,network,address,amount\nETH,ETH,0xaaa,1\n"))
+	_, err := reader.Read()
+	headerErr, ok := err.(*CsvHeaderError)
+	if !ok || headerErr.Line != 1 || strings.Join(headerErr.Missing, ",") != "message,signature1" {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err = reader.Read(); err != headerErr {
+		t.Errorf("a header error must be final, got %v", err)
+	}
+}
+
+func TestPorCsvReaderUnclosedQuote(t *testing.T) {
+	content := "coin,network,address,amount,message,signature1\n" +
+		"ETH,ETH,0xaaa,1,msg,0x01\n" +
+		"ETH,ETH,0xbbb,1,\"msg,0x02\n" +
+		"ETH,ETH,0xccc,1,msg,0x03\n"
+	reader := NewPorCsvReader(strings.NewReader(content))
+	var rows, rowErrors int
+	var err error
+	// callers skip a *CsvError and read on, an unclosed quote must end the file instead
+	for i := 0; i < 10; i++ {
+		if _, err = reader.Read(); err == nil {
+			rows++
+			continue
+		}
+		if _, ok := err.(*CsvError); !ok {
+			break
+		}
+		rowErrors++
+	}
+	quoteErr, ok := err.(*CsvQuoteError)
+	if rows != 1 || rowErrors != 0 || !ok || quoteErr.Line != 3 {
+		t.Fatalf("rows = %d, row errors = %d, err = %v", rows, rowErrors, err)
+	}
+	if _, err = reader.Read(); err != quoteErr {
+		t.Errorf("an unclosed quote must be final, got %v", err)
+	}
+
+	fileName := writeTempCsv(t, "unclosed.csv", content)
+	if err = ForEachPorCoinData(fileName, func(d *CoinData) error { return nil }); err == nil || !strings.Contains(err.Error(), "quoted field is not closed") {
+		t.Errorf("ForEachPorCoinData err = %v", err)
+	}
+}
+
+func TestInitPorCsvDataMapStakingLayout(t *testing.T) {
+	data, err := InitPorCsvDataMap("../example/okx_por_staking_example.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 0 {
+		t.Fatal("the 12-column staking layout must be loaded")
+	}
+	for _, d := range data {
+		if d.Type == "" {
+			t.Errorf("row at line %d has no type", d.Line)
+		}
+	}
+}
+
+func TestInitPorCsvDataMapKeys(t *testing.T) {
+	fileName := writeTempCsv(t, "por.csv", diffCsvHeader+
+		"USDT-ERC20,ETH,100,0xaaa,1,I am an OKX address,0x01,,\n"+
+		"USDT-ERC20,ARBITRUM,100,0xaaa,2,I am an OKX address,0x01,,\n")
+	data, err := InitPorCsvDataMap(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 2 || data[PorCoinKey{Coin: "USDT-ERC20", Network: "ARBITRUM", Address: "0xaaa"}].Balance != "2" {
+		t.Fatalf("data = %v", data)
+	}
+
+	fileName = writeTempCsv(t, "duplicate.csv", diffCsvHeader+
+		"USDT-ERC20,ETH,100,0xaaa,1,I am an OKX address,0x01,,\n"+
+		"USDT-ERC20,ETH,100,0xaaa,1,I am an OKX address,0x01,,\n")
+	if _, err = InitPorCsvDataMap(fileName); err == nil || !strings.Contains(err.Error(), "line 6 repeats line 5") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package common
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VerifyReport lists the failed rows of a verification run for triage, with their counts grouped
+// by reason code, and the rows per second the run verified.
+type VerifyReport struct {
+	Success       int64            `json:"success"`
+	Failed        int64            `json:"failed"`
+	RowsPerSecond float64          `json:"rowsPerSecond"`
+	Reasons       map[string]int   `json:"reasons"`
+	Lines         []FailedLineInfo `json:"lines"`
+}
+
+// Report returns the report of the results collected so far, the failed rows sorted by line.
+func (rc *ResultCollector) Report() *VerifyReport {
+	successCount, failCount, _, failedLines, _ := rc.GetStats()
+	_, _, rowsPerSecond := rc.Throughput()
+	report := &VerifyReport{Success: successCount, Failed: failCount, RowsPerSecond: rowsPerSecond, Reasons: rc.ReasonStats(), Lines: make([]FailedLineInfo, 0, len(failedLines))}
+	for _, f := range failedLines {
+		report.Lines = append(report.Lines, f)
+	}
+	sort.Slice(report.Lines, func(i, j int) bool { return report.Lines[i].LineNumber < report.Lines[j].LineNumber })
+	return report
+}
+
+// Write writes the report as json when the file name ends with .json, as csv otherwise.
+func (r *VerifyReport) Write(fileName string) error {
+	if strings.EqualFold(filepath.Ext(fileName), ".json") {
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(fileName, b, 0644)
+	}
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(file)
+	w.Write([]string{"line", "coin", "digitalAsset", "network", "address", "signer", "verifier", "quorum", "reason", "errorMessage"})
+	for _, f := range r.Lines {
+		w.Write([]string{strconv.Itoa(f.LineNumber), f.Coin, f.DigitalAsset, f.Network, f.Address, f.Signer, f.Verifier, f.Quorum, f.Reason, f.ErrorMessage})
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -1,33 +1,29 @@
 package common
 
-// CSV line data structure
-type CSVLine struct {
-	LineNumber     int
-	DigitalAsset   string
-	Network        string
-	Address        string
-	SignedMessage  string
-	SignedMessage2 string
-	Message        string
-	PublicKey      string
-	Owner1         string
-	Owner2         string
-	RawLine        string
-}
-
 // Verification result structure
 type VerifyResult struct {
-	Line    CSVLine
+	Row     *CoinData
 	Success bool
 	Coin    string
 	Error   string
+	// Reason is the reason code of a failure, Signer, Verifier and Quorum are taken from the
+	// SignatureResult
+	Reason   string
+	Signer   string
+	Verifier string
+	Quorum   string
 }
 
 // Failed line information structure
 type FailedLineInfo struct {
-	LineNumber   int
-	Coin         string
-	DigitalAsset string
-	Address      string
-	ErrorMessage string
+	LineNumber   int    `json:"line"`
+	Coin         string `json:"coin"`
+	DigitalAsset string `json:"digitalAsset,omitempty"`
+	Network      string `json:"network,omitempty"`
+	Address      string `json:"address"`
+	Signer       string `json:"signer,omitempty"`
+	Verifier     string `json:"verifier,omitempty"`
+	Quorum       string `json:"quorum,omitempty"`
+	Reason       string `json:"reason"`
+	ErrorMessage string `json:"error"`
 }
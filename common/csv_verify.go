@@ -1,155 +1,163 @@
 package common
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
-	"testing"
+	"io"
+	"os"
 )
 
-// Verify single line data (single-threaded version, only handle StarkNet)
-func verifyCSVLineStarknetOnly(coin, addr, msg, sign1, sign2, publicKey, digitalAsset string, lineNumber int, t *testing.T) (bool, string, string) {
-	// Check if it's StarkNet coin, skip if not
-	coinType, exists := PorCoinTypeMap[coin]
-	if !exists || coinType != StarkCoinType {
-		return true, coin, ""
+// VerifyCoinDataRow verifies the signature of a row through VerifyRowSignature, it is the default
+// job of a WorkerPool.
+func VerifyCoinDataRow(row *CoinData) VerifyResult {
+	result := VerifyRowSignature(row)
+	if result.OK() {
+		return VerifyResult{Row: row, Success: true, Coin: row.Coin, Verifier: result.Verifier, Quorum: result.Quorum}
 	}
 
-	return verifyCSVLineInternal(coin, addr, msg, sign1, sign2, publicKey, "", "", digitalAsset, lineNumber, t)
+	var errorMsg string
+	switch {
+	case errors.Is(result.Err, ErrMissingSignatureParams):
+		errorMsg = fmt.Sprintf("Missing required parameters (digitalAsset:%s, network:%s, addr:%s)", row.DigitalAsset, row.Coin, row.Address)
+	case errors.Is(result.Err, ErrUnsupportedCoin):
+		errorMsg = fmt.Sprintf("Unsupported coin type %s (digitalAsset:%s, network:%s)", result.CoinType, row.DigitalAsset, row.Coin)
+	default:
+		errorMsg = fmt.Sprintf("Verification failed: %v (addr:%s)", result.Err, result.Address)
+	}
+	return VerifyResult{Row: row, Success: false, Coin: row.Coin, Error: errorMsg, Reason: result.Reason(), Signer: result.Signer, Verifier: result.Verifier, Quorum: result.Quorum}
 }
 
-// Verify single line data (multithreaded version, skip StarkNet)
-func verifyCSVLineMultithread(coin, addr, msg, sign1, sign2, publicKey, owner1, owner2, digitalAsset string, lineNumber int, t *testing.T) (bool, string, string) {
-	// Check if it's StarkNet coin, skip multithreaded verification if yes
-	coinType, exists := PorCoinTypeMap[coin]
-	if exists && coinType == StarkCoinType {
-		return true, coin, ""
-	}
+// DefaultCheckpointInterval is the number of rows verified between two checkpoints
+const DefaultCheckpointInterval = 100000
 
-	return verifyCSVLineInternal(coin, addr, msg, sign1, sign2, publicKey, owner1, owner2, digitalAsset, lineNumber, t)
+// PorCsvVerifier verifies the detail rows of a por csv with a WorkerPool, and keeps a checkpoint
+// of the verified rows next to the csv.
+type PorCsvVerifier struct {
+	Workers   int
+	BatchSize int
+	// Verify is the job of the workers, VerifyCoinDataRow when nil
+	Verify func(row *CoinData) VerifyResult
+	// CheckpointFileName is saved every CheckpointInterval rows, and at the end when a row failed.
+	// It is removed once every row verified, no checkpoint is kept when it is empty.
+	CheckpointFileName string
+	CheckpointInterval int
+	// Checkpoint is the checkpoint of an earlier run, only its failed rows and the rows after it are verified
+	Checkpoint *VerifyCheckpoint
+	// Prepare is called for every detail row before its checkpoint is looked up. It returns false for
+	// a row that is not verified, with the failed result of an invalid row or nil for a row that
+	// is left out. Every row is verified when it is nil.
+	Prepare func(row *CoinData) (failed *VerifyResult, verify bool)
+	// Summary is called once the summary section is read
+	Summary func(reader *PorCsvReader)
+	// Progress is called with the line of every counted row
+	Progress func(line int)
+	// Log prints the failure message of a malformed or invalid row, and a checkpoint save error
+	Log func(msg string)
 }
 
-// Internal verification logic (shared)
-func verifyCSVLineInternal(coin, addr, msg, sign1, sign2, publicKey, owner1, owner2, digitalAsset string, lineNumber int, t *testing.T) (bool, string, string) {
-
-	// Check required fields
-	if addr == "" || msg == "" || sign1 == "" {
-		errorMsg := fmt.Sprintf("Missing required parameters (digitalAsset:%s, network:%s, addr:%s)", digitalAsset, coin, addr)
-		t.Logf("Line %d: %s", lineNumber, errorMsg)
-		return false, coin, errorMsg
+// Run verifies the csv of source into collector, the rows of the checkpoint are restored into it
+// first. It returns the reader, whose summary is read, and the number of rows counted. The error
+// is the one of a file that cannot be read.
+func (v *PorCsvVerifier) Run(source *PorCsvSource, collector *ResultCollector) (*PorCsvReader, int, error) {
+	f, err := os.Open(source.Path)
+	if err != nil {
+		return nil, 0, err
 	}
+	defer f.Close()
 
-	// Get coin verification type
-	coinType, exists := PorCoinTypeMap[coin]
-	if !exists {
-		// If coin is not in mapping table, try using default ECDSA verification
-		coinType = EcdsaCoinType
+	if v.Checkpoint != nil {
+		collector.Restore(v.Checkpoint)
 	}
+	verify := v.Verify
+	if verify == nil {
+		verify = VerifyCoinDataRow
+	}
+	interval := v.CheckpointInterval
+	if interval <= 0 {
+		interval = DefaultCheckpointInterval
+	}
+	pool := NewWorkerPool(v.Workers, collector, verify)
+	if v.BatchSize > 0 {
+		pool.SetBatchSize(v.BatchSize)
+	}
+	pool.Start()
 
-	// Verify according to coin type
-	var err error
-	switch coinType {
-	case EvmCoinTye:
-		// For EVM coins, if there are owner fields, use owner for signature verification
-		if owner1 != "" && owner1 != "null" {
-			// Use signature1 + owner1 for verification
-			err = VerifyEvmCoin(coin, owner1, msg, sign1)
-
-			// If there's a second owner, both must pass verification
-			if owner2 != "" && owner2 != "null" && sign2 != "" && sign2 != "null" {
-				err2 := VerifyEvmCoin(coin, owner2, msg, sign2)
-
-				// Record verification results
-				if err == nil && err2 == nil {
-					t.Logf("Line %d: Dual owner verification both successful (digitalAsset:%s, network:%s, owner1:%s, owner2:%s)", lineNumber, digitalAsset, coin, owner1, owner2)
-				} else if err != nil && err2 != nil {
-					// Both failed
-					t.Logf("Line %d: EVM contract address dual verification both failed (digitalAsset:%s, network:%s, addr:%s, owner1:%s, owner2:%s)", lineNumber, digitalAsset, coin, addr, owner1, owner2)
-					err = fmt.Errorf("owner1 verification failed: %v, owner2 verification failed: %v", err, err2)
-				} else if err != nil {
-					// owner1 failed, owner2 succeeded
-					t.Logf("Line %d: EVM contract address owner1 verification failed, owner2 succeeded (digitalAsset:%s, network:%s, addr:%s, owner1:%s, owner2:%s)", lineNumber, digitalAsset, coin, addr, owner1, owner2)
-					err = fmt.Errorf("owner1 verification failed: %v", err)
-				} else {
-					// owner1 succeeded, owner2 failed
-					t.Logf("Line %d: EVM contract address owner1 verification succeeded, owner2 failed (digitalAsset:%s, network:%s, addr:%s, owner1:%s, owner2:%s)", lineNumber, digitalAsset, coin, addr, owner1, owner2)
-					err = fmt.Errorf("owner2 verification failed: %v", err2)
-				}
-			} else {
-				// Single owner case
-				if err != nil {
-					t.Logf("Line %d: EVM contract address owner1 verification failed (digitalAsset:%s, network:%s, addr:%s, owner1:%s)", lineNumber, digitalAsset, coin, addr, owner1)
-				}
+	reader := NewPorCsvReader(f)
+	count, lastLine, summaryRead := 0, 0, false
+	for {
+		row, err := reader.Read()
+		// the summary section precedes the detail rows
+		if !summaryRead && (row != nil || err == io.EOF) {
+			summaryRead = true
+			if v.Summary != nil {
+				v.Summary(reader)
 			}
-		} else {
-			// No owner field, use original address for verification
-			err = VerifyEvmCoin(coin, addr, msg, sign1)
-		}
-	case EcdsaCoinType:
-		// For XRP and other coins using ECDSA, use public key verification if available
-		if publicKey != "" && publicKey != "null" && publicKey != "\\N" {
-			err = VerifyEcdsaCoinWithPub(msg, sign1, publicKey)
-		} else {
-			err = VerifyEcdsaCoin(coin, addr, msg, sign1)
-		}
-	case Ed25519CoinType:
-		if publicKey == "" || publicKey == "null" {
-			errorMsg := fmt.Sprintf("ED25519 coin %s missing public key (digitalAsset:%s)", coin, digitalAsset)
-			t.Logf("Line %d: %s", lineNumber, errorMsg)
-			return false, coin, errorMsg
 		}
-		err = VerifyEd25519Coin(coin, addr, msg, sign1, publicKey)
-	case TrxCoinType:
-		err = VerifyTRX(addr, msg, sign1)
-	case BethCoinType:
-		err = VerifyBETH(addr, msg, sign1)
-	case UTXOCoinType:
-		err = VerifyUtxoCoin(coin, addr, msg, sign1, sign2, publicKey)
-	case StarkCoinType:
-		if publicKey == "" || publicKey == "null" {
-			errorMsg := fmt.Sprintf("STARK coin %s missing public key (digitalAsset:%s)", coin, digitalAsset)
-			t.Logf("Line %d: %s", lineNumber, errorMsg)
-			return false, coin, errorMsg
+		if err == io.EOF {
+			break
 		}
-		err = VerifyStarkCoin(coin, addr, msg, sign1, publicKey)
-	case EOSCoinType:
-		if publicKey == "" || publicKey == "null" {
-			errorMsg := fmt.Sprintf("EOS coin %s missing public key (digitalAsset:%s)", coin, digitalAsset)
-			t.Logf("Line %d: %s", lineNumber, errorMsg)
-			return false, coin, errorMsg
+		if csvErr, isRowErr := err.(*CsvError); isRowErr {
+			msg := fmt.Sprintf("Fail to verify address signature.The line %d has error:%s.", csvErr.Line, csvErr.Msg)
+			v.log(msg)
+			collector.AddResult(VerifyResult{Row: &CoinData{Line: csvErr.Line}, Error: msg, Reason: ReasonInvalidRow})
+			count++
+			lastLine = csvErr.Line
+			continue
+		} else if err != nil {
+			pool.Stop()
+			return reader, count, err
 		}
+		lastLine = row.Line
 
-		cleanKey := strings.TrimSpace(publicKey)
-		if strings.HasPrefix(cleanKey, "\"") && strings.HasSuffix(cleanKey, "\"") {
-			cleanKey = cleanKey[1 : len(cleanKey)-1]
-			cleanKey = strings.ReplaceAll(cleanKey, "\"\"", "\"") // 处理CSV转义的双引号
-		}
-
-		if strings.HasPrefix(cleanKey, "{") {
-			var pubKeys map[string]string
-			if json.Unmarshal([]byte(cleanKey), &pubKeys) == nil {
-				err1 := VerifyEOSCoin(coin, addr, msg, sign1, pubKeys["publicKey1"])
-				err2 := VerifyEOSCoin(coin, addr, msg, sign2, pubKeys["publicKey2"])
-				if err1 != nil || err2 != nil {
-					err = fmt.Errorf("EOS dual signature failed: sig1=%v, sig2=%v", err1, err2)
-				}
-			} else {
-				err = fmt.Errorf("invalid JSON public key format")
+		var failed *VerifyResult
+		if v.Prepare != nil {
+			var verify bool
+			if failed, verify = v.Prepare(row); !verify && failed == nil {
+				continue
 			}
+		}
+		count++
+		if v.Checkpoint != nil && !v.Checkpoint.IsRetry(row.Line) {
+			collector.AddSkip()
+			continue
+		}
+		if failed != nil {
+			v.log(failed.Error)
+			collector.AddResult(*failed)
 		} else {
-			err = VerifyEOSCoin(coin, addr, msg, sign1, publicKey)
+			pool.AddJob(row)
+		}
+		if v.Progress != nil {
+			v.Progress(row.Line)
+		}
+		if count%interval == 0 && v.CheckpointFileName != "" {
+			pool.Wait()
+			v.saveCheckpoint(collector.Checkpoint(source.SHA256, lastLine))
 		}
-	default:
-		errorMsg := fmt.Sprintf("Unsupported coin type %s (digitalAsset:%s, network:%s)", coinType, digitalAsset, coin)
-		t.Logf("Line %d: %s", lineNumber, errorMsg)
-		return false, coin, errorMsg
 	}
+	pool.Stop()
 
-	if err != nil {
-		errorMsg := fmt.Sprintf("Verification failed: %v", err)
-		t.Logf("Line %d verification failed: %s (digitalAsset:%s, network:%s, addr:%s, error:%v)", lineNumber, coin, digitalAsset, coin, addr, err)
-		return false, coin, errorMsg
+	if v.CheckpointFileName == "" {
+		return reader, count, nil
+	}
+	if _, failCount, _, _, _ := collector.GetStats(); failCount == 0 {
+		os.Remove(v.CheckpointFileName)
+	} else {
+		// a resumed run verifies the failed rows only
+		v.saveCheckpoint(collector.Checkpoint(source.SHA256, lastLine))
 	}
+	return reader, count, nil
+}
 
-	return true, coin, ""
+// saveCheckpoint logs a checkpoint that cannot be saved, the verification goes on without it
+func (v *PorCsvVerifier) saveCheckpoint(cp *VerifyCheckpoint) {
+	if err := SaveVerifyCheckpoint(v.CheckpointFileName, cp); err != nil {
+		v.log(fmt.Sprintf("Fail to save the checkpoint.The error is %v", err))
+	}
+}
+
+func (v *PorCsvVerifier) log(msg string) {
+	if v.Log != nil {
+		v.Log(msg)
+	}
 }
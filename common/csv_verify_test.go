@@ -1,395 +1,107 @@
 package common
 
 import (
-	"bufio"
-	"fmt"
-	"os"
-	"runtime"
+	"io/ioutil"
 	"strings"
 	"testing"
 )
 
-// Multithreaded CSV file verification
-func TestVerifyCSVFileMultithread(t *testing.T) {
-	csvFileName := "../example/merged - Sheet1.csv"
-
-	// Temporary marking function switch - can be deleted after testing
-	enableMarking := true // Set to false to disable marking function
-	batchSize := 100000   // Save every 100k lines
-
-	// Get CPU core count, set worker thread count
-	workerCount := runtime.NumCPU()
-
-	fmt.Printf("Using %d worker threads for verification\n", workerCount)
-
-	var existingFailedLines map[int]FailedLineInfo
-	var lastProcessedLine int
-	var resultFileName string
-	if enableMarking {
-		resultFileName = csvFileName + "_result"
-		existingFailedLines, lastProcessedLine = loadVerificationResult(resultFileName)
-		fmt.Printf("Loaded verification results: processed to line %d, %d failed lines need re-verification\n", lastProcessedLine, len(existingFailedLines))
-	}
-
-	fmt.Printf("Starting multithreaded CSV file verification: %s\n", csvFileName)
-
-	// First calculate total lines (for progress bar)
-	fmt.Printf("Calculating total file lines...\n")
-	totalLines := 0
-	file, err := os.Open(csvFileName)
-	if err != nil {
-		t.Fatalf("Failed to open CSV file: %v", err)
-	}
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		totalLines++
-	}
-	file.Close()
-	fmt.Printf("Total lines: %d\n", totalLines)
-
-	// Create progress bar
-	var progressBar *ProgressBar
-	if totalLines > 1000 { // Only show progress bar for large files
-		progressBar = NewProgressBar(totalLines - 1) // Exclude header line
-	}
-
-	// Create result collector and worker pool
-	collector := NewResultCollector()
-	workerPool := NewWorkerPool(workerCount, collector, t)
-
-	// Start worker pool
-	workerPool.Start()
-
-	// Open file for processing
-	file, err = os.Open(csvFileName)
+// verifyCsv verifies a csv with the checkpoint next to it, as a resumed VerifyAddress run does
+func verifyCsv(t *testing.T, csvFileName, checkpointFileName string) (int64, int64) {
+	source, err := OpenPorCsvSource(csvFileName)
 	if err != nil {
-		t.Fatalf("Failed to open CSV file: %v", err)
+		t.Fatal(err)
 	}
-	defer file.Close()
-
-	scanner = bufio.NewScanner(file)
-	lineNumber := 0
-	processedCount := 0
-
-	for scanner.Scan() {
-		lineNumber++
-		line := strings.TrimSpace(scanner.Text())
-
-		// Skip empty lines and header
-		if line == "" || lineNumber == 1 {
-			continue
-		}
-
-		// Skip already processed lines (unless they are failed lines)
-		if enableMarking && lineNumber <= lastProcessedLine {
-			if _, isFailed := existingFailedLines[lineNumber]; !isFailed {
-				collector.AddSkip()
-				continue
-			}
-		}
-
-		// Parse CSV line (handle JSON in fields)
-		fields := ParseCSVLine(line)
-		if len(fields) < 7 {
-			// Format error, add directly to failed results
-			result := VerifyResult{
-				Line: CSVLine{
-					LineNumber:   lineNumber,
-					DigitalAsset: "UNKNOWN",
-					Network:      "UNKNOWN",
-					Address:      "UNKNOWN",
-					RawLine:      line,
-				},
-				Success: false,
-				Coin:    "UNKNOWN",
-				Error:   fmt.Sprintf("Format error, insufficient fields: %s", line),
-			}
-			collector.AddResult(result)
-			continue
-		}
-
-		// Skip rows where status is not 5
-		if len(fields) >= 10 {
-			status := strings.TrimSpace(fields[9])
-			if status != "5" {
-				collector.AddSkip()
-				continue
-			}
-		}
-
-		// Create CSV line data
-		csvLine := CSVLine{
-			LineNumber:     lineNumber,
-			DigitalAsset:   strings.TrimSpace(fields[0]),
-			Network:        strings.TrimSpace(fields[1]),
-			Address:        strings.TrimSpace(fields[2]),
-			SignedMessage:  strings.TrimSpace(fields[3]),
-			SignedMessage2: strings.TrimSpace(fields[4]),
-			Message:        strings.TrimSpace(fields[5]),
-			PublicKey:      strings.TrimSpace(fields[6]),
-			RawLine:        line,
-		}
-
-		// Parse owner1 and owner2 fields (if exist)
-		if len(fields) > 7 {
-			csvLine.Owner1 = strings.TrimSpace(fields[7])
-		}
-		if len(fields) > 8 {
-			csvLine.Owner2 = strings.TrimSpace(fields[8])
+	verifier := &PorCsvVerifier{Workers: 4, CheckpointFileName: checkpointFileName}
+	if checkpointFileName != "" {
+		if verifier.Checkpoint, err = LoadVerifyCheckpoint(checkpointFileName, source.SHA256); err != nil {
+			t.Fatal(err)
 		}
-
-		// Send job to worker pool
-		workerPool.AddJob(csvLine)
-		processedCount++
-
-		// Update progress bar
-		if progressBar != nil {
-			progressBar.Update(lineNumber - 1) // Subtract header line
-		}
-
-		// Save results every batch
-		if enableMarking && processedCount%batchSize == 0 {
-			successCount, failCount, skipCount, failedLines, _ := collector.GetStats()
-			saveVerificationResult(resultFileName, failedLines, lineNumber)
-			fmt.Printf("\nSaved verification results at line %d (Success: %d, Failed: %d, Skipped: %d)\n",
-				lineNumber, successCount, failCount, skipCount)
-		}
-	}
-
-	// Stop worker pool and wait for completion
-	workerPool.Stop()
-
-	// Finish progress bar
-	if progressBar != nil {
-		progressBar.Finish()
-	}
-
-	// Get final statistics
-	successCount, failCount, skipCount, failedLines, coinStats := collector.GetStats()
-
-	// Final save
-	if enableMarking {
-		saveVerificationResult(resultFileName, failedLines, lineNumber)
 	}
-
-	// Display results
-	fmt.Printf("\n=== Verification Results ===\n")
-	fmt.Printf("Total processed: %d lines\n", lineNumber-1)
-	fmt.Printf("Success: %d\n", successCount)
-	fmt.Printf("Failed: %d\n", failCount)
-	fmt.Printf("Skipped: %d\n", skipCount)
-
-	// Display coin statistics
-	fmt.Printf("\n=== Coin Statistics ===\n")
-	for coin, stats := range coinStats {
-		total := stats["success"] + stats["fail"]
-		if total > 0 {
-			fmt.Printf("%s: Total %d, Success %d, Failed %d\n", coin, total, stats["success"], stats["fail"])
-		}
+	collector := NewResultCollector()
+	if _, _, err = verifier.Run(source, collector); err != nil {
+		t.Fatal(err)
 	}
-
-	if failCount == 0 {
-		fmt.Println("\nAll addresses verified successfully!")
-		fmt.Printf("CSV file preserved: %s\n", csvFileName)
-		if enableMarking {
-			// Only clean up result files, keep the original CSV
-			os.Remove(resultFileName)
-			fmt.Printf("Verification result file deleted: %s\n", resultFileName)
-		}
-	} else {
-		fmt.Printf("\n%d addresses failed verification, CSV file preserved for debugging\n", failCount)
+	success, fail, _, failedLines, _ := collector.GetStats()
+	for _, f := range failedLines {
+		t.Logf("Line %d: %s (digitalAsset:%s, network:%s, addr:%s)", f.LineNumber, f.ErrorMessage, f.DigitalAsset, f.Coin, f.Address)
 	}
+	return success, fail
 }
 
-// Single-threaded CSV file verification (StarkNet only)
-func TestVerifyCSVFileStarknetOnly(t *testing.T) {
-	csvFileName := "../example/test.csv"
-
-	// Temporary marking function switch - can be deleted after testing
-	enableMarking := true // Set to false to disable marking function
-	batchSize := 100000   // Save every 100k lines
-
-	var failedLines map[int]FailedLineInfo
-	var lastProcessedLine int
-	var resultFileName string
-	if enableMarking {
-		resultFileName = csvFileName + "_result"
-		failedLines, lastProcessedLine = loadVerificationResult(resultFileName)
-		fmt.Printf("Loaded verification results: processed to line %d, %d failed lines need re-verification\n", lastProcessedLine, len(failedLines))
+// StarkNet rows are verified by the worker pool with the other rows
+func TestVerifyCSVFileWithStarknet(t *testing.T) {
+	if _, failed := verifyCsv(t, "../example/test.csv", ""); failed != 0 {
+		t.Fatalf("expected every row to verify, %d failed", failed)
 	}
+}
 
-	fmt.Printf("Starting CSV file verification (StarkNet only): %s\n", csvFileName)
-
-	// First calculate total lines (for progress bar)
-	fmt.Printf("Calculating total file lines...\n")
-	totalLines := 0
-	file, err := os.Open(csvFileName)
+func TestVerifyCheckpointResume(t *testing.T) {
+	dir := t.TempDir()
+	csvFileName := dir + "/test.csv"
+	b, err := ioutil.ReadFile("../example/test.csv")
 	if err != nil {
-		t.Fatalf("Failed to open CSV file: %v", err)
+		t.Fatal(err)
 	}
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		totalLines++
+	// break the signature of the ETH row on line 2
+	b = []byte(strings.Replace(string(b), "0x63e1ecb04bf6", "0x63e1ecb04bf7", 1))
+	if err = ioutil.WriteFile(csvFileName, b, 0644); err != nil {
+		t.Fatal(err)
 	}
-	file.Close()
-	fmt.Printf("Total lines: %d\n", totalLines)
 
-	// Create progress bar
-	var progressBar *ProgressBar
-	if totalLines > 1000 { // Only show progress bar for large files
-		progressBar = NewProgressBar(totalLines - 1) // Exclude header line
+	success, fail := verifyCsv(t, csvFileName, csvFileName+".checkpoint")
+	if success != 8 || fail != 1 {
+		t.Fatalf("expected 8 verified and 1 failed, got %d and %d", success, fail)
 	}
-
-	// Open file again for processing
-	file, err = os.Open(csvFileName)
-	if err != nil {
-		t.Fatalf("Failed to open CSV file: %v", err)
-	}
-	defer file.Close()
-
-	scanner = bufio.NewScanner(file)
-	lineNumber := 0
-	successCount := 0
-	failCount := 0
-	skipCount := 0
-
-	// Coin statistics
-	coinStats := make(map[string]map[string]int)
-
-	for scanner.Scan() {
-		lineNumber++
-		line := strings.TrimSpace(scanner.Text())
-
-		// Skip empty lines and header
-		if line == "" || lineNumber == 1 {
-			continue
-		}
-
-		// Skip already processed lines (unless they are failed lines)
-		if enableMarking && lineNumber <= lastProcessedLine {
-			if _, isFailed := failedLines[lineNumber]; !isFailed {
-				skipCount++
-				continue
-			}
-		}
-
-		// Parse CSV line (handle JSON in fields)
-		fields := ParseCSVLine(line)
-		if len(fields) < 7 {
-			errorMsg := fmt.Sprintf("Format error, insufficient fields: %s", line)
-			t.Logf("Line %d: %s", lineNumber, errorMsg)
-			failCount++
-			if enableMarking {
-				// Record format error details
-				failedInfo := FailedLineInfo{
-					LineNumber:   lineNumber,
-					Coin:         "UNKNOWN",
-					DigitalAsset: "UNKNOWN",
-					Address:      "UNKNOWN",
-					ErrorMessage: errorMsg,
-				}
-				failedLines[lineNumber] = failedInfo
-			}
-			continue
-		}
-
-		digitalAsset := strings.TrimSpace(fields[0]) // Keep digitalAsset field for error messages
-		network := strings.TrimSpace(fields[1])      // Use network field as coin
-		address := strings.TrimSpace(fields[2])
-		signedMessage := strings.TrimSpace(fields[3])
-		signedMessage2 := strings.TrimSpace(fields[4])
-		message := strings.TrimSpace(fields[5])
-		publicKey := strings.TrimSpace(fields[6])
-
-		// Verify this line, add panic protection
-		var success bool
-		var coin string
-		var errorMsg string
-
-		func() {
-			defer func() {
-				if r := recover(); r != nil {
-					// Caught panic, convert to error handling
-					success = false
-					coin = network
-					errorMsg = fmt.Sprintf("Verification panic occurred: %v", r)
-					t.Logf("Line %d panic occurred during verification: %v (digitalAsset:%s, network:%s, addr:%s)", lineNumber, r, digitalAsset, network, address)
-				}
-			}()
-
-			success, coin, errorMsg = verifyCSVLineStarknetOnly(network, address, message, signedMessage, signedMessage2, publicKey, digitalAsset, lineNumber, t)
-		}()
-
-		// Update statistics
-		if coinStats[coin] == nil {
-			coinStats[coin] = make(map[string]int)
-		}
-		if success {
-			successCount++
-			coinStats[coin]["success"]++
-		} else {
-			failCount++
-			coinStats[coin]["fail"]++
-			if enableMarking {
-				// Record failed details
-				failedInfo := FailedLineInfo{
-					LineNumber:   lineNumber,
-					Coin:         coin,
-					DigitalAsset: digitalAsset,
-					Address:      address,
-					ErrorMessage: errorMsg,
-				}
-				failedLines[lineNumber] = failedInfo
-			}
-		}
-
-		// Update progress bar
-		if progressBar != nil {
-			progressBar.Update(lineNumber - 1) // Subtract header line
-		}
-
-		// Save results every 100k lines
-		if enableMarking && lineNumber%batchSize == 0 {
-			saveVerificationResult(resultFileName, failedLines, lineNumber)
-			fmt.Printf("\nSaved verification results at line %d\n", lineNumber)
-		}
+	source, _ := OpenPorCsvSource(csvFileName)
+	cp, err := LoadVerifyCheckpoint(csvFileName+".checkpoint", source.SHA256)
+	if err != nil || cp == nil {
+		t.Fatalf("expected a checkpoint, got %v", err)
 	}
-
-	// Finish progress bar
-	if progressBar != nil {
-		progressBar.Finish()
+	if len(cp.Failed) != 1 || cp.Failed[0].LineNumber != 2 || !cp.IsRetry(2) || cp.IsRetry(3) || !cp.IsRetry(11) {
+		t.Fatalf("unexpected checkpoint %+v", cp)
 	}
 
-	// Final save
-	if enableMarking {
-		saveVerificationResult(resultFileName, failedLines, lineNumber)
+	// the resumed run verifies only the failed row again, the restored successes are kept
+	success, fail = verifyCsv(t, csvFileName, csvFileName+".checkpoint")
+	if success != 8 || fail != 1 {
+		t.Fatalf("expected 8 verified and 1 failed after resume, got %d and %d", success, fail)
 	}
 
-	// Display results
-	fmt.Printf("\n=== Verification Results ===\n")
-	fmt.Printf("Total processed: %d lines\n", lineNumber-1)
-	fmt.Printf("Success: %d\n", successCount)
-	fmt.Printf("Failed: %d\n", failCount)
-	fmt.Printf("Skipped: %d\n", skipCount)
-
-	// Display coin statistics
-	fmt.Printf("\n=== Coin Statistics ===\n")
-	for coin, stats := range coinStats {
-		total := stats["success"] + stats["fail"]
-		if total > 0 {
-			fmt.Printf("%s: Total %d, Success %d, Failed %d\n", coin, total, stats["success"], stats["fail"])
-		}
+	if _, err = LoadVerifyCheckpoint(csvFileName+".checkpoint", "other"); err == nil {
+		t.Fatal("expected a checkpoint of another file to be rejected")
 	}
+}
 
-	if failCount == 0 {
-		fmt.Println("\nAll addresses verified successfully!")
-		fmt.Printf("CSV file preserved: %s\n", csvFileName)
-		if enableMarking {
-			// Only clean up result files, keep the original CSV
-			os.Remove(resultFileName)
-			fmt.Printf("Verification result file deleted: %s\n", resultFileName)
-		}
-	} else {
-		fmt.Printf("\n%d addresses failed verification, CSV file preserved for debugging\n", failCount)
+func TestVerifyReport(t *testing.T) {
+	collector := NewResultCollector()
+	collector.AddResult(VerifyResult{Row: &CoinData{Line: 3, Coin: "ETH", Address: "0x1"}, Coin: "ETH", Error: "mismatch", Reason: ReasonAddressMismatch, Signer: SignerEOA1, Verifier: EvmCoinTye})
+	collector.AddResult(VerifyResult{Row: &CoinData{Line: 2, Coin: "BTC", Address: "1x"}, Coin: "BTC", Error: "bad"})
+	collector.AddResult(VerifyResult{Row: &CoinData{Line: 4, Coin: "BTC", Address: "1y"}, Success: true, Coin: "BTC"})
+	collector.AddResult(VerifyResult{Row: &CoinData{Line: 5, Coin: "BTC", Address: "3z"}, Success: true, Coin: "BTC", Quorum: "2-of-3"})
+	collector.AddResult(VerifyResult{Row: &CoinData{Line: 6, Coin: "BTC", Address: "3w"}, Coin: "BTC", Error: "one signature", Reason: ReasonBelowThreshold, Quorum: "3-of-5"})
+
+	report := collector.Report()
+	if report.Success != 2 || report.Failed != 3 || report.Reasons[ReasonAddressMismatch] != 1 || report.Reasons[ReasonBadSignature] != 1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.Lines[0].LineNumber != 2 || report.Lines[1].Signer != SignerEOA1 {
+		t.Fatalf("unexpected lines %+v", report.Lines)
+	}
+	if quorums := collector.QuorumStats(); len(quorums) != 1 || quorums["2-of-3"] != 1 {
+		t.Fatalf("unexpected quorum stats %v", quorums)
+	}
+
+	fileName := t.TempDir() + "/failed.csv"
+	if err := report.Write(fileName); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadFile(fileName)
+	expected := "line,coin,digitalAsset,network,address,signer,verifier,quorum,reason,errorMessage\n" +
+		"2,BTC,,,1x,,,,bad_signature,bad\n" +
+		"3,ETH,,,0x1,eoa1,EVM,,address_mismatch,mismatch\n" +
+		"6,BTC,,,3w,,,3-of-5,below_threshold,one signature\n"
+	if string(b) != expected {
+		t.Fatalf("unexpected csv report:\n%s", b)
 	}
 }
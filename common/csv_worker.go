@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"sync"
 	"sync/atomic"
-	"testing"
+	"time"
 )
 
 // Thread-safe result collector
@@ -15,6 +15,12 @@ type ResultCollector struct {
 	failCount    int64
 	skipCount    int64
 	coinStats    map[string]map[string]int
+	reasonStats  map[string]int
+	// quorumStats counts the verified multisig rows per m-of-n quorum
+	quorumStats map[string]int
+	// verifiedCount counts the rows verified since started, rows restored from a checkpoint aside
+	verifiedCount int64
+	started       time.Time
 }
 
 // Create result collector
@@ -22,6 +28,9 @@ func NewResultCollector() *ResultCollector {
 	return &ResultCollector{
 		failedLines: make(map[int]FailedLineInfo),
 		coinStats:   make(map[string]map[string]int),
+		reasonStats: make(map[string]int),
+		quorumStats: make(map[string]int),
+		started:     time.Now(),
 	}
 }
 
@@ -29,6 +38,7 @@ func NewResultCollector() *ResultCollector {
 func (rc *ResultCollector) AddResult(result VerifyResult) {
 	rc.mu.Lock()
 	defer rc.mu.Unlock()
+	rc.verifiedCount++
 
 	// Initialize coin statistics
 	if rc.coinStats[result.Coin] == nil {
@@ -38,16 +48,29 @@ func (rc *ResultCollector) AddResult(result VerifyResult) {
 	if result.Success {
 		atomic.AddInt64(&rc.successCount, 1)
 		rc.coinStats[result.Coin]["success"]++
+		if result.Quorum != "" {
+			rc.quorumStats[result.Quorum]++
+		}
 	} else {
 		atomic.AddInt64(&rc.failCount, 1)
 		rc.coinStats[result.Coin]["fail"]++
+		reason := result.Reason
+		if reason == "" {
+			reason = ReasonBadSignature
+		}
+		rc.reasonStats[reason]++
 
 		// Record failed line detailed information
-		rc.failedLines[result.Line.LineNumber] = FailedLineInfo{
-			LineNumber:   result.Line.LineNumber,
+		rc.failedLines[result.Row.Line] = FailedLineInfo{
+			LineNumber:   result.Row.Line,
 			Coin:         result.Coin,
-			DigitalAsset: result.Line.DigitalAsset,
-			Address:      result.Line.Address,
+			DigitalAsset: result.Row.DigitalAsset,
+			Network:      result.Row.Network,
+			Address:      result.Row.Address,
+			Signer:       result.Signer,
+			Verifier:     result.Verifier,
+			Quorum:       result.Quorum,
+			Reason:       reason,
 			ErrorMessage: result.Error,
 		}
 	}
@@ -82,23 +105,76 @@ func (rc *ResultCollector) GetStats() (int64, int64, int64, map[int]FailedLineIn
 		atomic.LoadInt64(&rc.skipCount), failedLinesCopy, coinStatsCopy
 }
 
+// ReasonStats returns the number of failed rows per reason code
+func (rc *ResultCollector) ReasonStats() map[string]int {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	stats := make(map[string]int, len(rc.reasonStats))
+	for reason, count := range rc.reasonStats {
+		stats[reason] = count
+	}
+	return stats
+}
+
+// QuorumStats returns the number of verified multisig rows per m-of-n quorum
+func (rc *ResultCollector) QuorumStats() map[string]int {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	stats := make(map[string]int, len(rc.quorumStats))
+	for quorum, count := range rc.quorumStats {
+		stats[quorum] = count
+	}
+	return stats
+}
+
+// Throughput returns the number of rows verified since the collector was created, the time it took
+// and the rows per second.
+func (rc *ResultCollector) Throughput() (int64, time.Duration, float64) {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	elapsed := time.Since(rc.started)
+	return rc.verifiedCount, elapsed, float64(rc.verifiedCount) / elapsed.Seconds()
+}
+
 // Worker pool structure
 type WorkerPool struct {
 	workerCount int
-	jobChan     chan CSVLine
+	jobChan     chan []*CoinData
 	wg          sync.WaitGroup
-	collector   *ResultCollector
-	t           *testing.T
+	// batchSize is the number of rows a worker takes at once, pending holds the rows of the batch
+	// being filled
+	batchSize int
+	pending   []*CoinData
+	// inflight counts the jobs added but not yet collected, Wait drains them before a checkpoint
+	inflight  sync.WaitGroup
+	collector *ResultCollector
+	verify    func(row *CoinData) VerifyResult
 }
 
-// Create worker pool
-func NewWorkerPool(workerCount int, collector *ResultCollector, t *testing.T) *WorkerPool {
+// Create worker pool, verify is the job run for every row, VerifyCoinDataRow when nil
+func NewWorkerPool(workerCount int, collector *ResultCollector, verify func(row *CoinData) VerifyResult) *WorkerPool {
+	if workerCount < 1 {
+		workerCount = 1
+	}
+	if verify == nil {
+		verify = VerifyCoinDataRow
+	}
 	return &WorkerPool{
 		workerCount: workerCount,
-		jobChan:     make(chan CSVLine, workerCount*2), // Buffer size is twice the worker count
+		jobChan:     make(chan []*CoinData, workerCount*2), // Buffer size is twice the worker count
+		batchSize:   1,
 		collector:   collector,
-		t:           t,
+		verify:      verify,
+	}
+}
+
+// SetBatchSize sets the number of rows a worker takes at once, fewer hand-offs between the reader
+// and the workers. It is called before Start.
+func (wp *WorkerPool) SetBatchSize(batchSize int) {
+	if batchSize < 1 {
+		batchSize = 1
 	}
+	wp.batchSize = batchSize
 }
 
 // Start worker pool
@@ -113,46 +189,59 @@ func (wp *WorkerPool) Start() {
 func (wp *WorkerPool) worker(id int) {
 	defer wp.wg.Done()
 
-	for line := range wp.jobChan {
-		func() {
-			defer func() {
-				if r := recover(); r != nil {
-					// Caught panic, convert to error handling
-					errorMsg := fmt.Sprintf("Verification panic occurred: %v", r)
-					result := VerifyResult{
-						Line:    line,
-						Success: false,
-						Coin:    line.Network, // Use network as coin
-						Error:   errorMsg,
-					}
-					wp.collector.AddResult(result)
-				}
-			}()
-
-			// Verify this line (multithreaded version, skip StarkNet)
-			success, coin, errorMsg := verifyCSVLineMultithread(line.Network, line.Address, line.Message,
-				line.SignedMessage, line.SignedMessage2, line.PublicKey, line.Owner1, line.Owner2, line.DigitalAsset, line.LineNumber, wp.t)
-
-			// Send result
-			result := VerifyResult{
-				Line:    line,
-				Success: success,
-				Coin:    coin,
-				Error:   errorMsg,
-			}
-
-			wp.collector.AddResult(result)
-		}()
+	for rows := range wp.jobChan {
+		for _, row := range rows {
+			wp.verifyRow(row)
+		}
+	}
+}
+
+// verifyRow collects the result of a row, a panic is converted to a failure
+func (wp *WorkerPool) verifyRow(row *CoinData) {
+	defer wp.inflight.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			// Caught panic, convert to error handling
+			wp.collector.AddResult(VerifyResult{
+				Row:     row,
+				Success: false,
+				Coin:    row.Coin,
+				Error:   fmt.Sprintf("Verification panic occurred: %v", r),
+				Reason:  ReasonPanic,
+			})
+		}
+	}()
+
+	wp.collector.AddResult(wp.verify(row))
+}
+
+// Add job to worker pool, the rows are handed to the workers in batches of the batch size. AddJob,
+// Wait and Stop are called by the goroutine reading the rows.
+func (wp *WorkerPool) AddJob(row *CoinData) {
+	wp.inflight.Add(1)
+	wp.pending = append(wp.pending, row)
+	if len(wp.pending) >= wp.batchSize {
+		wp.flush()
+	}
+}
+
+// flush hands the rows of the batch being filled to the workers
+func (wp *WorkerPool) flush() {
+	if len(wp.pending) > 0 {
+		wp.jobChan <- wp.pending
+		wp.pending = nil
 	}
 }
 
-// Add job to worker pool
-func (wp *WorkerPool) AddJob(line CSVLine) {
-	wp.jobChan <- line
+// Wait until every job added so far has been collected, the pool keeps running
+func (wp *WorkerPool) Wait() {
+	wp.flush()
+	wp.inflight.Wait()
 }
 
 // Stop worker pool
 func (wp *WorkerPool) Stop() {
+	wp.flush()
 	close(wp.jobChan)
 	wp.wg.Wait()
 }
@@ -0,0 +1,259 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+// PorDiff is the difference between two PoR snapshots.
+type PorDiff struct {
+	OldFile          *PorCsvSource         `json:"oldFile,omitempty"`
+	NewFile          *PorCsvSource         `json:"newFile,omitempty"`
+	Added            []*PorDiffAddress     `json:"added"`
+	Removed          []*PorDiffAddress     `json:"removed"`
+	BalanceChanges   []*PorBalanceChange   `json:"balanceChanges"`
+	CoinTotalChanges []*PorCoinTotalChange `json:"coinTotalChanges"`
+	SignatureChanges []*PorFieldChange     `json:"signatureChanges"`
+	MessageChanges   []*PorFieldChange     `json:"messageChanges"`
+	ParseErrors      []*PorDiffParseError  `json:"parseErrors"`
+}
+
+type PorDiffAddress struct {
+	Coin    string `json:"coin"`
+	Network string `json:"network"`
+	Address string `json:"address"`
+	Type    string `json:"type,omitempty"`
+	Balance string `json:"balance"`
+}
+
+type PorBalanceChange struct {
+	Coin       string `json:"coin"`
+	Network    string `json:"network"`
+	Address    string `json:"address"`
+	Type       string `json:"type,omitempty"`
+	OldBalance string `json:"oldBalance"`
+	NewBalance string `json:"newBalance"`
+	Delta      string `json:"delta"`
+}
+
+type PorCoinTotalChange struct {
+	Coin     string `json:"coin"`
+	OldTotal string `json:"oldTotal"`
+	NewTotal string `json:"newTotal"`
+	Delta    string `json:"delta"`
+}
+
+// PorFieldChange records a changed signature1, signature2, script or message column of an address.
+type PorFieldChange struct {
+	Coin    string `json:"coin"`
+	Network string `json:"network"`
+	Address string `json:"address"`
+	Type    string `json:"type,omitempty"`
+	Field   string `json:"field"`
+	Old     string `json:"old"`
+	New     string `json:"new"`
+}
+
+// PorDiffParseError records a row whose balance is not a number. The row is left out of the
+// balance changes and coin totals instead of being counted as zero.
+type PorDiffParseError struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Key     string `json:"key"`
+	Balance string `json:"balance"`
+}
+
+// DiffPorCsvData compares two snapshots loaded by InitPorCsvDataMap.
+func DiffPorCsvData(oldData, newData map[PorCoinKey]*CoinData) *PorDiff {
+	diff := &PorDiff{
+		Added:            make([]*PorDiffAddress, 0),
+		Removed:          make([]*PorDiffAddress, 0),
+		BalanceChanges:   make([]*PorBalanceChange, 0),
+		CoinTotalChanges: make([]*PorCoinTotalChange, 0),
+		SignatureChanges: make([]*PorFieldChange, 0),
+		MessageChanges:   make([]*PorFieldChange, 0),
+		ParseErrors:      make([]*PorDiffParseError, 0),
+	}
+	oldTotals, newTotals := make(map[string]decimal.Decimal), make(map[string]decimal.Decimal)
+	parseBalance := func(file string, d *CoinData) (decimal.Decimal, bool) {
+		balance, err := decimal.NewFromString(d.Balance)
+		if err != nil {
+			diff.ParseErrors = append(diff.ParseErrors, &PorDiffParseError{File: file, Line: d.Line, Key: d.Key().String(), Balance: d.Balance})
+			return decimal.Zero, false
+		}
+		return balance, true
+	}
+	oldBalances := make(map[PorCoinKey]decimal.Decimal, len(oldData))
+	for key, o := range oldData {
+		if balance, ok := parseBalance("old", o); ok {
+			oldBalances[key] = balance
+			oldTotals[o.Coin] = oldTotals[o.Coin].Add(balance)
+		}
+		if _, exist := newData[key]; !exist {
+			diff.Removed = append(diff.Removed, &PorDiffAddress{Coin: o.Coin, Network: o.Network, Address: o.Address, Type: o.Type, Balance: o.Balance})
+		}
+	}
+
+	for key, n := range newData {
+		newBalance, newOK := parseBalance("new", n)
+		if newOK {
+			newTotals[n.Coin] = newTotals[n.Coin].Add(newBalance)
+		}
+		o, exist := oldData[key]
+		if !exist {
+			diff.Added = append(diff.Added, &PorDiffAddress{Coin: n.Coin, Network: n.Network, Address: n.Address, Type: n.Type, Balance: n.Balance})
+			continue
+		}
+
+		oldBalance, oldOK := oldBalances[key]
+		if oldOK && newOK && !oldBalance.Equal(newBalance) {
+			diff.BalanceChanges = append(diff.BalanceChanges, &PorBalanceChange{
+				Coin:       n.Coin,
+				Network:    n.Network,
+				Address:    n.Address,
+				Type:       n.Type,
+				OldBalance: o.Balance,
+				NewBalance: n.Balance,
+				Delta:      newBalance.Sub(oldBalance).String(),
+			})
+		}
+
+		for _, f := range []struct{ field, old, new string }{
+			{"signature1", o.Sign1, n.Sign1},
+			{"signature2", o.Sign2, n.Sign2},
+			{"script", o.Script, n.Script},
+		} {
+			if f.old != f.new {
+				diff.SignatureChanges = append(diff.SignatureChanges, &PorFieldChange{Coin: n.Coin, Network: n.Network, Address: n.Address, Type: n.Type, Field: f.field, Old: f.old, New: f.new})
+			}
+		}
+		if o.Message != n.Message {
+			diff.MessageChanges = append(diff.MessageChanges, &PorFieldChange{Coin: n.Coin, Network: n.Network, Address: n.Address, Type: n.Type, Field: "message", Old: o.Message, New: n.Message})
+		}
+	}
+
+	coins := make(map[string]struct{})
+	for coin := range oldTotals {
+		coins[coin] = struct{}{}
+	}
+	for coin := range newTotals {
+		coins[coin] = struct{}{}
+	}
+	for coin := range coins {
+		oldTotal, newTotal := oldTotals[coin], newTotals[coin]
+		if oldTotal.Equal(newTotal) {
+			continue
+		}
+		diff.CoinTotalChanges = append(diff.CoinTotalChanges, &PorCoinTotalChange{
+			Coin:     coin,
+			OldTotal: oldTotal.String(),
+			NewTotal: newTotal.String(),
+			Delta:    newTotal.Sub(oldTotal).String(),
+		})
+	}
+
+	diff.sort()
+	return diff
+}
+
+// IsEmpty reports whether both snapshots hold the same addresses, balances, signatures and messages.
+func (d *PorDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.BalanceChanges) == 0 &&
+		len(d.CoinTotalChanges) == 0 && len(d.SignatureChanges) == 0 && len(d.MessageChanges) == 0 &&
+		len(d.ParseErrors) == 0
+}
+
+// WriteText writes the diff in a human readable form, addresses are grouped by coin and network.
+func (d *PorDiff) WriteText(w io.Writer) {
+	writeAddresses := func(title string, addresses []*PorDiffAddress) {
+		fmt.Fprintf(w, "%s addresses: %d\n", title, len(addresses))
+		group := ""
+		for _, a := range addresses {
+			if g := a.Coin + "/" + a.Network; g != group {
+				group = g
+				fmt.Fprintf(w, "  %s %s:\n", a.Coin, a.Network)
+			}
+			fmt.Fprintf(w, "    %s %s\n", keySuffix(a.Address, a.Type), a.Balance)
+		}
+	}
+	writeAddresses("Added", d.Added)
+	writeAddresses("Removed", d.Removed)
+
+	fmt.Fprintf(w, "Balance changes: %d\n", len(d.BalanceChanges))
+	for _, c := range d.BalanceChanges {
+		fmt.Fprintf(w, "  %s: %s -> %s (%s)\n", PorCoinKey{Coin: c.Coin, Network: c.Network, Address: c.Address, Type: c.Type}, c.OldBalance, c.NewBalance, signedDelta(c.Delta))
+	}
+	fmt.Fprintf(w, "Coin total changes: %d\n", len(d.CoinTotalChanges))
+	for _, c := range d.CoinTotalChanges {
+		fmt.Fprintf(w, "  %s: %s -> %s (%s)\n", c.Coin, c.OldTotal, c.NewTotal, signedDelta(c.Delta))
+	}
+	fmt.Fprintf(w, "Signature and script changes: %d\n", len(d.SignatureChanges))
+	for _, c := range d.SignatureChanges {
+		fmt.Fprintf(w, "  %s %s: %s -> %s\n", PorCoinKey{Coin: c.Coin, Network: c.Network, Address: c.Address, Type: c.Type}, c.Field, c.Old, c.New)
+	}
+	fmt.Fprintf(w, "Message changes: %d\n", len(d.MessageChanges))
+	for _, c := range d.MessageChanges {
+		fmt.Fprintf(w, "  %s: %q -> %q\n", PorCoinKey{Coin: c.Coin, Network: c.Network, Address: c.Address, Type: c.Type}, c.Old, c.New)
+	}
+	fmt.Fprintf(w, "Invalid balances: %d\n", len(d.ParseErrors))
+	for _, e := range d.ParseErrors {
+		fmt.Fprintf(w, "  %s file line %d %s: %q\n", e.File, e.Line, e.Key, e.Balance)
+	}
+}
+
+func (d *PorDiff) sort() {
+	addressLess := func(a, b *PorDiffAddress) bool {
+		if a.Coin != b.Coin {
+			return a.Coin < b.Coin
+		}
+		if a.Network != b.Network {
+			return a.Network < b.Network
+		}
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+		return a.Type < b.Type
+	}
+	sort.Slice(d.Added, func(i, j int) bool { return addressLess(d.Added[i], d.Added[j]) })
+	sort.Slice(d.Removed, func(i, j int) bool { return addressLess(d.Removed[i], d.Removed[j]) })
+	sort.Slice(d.BalanceChanges, func(i, j int) bool {
+		a, b := d.BalanceChanges[i], d.BalanceChanges[j]
+		return addressLess(&PorDiffAddress{Coin: a.Coin, Network: a.Network, Address: a.Address, Type: a.Type}, &PorDiffAddress{Coin: b.Coin, Network: b.Network, Address: b.Address, Type: b.Type})
+	})
+	sort.Slice(d.CoinTotalChanges, func(i, j int) bool { return d.CoinTotalChanges[i].Coin < d.CoinTotalChanges[j].Coin })
+	fieldLess := func(changes []*PorFieldChange) func(i, j int) bool {
+		return func(i, j int) bool {
+			a, b := changes[i], changes[j]
+			if a.Coin != b.Coin || a.Network != b.Network || a.Address != b.Address || a.Type != b.Type {
+				return addressLess(&PorDiffAddress{Coin: a.Coin, Network: a.Network, Address: a.Address, Type: a.Type}, &PorDiffAddress{Coin: b.Coin, Network: b.Network, Address: b.Address, Type: b.Type})
+			}
+			return a.Field < b.Field
+		}
+	}
+	sort.Slice(d.SignatureChanges, fieldLess(d.SignatureChanges))
+	sort.Slice(d.MessageChanges, fieldLess(d.MessageChanges))
+	sort.Slice(d.ParseErrors, func(i, j int) bool {
+		if d.ParseErrors[i].File != d.ParseErrors[j].File {
+			return d.ParseErrors[i].File > d.ParseErrors[j].File
+		}
+		return d.ParseErrors[i].Line < d.ParseErrors[j].Line
+	})
+}
+
+// keySuffix appends the type of a row to its address, rows are keyed on both.
+func keySuffix(address, typ string) string {
+	if typ == "" {
+		return address
+	}
+	return address + "/" + typ
+}
+
+func signedDelta(delta string) string {
+	if len(delta) > 0 && delta[0] != '-' && delta != "0" {
+		return "+" + delta
+	}
+	return delta
+}
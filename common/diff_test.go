@@ -0,0 +1,104 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const diffCsvHeader = "coin,snapshot height,amount\nETH(ALL),-,3\n\ncoin,Network,Snapshot Height,address,amount,message,signature1,signature2,redeem script/ public key\n"
+
+func writeTempCsv(t *testing.T, name, content string) string {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(fileName, []byte(content), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func TestDiffPorCsvData(t *testing.T) {
+	oldFile := writeTempCsv(t, "old.csv", diffCsvHeader+
+		"ETH,ETH,100,0xaaa,1.5,I am an OKX address,0x01,,\n"+
+		"ETH,ETH,100,0xbbb,1,I am an OKX address,0x02,,\n"+
+		"BTC,BTC,200,3Fs7,0.5,I am an OKX address,H1,H2,5221\n")
+	newFile := writeTempCsv(t, "new.csv", diffCsvHeader+
+		"ETH,ETH,101,0xaaa,2,I am an OKX address,0x01,,\n"+
+		"ETH,ETH,101,0xccc,0.25,I am an OKX address,0x03,,\n"+
+		"BTC,BTC,201,3Fs7,0.5,OKC_DTT_AUP2025,H1,H3,5221\n")
+
+	oldData, err := InitPorCsvDataMap(oldFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newData, err := InitPorCsvDataMap(newFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := DiffPorCsvData(oldData, newData)
+
+	if len(diff.Added) != 1 || diff.Added[0].Address != "0xccc" {
+		t.Errorf("added = %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Address != "0xbbb" {
+		t.Errorf("removed = %+v", diff.Removed)
+	}
+	if len(diff.BalanceChanges) != 1 || diff.BalanceChanges[0].Delta != "0.5" {
+		t.Errorf("balance changes = %+v", diff.BalanceChanges)
+	}
+	if len(diff.CoinTotalChanges) != 1 || diff.CoinTotalChanges[0].Coin != "ETH" || diff.CoinTotalChanges[0].Delta != "-0.25" {
+		t.Errorf("coin total changes = %+v", diff.CoinTotalChanges)
+	}
+	if len(diff.SignatureChanges) != 1 || diff.SignatureChanges[0].Field != "signature2" {
+		t.Errorf("signature changes = %+v", diff.SignatureChanges)
+	}
+	if len(diff.MessageChanges) != 1 || diff.MessageChanges[0].Address != "3Fs7" {
+		t.Errorf("message changes = %+v", diff.MessageChanges)
+	}
+
+	var text strings.Builder
+	diff.WriteText(&text)
+	if !strings.Contains(text.String(), "0xaaa: 1.5 -> 2 (+0.5)") {
+		t.Errorf("text output:\n%s", text.String())
+	}
+	if !DiffPorCsvData(oldData, oldData).IsEmpty() {
+		t.Error("a snapshot must not differ from itself")
+	}
+}
+
+func TestDiffPorCsvDataInvalidBalance(t *testing.T) {
+	header := "coin,snapshot height,amount\nETH(ALL),-,3\n\ncoin,Type,Network,Snapshot Height,address,amount,message,signature1,signature2,redeem script/ public key,EOA1,EOA2\n"
+	oldFile := writeTempCsv(t, "old.csv", header+
+		"ETH,Non Staking,ETH,100,0xaaa,1,I am an OKX address,0x01,,,,\n"+
+		"ETH,Native ETH Staking,ETH,100,0xaaa,2,I am an OKX address,0x01,,,,\n")
+	newFile := writeTempCsv(t, "new.csv", header+
+		"ETH,Non Staking,ETH,101,0xaaa,1.x,I am an OKX address,0x01,,,,\n"+
+		"ETH,Native ETH Staking,ETH,101,0xaaa,3,I am an OKX address,0x01,,,,\n")
+	oldData, err := InitPorCsvDataMap(oldFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newData, err := InitPorCsvDataMap(newFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := DiffPorCsvData(oldData, newData)
+
+	if len(diff.ParseErrors) != 1 || diff.ParseErrors[0].File != "new" || diff.ParseErrors[0].Key != "ETH/ETH/0xaaa/Non Staking" {
+		t.Fatalf("parse errors = %+v", diff.ParseErrors)
+	}
+	// the unreadable balance is neither a change to 0 nor counted in the total
+	if len(diff.BalanceChanges) != 1 || diff.BalanceChanges[0].Type != "Native ETH Staking" || diff.BalanceChanges[0].Delta != "1" {
+		t.Errorf("balance changes = %+v", diff.BalanceChanges)
+	}
+	var text strings.Builder
+	diff.WriteText(&text)
+	if !strings.Contains(text.String(), "ETH/ETH/0xaaa/Native ETH Staking: 2 -> 3 (+1)") || !strings.Contains(text.String(), "Invalid balances: 1") {
+		t.Errorf("text output:\n%s", text.String())
+	}
+	if DiffPorCsvData(newData, newData).IsEmpty() {
+		t.Error("a snapshot with an invalid balance must not be reported as unchanged")
+	}
+}
@@ -1,6 +1,8 @@
 package common
 
 import (
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"github.com/dchest/blake2b"
 	"github.com/martinboehm/btcutil/base58"
@@ -44,3 +46,51 @@ func appendBytes(data1, data2 []byte) []byte {
 	}
 	return append(data1, data2...)
 }
+
+// GetSiaAddressFromPublicKey returns the unlock hash of the standard unlock conditions of a key
+// (timelock 0, the key, 1 signature required) followed by its 6 byte checksum, in hex.
+func GetSiaAddressFromPublicKey(publicKeyHex string) (string, error) {
+	publicKeyBytes, _ := Decode(publicKeyHex)
+	if len(publicKeyBytes) != 32 {
+		return "", errors.New("public hash length is not equal 32")
+	}
+	// the unlock hash is the merkle root of the leaves timelock, public key and signatures required
+	leaf := func(data []byte) [32]byte {
+		return blake2b.Sum256(append([]byte{0x00}, data...))
+	}
+	node := func(left, right [32]byte) [32]byte {
+		return blake2b.Sum256(append(append([]byte{0x01}, left[:]...), right[:]...))
+	}
+	timelock, sigsRequired := make([]byte, 8), make([]byte, 8)
+	binary.LittleEndian.PutUint64(sigsRequired, 1)
+	// a SiaPublicKey is its 16 byte algorithm specifier and the length prefixed key
+	siaPublicKey := make([]byte, 16+8, 16+8+32)
+	copy(siaPublicKey, "ed25519")
+	binary.LittleEndian.PutUint64(siaPublicKey[16:], 32)
+	siaPublicKey = append(siaPublicKey, publicKeyBytes...)
+
+	unlockHash := node(node(leaf(timelock), leaf(siaPublicKey)), leaf(sigsRequired))
+	checksum := blake2b.Sum256(unlockHash[:])
+	return hex.EncodeToString(unlockHash[:]) + hex.EncodeToString(checksum[:6]), nil
+}
+
+// GetIotaAddressesFromPublicKey returns the addresses of a key on IOTA: the Stardust Ed25519
+// addresses of IOTA and Shimmer, bech32 of 0x00 and blake2b-256(key), and the IOTA Rebased
+// address, blake2b-256(0x00 and key) in hex.
+func GetIotaAddressesFromPublicKey(publicKeyHex string) ([]string, error) {
+	publicKeyBytes, _ := Decode(publicKeyHex)
+	if len(publicKeyBytes) != 32 {
+		return nil, errors.New("public hash length is not equal 32")
+	}
+	keyHash := blake2b.Sum256(publicKeyBytes)
+	var addrs []string
+	for _, hrp := range []string{"iota", "smr"} {
+		addr, err := encodeBech32(hrp, append([]byte{0x00}, keyHash[:]...))
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+	rebased := blake2b.Sum256(append([]byte{0x00}, publicKeyBytes...))
+	return append(addrs, "0x"+hex.EncodeToString(rebased[:])), nil
+}
@@ -0,0 +1,157 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Eip1271MagicValue is the selector of isValidSignature(bytes32,bytes), returned by a contract
+	// wallet that accepts the signature.
+	Eip1271MagicValue = "0x1626ba7e"
+	// Erc6492MagicSuffix ends the signature of a counterfactual wallet, the signature is
+	// abi.encode(factory, factoryCalldata, signature) followed by the suffix.
+	Erc6492MagicSuffix = "0x6492649264926492649264926492649264926492649264926492649264926492"
+)
+
+// Eip1271Verifier verifies EVM rows that the EOA verifier rejects against the contract at the
+// address, by calling isValidSignature(bytes32,bytes) at the snapshot block. Signatures wrapped
+// per ERC-6492 are checked on a simulated deployment when the wallet is not deployed yet.
+type Eip1271Verifier struct {
+	next      SignatureVerifier
+	endpoints map[string]*EvmRPCEndpoint
+}
+
+// NewEip1271Verifier returns a verifier that falls back to EIP-1271 when next fails. client.RpcClient
+// must be initialized.
+func NewEip1271Verifier(next SignatureVerifier, endpoints map[string]*EvmRPCEndpoint) *Eip1271Verifier {
+	return &Eip1271Verifier{next: next, endpoints: endpoints}
+}
+
+func (v *Eip1271Verifier) Verify(row *CoinData) *SignatureResult {
+	result := v.next.Verify(row)
+	if result.OK() {
+		return result
+	}
+	if err := v.verifyContract(row); err != nil {
+		// report the contract failure, the EOA failure is expected for a contract wallet
+		return &SignatureResult{Address: row.Address, Signer: SignerAddress, Verifier: EvmCoinTye + "+EIP-1271",
+			Err: fmt.Errorf("%w, EOA verification failed: %v", err, result.Err)}
+	}
+	return &SignatureResult{Address: row.Address, Signer: SignerAddress, Verifier: EvmCoinTye + "+EIP-1271"}
+}
+
+func (v *Eip1271Verifier) verifyContract(row *CoinData) error {
+	endpoint, err := rowRPCEndpoint(v.endpoints, row)
+	if err != nil {
+		return err
+	}
+	msgHeader, exist := PorCoinMessageSignatureHeaderMap[row.Coin]
+	if !exist {
+		return withReason(ReasonUnsupportedCoin, fmt.Errorf("invalid coin type %s, addr:%s", row.Coin, row.Address))
+	}
+	sign, err := Decode(row.Sign1)
+	if err != nil {
+		return fmt.Errorf("invalid contract signature, addr:%s, error:%v", row.Address, err)
+	}
+	block, err := rowBlockParam(endpoint, row)
+	if err != nil {
+		return err
+	}
+	hash := HashEvmCoinTypeMsg(msgHeader, row.Message)
+	return VerifyEip1271Signature(endpoint, row.Address, hash, sign, block)
+}
+
+// VerifyEip1271Signature asks the contract at addr whether sign is a valid signature of hash at
+// the block. An ERC-6492 signature of a wallet without code is verified on eth_simulateV1 after
+// its factory call.
+func VerifyEip1271Signature(endpoint *EvmRPCEndpoint, addr string, hash, sign []byte, block interface{}) error {
+	factory, factoryCalldata, inner, wrapped, err := decodeErc6492Signature(sign)
+	if err != nil {
+		return fmt.Errorf("invalid ERC-6492 signature, addr:%s, error:%v", addr, err)
+	}
+	call := map[string]string{"to": addr, "data": Encode(encodeIsValidSignature(hash, inner))}
+
+	var returnData string
+	deployed := true
+	if wrapped {
+		var code string
+		if err = evmRPCCall(endpoint, "eth_getCode", []interface{}{addr, block}, &code); err != nil {
+			return err
+		}
+		deployed = code != "" && code != "0x"
+	}
+	if deployed {
+		if err = evmRPCCall(endpoint, "eth_call", []interface{}{call, block}, &returnData); err != nil {
+			// a reverting isValidSignature rejects the signature, it is not a node failure
+			if reverted := evmCallReverted(err); reverted != nil {
+				return fmt.Errorf("contract rejected the signature, addr:%s, isValidSignature reverted: %s", addr, reverted.Message)
+			}
+			return err
+		}
+	} else {
+		simulation := map[string]interface{}{
+			"blockStateCalls": []interface{}{
+				map[string]interface{}{"calls": []interface{}{
+					map[string]string{"to": factory, "data": Encode(factoryCalldata)},
+					call,
+				}},
+			},
+		}
+		var blocks []struct {
+			Calls []struct {
+				ReturnData string `json:"returnData"`
+				Status     string `json:"status"`
+			} `json:"calls"`
+		}
+		if err = evmRPCCall(endpoint, "eth_simulateV1", []interface{}{simulation, block}, &blocks); err != nil {
+			return err
+		}
+		if len(blocks) != 1 || len(blocks[0].Calls) != 2 {
+			return withReason(ReasonRPCError, fmt.Errorf("%w, unexpected eth_simulateV1 result, addr:%s", ErrRPC, addr))
+		}
+		if blocks[0].Calls[0].Status != "0x1" {
+			return fmt.Errorf("ERC-6492 factory call reverted, addr:%s, factory:%s", addr, factory)
+		}
+		returnData = blocks[0].Calls[1].ReturnData
+	}
+
+	// bytes4 is returned left aligned in a 32 byte word
+	if !strings.HasPrefix(strings.ToLower(returnData), Eip1271MagicValue) {
+		return fmt.Errorf("contract rejected the signature, addr:%s, isValidSignature returned %q", addr, returnData)
+	}
+	return nil
+}
+
+// encodeIsValidSignature abi encodes isValidSignature(bytes32 hash, bytes signature).
+func encodeIsValidSignature(hash, sign []byte) []byte {
+	data := make([]byte, 0, 4+32*4+len(sign))
+	data = append(data, MustDecode(Eip1271MagicValue)...)
+	data = append(data, leftPad32(hash)...)
+	data = append(data, abiUint(64)...)
+	data = append(data, abiBytes(sign)...)
+	return data
+}
+
+// decodeErc6492Signature unwraps abi.encode(address, bytes, bytes) ++ magic suffix, a signature
+// without the suffix is returned as it is.
+func decodeErc6492Signature(sign []byte) (factory string, factoryCalldata, inner []byte, wrapped bool, err error) {
+	suffix := MustDecode(Erc6492MagicSuffix)
+	if !bytes.HasSuffix(sign, suffix) {
+		return "", nil, sign, false, nil
+	}
+	data := sign[:len(sign)-len(suffix)]
+	if len(data) < 96 {
+		return "", nil, nil, true, errors.New("wrapper is shorter than its head")
+	}
+	factory = Encode(data[12:32])
+	if factoryCalldata, err = abiDynamicBytes(data, data[32:64]); err != nil {
+		return "", nil, nil, true, err
+	}
+	if inner, err = abiDynamicBytes(data, data[64:96]); err != nil {
+		return "", nil, nil, true, err
+	}
+	return factory, factoryCalldata, inner, true, nil
+}
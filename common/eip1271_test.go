@@ -0,0 +1,161 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/okx/proof-of-reserves/client"
+)
+
+const (
+	contractWallet = "0x00000000000000000000000000000000000c0de1"
+	walletFactory  = "0x00000000000000000000000000000000000fac70"
+	okxTestMessage = "I am an OKX address"
+)
+
+// newContractWalletNode answers isValidSignature with the magic value for the signature 0x1234
+// only. The wallet has code unless undeployed is set, then it exists on eth_simulateV1 only.
+func newContractWalletNode(t *testing.T, undeployed bool, methods *[]string) *httptest.Server {
+	accepted := Encode(encodeIsValidSignature(HashEvmCoinTypeMsg(PorCoinMessageSignatureHeaderMap["ETH"], okxTestMessage), []byte{0x12, 0x34}))
+	isValid := func(call map[string]string) string {
+		if call["to"] == contractWallet && call["data"] == accepted {
+			return Eip1271MagicValue + strings.Repeat("0", 56)
+		}
+		return "0xffffffff" + strings.Repeat("0", 56)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		*methods = append(*methods, body.Method)
+		var block string
+		_ = json.Unmarshal(body.Params[len(body.Params)-1], &block)
+		if block != "0x13f2c2f" {
+			t.Fatalf("%s at block %s, want the snapshot height", body.Method, block)
+		}
+		switch body.Method {
+		case "eth_getCode":
+			if undeployed {
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":"0x"}`)
+			} else {
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":"0x6080"}`)
+			}
+		case "eth_call":
+			var call map[string]string
+			_ = json.Unmarshal(body.Params[0], &call)
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":"%s"}`, isValid(call))
+		case "eth_simulateV1":
+			var simulation struct {
+				BlockStateCalls []struct {
+					Calls []map[string]string `json:"calls"`
+				} `json:"blockStateCalls"`
+			}
+			_ = json.Unmarshal(body.Params[0], &simulation)
+			calls := simulation.BlockStateCalls[0].Calls
+			if calls[0]["to"] != walletFactory || calls[0]["data"] != "0xdeadbeef" {
+				t.Fatalf("unexpected factory call %v", calls[0])
+			}
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":[{"calls":[{"returnData":"0x","status":"0x1"},{"returnData":"%s","status":"0x1"}]}]}`, isValid(calls[1]))
+		default:
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method not found"}}`)
+		}
+	}))
+}
+
+// wrapErc6492 returns abi.encode(factory, factoryCalldata, sign) ++ magic suffix.
+func wrapErc6492(factory string, factoryCalldata, sign []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(leftPad32(MustDecode(factory)))
+	buf.Write(abiUint(96))
+	buf.Write(abiUint(uint64(96 + len(abiBytes(factoryCalldata)))))
+	buf.Write(abiBytes(factoryCalldata))
+	buf.Write(abiBytes(sign))
+	buf.Write(MustDecode(Erc6492MagicSuffix))
+	return buf.Bytes()
+}
+
+func TestEip1271Verifier(t *testing.T) {
+	eoaRow := &CoinData{Coin: "ETH", Network: "ETH", SnapshotHeight: "20917295", Address: "0x0cdcdb19a857c2ac24818ca4fdfe38cce071483e", Message: okxTestMessage,
+		Sign1: "0x07f19879aa28d51c97cddfdfecffe7ed96525545d041aee4f4386b0bf4c1a26924b637fb02ccbb97305c13daa51a0f50b8896fb25ecbaf60020cde920d227a221b"}
+	contractRow := func(sign string) *CoinData {
+		return &CoinData{Coin: "ETH", Network: "ETH", SnapshotHeight: "20917295", Address: contractWallet, Message: okxTestMessage, Sign1: sign}
+	}
+	wrapped := Encode(wrapErc6492(walletFactory, MustDecode("0xdeadbeef"), []byte{0x12, 0x34}))
+
+	tests := []struct {
+		name       string
+		row        *CoinData
+		undeployed bool
+		reason     string
+		methods    string
+	}{
+		{"eoa", eoaRow, false, "", ""},
+		{"contract accepts", contractRow("0x1234"), false, "", "eth_call"},
+		{"contract rejects", contractRow("0x5678"), false, ReasonBadSignature, "eth_call"},
+		{"erc6492 deployed", contractRow(wrapped), false, "", "eth_getCode,eth_call"},
+		{"erc6492 counterfactual", contractRow(wrapped), true, "", "eth_getCode,eth_simulateV1"},
+		{"no endpoint", &CoinData{Coin: "ETH", Network: "POLYGON", Address: contractWallet, Message: okxTestMessage, Sign1: "0x1234"}, false, ReasonUnsupportedCoin, ""},
+	}
+	client.RpcClient = client.NewJsonRPCClient()
+	evm, _ := RegisteredSignatureVerifier(EvmCoinTye)
+	for _, test := range tests {
+		var methods []string
+		node := newContractWalletNode(t, test.undeployed, &methods)
+		verifier := NewEip1271Verifier(evm, map[string]*EvmRPCEndpoint{"eth": {Endpoint: node.URL}})
+		result := verifier.Verify(test.row)
+		node.Close()
+		if FailureReason(result.Err) != test.reason {
+			t.Errorf("%s: expected reason %q, got %q (%v)", test.name, test.reason, FailureReason(result.Err), result.Err)
+		}
+		if strings.Join(methods, ",") != test.methods {
+			t.Errorf("%s: expected calls %q, got %q", test.name, test.methods, strings.Join(methods, ","))
+		}
+	}
+}
+
+func TestEip1271VerifierRPCError(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		reason   string
+	}{
+		{"node failure", `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"missing trie node"}}`, ReasonRPCError},
+		{"reverted", `{"jsonrpc":"2.0","id":1,"error":{"code":3,"message":"execution reverted","data":"0x"}}`, ReasonBadSignature},
+		{"reverted without code", `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"execution reverted"}}`, ReasonBadSignature},
+	}
+	client.RpcClient = client.NewJsonRPCClient()
+	evm, _ := RegisteredSignatureVerifier(EvmCoinTye)
+	for _, test := range tests {
+		node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			fmt.Fprint(w, test.response)
+		}))
+		verifier := NewEip1271Verifier(evm, map[string]*EvmRPCEndpoint{"eth": {Endpoint: node.URL}})
+		result := verifier.Verify(&CoinData{Coin: "ETH", Network: "ETH", SnapshotHeight: "20917295", Address: contractWallet, Message: okxTestMessage, Sign1: "0x1234"})
+		node.Close()
+		if FailureReason(result.Err) != test.reason {
+			t.Errorf("%s: expected %q, got %q (%v)", test.name, test.reason, FailureReason(result.Err), result.Err)
+		}
+	}
+}
+
+func TestDecodeErc6492Signature(t *testing.T) {
+	factory, calldata, inner, wrapped, err := decodeErc6492Signature(wrapErc6492(walletFactory, bytes.Repeat([]byte{1}, 40), []byte{0x12, 0x34}))
+	if err != nil || !wrapped || factory != walletFactory || len(calldata) != 40 || !bytes.Equal(inner, []byte{0x12, 0x34}) {
+		t.Fatalf("unexpected unwrap %s %x %x %v %v", factory, calldata, inner, wrapped, err)
+	}
+	if _, _, inner, wrapped, err = decodeErc6492Signature([]byte{0x12}); err != nil || wrapped || !bytes.Equal(inner, []byte{0x12}) {
+		t.Fatalf("plain signature must be returned as it is")
+	}
+	if _, _, _, _, err = decodeErc6492Signature(MustDecode(Erc6492MagicSuffix)); err == nil {
+		t.Fatalf("expected a truncated wrapper to fail")
+	}
+}
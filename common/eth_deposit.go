@@ -0,0 +1,292 @@
+package common
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// DomainDeposit is the domain type of deposit signatures, which are valid on every fork.
+var DomainDeposit = [4]byte{0x03, 0x00, 0x00, 0x00}
+
+// DepositForkVersions are the genesis fork versions of the networks a deposit may be signed for.
+var DepositForkVersions = map[string][4]byte{
+	"mainnet": {0x00, 0x00, 0x00, 0x00},
+	"sepolia": {0x90, 0x00, 0x00, 0x69},
+	"holesky": {0x01, 0x01, 0x70, 0x00},
+	"hoodi":   {0x10, 0x00, 0x09, 0x10},
+}
+
+// Withdrawal credential prefixes: a BLS withdrawal key, and an execution address without or with
+// compounding.
+const (
+	BLSWithdrawalPrefix         = 0x00
+	ExecutionWithdrawalPrefix   = 0x01
+	CompoundingWithdrawalPrefix = 0x02
+)
+
+// DepositData is a deposit of the deposit_data json of the staking deposit cli.
+type DepositData struct {
+	Pubkey                string `json:"pubkey"`
+	WithdrawalCredentials string `json:"withdrawal_credentials"`
+	// Amount is in gwei
+	Amount             uint64 `json:"amount"`
+	Signature          string `json:"signature"`
+	DepositMessageRoot string `json:"deposit_message_root"`
+	DepositDataRoot    string `json:"deposit_data_root"`
+	ForkVersion        string `json:"fork_version"`
+	NetworkName        string `json:"network_name,omitempty"`
+}
+
+// sszChunk pads a value of at most 32 bytes to a chunk.
+func sszChunk(b []byte) []byte {
+	chunk := make([]byte, 32)
+	copy(chunk, b)
+	return chunk
+}
+
+// sszMerkleize returns the root of the chunks, padded with zero chunks to a power of two.
+func sszMerkleize(chunks ...[]byte) []byte {
+	n := 1
+	for n < len(chunks) {
+		n *= 2
+	}
+	layer := make([][]byte, n)
+	for i := range layer {
+		layer[i] = make([]byte, 32)
+		if i < len(chunks) {
+			copy(layer[i], chunks[i])
+		}
+	}
+	for len(layer) > 1 {
+		next := make([][]byte, len(layer)/2)
+		for i := range next {
+			h := sha256.Sum256(append(append([]byte{}, layer[2*i]...), layer[2*i+1]...))
+			next[i] = h[:]
+		}
+		layer = next
+	}
+	return layer[0]
+}
+
+// sszBytesRoot returns the hash tree root of a fixed size byte vector.
+func sszBytesRoot(b []byte) []byte {
+	var chunks [][]byte
+	for i := 0; i < len(b); i += 32 {
+		end := i + 32
+		if end > len(b) {
+			end = len(b)
+		}
+		chunks = append(chunks, sszChunk(b[i:end]))
+	}
+	return sszMerkleize(chunks...)
+}
+
+func sszUint64(v uint64) []byte {
+	chunk := make([]byte, 32)
+	binary.LittleEndian.PutUint64(chunk, v)
+	return chunk
+}
+
+// DepositMessageRoot returns the hash tree root of the DepositMessage, the pubkey, withdrawal
+// credentials and amount in gwei.
+func DepositMessageRoot(pubkey, withdrawalCredentials []byte, amount uint64) []byte {
+	return sszMerkleize(sszBytesRoot(pubkey), sszBytesRoot(withdrawalCredentials), sszUint64(amount))
+}
+
+// DepositDataRoot returns the hash tree root of the DepositData, the DepositMessage and its signature.
+func DepositDataRoot(pubkey, withdrawalCredentials []byte, amount uint64, signature []byte) []byte {
+	return sszMerkleize(sszBytesRoot(pubkey), sszBytesRoot(withdrawalCredentials), sszUint64(amount), sszBytesRoot(signature))
+}
+
+// ComputeDepositDomain returns the deposit domain of a fork version, the domain type and the
+// first 28 bytes of the ForkData root with an empty genesis validators root.
+func ComputeDepositDomain(forkVersion [4]byte) []byte {
+	forkDataRoot := sszMerkleize(sszChunk(forkVersion[:]), make([]byte, 32))
+	return append(DomainDeposit[:], forkDataRoot[:28]...)
+}
+
+// DepositSigningRoot returns the root a deposit signs, the SigningData of the DepositMessage root
+// and the domain.
+func DepositSigningRoot(messageRoot, domain []byte) []byte {
+	return sszMerkleize(messageRoot, domain)
+}
+
+// forkVersion returns the fork version of the deposit, its network's when it has none.
+func (d *DepositData) forkVersion() ([4]byte, error) {
+	var version [4]byte
+	if d.ForkVersion == "" {
+		version, exist := DepositForkVersions[strings.ToLower(d.NetworkName)]
+		if !exist {
+			return version, fmt.Errorf("deposit of %s has no fork version", d.Pubkey)
+		}
+		return version, nil
+	}
+	b, err := Decode(d.ForkVersion)
+	if err != nil || len(b) != 4 {
+		return version, fmt.Errorf("invalid fork version %s", d.ForkVersion)
+	}
+	copy(version[:], b)
+	return version, nil
+}
+
+// Verify checks the deposit roots the json publishes and the BLS signature of the deposit message
+// by the validator key, over the deposit domain of its fork version.
+func (d *DepositData) Verify() error {
+	pubkey, err := Decode(d.Pubkey)
+	if err != nil || len(pubkey) != 48 {
+		return withReason(ReasonUndecodableAddress, fmt.Errorf("invalid validator pubkey %s", d.Pubkey))
+	}
+	credentials, err := Decode(d.WithdrawalCredentials)
+	if err != nil || len(credentials) != 32 {
+		return fmt.Errorf("invalid withdrawal credentials %s", d.WithdrawalCredentials)
+	}
+	signature, err := Decode(d.Signature)
+	if err != nil || len(signature) != 96 {
+		return fmt.Errorf("invalid deposit signature %s", d.Signature)
+	}
+	version, err := d.forkVersion()
+	if err != nil {
+		return err
+	}
+
+	messageRoot := DepositMessageRoot(pubkey, credentials, d.Amount)
+	if d.DepositMessageRoot != "" && !strings.EqualFold(strings.TrimPrefix(d.DepositMessageRoot, "0x"), hex.EncodeToString(messageRoot)) {
+		return fmt.Errorf("deposit message root %s is not %x", d.DepositMessageRoot, messageRoot)
+	}
+	dataRoot := DepositDataRoot(pubkey, credentials, d.Amount, signature)
+	if d.DepositDataRoot != "" && !strings.EqualFold(strings.TrimPrefix(d.DepositDataRoot, "0x"), hex.EncodeToString(dataRoot)) {
+		return fmt.Errorf("deposit data root %s is not %x", d.DepositDataRoot, dataRoot)
+	}
+
+	var p [48]byte
+	var s [96]byte
+	copy(p[:], pubkey)
+	copy(s[:], signature)
+	var pub Pubkey
+	if err = pub.Deserialize(&p); err != nil {
+		return withReason(ReasonUndecodableAddress, fmt.Errorf("failed to deserialize validator pubkey %s: %v", d.Pubkey, err))
+	}
+	var sig Signature
+	if err = sig.Deserialize(&s); err != nil {
+		return fmt.Errorf("failed to deserialize deposit signature: %v", err)
+	}
+	if !Verify(&pub, DepositSigningRoot(messageRoot, ComputeDepositDomain(version)), &sig) {
+		return fmt.Errorf("deposit signature of %s does not verify for fork version %x", d.Pubkey, version)
+	}
+	return nil
+}
+
+// WithdrawalAddress returns the execution address of 0x01 or 0x02 withdrawal credentials.
+func WithdrawalAddress(credentials []byte) (string, bool) {
+	if len(credentials) != 32 || (credentials[0] != ExecutionWithdrawalPrefix && credentials[0] != CompoundingWithdrawalPrefix) ||
+		!bytes.Equal(credentials[1:12], make([]byte, 11)) {
+		return "", false
+	}
+	return "0x" + hex.EncodeToString(credentials[12:]), true
+}
+
+// CheckWithdrawal checks that the withdrawal credentials of the deposit pay one of the addresses.
+// BLS withdrawal credentials name no address and do not pass.
+func (d *DepositData) CheckWithdrawal(addrs ...string) error {
+	credentials, _ := Decode(d.WithdrawalCredentials)
+	withdrawal, ok := WithdrawalAddress(credentials)
+	if !ok {
+		return withReason(ReasonAddressMismatch, fmt.Errorf("withdrawal credentials %s of %s name no execution address", d.WithdrawalCredentials, d.Pubkey))
+	}
+	for _, addr := range addrs {
+		if addr != "" && strings.EqualFold(addr, withdrawal) {
+			return nil
+		}
+	}
+	return withReason(ReasonAddressMismatch, fmt.Errorf("validator %s withdraws to %s, not to %v", d.Pubkey, withdrawal, addrs))
+}
+
+// DepositIndex holds the deposits of a deposit_data json by validator pubkey, a validator may have
+// several deposits.
+type DepositIndex map[string][]*DepositData
+
+// depositKey returns the lower case hex of a validator pubkey without 0x.
+func depositKey(pubkey string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(pubkey), "0x"))
+}
+
+// ParseDepositData decodes the deposits of a deposit_data json, an array of deposits.
+func ParseDepositData(b []byte) (DepositIndex, error) {
+	var deposits []*DepositData
+	if err := json.Unmarshal(b, &deposits); err != nil {
+		return nil, fmt.Errorf("invalid deposit data: %v", err)
+	}
+	index := make(DepositIndex, len(deposits))
+	for _, d := range deposits {
+		key := depositKey(d.Pubkey)
+		index[key] = append(index[key], d)
+	}
+	return index, nil
+}
+
+// LoadDepositData reads the deposits of deposit_data json files.
+func LoadDepositData(fileNames ...string) (DepositIndex, error) {
+	index := make(DepositIndex)
+	for _, fileName := range fileNames {
+		b, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		deposits, err := ParseDepositData(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fileName, err)
+		}
+		for key, d := range deposits {
+			index[key] = append(index[key], d...)
+		}
+	}
+	return index, nil
+}
+
+// Verify checks the deposits of a validator: one of them must be signed by the validator and
+// withdraw to one of the addresses.
+func (x DepositIndex) Verify(pubkey string, addrs ...string) error {
+	deposits := x[depositKey(pubkey)]
+	if len(deposits) == 0 {
+		return withReason(ReasonMissingDeposit, fmt.Errorf("validator %s has no deposit", pubkey))
+	}
+	var err error
+	for _, d := range deposits {
+		if err = d.Verify(); err == nil {
+			if err = d.CheckWithdrawal(addrs...); err == nil {
+				return nil
+			}
+		}
+	}
+	return err
+}
+
+// DepositVerifier ties the validator key of an ETH staking row to its deposit: after the wrapped
+// verifier, the row's address must have a deposit signed by it whose withdrawal credentials pay
+// EOA1, EOA2 or the EigenPod of an Eigenlayer row. Other rows are left to the wrapped verifier.
+type DepositVerifier struct {
+	next     SignatureVerifier
+	deposits DepositIndex
+}
+
+func NewDepositVerifier(next SignatureVerifier, deposits DepositIndex) *DepositVerifier {
+	return &DepositVerifier{next: next, deposits: deposits}
+}
+
+func (v *DepositVerifier) Verify(row *CoinData) *SignatureResult {
+	result := v.next.Verify(row)
+	if !result.OK() || row.Coin != "ETH" || !isStakingRow(row) {
+		return result
+	}
+	result.Verifier += "+deposit"
+	if err := v.deposits.Verify(row.Address, row.EOA1, row.EOA2, row.EigenPod); err != nil {
+		result.Address, result.Signer, result.Err = row.Address, SignerAddress, err
+	}
+	return result
+}
@@ -0,0 +1,175 @@
+package common
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	kbls "github.com/kilic/bls12-381"
+)
+
+func TestComputeDepositDomain(t *testing.T) {
+	expected := "03000000f5a5fd42d16a20302798ef6ed309979b43003d2320d9f0e8ea9831a9"
+	if d := hex.EncodeToString(ComputeDepositDomain(DepositForkVersions["mainnet"])); d != expected {
+		t.Fatalf("expected the mainnet deposit domain %s, got %s", expected, d)
+	}
+	if root := hex.EncodeToString(sszBytesRoot(make([]byte, 48))); root != hex.EncodeToString(sszMerkleize(make([]byte, 32), make([]byte, 32))) {
+		t.Fatalf("unexpected root of a zero pubkey %s", root)
+	}
+}
+
+// depositTestKey is the secret key of a validator.
+type depositTestKey struct {
+	sk  *big.Int
+	pub [48]byte
+}
+
+func newDepositTestKey(seed int64) *depositTestKey {
+	k := &depositTestKey{sk: big.NewInt(seed*7919 + 1)}
+	g1 := kbls.NewG1()
+	copy(k.pub[:], g1.ToCompressed(g1.MulScalarBig(g1.New(), &kbls.G1One, k.sk)))
+	return k
+}
+
+// deposit returns the deposit of 32 ETH withdrawing to the credentials, signed for the network.
+func (k *depositTestKey) deposit(credentials, network string) *DepositData {
+	wc := MustDecode(credentials)
+	version := DepositForkVersions[network]
+	messageRoot := DepositMessageRoot(k.pub[:], wc, 32000000000)
+	g2 := kbls.NewG2()
+	q, _ := g2.HashToCurve(DepositSigningRoot(messageRoot, ComputeDepositDomain(version)), domain)
+	sig := g2.ToCompressed(g2.MulScalarBig(g2.New(), q, k.sk))
+	return &DepositData{
+		Pubkey:                hex.EncodeToString(k.pub[:]),
+		WithdrawalCredentials: hex.EncodeToString(wc),
+		Amount:                32000000000,
+		Signature:             hex.EncodeToString(sig),
+		DepositMessageRoot:    hex.EncodeToString(messageRoot),
+		DepositDataRoot:       hex.EncodeToString(DepositDataRoot(k.pub[:], wc, 32000000000, sig)),
+		ForkVersion:           hex.EncodeToString(version[:]),
+		NetworkName:           network,
+	}
+}
+
+const (
+	depositTestEOA = "0x0cdcdb7c6a2b2a0e5a0e1e4f6b0b4c8e2b3a4d5f"
+	depositTestPod = "0x91e677b07f7af907ec9a428aafa9fc14a0d3a338"
+)
+
+func TestDepositDataVerify(t *testing.T) {
+	k := newDepositTestKey(1)
+	credentials := "0x010000000000000000000000" + depositTestEOA[2:]
+	if err := k.deposit(credentials, "mainnet").Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.deposit(credentials, "mainnet").CheckWithdrawal("", strings.ToUpper(depositTestEOA[2:])); err == nil {
+		t.Fatal("expected an address without 0x not to match")
+	}
+
+	other := k.deposit(credentials, "mainnet")
+	other.Signature = newDepositTestKey(2).deposit(credentials, "mainnet").Signature
+	other.DepositDataRoot = ""
+	testnet := k.deposit(credentials, "holesky")
+	testnet.ForkVersion = "00000000"
+	amount := k.deposit(credentials, "mainnet")
+	amount.Amount = 1000000000
+	forged := k.deposit(credentials, "mainnet")
+	forged.DepositMessageRoot, forged.DepositDataRoot, forged.Amount = "", "", 1000000000
+	byNetwork := k.deposit(credentials, "sepolia")
+	byNetwork.ForkVersion = ""
+	tests := []struct {
+		name    string
+		deposit *DepositData
+		reason  string
+	}{
+		{"signed by another key", other, ReasonBadSignature},
+		{"signed for another fork", testnet, ReasonBadSignature},
+		{"root of another amount", amount, ReasonBadSignature},
+		{"another amount", forged, ReasonBadSignature},
+		{"fork version of the network", byNetwork, ""},
+	}
+	for _, test := range tests {
+		result := &SignatureResult{Err: test.deposit.Verify()}
+		if result.Reason() != test.reason {
+			t.Errorf("%s: expected %q, got %q (%v)", test.name, test.reason, result.Reason(), result.Err)
+		}
+	}
+}
+
+func TestWithdrawalAddress(t *testing.T) {
+	tests := []struct {
+		credentials, addr string
+	}{
+		{"0x010000000000000000000000" + depositTestEOA[2:], depositTestEOA},
+		{"0x020000000000000000000000" + depositTestPod[2:], depositTestPod},
+		{"0x00" + strings.Repeat("11", 31), ""},
+		{"0x010000000000000000000001" + depositTestEOA[2:], ""},
+	}
+	for _, test := range tests {
+		if addr, ok := WithdrawalAddress(MustDecode(test.credentials)); addr != test.addr || ok != (test.addr != "") {
+			t.Errorf("%s: expected %s, got %s %v", test.credentials, test.addr, addr, ok)
+		}
+	}
+}
+
+// depositVerifierStub verifies every row, as the EVM verifier does the EOA1 signature of a staking row.
+type depositVerifierStub struct{}
+
+func (depositVerifierStub) Verify(row *CoinData) *SignatureResult {
+	return &SignatureResult{Verifier: EvmCoinTye, Address: row.EOA1, Signer: SignerEOA1}
+}
+
+func TestDepositVerifier(t *testing.T) {
+	native, eigen, bls, missing := newDepositTestKey(1), newDepositTestKey(2), newDepositTestKey(3), newDepositTestKey(4)
+	deposits, _ := json.Marshal([]*DepositData{
+		native.deposit("0x010000000000000000000000"+depositTestEOA[2:], "mainnet"),
+		eigen.deposit("0x010000000000000000000000"+depositTestPod[2:], "mainnet"),
+		bls.deposit("0x00"+strings.Repeat("11", 31), "mainnet"),
+	})
+	index, err := ParseDepositData(deposits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := NewDepositVerifier(depositVerifierStub{}, index)
+	tests := []struct {
+		name, coin, typ, addr, eoa2 string
+		reason, verifier            string
+	}{
+		{"native staking", "ETH", "Native ETH Staking", "0x" + hex.EncodeToString(native.pub[:]), "", "", "EVM+deposit"},
+		{"upper case key", "ETH", "Native ETH Staking", "0x" + strings.ToUpper(hex.EncodeToString(native.pub[:])), "", "", "EVM+deposit"},
+		{"eigenpod", "ETH", "Eigenlayer Staking", "0x" + hex.EncodeToString(eigen.pub[:]), depositTestPod, "", "EVM+deposit"},
+		{"eigenpod not in the row", "ETH", "Eigenlayer Staking", "0x" + hex.EncodeToString(eigen.pub[:]), "", ReasonAddressMismatch, "EVM+deposit"},
+		{"bls withdrawal credentials", "ETH", "Native ETH Staking", "0x" + hex.EncodeToString(bls.pub[:]), "", ReasonAddressMismatch, "EVM+deposit"},
+		{"no deposit", "ETH", "Native ETH Staking", "0x" + hex.EncodeToString(missing.pub[:]), "", ReasonMissingDeposit, "EVM+deposit"},
+		{"non staking", "ETH", "Non Staking", depositTestEOA, "", "", "EVM"},
+		{"other coin", "BNB", "Native Staking", depositTestEOA, "", "", "EVM"},
+	}
+	for _, test := range tests {
+		result := verifier.Verify(&CoinData{Coin: test.coin, Type: test.typ, Address: test.addr, EOA1: depositTestEOA, EOA2: test.eoa2})
+		if result.Reason() != test.reason || result.Verifier != test.verifier {
+			t.Errorf("%s: expected %s %q, got %s %q (%v)", test.name, test.verifier, test.reason, result.Verifier, result.Reason(), result.Err)
+		}
+	}
+}
+
+// VerifyRowSignature clears EOA2 of an Eigenlayer row, the deposit check still sees the EigenPod.
+func TestDepositVerifierThroughVerifyRowSignature(t *testing.T) {
+	eigen := newDepositTestKey(2)
+	deposits, _ := json.Marshal([]*DepositData{eigen.deposit("0x010000000000000000000000"+depositTestPod[2:], "mainnet")})
+	index, err := ParseDepositData(deposits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registerTestVerifier(t, EvmCoinTye, NewDepositVerifier(depositVerifierStub{}, index))
+	row := &CoinData{Coin: "ETH", Type: "Eigenlayer Staking", Address: "0x" + hex.EncodeToString(eigen.pub[:]), Message: okxTestMessage,
+		Sign1: "0x01", EOA1: depositTestEOA, EOA2: depositTestPod}
+	if result := VerifyRowSignature(row); !result.OK() || result.Verifier != "EVM+deposit" {
+		t.Fatalf("expected the eigenpod deposit to verify, got %s %q (%v)", result.Verifier, result.Reason(), result.Err)
+	}
+	row.EOA2 = "null"
+	if result := VerifyRowSignature(row); result.Reason() != ReasonAddressMismatch {
+		t.Fatalf("expected a row without its eigenpod to fail, got %q (%v)", result.Reason(), result.Err)
+	}
+}
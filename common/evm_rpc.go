@@ -0,0 +1,203 @@
+package common
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/okx/proof-of-reserves/client"
+)
+
+// ErrRPC is returned when a contract cannot be queried through the node.
+var ErrRPC = errors.New("rpc call failed")
+
+// EvmRPCEndpoint is the json-rpc node of an EVM chain.
+type EvmRPCEndpoint struct {
+	Endpoint      string
+	AuthUser      string
+	AuthPassword  string
+	CustomHeaders map[string]string
+
+	// pin resolves the block hash of a snapshot height, the block is queried by number without it
+	pin func(height string) (string, error)
+}
+
+// EvmRPCEndpoints returns the rpc node of every chain configured in rpc.json, keyed by the lower
+// case coin field (eth, arbitrum, polygon, ...). The rpc enabled flag selects the balance query
+// method only, a configured endpoint is used either way.
+func (r *AddressBalanceValidator) EvmRPCEndpoints() map[string]*EvmRPCEndpoint {
+	endpoints := make(map[string]*EvmRPCEndpoint)
+	for _, c := range r.confMap {
+		chain := strings.ToLower(c.Coin)
+		if c.RPC.Endpoint == "" || endpoints[chain] != nil && c.Name != chain {
+			continue
+		}
+		// the calls go to the rpc node, the block hash is pinned through it
+		pinned := *c
+		pinned.RPC.Enabled = true
+		endpoints[chain] = &EvmRPCEndpoint{Endpoint: c.RPC.Endpoint, AuthUser: c.RPC.AuthUser, AuthPassword: c.RPC.AuthPassword, CustomHeaders: c.RPC.CustomHeaders,
+			pin: func(height string) (string, error) { return r.PinBlockHash(&pinned, height) }}
+	}
+	return endpoints
+}
+
+// rowRPCEndpoint returns the node of the chain a row is on, its network or else its coin.
+func rowRPCEndpoint(endpoints map[string]*EvmRPCEndpoint, row *CoinData) (*EvmRPCEndpoint, error) {
+	chain := strings.ToLower(row.Network)
+	if chain == "" {
+		chain = strings.ToLower(row.Coin)
+	}
+	endpoint, exist := endpoints[chain]
+	if !exist {
+		return nil, withReason(ReasonUnsupportedCoin, fmt.Errorf("no rpc endpoint for chain %s in rpc json file", chain))
+	}
+	return endpoint, nil
+}
+
+// rowBlockParam returns the snapshot block of a row, the latest block when it has no height. The
+// block is pinned to its hash (EIP-1898) when the endpoint comes from rpc.json.
+func rowBlockParam(endpoint *EvmRPCEndpoint, row *CoinData) (interface{}, error) {
+	block := "latest"
+	if h := row.SnapshotHeight; h != "" && h != "-" {
+		block = h
+	}
+	var hash string
+	if endpoint.pin != nil {
+		var err error
+		if hash, err = endpoint.pin(block); err != nil {
+			return nil, withReason(ReasonRPCError, fmt.Errorf("%w, %v", ErrRPC, err))
+		}
+	}
+	return blockParam(block, hash), nil
+}
+
+// abiDynamicBytes reads the bytes value whose offset is the head word.
+func abiDynamicBytes(data, head []byte) ([]byte, error) {
+	offset, ok := abiWordToInt(head)
+	if !ok || offset+32 > len(data) {
+		return nil, fmt.Errorf("bytes offset out of range")
+	}
+	length, ok := abiWordToInt(data[offset : offset+32])
+	if !ok || offset+32+length > len(data) {
+		return nil, fmt.Errorf("bytes length out of range")
+	}
+	return data[offset+32 : offset+32+length], nil
+}
+
+func abiWordToInt(word []byte) (int, bool) {
+	for _, b := range word[:24] {
+		if b != 0 {
+			return 0, false
+		}
+	}
+	n := binary.BigEndian.Uint64(word[24:])
+	if n > 1<<31 {
+		return 0, false
+	}
+	return int(n), true
+}
+
+func abiUint(n uint64) []byte {
+	word := make([]byte, 32)
+	binary.BigEndian.PutUint64(word[24:], n)
+	return word
+}
+
+func abiBytes(b []byte) []byte {
+	out := abiUint(uint64(len(b)))
+	out = append(out, b...)
+	if pad := len(b) % 32; pad != 0 {
+		out = append(out, make([]byte, 32-pad)...)
+	}
+	return out
+}
+
+func leftPad32(b []byte) []byte {
+	if len(b) >= 32 {
+		return b[len(b)-32:]
+	}
+	word := make([]byte, 32)
+	copy(word[32-len(b):], b)
+	return word
+}
+
+// EvmRPCCallError is the json-rpc error a node answered a call with. It is a node failure unless
+// the caller recognizes the contract failing the call, see Reverted.
+type EvmRPCCallError struct {
+	Method  string
+	Code    int
+	Message string
+	// Data is the raw json data of the error, the revert data of a reverted eth_call
+	Data string
+}
+
+func (e *EvmRPCCallError) Error() string {
+	msg := fmt.Sprintf("%v, method:%s, error:%d %s", ErrRPC, e.Method, e.Code, e.Message)
+	if e.Data != "" {
+		msg += ", data:" + e.Data
+	}
+	return msg
+}
+
+func (e *EvmRPCCallError) Unwrap() error {
+	return ErrRPC
+}
+
+// Reverted reports whether the call was executed and reverted, code 3 or an execution reverted
+// message, rather than failed in the node.
+func (e *EvmRPCCallError) Reverted() bool {
+	return e.Code == 3 || strings.Contains(strings.ToLower(e.Message), "execution reverted")
+}
+
+// evmCallReverted returns the error of a call that reverted, nil for other errors.
+func evmCallReverted(err error) *EvmRPCCallError {
+	var callErr *EvmRPCCallError
+	if errors.As(err, &callErr) && callErr.Reverted() {
+		return callErr
+	}
+	return nil
+}
+
+var evmRPCCallID struct {
+	sync.Mutex
+	id int
+}
+
+// evmRPCCall posts a json-rpc request and decodes its result.
+func evmRPCCall(endpoint *EvmRPCEndpoint, method string, params []interface{}, result interface{}) error {
+	evmRPCCallID.Lock()
+	evmRPCCallID.id++
+	id := evmRPCCallID.id
+	evmRPCCallID.Unlock()
+
+	request, err := client.RpcClient.MakeJsonRPCRequestParams(id, method, params)
+	if err != nil {
+		return err
+	}
+	body, err := client.RpcClient.Post(endpoint.Endpoint, request, endpoint.AuthUser, endpoint.AuthPassword, endpoint.CustomHeaders)
+	if err != nil {
+		return withReason(ReasonRPCError, fmt.Errorf("%w, method:%s, error:%v", ErrRPC, method, err))
+	}
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int             `json:"code"`
+			Message string          `json:"message"`
+			Data    json.RawMessage `json:"data"`
+		} `json:"error"`
+	}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return withReason(ReasonRPCError, fmt.Errorf("%w, method:%s, error:%v", ErrRPC, method, err))
+	}
+	if response.Error != nil {
+		// an rpc_error unless the caller finds that the contract failed the call
+		return withReason(ReasonRPCError, &EvmRPCCallError{Method: method, Code: response.Error.Code, Message: response.Error.Message, Data: string(response.Error.Data)})
+	}
+	if err = json.Unmarshal(response.Result, result); err != nil {
+		return withReason(ReasonRPCError, fmt.Errorf("%w, method:%s, error:%v", ErrRPC, method, err))
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// Placeholders of a MessagePolicy pattern.
+const (
+	// MessageDatePlaceholder matches a date, 20241001 or 2024-10-01
+	MessageDatePlaceholder = "{date}"
+	// MessageNoncePlaceholder matches a nonce of at least 8 letters or digits
+	MessageNoncePlaceholder = "{nonce}"
+)
+
+// MessagePolicy is the ownership message the rows of a snapshot must sign, so that an old
+// signature over a stale message does not pass.
+type MessagePolicy struct {
+	// Messages are accepted as they are
+	Messages []string `json:"messages"`
+	// Pattern accepts the messages of a template, its text is literal except for {date} and {nonce}
+	Pattern string `json:"pattern,omitempty"`
+	// Previous are the messages of earlier snapshots, a row that signs one of them is reused
+	Previous []string `json:"previous,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// NewMessagePolicy returns the policy that accepts the messages and the pattern.
+func NewMessagePolicy(messages []string, pattern string, previous []string) (*MessagePolicy, error) {
+	p := &MessagePolicy{Messages: messages, Pattern: pattern, Previous: previous}
+	return p, p.init()
+}
+
+// LoadMessagePolicy reads a policy file, e.g.
+// {"messages":["OKC_DTT_AUP2025"],"pattern":"OKX PoR {date} {nonce}","previous":["I am an OKX address"]}
+func LoadMessagePolicy(fileName string) (*MessagePolicy, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	p := &MessagePolicy{}
+	if err = json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("read message policy %s: %w", fileName, err)
+	}
+	if err = p.init(); err != nil {
+		return nil, fmt.Errorf("read message policy %s: %w", fileName, err)
+	}
+	return p, nil
+}
+
+func (p *MessagePolicy) init() error {
+	if len(p.Messages) == 0 && p.Pattern == "" {
+		return errors.New("the message policy accepts no message")
+	}
+	if p.Pattern != "" {
+		expr := regexp.QuoteMeta(p.Pattern)
+		expr = strings.ReplaceAll(expr, regexp.QuoteMeta(MessageDatePlaceholder), `\d{4}-?\d{2}-?\d{2}`)
+		expr = strings.ReplaceAll(expr, regexp.QuoteMeta(MessageNoncePlaceholder), `[0-9A-Za-z]{8,}`)
+		p.pattern = regexp.MustCompile("^" + expr + "$")
+	}
+	// a pattern matches earlier messages of its template, Check flags them as reused first
+	for _, previous := range p.Previous {
+		for _, m := range p.Messages {
+			if m == previous {
+				return fmt.Errorf("message %q of an earlier snapshot is accepted by the policy", previous)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *MessagePolicy) accepts(msg string) bool {
+	for _, m := range p.Messages {
+		if msg == m {
+			return true
+		}
+	}
+	return p.pattern != nil && p.pattern.MatchString(msg)
+}
+
+// Check returns a message_reused error for a message of an earlier snapshot and a
+// message_mismatch error for any other message the policy does not accept.
+func (p *MessagePolicy) Check(msg string) error {
+	for _, previous := range p.Previous {
+		if msg == previous {
+			return withReason(ReasonMessageReused, fmt.Errorf("message %q was signed for an earlier snapshot", msg))
+		}
+	}
+	if !p.accepts(msg) {
+		return withReason(ReasonMessageMismatch, fmt.Errorf("message %q is not the message of the snapshot", msg))
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package common
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestMessagePolicy(t *testing.T) {
+	policy, err := NewMessagePolicy([]string{"OKC_DTT_AUP2025"}, "OKX PoR {date} {nonce}", []string{"I am an OKX address", "OKX PoR 20241001 a1b2c3d4e5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		msg    string
+		reason string
+	}{
+		{"OKC_DTT_AUP2025", ""},
+		{"OKX PoR 20251001 9f8e7d6c5b", ""},
+		{"OKX PoR 2025-10-01 9f8e7d6c5b", ""},
+		{"I am an OKX address", ReasonMessageReused},
+		{"OKX PoR 20241001 a1b2c3d4e5", ReasonMessageReused},
+		{"OKX PoR 20251001 short", ReasonMessageMismatch},
+		{"OKX PoR 20251001 9f8e7d6c5b extra", ReasonMessageMismatch},
+		{"OKC_DTT_AUP2024", ReasonMessageMismatch},
+	}
+	for _, test := range tests {
+		if reason := FailureReason(policy.Check(test.msg)); reason != test.reason {
+			t.Errorf("%q: expected reason %q, got %q", test.msg, test.reason, reason)
+		}
+	}
+}
+
+func TestLoadMessagePolicy(t *testing.T) {
+	fileName := t.TempDir() + "/policy.json"
+	_ = ioutil.WriteFile(fileName, []byte(`{"messages":["OKC_DTT_AUP2025"],"previous":["I am an OKX address"]}`), 0644)
+	policy, err := LoadMessagePolicy(fileName)
+	if err != nil || policy.Check("OKC_DTT_AUP2025") != nil {
+		t.Fatalf("unexpected policy %+v, %v", policy, err)
+	}
+
+	// a policy that accepts a message of an earlier snapshot would never flag it as reused
+	_ = ioutil.WriteFile(fileName, []byte(`{"messages":["I am an OKX address"],"previous":["I am an OKX address"]}`), 0644)
+	if _, err = LoadMessagePolicy(fileName); err == nil {
+		t.Fatal("expected a policy accepting an earlier message to be rejected")
+	}
+	_ = ioutil.WriteFile(fileName, []byte(`{"previous":["I am an OKX address"]}`), 0644)
+	if _, err = LoadMessagePolicy(fileName); err == nil {
+		t.Fatal("expected a policy without messages to be rejected")
+	}
+}
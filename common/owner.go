@@ -0,0 +1,150 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// SafeGetOwnersSelector is the selector of getOwners() of a Safe (Gnosis Safe) wallet
+	SafeGetOwnersSelector = "0xa0e67e2b"
+	// SafeGetThresholdSelector is the selector of getThreshold() of a Safe wallet
+	SafeGetThresholdSelector = "0xe75235b8"
+)
+
+// ContractOwners are the owners of a multisig address and the number of them that must sign.
+type ContractOwners struct {
+	Owners    []string
+	Threshold int
+}
+
+// OwnerLookup returns the owners of the address of a row at its snapshot. An adapter is written
+// per wallet kind, Safe is built in.
+type OwnerLookup interface {
+	Owners(row *CoinData) (*ContractOwners, error)
+}
+
+// OwnerLookupFunc adapts a function to OwnerLookup.
+type OwnerLookupFunc func(row *CoinData) (*ContractOwners, error)
+
+func (f OwnerLookupFunc) Owners(row *CoinData) (*ContractOwners, error) {
+	return f(row)
+}
+
+// SafeOwnerLookup reads getOwners() and getThreshold() of a Safe wallet at the snapshot block.
+type SafeOwnerLookup struct {
+	endpoints map[string]*EvmRPCEndpoint
+}
+
+// NewSafeOwnerLookup returns a lookup through the nodes of rpc.json, client.RpcClient must be
+// initialized.
+func NewSafeOwnerLookup(endpoints map[string]*EvmRPCEndpoint) *SafeOwnerLookup {
+	return &SafeOwnerLookup{endpoints: endpoints}
+}
+
+func (l *SafeOwnerLookup) Owners(row *CoinData) (*ContractOwners, error) {
+	endpoint, err := rowRPCEndpoint(l.endpoints, row)
+	if err != nil {
+		return nil, err
+	}
+	block, err := rowBlockParam(endpoint, row)
+	if err != nil {
+		return nil, err
+	}
+
+	var ownersData, thresholdData string
+	call := map[string]string{"to": row.Address, "data": SafeGetOwnersSelector}
+	if err = evmRPCCall(endpoint, "eth_call", []interface{}{call, block}, &ownersData); err != nil {
+		if reverted := evmCallReverted(err); reverted != nil {
+			return nil, fmt.Errorf("%s is not a Safe wallet, getOwners reverted: %s", row.Address, reverted.Message)
+		}
+		return nil, fmt.Errorf("getOwners of %s failed: %w", row.Address, err)
+	}
+	call = map[string]string{"to": row.Address, "data": SafeGetThresholdSelector}
+	if err = evmRPCCall(endpoint, "eth_call", []interface{}{call, block}, &thresholdData); err != nil {
+		if reverted := evmCallReverted(err); reverted != nil {
+			return nil, fmt.Errorf("%s is not a Safe wallet, getThreshold reverted: %s", row.Address, reverted.Message)
+		}
+		return nil, fmt.Errorf("getThreshold of %s failed: %w", row.Address, err)
+	}
+
+	// getOwners returns address[]: the offset word, the length word and one word per owner
+	data, err := Decode(ownersData)
+	if err != nil || len(data) < 64 {
+		return nil, fmt.Errorf("%s is not a Safe wallet, getOwners returned %q", row.Address, ownersData)
+	}
+	offset, ok := abiWordToInt(data[:32])
+	if !ok || offset+32 > len(data) {
+		return nil, fmt.Errorf("%s is not a Safe wallet, getOwners returned %q", row.Address, ownersData)
+	}
+	count, ok := abiWordToInt(data[offset : offset+32])
+	if !ok || offset+32+count*32 > len(data) {
+		return nil, fmt.Errorf("%s is not a Safe wallet, getOwners returned %q", row.Address, ownersData)
+	}
+	owners := &ContractOwners{Owners: make([]string, 0, count)}
+	for i := 0; i < count; i++ {
+		word := data[offset+32+i*32 : offset+64+i*32]
+		owners.Owners = append(owners.Owners, Encode(word[12:]))
+	}
+	threshold, err := Decode(thresholdData)
+	if err != nil || len(threshold) != 32 {
+		return nil, fmt.Errorf("%s is not a Safe wallet, getThreshold returned %q", row.Address, thresholdData)
+	}
+	if owners.Threshold, ok = abiWordToInt(threshold); !ok {
+		return nil, fmt.Errorf("%s is not a Safe wallet, getThreshold returned %q", row.Address, thresholdData)
+	}
+	return owners, nil
+}
+
+// OwnerVerifier makes sure that the EOA1/EOA2 signers of a row own its address: every signer must
+// be an owner and the signers must meet the threshold. Rows that sign with the address itself and
+// staking rows, whose address is a validator key, are left to the wrapped verifier.
+type OwnerVerifier struct {
+	next   SignatureVerifier
+	lookup OwnerLookup
+}
+
+func NewOwnerVerifier(next SignatureVerifier, lookup OwnerLookup) *OwnerVerifier {
+	return &OwnerVerifier{next: next, lookup: lookup}
+}
+
+func (v *OwnerVerifier) Verify(row *CoinData) *SignatureResult {
+	result := v.next.Verify(row)
+	if !result.OK() || row.EOA1 == "" || isStakingRow(row) {
+		return result
+	}
+	result.Verifier += "+owners"
+
+	owners, err := v.lookup.Owners(row)
+	if err != nil {
+		result.Address, result.Signer, result.Err = row.Address, SignerAddress, err
+		return result
+	}
+	isOwner := make(map[string]bool, len(owners.Owners))
+	for _, owner := range owners.Owners {
+		isOwner[strings.ToLower(owner)] = true
+	}
+	signers := make(map[string]bool)
+	for i, signer := range []string{row.EOA1, row.EOA2} {
+		if signer == "" {
+			continue
+		}
+		if !isOwner[strings.ToLower(signer)] {
+			result.Address, result.Signer = signer, []string{SignerEOA1, SignerEOA2}[i]
+			result.Err = withReason(ReasonNotOwner, fmt.Errorf("%s is not an owner of %s, owners:%v", signer, row.Address, owners.Owners))
+			return result
+		}
+		signers[strings.ToLower(signer)] = true
+	}
+	if len(signers) < owners.Threshold {
+		result.Address, result.Signer = row.Address, SignerAddress
+		result.Err = withReason(ReasonBelowThreshold, fmt.Errorf("%d of the owners of %s signed, the threshold is %d", len(signers), row.Address, owners.Threshold))
+	}
+	return result
+}
+
+// isStakingRow reports whether the address of a row is a validator key rather than a wallet.
+func isStakingRow(row *CoinData) bool {
+	t := strings.ToLower(strings.TrimSpace(row.Type))
+	return strings.HasSuffix(t, "staking") && t != "non staking"
+}
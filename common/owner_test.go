@@ -0,0 +1,106 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/okx/proof-of-reserves/client"
+)
+
+const (
+	safeWallet = "0x0000000000000000000000000000000000005afe"
+	owner1     = "0x0cdcdb19a857c2ac24818ca4fdfe38cce071483e"
+	owner1Sig  = "0x07f19879aa28d51c97cddfdfecffe7ed96525545d041aee4f4386b0bf4c1a26924b637fb02ccbb97305c13daa51a0f50b8896fb25ecbaf60020cde920d227a221b"
+	owner2     = "0x16f01cfc16b0b8c3400fb8e5099b0974fcc9fc12"
+	owner2Sig  = "0xf6e60fd5d2692eaf813cbb38369c160781a063e39dbadde9a88998a4c8019e08488f83a6e7ee5e5b3fbdd50f25db631150070e8bb470d1474eb0e6d9a1fd0c561c"
+)
+
+// newSafeNode serves getOwners and getThreshold of a Safe at safeWallet, other addresses revert.
+func newSafeNode(t *testing.T, owners []string, threshold uint64) *httptest.Server {
+	ownersData := append(abiUint(32), abiUint(uint64(len(owners)))...)
+	for _, owner := range owners {
+		ownersData = append(ownersData, leftPad32(MustDecode(owner))...)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		var call map[string]string
+		_ = json.Unmarshal(body.Params[0], &call)
+		switch {
+		case call["to"] != safeWallet:
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":3,"message":"execution reverted"}}`)
+		case call["data"] == SafeGetOwnersSelector:
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":"%s"}`, Encode(ownersData))
+		case call["data"] == SafeGetThresholdSelector:
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":"%s"}`, Encode(abiUint(threshold)))
+		default:
+			t.Fatalf("unexpected call %v", call)
+		}
+	}))
+}
+
+func TestOwnerVerifier(t *testing.T) {
+	ownerRow := func(addr, eoa1, sign1, eoa2, sign2 string) *CoinData {
+		return &CoinData{Coin: "ETH", Network: "ETH", SnapshotHeight: "20917295", Address: addr, Message: okxTestMessage, EOA1: eoa1, Sign1: sign1, EOA2: eoa2, Sign2: sign2}
+	}
+	tests := []struct {
+		name      string
+		row       *CoinData
+		owners    []string
+		threshold uint64
+		reason    string
+		signer    string
+	}{
+		{"two of two", ownerRow(safeWallet, owner1, owner1Sig, owner2, owner2Sig), []string{owner1, strings.ToUpper(owner2[2:])}, 2, "", SignerEOA2},
+		{"one of one", ownerRow(safeWallet, owner1, owner1Sig, "", ""), []string{owner1}, 1, "", SignerEOA1},
+		{"signer is not an owner", ownerRow(safeWallet, owner1, owner1Sig, owner2, owner2Sig), []string{owner1, "0x0000000000000000000000000000000000000003"}, 1, ReasonNotOwner, SignerEOA2},
+		{"below threshold", ownerRow(safeWallet, owner1, owner1Sig, "", ""), []string{owner1, owner2}, 2, ReasonBelowThreshold, SignerAddress},
+		{"not a safe", ownerRow("0x0000000000000000000000000000000000000004", owner1, owner1Sig, "", ""), []string{owner1}, 1, ReasonBadSignature, SignerAddress},
+		{"address signs itself", ownerRow(owner1, "", owner1Sig, "", ""), nil, 1, "", ""},
+	}
+	client.RpcClient = client.NewJsonRPCClient()
+	evm, _ := RegisteredSignatureVerifier(EvmCoinTye)
+	for _, test := range tests {
+		node := newSafeNode(t, test.owners, test.threshold)
+		verifier := NewOwnerVerifier(evm, NewSafeOwnerLookup(map[string]*EvmRPCEndpoint{"eth": {Endpoint: node.URL}}))
+		result := verifier.Verify(test.row)
+		node.Close()
+		if FailureReason(result.Err) != test.reason || result.Signer != test.signer {
+			t.Errorf("%s: expected reason %q signer %q, got %q %q (%v)", test.name, test.reason, test.signer, FailureReason(result.Err), result.Signer, result.Err)
+		}
+	}
+}
+
+func TestOwnerVerifierSkipsStakingRows(t *testing.T) {
+	lookup := OwnerLookupFunc(func(row *CoinData) (*ContractOwners, error) {
+		t.Fatalf("owners of staking row %s looked up", row.Address)
+		return nil, nil
+	})
+	evm, _ := RegisteredSignatureVerifier(EvmCoinTye)
+	row := &CoinData{Coin: "ETH", Type: "Native ETH Staking", Address: "0x" + strings.Repeat("ab", 48), Message: okxTestMessage, Sign1: owner1Sig, EOA1: owner1}
+	if result := NewOwnerVerifier(evm, lookup).Verify(row); !result.OK() {
+		t.Fatalf("staking row should verify, got %v", result.Err)
+	}
+}
+
+func TestSafeOwnerLookupRPCError(t *testing.T) {
+	client.RpcClient = client.NewJsonRPCClient()
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"missing trie node"}}`)
+	}))
+	defer node.Close()
+	lookup := NewSafeOwnerLookup(map[string]*EvmRPCEndpoint{"eth": {Endpoint: node.URL}})
+	_, err := lookup.Owners(&CoinData{Coin: "ETH", Network: "ETH", SnapshotHeight: "20917295", Address: safeWallet})
+	if FailureReason(err) != ReasonRPCError || strings.Contains(err.Error(), "reverted") {
+		t.Fatalf("expected rpc_error, got %q (%v)", FailureReason(err), err)
+	}
+}
@@ -0,0 +1,350 @@
+package common
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secp_ecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	kbls "github.com/kilic/bls12-381"
+	"github.com/martinboehm/btcutil"
+	"github.com/martinboehm/btcutil/base58"
+	"github.com/okx/go-wallet-sdk/coins/starknet"
+	"github.com/shopspring/decimal"
+	tonWallet "github.com/xssnick/tonutils-go/ton/wallet"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// blsCurveOrder is the order r of the BLS12-381 groups, a BLS secret key is below it.
+var blsCurveOrder, _ = new(big.Int).SetString("73eda753299d7d483339d80809a1d80553bda402fffe5bfeffffffff00000001", 16)
+
+// PorTestKeys are the private keys a generated PoR file is signed with: the given keys, then keys
+// derived from the seed. They are test keys for fixtures and rehearsals, their addresses must never
+// hold funds.
+type PorTestKeys struct {
+	seed string
+	keys [][]byte
+}
+
+func NewPorTestKeys(seed string, keys ...[]byte) *PorTestKeys {
+	return &PorTestKeys{seed: seed, keys: keys}
+}
+
+// Key returns the 32 byte private key i.
+func (k *PorTestKeys) Key(i int) []byte {
+	if i < len(k.keys) {
+		return k.keys[i]
+	}
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(i))
+	h := sha256.Sum256(append([]byte("porsign:"+k.seed+":"), n[:]...))
+	return h[:]
+}
+
+// PorSignKeys is the number of keys a row is signed with, the keys of a 2-of-3 UTXO multisig.
+const PorSignKeys = 3
+
+// SignPorRow fills the address, signature1, signature2 and redeem script/public key columns of a
+// row of the coin with the keys index to index+PorSignKeys-1, and verifies the row. UTXO rows are
+// 2-of-3 multisig addresses signed by two keys, the other rows are signed by a single key.
+// SignPorRow returns ErrUnsupportedCoin for a coin the verifiers do not support.
+func SignPorRow(keys *PorTestKeys, index int, row *CoinData) error {
+	coinType, exist := SignatureCoinType(row.Coin)
+	if _, hasVerifier := signatureVerifier(coinType); !exist || !hasVerifier {
+		return fmt.Errorf("%w %s", ErrUnsupportedCoin, row.Coin)
+	}
+	if row.Message == "" {
+		return fmt.Errorf("no message to sign for %s", row.Coin)
+	}
+	var err error
+	switch coinType {
+	case UTXOCoinType:
+		err = signUtxoRow(row, keys.Key(index), keys.Key(index+1), keys.Key(index+2))
+	case EvmCoinTye:
+		err = signEvmRow(row, keys.Key(index))
+	case EcdsaCoinType:
+		err = signEcdsaRow(row, keys.Key(index))
+	case TrxCoinType:
+		signTrxRow(row, keys.Key(index))
+	case Ed25519CoinType:
+		err = signEd25519Row(row, keys.Key(index))
+	case StarkCoinType:
+		err = signStarkRow(row, keys.Key(index))
+	case BethCoinType:
+		err = signBethRow(row, keys.Key(index))
+	case EOSCoinType:
+		signEOSRow(row, keys.Key(index), index)
+	default:
+		return fmt.Errorf("%w %s, no signer for coin type %s", ErrUnsupportedCoin, row.Coin, coinType)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to sign %s: %w", row.Coin, err)
+	}
+	// e.g. a coin without a message header
+	if result := VerifyRowSignature(row); result.Reason() == ReasonUnsupportedCoin {
+		return fmt.Errorf("%w %s: %v", ErrUnsupportedCoin, row.Coin, result.Err)
+	} else if !result.OK() {
+		return fmt.Errorf("signed %s row does not verify: %w", row.Coin, result.Err)
+	}
+	return nil
+}
+
+// signRecoverable returns r || s || v of a recoverable secp256k1 signature of the hash, v is 27 or
+// 28, or 31 or 32 for a compressed key.
+func signRecoverable(key *secp256k1.PrivateKey, hash []byte, compressed bool) []byte {
+	compact := secp_ecdsa.SignCompact(key, hash, compressed)
+	return append(compact[1:], compact[0])
+}
+
+// utxoSegwitAddressTypes are the UTXO address types with their own segwit addresses.
+var utxoSegwitAddressTypes = map[string]bool{"BTC": true, "LTC": true, "BTG": true, "DGB": true, "QTUM": true}
+
+// signUtxoRow signs a 2-of-3 multisig address, P2WSH on the chains with segwit addresses and
+// P2SH on the others, with the first two keys.
+func signUtxoRow(row *CoinData, k1, k2, k3 []byte) error {
+	addrType := PorCoinAddressTypeMap[row.Coin]
+	params := UtxoMainNetParams(addrType)
+	hash := HashUtxoCoinTypeMsg(PorCoinMessageSignatureHeaderMap[row.Coin], row.Message)
+	script := []byte{0x52}
+	var signs []string
+	for i, k := range [][]byte{k1, k2, k3} {
+		key := secp256k1.PrivKeyFromBytes(k)
+		script = append(append(script, secp256k1.PubKeyBytesLenCompressed), key.PubKey().SerializeCompressed()...)
+		if i < 2 {
+			signs = append(signs, base64.StdEncoding.EncodeToString(secp_ecdsa.SignCompact(key, hash, true)))
+		}
+	}
+	script = append(script, 0x53, 0xae)
+
+	var addr btcutil.Address
+	var err error
+	if utxoSegwitAddressTypes[addrType] {
+		witnessProgram := sha256.Sum256(script)
+		addr, err = btcutil.NewAddressWitnessScriptHash(witnessProgram[:], params)
+	} else {
+		addr, err = btcutil.NewAddressScriptHash(script, params)
+	}
+	if err != nil {
+		return err
+	}
+	row.Address, row.Sign1, row.Sign2, row.Script = addr.EncodeAddress(), signs[0], signs[1], hex.EncodeToString(script)
+	return nil
+}
+
+func signEvmRow(row *CoinData, k []byte) error {
+	key := secp256k1.PrivKeyFromBytes(k)
+	addr := PubkeyToAddress(*key.PubKey().ToECDSA()).String()
+	if PorCoinAddressTypeMap[row.Coin] == "LAT" {
+		var err error
+		if addr, err = ConvertETHToLATAddress(strings.ToLower(addr)); err != nil {
+			return err
+		}
+	}
+	row.Address = addr
+	row.Sign1 = Encode(signRecoverable(key, HashEvmCoinTypeMsg(PorCoinMessageSignatureHeaderMap[row.Coin], row.Message), false))
+	return nil
+}
+
+// signEcdsaRow signs with the address of the key and publishes the key, which the verifier binds
+// to the address. An address type without a derivation (e.g. NULS) cannot be signed.
+func signEcdsaRow(row *CoinData, k []byte) error {
+	key := secp256k1.PrivKeyFromBytes(k)
+	row.Address = EcdsaCoinAddress(PorCoinAddressTypeMap[row.Coin], "", key.PubKey())
+	if row.Address == "" {
+		return fmt.Errorf("%w %s, no address derivation", ErrUnsupportedCoin, row.Coin)
+	}
+	row.Script = hex.EncodeToString(key.PubKey().SerializeCompressed())
+	row.Sign1 = Encode(signRecoverable(key, HashEcdsaMsg(OKXMessageSignatureHeader, row.Message), false))
+	return nil
+}
+
+func signTrxRow(row *CoinData, k []byte) {
+	key := secp256k1.PrivKeyFromBytes(k)
+	row.Address = TrxAddress(key.PubKey())
+	row.Sign1 = Encode(signRecoverable(key, HashTrxMsg(row.Message), false))
+}
+
+// signEd25519Row signs with the address of the key for the coin's address type: a v4r2 wallet of
+// TON, an enterprise address of ADA, and the hex public key of the types without a derivation.
+func signEd25519Row(row *CoinData, k []byte) error {
+	key := ed25519.NewKeyFromSeed(k)
+	pub := key.Public().(ed25519.PublicKey)
+	pubHex := hex.EncodeToString(pub)
+	addr := pubHex
+	var err error
+	switch addrType := PorCoinAddressTypeMap[row.Coin]; addrType {
+	case "SOL":
+		addr = base58.Encode(pub)
+	case "APTOS":
+		addr = "0x" + hex.EncodeToString(Sha256Hash(append(append([]byte{}, pub...), 0)))
+	case "SUI":
+		addr = SuiPublicKey{Flag: 0, Key: pub}.Address()
+	case "TON":
+		tonAddr, err := tonWallet.AddressFromPubKey(pub, tonWallet.V4R2, tonWallet.DefaultSubwallet)
+		if err != nil {
+			return err
+		}
+		addr = tonAddr.String()
+	case "ADA":
+		var data []byte
+		if data, err = bech32.ConvertBits(append([]byte{cardanoEnterpriseKey<<4 | 1}, calculateBlake2b224(pub)...), 8, 5, true); err == nil {
+			addr, err = bech32.Encode("addr", data)
+		}
+	case "XLM", "PI", "STELLAR":
+		addr, err = GetXlmAddressFromPublicKey(pubHex)
+	case "SC":
+		addr, err = GetSiaAddressFromPublicKey(pubHex)
+	case "IOTA":
+		var addrs []string
+		if addrs, err = GetIotaAddressesFromPublicKey(pubHex); err == nil {
+			addr = addrs[0]
+		}
+	default:
+		if netID, exist := SubstrateNetworks[addrType]; exist {
+			addr, err = GetSubstrateAddressFromPublicKey(pubHex, netID)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	sig := ed25519.Sign(key, HashEd25519Msg(PorCoinMessageSignatureHeaderMap[row.Coin], row.Message))
+	row.Address, row.Sign1, row.Script = addr, hex.EncodeToString(sig), pubHex
+	return nil
+}
+
+// signStarkRow signs with the account the OKX wallet deploys for the stark key. The message must
+// fit a felt.
+func signStarkRow(row *CoinData, k []byte) error {
+	curve := starknetCurve()
+	priv := new(big.Int).SetBytes(k[:31])
+	pub, err := curve.PrivateToPublic(priv)
+	if err != nil {
+		return err
+	}
+	account, err := starknet.CalculateContractAddressFromHash(starknet.BigToHex(pub))
+	if err != nil {
+		return err
+	}
+	addr := starknet.BigToHexWithPadding(account)
+	hash, err := StarknetMessageHash(addr, row.Message)
+	if err != nil {
+		return err
+	}
+	r, s, err := curve.Sign(hash, priv)
+	if err != nil {
+		return err
+	}
+	row.Address, row.Sign1, row.Script = addr, fmt.Sprintf("%064x%064x", r, s), starknet.BigToHex(pub)
+	return nil
+}
+
+// signBethRow signs with a BLS key, the address is the public key.
+func signBethRow(row *CoinData, k []byte) error {
+	sk := new(big.Int).Mod(new(big.Int).SetBytes(k), blsCurveOrder)
+	g1, g2 := kbls.NewG1(), kbls.NewG2()
+	msg, err := g2.HashToCurve(HashEvmCoinTypeMsg(PorCoinMessageSignatureHeaderMap[row.Coin], row.Message), domain)
+	if err != nil {
+		return err
+	}
+	row.Address = Encode(g1.ToCompressed(g1.MulScalarBig(g1.New(), &kbls.G1One, sk)))
+	row.Sign1 = Encode(g2.ToCompressed(g2.MulScalarBig(g2.New(), msg, sk)))
+	return nil
+}
+
+// signEOSRow signs for an account named after the key index, with its EOS public key.
+func signEOSRow(row *CoinData, k []byte, index int) {
+	key := secp256k1.PrivKeyFromBytes(k)
+	eosChecksum := func(b []byte, suffix string) []byte {
+		h := ripemd160.New()
+		h.Write(b)
+		h.Write([]byte(suffix))
+		return append(append([]byte{}, b...), h.Sum(nil)[:4]...)
+	}
+	pub := key.PubKey().SerializeCompressed()
+	sig := secp_ecdsa.SignCompact(key, HashEosMsg(OKXMessageSignatureHeader, row.Message), true)
+	row.Address = eosAccountName(index)
+	row.Sign1 = "SIG_K1_" + base58.Encode(eosChecksum(sig, "K1"))
+	row.Script = "EOS" + base58.Encode(eosChecksum(pub, ""))
+}
+
+// eosAccountName returns a 12 character account name of the letters an EOS name may hold.
+func eosAccountName(index int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyz12345"
+	name := []byte("porsign")
+	for i := 0; i < 5; i++ {
+		name = append(name, letters[index%len(letters)])
+		index /= len(letters)
+	}
+	return string(name)
+}
+
+// PorCsvColumns are the detail headers of the layouts WritePorCsv writes, by column count.
+var PorCsvColumns = map[int][]string{
+	9:  {"coin", "Network", "Snapshot Height", "address", "amount", "message", "signature1", "signature2", "redeem script/ public key"},
+	12: {"coin", "Type", "Network", "Snapshot Height", "address", "amount", "message", "signature1", "signature2", "redeem script/public key", "EOA1", "EOA2"},
+}
+
+// WritePorCsv writes a PoR file of the rows: the summary section, with a row per coin and an
+// "(ALL)" row per unit, then the detail section in the 9 or 12-column layout.
+func WritePorCsv(w io.Writer, rows []*CoinData, columns int) error {
+	header, exist := PorCsvColumns[columns]
+	if !exist {
+		return fmt.Errorf("no %d-column PoR layout, use 9 or 12", columns)
+	}
+	coinTotals := make(map[string]decimal.Decimal)
+	unitTotals := make(map[string]decimal.Decimal)
+	heights := make(map[string]string)
+	for _, row := range rows {
+		balance, err := decimal.NewFromString(row.Balance)
+		if err != nil {
+			return fmt.Errorf("invalid amount %q of %s %s", row.Balance, row.Coin, row.Address)
+		}
+		coinTotals[row.Coin] = coinTotals[row.Coin].Add(balance)
+		if unit, exist := PorCoinUnitMap[row.Coin]; exist {
+			unitTotals[unit] = unitTotals[unit].Add(balance)
+		}
+		heights[row.Coin] = row.SnapshotHeight
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"coin", "snapshot height", "amount"})
+	for _, unit := range sortedDecimalKeys(unitTotals) {
+		cw.Write([]string{unit + porSummaryAllSuffix, "-", unitTotals[unit].String()})
+	}
+	for _, coin := range sortedDecimalKeys(coinTotals) {
+		cw.Write([]string{coin, heights[coin], coinTotals[coin].String()})
+	}
+	cw.Flush()
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return err
+	}
+	cw.Write(header)
+	for _, row := range rows {
+		fields := []string{row.Coin, row.Network, row.SnapshotHeight, row.Address, row.Balance, row.Message, row.Sign1, row.Sign2, row.Script}
+		if columns == 12 {
+			fields = []string{row.Coin, row.Type, row.Network, row.SnapshotHeight, row.Address, row.Balance, row.Message, row.Sign1, row.Sign2, row.Script, row.EOA1, row.EOA2}
+		}
+		cw.Write(fields)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func sortedDecimalKeys(m map[string]decimal.Decimal) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
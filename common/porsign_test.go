@@ -0,0 +1,101 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+// porSignCoins returns the coins of PorCoinTypeMap, sorted.
+func porSignCoins() []string {
+	coins := make([]string, 0, len(PorCoinTypeMap))
+	for coin := range PorCoinTypeMap {
+		coins = append(coins, coin)
+	}
+	sort.Strings(coins)
+	return coins
+}
+
+func TestSignPorRow(t *testing.T) {
+	keys := NewPorTestKeys("test", MustDecode("0x0000000000000000000000000000000000000000000000000000000000000001"))
+	for i, coin := range porSignCoins() {
+		row := &CoinData{Coin: coin, Message: okxTestMessage}
+		// APT has no message header, USDT-ALGO no verifier and NULS no address derivation
+		if err := SignPorRow(keys, i*PorSignKeys, row); errors.Is(err, ErrUnsupportedCoin) != (coin == "APT" || coin == "USDT-ALGO" || coin == "NULS") {
+			t.Errorf("%s: %v", coin, err)
+		} else if err != nil && !errors.Is(err, ErrUnsupportedCoin) {
+			t.Errorf("%s: %v", coin, err)
+		} else if err == nil && PorCoinTypeMap[coin] == UTXOCoinType && VerifyRowSignature(row).Quorum != "2-of-3" {
+			t.Errorf("%s: expected the multisig address %s to be verified", coin, row.Address)
+		}
+	}
+
+	row := &CoinData{Coin: "ETH", Message: okxTestMessage}
+	if err := SignPorRow(keys, 0, row); err != nil || !strings.EqualFold(row.Address, "0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf") {
+		t.Fatalf("expected the address of the given key 1, got %s %v", row.Address, err)
+	}
+	btc := &CoinData{Coin: "BTC", Message: okxTestMessage}
+	if err := SignPorRow(keys, 0, btc); err != nil || !strings.HasPrefix(btc.Address, "bc1q") || VerifyRowSignature(btc).Quorum != "2-of-3" {
+		t.Fatalf("expected a 2-of-3 P2WSH address, got %s %v", btc.Address, err)
+	}
+	if again := (&CoinData{Coin: "BTC", Message: okxTestMessage}); SignPorRow(NewPorTestKeys("test", keys.Key(0)), 0, again) != nil || again.Address != btc.Address {
+		t.Fatal("expected the same keys to sign the same address")
+	}
+	if err := SignPorRow(keys, 0, &CoinData{Coin: "STARKNET", Message: "a message longer than a short string"}); err == nil {
+		t.Fatal("expected a STARKNET message that does not fit a felt to fail")
+	}
+}
+
+func TestWritePorCsv(t *testing.T) {
+	keys := NewPorTestKeys("test")
+	var rows []*CoinData
+	for i, coin := range []string{"BTC", "ETH", "USDT-ERC20", "USDT-TRC20", "SOL", "STARKNET", "BETH", "EOS", "ATOM", "ETH"} {
+		row := &CoinData{Coin: coin, Type: "Non Staking", Network: coin, SnapshotHeight: "100", Balance: "1.5", Message: okxTestMessage}
+		if err := SignPorRow(keys, i*PorSignKeys, row); err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+	for _, columns := range []int{9, 12} {
+		var b bytes.Buffer
+		if err := WritePorCsv(&b, rows, columns); err != nil {
+			t.Fatal(err)
+		}
+		reader := NewPorCsvReader(&b)
+		totals := make(map[string]decimal.Decimal)
+		n := 0
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%d columns: %v", columns, err)
+			}
+			if result := VerifyRowSignature(row); !result.OK() {
+				t.Errorf("%d columns: line %d %s does not verify: %v", columns, row.Line, row.Coin, result.Err)
+			}
+			if columns == 12 && row.Type != "Non Staking" {
+				t.Errorf("%d columns: unexpected type %q", columns, row.Type)
+			}
+			balance, _ := decimal.NewFromString(row.Balance)
+			totals[row.Coin] = totals[row.Coin].Add(balance)
+			n++
+		}
+		if n != len(rows) || len(reader.Header().Names) != columns {
+			t.Fatalf("%d columns: read %d rows of %d columns", columns, n, len(reader.Header().Names))
+		}
+		// ETH(ALL), USDT(ALL), ... and a row per coin
+		if mismatches := reader.Summary().Reconcile(totals, true); len(mismatches) != 0 || len(reader.Summary().Rows) < 9 {
+			t.Fatalf("%d columns: unexpected summary %v", columns, mismatches)
+		}
+	}
+	if err := WritePorCsv(io.Discard, rows, 11); err == nil {
+		t.Fatal("expected no 11-column layout")
+	}
+}
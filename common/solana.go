@@ -0,0 +1,351 @@
+package common
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/martinboehm/btcutil/base58"
+	"github.com/oasisprotocol/curve25519-voi/curve"
+)
+
+// SolanaOffchainSigningDomain starts every Solana off-chain message, it cannot start a transaction.
+const SolanaOffchainSigningDomain = "\xffsolana offchain"
+
+// Message formats of a version 0 off-chain message.
+const (
+	SolanaOffchainRestrictedASCII = 0
+	SolanaOffchainLimitedUTF8     = 1
+	SolanaOffchainExtendedUTF8    = 2
+)
+
+const (
+	// solanaOffchainMaxLenLedger is the longest message a Ledger signs, the restricted and limited formats
+	solanaOffchainMaxLenLedger = 1212
+	solanaOffchainMaxLen       = 65515
+)
+
+// SolanaOffchainMessage serializes msg as a Solana off-chain message of the version. Version 0,
+// signed by the Solana CLI and Ledger, is the signing domain, the version, the message format,
+// the length and the message. Version 1 is the signing domain, the version, the sorted signers
+// and the message.
+func SolanaOffchainMessage(version uint8, msg string, signers ...[]byte) ([]byte, error) {
+	if msg == "" {
+		return nil, errors.New("empty off-chain message")
+	}
+	var buf bytes.Buffer
+	buf.WriteString(SolanaOffchainSigningDomain)
+	buf.WriteByte(version)
+	switch version {
+	case 0:
+		var format byte
+		switch {
+		case len(msg) <= solanaOffchainMaxLenLedger && isPrintableASCII(msg):
+			format = SolanaOffchainRestrictedASCII
+		case len(msg) <= solanaOffchainMaxLenLedger && utf8.ValidString(msg):
+			format = SolanaOffchainLimitedUTF8
+		case len(msg) <= solanaOffchainMaxLen && utf8.ValidString(msg):
+			format = SolanaOffchainExtendedUTF8
+		default:
+			return nil, fmt.Errorf("off-chain message of %d bytes is not valid utf-8 or too long", len(msg))
+		}
+		buf.WriteByte(format)
+		_ = binary.Write(&buf, binary.LittleEndian, uint16(len(msg)))
+	case 1:
+		if len(signers) == 0 || len(signers) > 255 {
+			return nil, fmt.Errorf("off-chain message has %d signers", len(signers))
+		}
+		sorted := append([][]byte(nil), signers...)
+		sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+		buf.WriteByte(byte(len(sorted)))
+		for _, signer := range sorted {
+			buf.Write(signer)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported off-chain message version %d", version)
+	}
+	buf.WriteString(msg)
+	return buf.Bytes(), nil
+}
+
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// solanaSignature decodes a signature in hex, base58 as the Solana CLI prints it, or base64.
+func solanaSignature(sign string) []byte {
+	if b, err := Decode(sign); err == nil && len(b) == ed25519.SignatureSize {
+		return b
+	}
+	if b := base58.Decode(sign); len(b) == ed25519.SignatureSize {
+		return b
+	}
+	if b, err := base64.StdEncoding.DecodeString(sign); err == nil && len(b) == ed25519.SignatureSize {
+		return b
+	}
+	return nil
+}
+
+// VerifySolanaOffchainMessage verifies a signature of msg as an off-chain message, of version 0
+// or of version 1 signed by the key alone, and that the key is the address.
+func VerifySolanaOffchainMessage(coin, addr, msg, sign, pubkey string) error {
+	pubkeyBytes, _ := Decode(pubkey)
+	signature := solanaSignature(sign)
+	if len(pubkeyBytes) != ed25519.PublicKeySize || signature == nil {
+		return fmt.Errorf("invalid off-chain message signature or public key, coin:%s, addr:%s", coin, addr)
+	}
+	for _, version := range []uint8{0, 1} {
+		signed, err := SolanaOffchainMessage(version, msg, pubkeyBytes)
+		if err == nil && verifyEd25519(pubkeyBytes, signed, signature) {
+			return verifyEd25519Address(coin, addr, pubkey)
+		}
+	}
+	return fmt.Errorf("off-chain message signature verification failed, coin:%s, addr:%s", coin, addr)
+}
+
+// verifySolanaMessage verifies the PoR message signed as the other ed25519 coins do, or as an
+// off-chain message. The verifier suffix names the off-chain message.
+func verifySolanaMessage(coin, addr, msg, sign, pubkey string) (string, error) {
+	if pubkey == "" {
+		// a Solana address is its public key
+		if key := base58.Decode(addr); len(key) == ed25519.PublicKeySize {
+			pubkey = hex.EncodeToString(key)
+		} else {
+			return "", withReason(ReasonUndecodableAddress, fmt.Errorf("SOL address is not a public key, coin:%s, addr:%s", coin, addr))
+		}
+	}
+	err := VerifyEd25519Coin(coin, addr, msg, sign, pubkey)
+	if FailureReason(err) != ReasonBadSignature {
+		return "", err
+	}
+	if offchainErr := VerifySolanaOffchainMessage(coin, addr, msg, sign, pubkey); FailureReason(offchainErr) != ReasonBadSignature {
+		return "+offchain message", offchainErr
+	}
+	return "", err
+}
+
+// verifySolanaRow verifies a SOL row signed by its address, or by the members EOA1 and EOA2 of a
+// multisig vault, e.g. a Squads vault, which cannot sign. The key of a member is its address.
+func verifySolanaRow(row *CoinData) *SignatureResult {
+	if row.EOA1 == "" {
+		verifier, err := verifySolanaMessage(row.Coin, row.Address, row.Message, row.Sign1, row.Script)
+		return &SignatureResult{Address: row.Address, Verifier: verifier, Err: err}
+	}
+	var result *SignatureResult
+	for i, member := range []string{row.EOA1, row.EOA2} {
+		if member == "" {
+			continue
+		}
+		signer, sign := []string{SignerEOA1, SignerEOA2}[i], []string{row.Sign1, row.Sign2}[i]
+		verifier, err := verifySolanaMessage(row.Coin, member, row.Message, sign, "")
+		result = &SignatureResult{Address: member, Signer: signer, Verifier: verifier}
+		if err != nil {
+			result.Err = fmt.Errorf("owner%d verification failed: %w", i+1, err)
+			return result
+		}
+	}
+	return result
+}
+
+const (
+	// SquadsProgramID is the Squads v4 multisig program
+	SquadsProgramID = "SQDS4ep65T869zMMBKyuUq6aD6EgTu8psMjkvj52pCf"
+	// squadsVotePermission is the permission bit of the members that approve a transaction
+	squadsVotePermission = 1 << 1
+)
+
+// SolanaCreateProgramAddress returns the program derived address of the seeds, which must not be
+// a point of the ed25519 curve.
+func SolanaCreateProgramAddress(programID []byte, seeds ...[]byte) ([]byte, error) {
+	h := sha256.New()
+	for _, seed := range seeds {
+		h.Write(seed)
+	}
+	h.Write(programID)
+	h.Write([]byte("ProgramDerivedAddress"))
+	addr := h.Sum(nil)
+	compressed, _ := curve.NewCompressedEdwardsYFromBytes(addr)
+	if _, err := new(curve.EdwardsPoint).SetCompressedY(compressed); err == nil {
+		return nil, errors.New("program address is on the ed25519 curve")
+	}
+	return addr, nil
+}
+
+// SolanaFindProgramAddress returns the program derived address of the seeds and the first bump,
+// counting down from 255, whose address is off the curve.
+func SolanaFindProgramAddress(programID []byte, seeds ...[]byte) ([]byte, byte, error) {
+	for bump := 255; bump >= 0; bump-- {
+		if addr, err := SolanaCreateProgramAddress(programID, append(seeds[:len(seeds):len(seeds)], []byte{byte(bump)})...); err == nil {
+			return addr, byte(bump), nil
+		}
+	}
+	return nil, 0, errors.New("no program derived address off the curve")
+}
+
+// SquadsVaultAddress returns the vault of a Squads v4 multisig at the index.
+func SquadsVaultAddress(multisig string, index uint8) (string, error) {
+	key := base58.Decode(multisig)
+	if len(key) != ed25519.PublicKeySize {
+		return "", fmt.Errorf("invalid squads multisig %s", multisig)
+	}
+	addr, _, err := SolanaFindProgramAddress(base58.Decode(SquadsProgramID), []byte("multisig"), key, []byte("vault"), []byte{index})
+	if err != nil {
+		return "", err
+	}
+	return base58.Encode(addr), nil
+}
+
+// squadsMultisigDiscriminator is the anchor discriminator of the Multisig account.
+func squadsMultisigDiscriminator() []byte {
+	h := sha256.Sum256([]byte("account:Multisig"))
+	return h[:8]
+}
+
+// ParseSquadsMultisig reads the voting members and the threshold of a Squads v4 Multisig account.
+func ParseSquadsMultisig(data []byte) (*ContractOwners, error) {
+	// discriminator, create_key, config_authority, threshold, time_lock, transaction_index,
+	// stale_transaction_index, rent_collector (an option), bump, members
+	if len(data) < 8+32+32+2+4+8+8+1 || !bytes.Equal(data[:8], squadsMultisigDiscriminator()) {
+		return nil, errors.New("not a squads multisig account")
+	}
+	owners := &ContractOwners{Threshold: int(binary.LittleEndian.Uint16(data[72:74]))}
+	offset := 74 + 4 + 8 + 8
+	if data[offset] == 1 {
+		offset += 32
+	}
+	offset += 1 + 1
+	if offset+4 > len(data) {
+		return nil, errors.New("squads multisig account is truncated")
+	}
+	count := int(binary.LittleEndian.Uint32(data[offset : offset+4]))
+	offset += 4
+	if count > (len(data)-offset)/33 {
+		return nil, errors.New("squads multisig account is truncated")
+	}
+	for i := 0; i < count; i++ {
+		member := data[offset+33*i : offset+33*(i+1)]
+		if member[32]&squadsVotePermission != 0 {
+			owners.Owners = append(owners.Owners, base58.Encode(member[:32]))
+		}
+	}
+	return owners, nil
+}
+
+// SquadsOwnerLookup reads the voting members and the threshold of the Squads multisig whose vault
+// is the address of a row. The multisig account is published in the public key column as
+// {"multisig":"<address>"}. Solana nodes serve the current state of an account only, it is the
+// state at the snapshot slot when no transaction touched the multisig after it; a row whose
+// multisig changed since fails with state_changed.
+type SquadsOwnerLookup struct {
+	endpoints map[string]*EvmRPCEndpoint
+}
+
+// NewSquadsOwnerLookup returns a lookup through the nodes of rpc.json, client.RpcClient must be
+// initialized.
+func NewSquadsOwnerLookup(endpoints map[string]*EvmRPCEndpoint) *SquadsOwnerLookup {
+	return &SquadsOwnerLookup{endpoints: endpoints}
+}
+
+func (l *SquadsOwnerLookup) Owners(row *CoinData) (*ContractOwners, error) {
+	var script struct {
+		Multisig string `json:"multisig"`
+	}
+	if err := json.Unmarshal([]byte(row.Script), &script); err != nil || script.Multisig == "" {
+		return nil, withReason(ReasonMissingScript, fmt.Errorf("%s publishes no squads multisig, public key column %q", row.Address, row.Script))
+	}
+	vault := false
+	for index := 0; index < 256 && !vault; index++ {
+		addr, err := SquadsVaultAddress(script.Multisig, uint8(index))
+		if err != nil {
+			return nil, withReason(ReasonMissingScript, err)
+		}
+		vault = addr == row.Address
+	}
+	if !vault {
+		return nil, withReason(ReasonAddressMismatch, fmt.Errorf("%s is not a vault of squads multisig %s", row.Address, script.Multisig))
+	}
+
+	endpoint, err := rowRPCEndpoint(l.endpoints, row)
+	if err != nil {
+		return nil, err
+	}
+	config := map[string]interface{}{"encoding": "base64", "commitment": "finalized"}
+	snapshot, err := strconv.ParseUint(row.SnapshotHeight, 10, 64)
+	hasSnapshot := err == nil
+	if hasSnapshot {
+		config["minContextSlot"] = snapshot
+	}
+	var account struct {
+		Context struct {
+			Slot uint64 `json:"slot"`
+		} `json:"context"`
+		Value *struct {
+			Data  []string `json:"data"`
+			Owner string   `json:"owner"`
+		} `json:"value"`
+	}
+	if err = evmRPCCall(endpoint, "getAccountInfo", []interface{}{script.Multisig, config}, &account); err != nil {
+		return nil, err
+	}
+	if hasSnapshot && account.Context.Slot > snapshot {
+		if err = squadsUnchangedSince(endpoint, script.Multisig, snapshot); err != nil {
+			return nil, err
+		}
+	}
+	if account.Value == nil || account.Value.Owner != SquadsProgramID || len(account.Value.Data) == 0 {
+		return nil, withReason(ReasonAddressMismatch, fmt.Errorf("%s is not a squads multisig account", script.Multisig))
+	}
+	data, err := base64.StdEncoding.DecodeString(account.Value.Data[0])
+	if err != nil {
+		return nil, withReason(ReasonRPCError, fmt.Errorf("%w, method:getAccountInfo, error:%v", ErrRPC, err))
+	}
+	owners, err := ParseSquadsMultisig(data)
+	if err != nil {
+		return nil, withReason(ReasonAddressMismatch, fmt.Errorf("%s: %v", script.Multisig, err))
+	}
+	return owners, nil
+}
+
+// squadsUnchangedSince fails when a transaction touched the multisig after the snapshot slot, the
+// account state read afterwards may then hold other members or another threshold.
+func squadsUnchangedSince(endpoint *EvmRPCEndpoint, multisig string, snapshot uint64) error {
+	var signatures []struct {
+		Signature string `json:"signature"`
+		Slot      uint64 `json:"slot"`
+	}
+	config := map[string]interface{}{"limit": 1, "commitment": "finalized"}
+	if err := evmRPCCall(endpoint, "getSignaturesForAddress", []interface{}{multisig, config}, &signatures); err != nil {
+		return err
+	}
+	if len(signatures) > 0 && signatures[0].Slot > snapshot {
+		return withReason(ReasonStateChanged, fmt.Errorf("squads multisig %s changed at slot %d after the snapshot slot %d, transaction %s",
+			multisig, signatures[0].Slot, snapshot, signatures[0].Signature))
+	}
+	return nil
+}
+
+// NewSquadsOwnerVerifier requires the members that sign a SOL row to be voting members of the
+// Squads multisig of its vault and to meet the threshold, rows of other chains are left to next.
+func NewSquadsOwnerVerifier(next SignatureVerifier, endpoints map[string]*EvmRPCEndpoint) SignatureVerifier {
+	owners := NewOwnerVerifier(next, NewSquadsOwnerLookup(endpoints))
+	return SignatureVerifierFunc(func(row *CoinData) *SignatureResult {
+		if PorCoinAddressTypeMap[row.Coin] != "SOL" {
+			return next.Verify(row)
+		}
+		return owners.Verify(row)
+	})
+}
@@ -0,0 +1,217 @@
+package common
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/martinboehm/btcutil/base58"
+	"github.com/okx/proof-of-reserves/client"
+)
+
+func TestSolanaCreateProgramAddress(t *testing.T) {
+	// vectors of @solana/web3.js
+	programID := base58.Decode("BPFLoader1111111111111111111111111111111111")
+	tests := []struct {
+		seeds [][]byte
+		want  string
+	}{
+		{[][]byte{{}, {1}}, "3gF2KMe9KiC6FNVBmfg9i267aMPvK37FewCip4eGBFcT"},
+		{[][]byte{[]byte("☉")}, "7ytmC1nT1xY4RfxCV2ZgyA7UakC93do5ZdyhdF3EtPj7"},
+		{[][]byte{[]byte("Talking"), []byte("Squirrels")}, "HwRVBufQ4haG5XSgpspwKtNd3PC9GM9m1196uJW36vds"},
+	}
+	for _, test := range tests {
+		addr, err := SolanaCreateProgramAddress(programID, test.seeds...)
+		if err != nil || base58.Encode(addr) != test.want {
+			t.Errorf("%q: expected %s, got %s %v", test.seeds, test.want, base58.Encode(addr), err)
+		}
+	}
+	addr, bump, err := SolanaFindProgramAddress(programID, []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := SolanaCreateProgramAddress(programID, []byte{}, []byte{bump}); err != nil || !bytes.Equal(again, addr) {
+		t.Fatalf("expected the bump %d to create %s, got %v", bump, base58.Encode(addr), err)
+	}
+}
+
+func TestSolanaOffchainMessage(t *testing.T) {
+	signed, err := SolanaOffchainMessage(0, "Test Message")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte("\xffsolana offchain"), 0, SolanaOffchainRestrictedASCII, 12, 0)
+	if !bytes.Equal(signed, append(want, "Test Message"...)) {
+		t.Fatalf("unexpected version 0 message %x", signed)
+	}
+	if signed, _ = SolanaOffchainMessage(0, "Tést"); signed[17] != SolanaOffchainLimitedUTF8 {
+		t.Fatalf("expected the limited utf-8 format, got %d", signed[17])
+	}
+	if signed, _ = SolanaOffchainMessage(0, string(bytes.Repeat([]byte("a"), 2000))); signed[17] != SolanaOffchainExtendedUTF8 {
+		t.Fatalf("expected the extended utf-8 format, got %d", signed[17])
+	}
+	if _, err = SolanaOffchainMessage(0, "\xff"); err == nil {
+		t.Fatal("expected invalid utf-8 to fail")
+	}
+	a, b := bytes.Repeat([]byte{2}, 32), bytes.Repeat([]byte{1}, 32)
+	signed, _ = SolanaOffchainMessage(1, "hi", a, b)
+	if !bytes.Equal(signed[16:], append(append(append([]byte{1, 2}, b...), a...), "hi"...)) {
+		t.Fatalf("unexpected version 1 message %x", signed[16:])
+	}
+	if _, err = SolanaOffchainMessage(2, "hi"); err == nil {
+		t.Fatal("expected an unknown version to fail")
+	}
+}
+
+func solanaTestKey(seed byte) (ed25519.PrivateKey, string) {
+	key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, 32))
+	return key, base58.Encode(key.Public().(ed25519.PublicKey))
+}
+
+func TestVerifySolanaRow(t *testing.T) {
+	key, addr := solanaTestKey(1)
+	member2, addr2 := solanaTestKey(2)
+	v0, _ := SolanaOffchainMessage(0, okxTestMessage)
+	v1, _ := SolanaOffchainMessage(1, okxTestMessage, key.Public().(ed25519.PublicKey))
+	legacy := Encode(ed25519.Sign(key, HashEd25519Msg(OKXMessageSignatureHeader, okxTestMessage)))
+	pub := hex.EncodeToString(key.Public().(ed25519.PublicKey))
+
+	tests := []struct {
+		name     string
+		row      CoinData
+		verifier string
+		reason   string
+	}{
+		{"legacy", CoinData{Address: addr, Sign1: legacy, Script: pub}, "", ""},
+		{"legacy without public key", CoinData{Address: addr, Sign1: legacy}, "", ""},
+		{"offchain v0 base58", CoinData{Address: addr, Sign1: base58.Encode(ed25519.Sign(key, v0))}, "+offchain message", ""},
+		{"offchain v1 base64", CoinData{Address: addr, Sign1: base64.StdEncoding.EncodeToString(ed25519.Sign(key, v1))}, "+offchain message", ""},
+		{"offchain of another address", CoinData{Address: addr2, Sign1: Encode(ed25519.Sign(key, v0)), Script: pub}, "+offchain message", ReasonAddressMismatch},
+		{"offchain of another message", CoinData{Address: addr, Sign1: Encode(ed25519.Sign(key, append(v0, '!')))}, "", ReasonBadSignature},
+		{"members", CoinData{Address: "vault", EOA1: addr, Sign1: legacy, EOA2: addr2, Sign2: Encode(ed25519.Sign(member2, v0))}, "+offchain message", ""},
+		{"member signs for another", CoinData{Address: "vault", EOA1: addr, Sign1: legacy, EOA2: addr2, Sign2: legacy}, "", ReasonBadSignature},
+	}
+	for _, test := range tests {
+		row := test.row
+		row.Coin, row.Message = "SOL", okxTestMessage
+		result := verifyEd25519Row(&row)
+		if result.Reason() != test.reason || result.Verifier != test.verifier {
+			t.Errorf("%s: expected %q %q, got %q %q (%v)", test.name, test.verifier, test.reason, result.Verifier, result.Reason(), result.Err)
+		}
+	}
+}
+
+// squadsMultisigData encodes a Squads v4 Multisig account, members maps keys to permissions.
+func squadsMultisigData(threshold uint16, members [][]byte, permissions []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(squadsMultisigDiscriminator())
+	buf.Write(make([]byte, 64))
+	_ = binary.Write(&buf, binary.LittleEndian, threshold)
+	buf.Write(make([]byte, 4+8+8))
+	buf.WriteByte(1)
+	buf.Write(make([]byte, 32))
+	buf.WriteByte(254)
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(len(members)))
+	for i, m := range members {
+		buf.Write(m)
+		buf.WriteByte(permissions[i])
+	}
+	return buf.Bytes()
+}
+
+func TestSquadsOwnerVerifier(t *testing.T) {
+	key1, addr1 := solanaTestKey(1)
+	key2, addr2 := solanaTestKey(2)
+	_, addr3 := solanaTestKey(3)
+	_, multisig := solanaTestKey(9)
+	vault, _ := SquadsVaultAddress(multisig, 0)
+	vault1, _ := SquadsVaultAddress(multisig, 1)
+	if vault == vault1 {
+		t.Fatal("expected the vaults of a multisig to differ")
+	}
+	members := [][]byte{base58.Decode(addr1), base58.Decode(addr2), base58.Decode(addr3)}
+	// addr3 initiates and executes only, it does not vote
+	data := squadsMultisigData(2, members, []byte{7, 7, 5})
+	// the last transaction of the multisig, before the snapshot slot unless a test changes it
+	changedAt := 299999000
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		var account string
+		var config map[string]interface{}
+		_ = json.Unmarshal(body.Params[0], &account)
+		_ = json.Unmarshal(body.Params[1], &config)
+		if body.Method == "getSignaturesForAddress" && account == multisig {
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":[{"signature":"5h6x","slot":%d,"err":null}]}`, changedAt)
+			return
+		}
+		if body.Method != "getAccountInfo" || config["minContextSlot"] != float64(300000000) || config["encoding"] != "base64" {
+			t.Fatalf("unexpected request %s %v", body.Method, config)
+		}
+		if account != multisig {
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":{"context":{"slot":300000001},"value":null}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":{"context":{"slot":300000001},"value":{"data":["%s","base64"],"owner":"%s","lamports":1}}}`,
+			base64.StdEncoding.EncodeToString(data), SquadsProgramID)
+	}))
+	defer node.Close()
+	client.RpcClient = client.NewJsonRPCClient()
+
+	ed25519Verifier, _ := RegisteredSignatureVerifier(Ed25519CoinType)
+	verifier := NewSquadsOwnerVerifier(ed25519Verifier, map[string]*EvmRPCEndpoint{"sol": {Endpoint: node.URL}})
+	sign := func(key ed25519.PrivateKey) string {
+		return Encode(ed25519.Sign(key, HashEd25519Msg(OKXMessageSignatureHeader, okxTestMessage)))
+	}
+	_, other := solanaTestKey(8)
+	script := fmt.Sprintf(`{"multisig":"%s"}`, multisig)
+	tests := []struct {
+		name          string
+		addr, eoa2    string
+		script, sign2 string
+		reason        string
+	}{
+		{"threshold met", vault, addr2, script, sign(key2), ""},
+		{"vault 1", vault1, addr2, script, sign(key2), ""},
+		{"below threshold", vault, "", script, "", ReasonBelowThreshold},
+		{"member without vote", vault, addr3, script, "", ReasonNotOwner},
+		{"not a vault", other, addr2, script, sign(key2), ReasonAddressMismatch},
+		{"unknown multisig", vault, addr2, fmt.Sprintf(`{"multisig":"%s"}`, addr1), sign(key2), ReasonAddressMismatch},
+		{"no multisig", vault, addr2, "", sign(key2), ReasonMissingScript},
+	}
+	for _, test := range tests {
+		row := &CoinData{Coin: "SOL", SnapshotHeight: "300000000", Address: test.addr, Message: okxTestMessage,
+			EOA1: addr1, Sign1: sign(key1), EOA2: test.eoa2, Sign2: test.sign2, Script: test.script}
+		if test.name == "member without vote" {
+			// the member signs, but cannot approve a transaction
+			key3, _ := solanaTestKey(3)
+			row.Sign2 = sign(key3)
+		}
+		if result := verifier.Verify(row); result.Reason() != test.reason {
+			t.Errorf("%s: expected reason %q, got %q (%v)", test.name, test.reason, result.Reason(), result.Err)
+		}
+	}
+	// the state read is newer than the snapshot and the multisig changed in between
+	changedAt = 300000001
+	row := &CoinData{Coin: "SOL", SnapshotHeight: "300000000", Address: vault, Message: okxTestMessage,
+		EOA1: addr1, Sign1: sign(key1), EOA2: addr2, Sign2: sign(key2), Script: script}
+	if result := verifier.Verify(row); result.Reason() != ReasonStateChanged {
+		t.Errorf("expected reason %q, got %q (%v)", ReasonStateChanged, result.Reason(), result.Err)
+	}
+	// rows of other chains are not squads vaults
+	if result := verifier.Verify(ed25519Row("APTOS", "0x1")); strings.Contains(result.Verifier, "owners") {
+		t.Fatal("expected an APTOS row to skip the squads lookup")
+	}
+}
@@ -1,65 +1,219 @@
 package common
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/okx/go-wallet-sdk/coins/starknet"
 )
 
-var starknetMutex sync.Mutex
+// The SNIP-12 (revision 0) typed data every STARKNET row signs, the message is the contents felt.
+const (
+	StarknetDomainName    = "OKX POR MESSAGE"
+	StarknetDomainVersion = "1"
+	StarknetMainnetID     = "0x534e5f4d41494e"
+)
 
-func VerifyStarknetEIP712(accountAddress, msg, publicKey, sig string) bool {
-	starknetMutex.Lock()
-	defer starknetMutex.Unlock()
+// starkCurve is the curve with its pedersen constant points, loaded once. starknet.SC() reloads the
+// package curve on every call, which races between verifiers, the loaded copy is only read.
+var starkCurve struct {
+	once  sync.Once
+	curve starknet.StarkCurve
+}
 
-	const EIP712_TEMPLATE = `{
-    "accountAddress": "%s",
-    "typedData": {
-        "types": {
-            "StarkNetDomain": [
-                {
-                    "name": "name",
-                    "type": "felt"
-                },
-                {
-                    "name": "version",
-                    "type": "felt"
-                },
-                {
-                    "name": "chainId",
-                    "type": "felt"
-                }
-            ],
-            "Message": [
-                {
-                    "name": "contents",
-                    "type": "felt"
-                }
-            ]
-        },
-        "primaryType": "Message",
-        "domain": {
-            "name": "OKX POR MESSAGE",
-            "version": "1",
-            "chainId": "0x534e5f4d41494e"
-        },
-        "message": {
-            "contents": "%s"
-        }
-    }
-}`
+func starknetCurve() starknet.StarkCurve {
+	starkCurve.once.Do(func() {
+		starkCurve.curve = starknet.SC()
+	})
+	return starkCurve.curve
+}
 
-	hash, err := starknet.GetMessageHashWithJson(fmt.Sprintf(EIP712_TEMPLATE, accountAddress, msg))
-	if err != nil || len(hash) == 0 {
-		return false
+// starknetHashOnElements is the pedersen hash chain of the elements and their count.
+func starknetHashOnElements(curve starknet.StarkCurve, elems ...*big.Int) (*big.Int, error) {
+	hash := big.NewInt(0)
+	var err error
+	for _, e := range append(elems, big.NewInt(int64(len(elems)))) {
+		if hash, err = curve.PedersenHash([]*big.Int{hash, e}); err != nil {
+			return nil, err
+		}
+	}
+	return hash, nil
+}
+
+// starknetFelt encodes a typed data value as starknet.js does: hex, a decimal number or a short
+// string of at most 31 characters. A longer string does not fit a felt.
+func starknetFelt(v string) (*big.Int, error) {
+	if strings.HasPrefix(v, "0x") {
+		return starknet.HexToBN(v)
+	}
+	if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return big.NewInt(i), nil
+	}
+	if f := starknet.StrToFelt(v).Big(); f.Sign() != 0 {
+		return f, nil
+	}
+	return nil, fmt.Errorf("message %q does not fit a felt", v)
+}
+
+// StarknetMessageHash returns the SNIP-12 hash of the PoR message signed by the account: the
+// pedersen hash of "StarkNet Message", the domain hash, the account and the message hash.
+func StarknetMessageHash(accountAddress, msg string) (*big.Int, error) {
+	account, err := starknet.HexToBN(accountAddress)
+	if err != nil {
+		return nil, withReason(ReasonUndecodableAddress, fmt.Errorf("invalid starknet address %s", accountAddress))
+	}
+	contents, err := starknetFelt(msg)
+	if err != nil {
+		return nil, withReason(ReasonBadSignature, err)
+	}
+	curve := starknetCurve()
+	domain, err := starknetHashOnElements(curve,
+		starknet.GetSelectorFromName("StarkNetDomain(name:felt,version:felt,chainId:felt)"),
+		starknet.StrToFelt(StarknetDomainName).Big(),
+		starknet.StrToFelt(StarknetDomainVersion).Big(),
+		starknet.StrToFelt(StarknetMainnetID).Big())
+	if err != nil {
+		return nil, err
+	}
+	message, err := starknetHashOnElements(curve, starknet.GetSelectorFromName("Message(contents:felt)"), contents)
+	if err != nil {
+		return nil, withReason(ReasonBadSignature, err)
+	}
+	return starknetHashOnElements(curve, starknet.UTF8StrToBig("StarkNet Message"), domain, account, message)
+}
+
+// ParseStarknetSignature reads the felts of a signature: r and s as 128 hex characters, or the
+// felt array of the account, as json or separated by commas.
+func ParseStarknetSignature(sign string) ([]*big.Int, error) {
+	sign = strings.TrimSpace(sign)
+	var felts []string
+	switch {
+	case strings.HasPrefix(sign, "["):
+		if err := json.Unmarshal([]byte(sign), &felts); err != nil {
+			return nil, fmt.Errorf("invalid starknet signature array: %v", err)
+		}
+	case strings.Contains(sign, ","):
+		felts = strings.Split(sign, ",")
+	default:
+		sign = strings.TrimPrefix(sign, "0x")
+		if len(sign) != 128 {
+			return nil, fmt.Errorf("invalid starknet signature length %d", len(sign))
+		}
+		felts = []string{sign[:64], sign[64:]}
+	}
+	values := make([]*big.Int, 0, len(felts))
+	for _, f := range felts {
+		v, ok := new(big.Int).SetString(strings.TrimPrefix(strings.TrimSpace(f), "0x"), 16)
+		if !ok {
+			return nil, fmt.Errorf("invalid starknet signature felt %q", f)
+		}
+		values = append(values, v)
 	}
+	return values, nil
+}
+
+// starknetSigner is a stark key and its signature in an account signature.
+type starknetSigner struct {
+	pubKey, r, s *big.Int
+}
 
-	curve := starknet.SC()
+// errStarknetLayout is returned for account signatures that only the account can verify, e.g.
+// the secp256r1 and webauthn signers of Argent and Braavos.
+var errStarknetLayout = errors.New("the account signature has no offline layout, verify it against the account")
+
+// starknetSigners splits an account signature into its stark signers. Plain accounts (OpenZeppelin,
+// Braavos, Argent) sign [r, s], Argent adds the guardian [r, s, guardian r, guardian s], Argent
+// multisig signs [signer, r, s, ...] and Argent 0.4 signs the signer list [n, 0, signer, r, s, ...],
+// whose variant 0 is a stark signer. keys are the public keys of the row, in order, they sign the
+// layouts without signer keys.
+func starknetSigners(sig []*big.Int, keys []*big.Int) ([]starknetSigner, error) {
+	inKeys := func(k *big.Int) bool {
+		for _, key := range keys {
+			if key.Cmp(k) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	var signers []starknetSigner
+	switch {
+	case len(sig) == 2 || len(sig) == 4 && len(keys) > 1:
+		for i := 0; i+1 < len(sig) && i/2 < len(keys); i += 2 {
+			signers = append(signers, starknetSigner{keys[i/2], sig[i], sig[i+1]})
+		}
+	case len(sig) == 4:
+		// the guardian key is unknown, the owner signature proves the owner key
+		signers = append(signers, starknetSigner{keys[0], sig[0], sig[1]})
+	case len(sig) > 1 && sig[0].IsInt64() && int64(len(sig)) == 4*sig[0].Int64()+1:
+		for i := 1; i < len(sig); i += 4 {
+			if sig[i].Sign() != 0 {
+				return nil, errStarknetLayout
+			}
+			signers = append(signers, starknetSigner{sig[i+1], sig[i+2], sig[i+3]})
+		}
+	case len(sig)%3 == 0 && inKeys(sig[0]):
+		for i := 0; i < len(sig); i += 3 {
+			signers = append(signers, starknetSigner{sig[i], sig[i+1], sig[i+2]})
+		}
+	default:
+		return nil, errStarknetLayout
+	}
+	for i, signer := range signers {
+		if !inKeys(signer.pubKey) {
+			return nil, withReason(ReasonAddressMismatch, fmt.Errorf("signer %s is not a public key of the row", starknet.BigToHex(signer.pubKey)))
+		}
+		// the accounts require ascending signers, a key cannot sign twice
+		if i > 0 && len(sig) != 4 && signers[i-1].pubKey.Cmp(signer.pubKey) >= 0 {
+			return nil, withReason(ReasonBadSignature, errors.New("signers are not in ascending order"))
+		}
+	}
+	return signers, nil
+}
 
-	sigR := starknet.HexToBig(sig[:64])
-	sigS := starknet.HexToBig(sig[64:])
-	pubX, pubY := curve.XToPubKey(publicKey)
+// VerifyStarknetSignature verifies the account signature of the PoR message with the public keys
+// of the row, one key or a comma separated list for a multisig account. Every stark signer of the
+// signature must be a key of the row and sign the SNIP-12 hash.
+func VerifyStarknetSignature(accountAddress, msg, publicKey, sign string) error {
+	hash, err := StarknetMessageHash(accountAddress, msg)
+	if err != nil {
+		return err
+	}
+	sig, err := ParseStarknetSignature(sign)
+	if err != nil {
+		return withReason(ReasonBadSignature, err)
+	}
+	var keys []*big.Int
+	for _, k := range strings.Split(publicKey, ",") {
+		key, err := starknet.HexToBN(strings.TrimSpace(k))
+		if err != nil {
+			return withReason(ReasonMissingScript, fmt.Errorf("invalid starknet public key %q", k))
+		}
+		keys = append(keys, key)
+	}
+	signers, err := starknetSigners(sig, keys)
+	if err != nil {
+		return err
+	}
+	curve := starknetCurve()
+	for _, signer := range signers {
+		pubX, pubY := curve.XToPubKey(starknet.BigToHex(signer.pubKey))
+		if pubY == nil {
+			return withReason(ReasonMissingScript, fmt.Errorf("invalid starknet public key %s, not on the curve", starknet.BigToHex(signer.pubKey)))
+		}
+		if !curve.Verify(hash, signer.r, signer.s, pubX, pubY) {
+			return withReason(ReasonBadSignature, fmt.Errorf("signature does not verify for public key %s", starknet.BigToHex(signer.pubKey)))
+		}
+	}
+	return nil
+}
 
-	return curve.Verify(starknet.HexToBig(hash), sigR, sigS, pubX, pubY)
+// VerifyStarknetEIP712 reports whether sig, r and s in hex, is the signature of the public key
+// over the SNIP-12 typed data of msg. It is safe for concurrent use.
+func VerifyStarknetEIP712(accountAddress, msg, publicKey, sig string) bool {
+	return VerifyStarknetSignature(accountAddress, msg, publicKey, sig) == nil
 }
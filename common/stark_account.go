@@ -0,0 +1,128 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/okx/go-wallet-sdk/coins/starknet"
+)
+
+// StarknetValidMagic is 'VALID', the short string an SRC-6 account returns from
+// is_valid_signature for a signature it accepts.
+const StarknetValidMagic = "0x56414c4944"
+
+// Starknet json-rpc error codes of a call.
+const (
+	starknetContractNotFound  = 20
+	starknetSelectorNotFound  = 21
+	starknetContractExecution = 40
+)
+
+// starknetEntryPointNotFound reports whether a starknet_call failed because the contract has no
+// such entry point.
+func starknetEntryPointNotFound(e *EvmRPCCallError) bool {
+	return e.Code == starknetSelectorNotFound ||
+		e.Code == starknetContractExecution && (strings.Contains(e.Data, "ENTRYPOINT_NOT_FOUND") || strings.Contains(e.Data, "not found in contract"))
+}
+
+// StarknetAccountVerifier proves that the signature of a STARKNET row is one of the account
+// contract at the address, by calling is_valid_signature(hash, signature) at the snapshot block.
+// The public keys of the row are not trusted, and signatures that only the account can verify,
+// e.g. of Braavos hardware signers or Argent multisig signers of other schemes, are accepted.
+type StarknetAccountVerifier struct {
+	next      SignatureVerifier
+	endpoints map[string]*EvmRPCEndpoint
+}
+
+// NewStarknetAccountVerifier returns a verifier that checks the rows next accepts, or cannot verify
+// offline, against the account. client.RpcClient must be initialized.
+func NewStarknetAccountVerifier(next SignatureVerifier, endpoints map[string]*EvmRPCEndpoint) *StarknetAccountVerifier {
+	return &StarknetAccountVerifier{next: next, endpoints: endpoints}
+}
+
+func (v *StarknetAccountVerifier) Verify(row *CoinData) *SignatureResult {
+	result := v.next.Verify(row)
+	if !result.OK() && !errors.Is(result.Err, errStarknetLayout) && result.Reason() != ReasonMissingScript {
+		return result
+	}
+	offline := result.Err
+	result.Verifier += "+is_valid_signature"
+	result.Err = v.verifyAccount(row)
+	switch {
+	case result.Err == nil:
+	case offline != nil:
+		result.Err = fmt.Errorf("%w, offline verification failed: %v", result.Err, offline)
+	case FailureReason(result.Err) == ReasonBadSignature:
+		// the public keys of the row sign, but they are not keys of the account
+		result.Err = withReason(ReasonAddressMismatch, result.Err)
+	}
+	return result
+}
+
+func (v *StarknetAccountVerifier) verifyAccount(row *CoinData) error {
+	endpoint, err := rowRPCEndpoint(v.endpoints, row)
+	if err != nil {
+		return err
+	}
+	hash, err := StarknetMessageHash(row.Address, row.Message)
+	if err != nil {
+		return err
+	}
+	sig, err := ParseStarknetSignature(row.Sign1)
+	if err != nil {
+		return withReason(ReasonBadSignature, err)
+	}
+	return VerifyStarknetAccountSignature(endpoint, row.Address, hash, sig, starknetBlockID(row))
+}
+
+// VerifyStarknetAccountSignature asks the account at addr whether sig is a valid signature of hash
+// at the block, through is_valid_signature or the isValidSignature of cairo 0 accounts.
+func VerifyStarknetAccountSignature(endpoint *EvmRPCEndpoint, addr string, hash *big.Int, sig []*big.Int, block interface{}) error {
+	calldata := []string{starknet.BigToHex(hash), fmt.Sprintf("0x%x", len(sig))}
+	for _, s := range sig {
+		calldata = append(calldata, starknet.BigToHex(s))
+	}
+	for _, entryPoint := range []string{"is_valid_signature", "isValidSignature"} {
+		call := map[string]interface{}{
+			"contract_address":     addr,
+			"entry_point_selector": starknet.BigToHex(starknet.GetSelectorFromName(entryPoint)),
+			"calldata":             calldata,
+		}
+		var returnData []string
+		err := evmRPCCall(endpoint, "starknet_call", []interface{}{call, block}, &returnData)
+		var callErr *EvmRPCCallError
+		if errors.As(err, &callErr) {
+			switch {
+			case starknetEntryPointNotFound(callErr):
+				continue
+			case callErr.Code == starknetContractNotFound:
+				return withReason(ReasonAddressMismatch, fmt.Errorf("no account contract at %s", addr))
+			case callErr.Code == starknetContractExecution:
+				// accounts assert on an invalid signature
+				return fmt.Errorf("account rejected the signature, addr:%s, %s reverted: %s", addr, entryPoint, callErr.Data)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		// SRC-6 accounts return 'VALID', cairo 0 accounts return 1
+		if len(returnData) == 1 {
+			if v, ok := new(big.Int).SetString(strings.TrimPrefix(returnData[0], "0x"), 16); ok && (v.Cmp(starknet.HexToBig(StarknetValidMagic)) == 0 || v.Cmp(big.NewInt(1)) == 0) {
+				return nil
+			}
+		}
+		return fmt.Errorf("account rejected the signature, addr:%s, %s returned %v", addr, entryPoint, returnData)
+	}
+	return withReason(ReasonAddressMismatch, fmt.Errorf("contract at %s is not an account, it has no is_valid_signature", addr))
+}
+
+// starknetBlockID returns the snapshot block of a row, the latest block when it has no height.
+func starknetBlockID(row *CoinData) interface{} {
+	if height, err := strconv.ParseUint(row.SnapshotHeight, 10, 64); err == nil {
+		return map[string]uint64{"block_number": height}
+	}
+	return "latest"
+}
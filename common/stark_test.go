@@ -0,0 +1,210 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/okx/go-wallet-sdk/coins/starknet"
+	"github.com/okx/proof-of-reserves/client"
+)
+
+const starknetTestAccount = "0x0668a58aec3151bdf0f6f9360ea89453733d5c65f45cafe2d1591d8cddbd2395"
+
+func TestStarknetMessageHash(t *testing.T) {
+	const template = `{"accountAddress":"%s","typedData":{"types":{"StarkNetDomain":[{"name":"name","type":"felt"},{"name":"version","type":"felt"},{"name":"chainId","type":"felt"}],"Message":[{"name":"contents","type":"felt"}]},"primaryType":"Message","domain":{"name":"OKX POR MESSAGE","version":"1","chainId":"0x534e5f4d41494e"},"message":{"contents":"%s"}}}`
+	for _, msg := range []string{"OKC_DTT_AUP2025", "hello world", "0x1234", "20241001"} {
+		want, err := starknet.GetMessageHashWithJson(fmt.Sprintf(template, starknetTestAccount, msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash, err := StarknetMessageHash(starknetTestAccount, msg)
+		if err != nil || starknet.BigToHex(hash) != want {
+			t.Errorf("%s: expected hash %s, got %v %v", msg, want, hash, err)
+		}
+	}
+	if _, err := StarknetMessageHash(starknetTestAccount, "a message longer than a short string"); FailureReason(err) != ReasonBadSignature {
+		t.Errorf("expected a long message not to fit a felt, got %v", err)
+	}
+}
+
+func TestVerifyStarknetConcurrent(t *testing.T) {
+	const (
+		sign = "07abc5982853352d98763940726e0ab31f8c25fa6f1fc9951edad49cbfab6297018d6b42f497cefdcdb70aab45604612f03598a085bf984778fa413c7fab1b75"
+		pub  = "0x346262ffa4ec2f40feb9ae81e416af7cca9fcfa8871f1f9169e6dccd63aa667"
+	)
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			msg, ok := "hello world", true
+			if i%2 == 1 {
+				msg, ok = "hello moon", false
+			}
+			if err := VerifyStarkCoin("STARKNET", starknetTestAccount, msg, sign, pub); (err == nil) != ok {
+				errs <- fmt.Errorf("%s: expected ok %v, got %v", msg, ok, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// starknetTestSigners returns n stark keys, ascending, and a function that signs the PoR message
+// hash of the test account.
+func starknetTestSigners(t *testing.T, n int) ([]*big.Int, func(i int) (*big.Int, *big.Int)) {
+	curve := starknetCurve()
+	hash, err := StarknetMessageHash(starknetTestAccount, okxTestMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privs := make(map[string]*big.Int)
+	var pubs []*big.Int
+	for i := 0; i < n; i++ {
+		priv := big.NewInt(int64(1000 + i))
+		pub, _ := curve.PrivateToPublic(priv)
+		privs[pub.String()] = priv
+		pubs = append(pubs, pub)
+	}
+	sort.Slice(pubs, func(i, j int) bool { return pubs[i].Cmp(pubs[j]) < 0 })
+	return pubs, func(i int) (*big.Int, *big.Int) {
+		r, s, err := curve.Sign(hash, privs[pubs[i].String()])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r, s
+	}
+}
+
+func starknetFelts(values ...*big.Int) string {
+	felts := make([]string, len(values))
+	for i, v := range values {
+		felts[i] = starknet.BigToHex(v)
+	}
+	return strings.Join(felts, ",")
+}
+
+func TestVerifyStarknetAccountLayouts(t *testing.T) {
+	pubs, sign := starknetTestSigners(t, 3)
+	r0, s0 := sign(0)
+	r1, s1 := sign(1)
+	r2, s2 := sign(2)
+	keys := starknetFelts(pubs...)
+	zero, one, two := big.NewInt(0), big.NewInt(1), big.NewInt(2)
+
+	tests := []struct {
+		name, sign, keys string
+		reason           string
+	}{
+		{"plain", fmt.Sprintf("%064x%064x", r0, s0), starknet.BigToHex(pubs[0]), ""},
+		{"plain felt array", `["` + strings.Join(strings.Split(starknetFelts(r0, s0), ","), `","`) + `"]`, starknet.BigToHex(pubs[0]), ""},
+		{"plain other key", starknetFelts(r0, s0), starknet.BigToHex(pubs[1]), ReasonBadSignature},
+		{"argent guardian", starknetFelts(r0, s0, r1, s1), starknetFelts(pubs[0], pubs[1]), ""},
+		{"argent guardian unknown", starknetFelts(r0, s0, r1, s1), starknet.BigToHex(pubs[0]), ""},
+		{"argent multisig", starknetFelts(pubs[0], r0, s0, pubs[2], r2, s2), keys, ""},
+		{"argent multisig unsorted", starknetFelts(pubs[2], r2, s2, pubs[0], r0, s0), keys, ReasonBadSignature},
+		{"argent multisig twice", starknetFelts(pubs[1], r1, s1, pubs[1], r1, s1), keys, ReasonBadSignature},
+		{"argent multisig outsider", starknetFelts(pubs[0], r0, s0, pubs[2], r2, s2), starknetFelts(pubs[0], pubs[1]), ReasonAddressMismatch},
+		{"argent multisig bad signer", starknetFelts(pubs[0], r0, s0, pubs[1], r2, s2), keys, ReasonBadSignature},
+		{"argent signer list", starknetFelts(two, zero, pubs[0], r0, s0, zero, pubs[1], r1, s1), keys, ""},
+		{"argent secp256r1 signer", starknetFelts(one, two, pubs[0], r0, s0), keys, ReasonBadSignature},
+		{"braavos hardware signer", starknetFelts(r0, s0, one, r1, s1, r2, s2), keys, ReasonBadSignature},
+	}
+	for _, test := range tests {
+		if err := VerifyStarkCoin("STARKNET", starknetTestAccount, okxTestMessage, test.sign, test.keys); FailureReason(err) != test.reason {
+			t.Errorf("%s: expected reason %q, got %v", test.name, test.reason, err)
+		}
+	}
+}
+
+// newStarknetNode is a starknet json-rpc stand-in at block 100. The account at starknetTestAccount
+// accepts the signatures in accepted through is_valid_signature, a cairo 0 account at 0x2 accepts
+// any signature through isValidSignature, other addresses have no contract.
+func newStarknetNode(t *testing.T, accepted ...string) *httptest.Server {
+	snake := starknet.BigToHex(starknet.GetSelectorFromName("is_valid_signature"))
+	camel := starknet.BigToHex(starknet.GetSelectorFromName("isValidSignature"))
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Method string `json:"method"`
+			Params []struct {
+				ContractAddress    string   `json:"contract_address"`
+				EntryPointSelector string   `json:"entry_point_selector"`
+				Calldata           []string `json:"calldata"`
+				BlockNumber        int      `json:"block_number"`
+			} `json:"params"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.Method != "starknet_call" {
+			t.Fatalf("unexpected request %s, %v", body.Method, err)
+		}
+		call := body.Params[0]
+		if body.Params[1].BlockNumber != 100 {
+			t.Fatalf("starknet_call at block %d, want the snapshot height", body.Params[1].BlockNumber)
+		}
+		signature := strings.Join(call.Calldata[2:], ",")
+		switch {
+		case call.ContractAddress == starknetTestAccount && call.EntryPointSelector == snake:
+			for _, a := range accepted {
+				if a == signature {
+					fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":["%s"]}`, StarknetValidMagic)
+					return
+				}
+			}
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":40,"message":"Contract error","data":{"revert_error":"argent/invalid-signature"}}}`)
+		case call.ContractAddress == "0x2" && call.EntryPointSelector == camel:
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":["0x1"]}`)
+		case call.ContractAddress == "0x2":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":21,"message":"Invalid message selector"}}`)
+		default:
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":20,"message":"Contract not found"}}`)
+		}
+	}))
+}
+
+func TestStarknetAccountVerifier(t *testing.T) {
+	pubs, sign := starknetTestSigners(t, 3)
+	r0, s0 := sign(0)
+	r1, s1 := sign(1)
+	r2, s2 := sign(2)
+	multisig := starknetFelts(pubs[0], r0, s0, pubs[1], r1, s1)
+	braavos := starknetFelts(r0, s0, big.NewInt(1), r2, s2, big.NewInt(7))
+	node := newStarknetNode(t, multisig, braavos)
+	defer node.Close()
+	client.RpcClient = client.NewJsonRPCClient()
+
+	stark, _ := RegisteredSignatureVerifier(StarkCoinType)
+	verifier := NewStarknetAccountVerifier(stark, map[string]*EvmRPCEndpoint{"starknet": {Endpoint: node.URL}})
+	tests := []struct {
+		name, addr, sign, keys string
+		reason                 string
+	}{
+		{"argent multisig", starknetTestAccount, multisig, starknetFelts(pubs...), ""},
+		{"braavos hardware signer", starknetTestAccount, braavos, starknet.BigToHex(pubs[0]), ""},
+		{"braavos without public key", starknetTestAccount, braavos, "", ""},
+		{"key of another account", starknetTestAccount, starknetFelts(pubs[2], r2, s2), starknetFelts(pubs...), ReasonAddressMismatch},
+		{"rejected layout", starknetTestAccount, starknetFelts(r1, s1, big.NewInt(1), r2, s2, big.NewInt(7)), "", ReasonBadSignature},
+		{"offline failure", starknetTestAccount, starknetFelts(r1, s1), starknet.BigToHex(pubs[0]), ReasonBadSignature},
+		{"cairo 0 account", "0x2", starknetFelts(r0, s0, r1, s1, r2, s2, big.NewInt(1)), "", ""},
+		{"no account", "0x3", starknetFelts(r0, s0, r1, s1, r2, s2, big.NewInt(1)), "", ReasonAddressMismatch},
+	}
+	for _, test := range tests {
+		row := &CoinData{Coin: "STARKNET", SnapshotHeight: "100", Address: test.addr, Message: okxTestMessage, Sign1: test.sign, Script: test.keys}
+		result := verifier.Verify(row)
+		if result.Reason() != test.reason {
+			t.Errorf("%s: expected reason %q, got %q (%v)", test.name, test.reason, result.Reason(), result.Err)
+		}
+		if test.name != "offline failure" && result.Verifier != "+is_valid_signature" {
+			t.Errorf("%s: unexpected verifier %s", test.name, result.Verifier)
+		}
+	}
+}
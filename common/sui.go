@@ -0,0 +1,338 @@
+package common
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/dchest/blake2b"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secp_ecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// Sui signature scheme flags, the first byte of a serialized signature and of the address preimage.
+const (
+	SuiFlagEd25519   = 0x00
+	SuiFlagSecp256k1 = 0x01
+	SuiFlagSecp256r1 = 0x02
+	SuiFlagMultiSig  = 0x03
+)
+
+// SuiPersonalMessageIntent is the intent of signPersonalMessage: scope PersonalMessage, version 0, app Sui.
+var SuiPersonalMessageIntent = []byte{3, 0, 0}
+
+// maxSuiMultiSigKeys bounds the keys of a MultiSig public key, as Sui does.
+const maxSuiMultiSigKeys = 10
+
+// SuiPersonalMessageDigest returns the digest a Sui wallet signs for a personal message,
+// blake2b-256 of the intent and the BCS bytes of the message.
+func SuiPersonalMessageDigest(msg string) []byte {
+	var buf bytes.Buffer
+	buf.Write(SuiPersonalMessageIntent)
+	buf.Write(appendULEB128(nil, uint64(len(msg))))
+	buf.WriteString(msg)
+	digest := blake2b.Sum256(buf.Bytes())
+	return digest[:]
+}
+
+func appendULEB128(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// SuiPublicKey is a public key of a Sui signature scheme.
+type SuiPublicKey struct {
+	Flag byte
+	Key  []byte
+}
+
+// Address returns the Sui address of the key, blake2b-256 of the flag and the key.
+func (k SuiPublicKey) Address() string {
+	h := blake2b.Sum256(append([]byte{k.Flag}, k.Key...))
+	return "0x" + hex.EncodeToString(h[:])
+}
+
+// suiKeySize returns the public key size of a scheme.
+func suiKeySize(flag byte) (int, error) {
+	switch flag {
+	case SuiFlagEd25519:
+		return ed25519.PublicKeySize, nil
+	case SuiFlagSecp256k1, SuiFlagSecp256r1:
+		return 33, nil
+	}
+	return 0, fmt.Errorf("unsupported sui signature scheme %d", flag)
+}
+
+// Verify verifies a 64 byte signature of the digest. secp256k1 and secp256r1 sign the sha256 of
+// the digest and must be in the lower s form.
+func (k SuiPublicKey) Verify(digest, sig []byte) error {
+	if len(sig) != 64 {
+		return fmt.Errorf("invalid sui signature length %d", len(sig))
+	}
+	hash := sha256.Sum256(digest)
+	switch k.Flag {
+	case SuiFlagEd25519:
+		if ed25519.Verify(k.Key, digest, sig) {
+			return nil
+		}
+	case SuiFlagSecp256k1:
+		pub, err := secp256k1.ParsePubKey(k.Key)
+		if err != nil {
+			return fmt.Errorf("invalid secp256k1 public key: %v", err)
+		}
+		var r, s secp256k1.ModNScalar
+		if r.SetByteSlice(sig[:32]) || s.SetByteSlice(sig[32:]) || s.IsOverHalfOrder() {
+			return errors.New("secp256k1 signature is out of range or not in the lower s form")
+		}
+		if secp_ecdsa.NewSignature(&r, &s).Verify(hash[:], pub) {
+			return nil
+		}
+	case SuiFlagSecp256r1:
+		curve := elliptic.P256()
+		x, y := elliptic.UnmarshalCompressed(curve, k.Key)
+		if x == nil {
+			return errors.New("invalid secp256r1 public key")
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if s.Cmp(new(big.Int).Rsh(curve.Params().N, 1)) > 0 {
+			return errors.New("secp256r1 signature is not in the lower s form")
+		}
+		if ecdsa.Verify(&ecdsa.PublicKey{Curve: curve, X: x, Y: y}, hash[:], r, s) {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported sui signature scheme %d", k.Flag)
+	}
+	return fmt.Errorf("sui %s signature verification failed", suiSchemeName(k.Flag))
+}
+
+func suiSchemeName(flag byte) string {
+	switch flag {
+	case SuiFlagEd25519:
+		return "ed25519"
+	case SuiFlagSecp256k1:
+		return "secp256k1"
+	case SuiFlagSecp256r1:
+		return "secp256r1"
+	case SuiFlagMultiSig:
+		return "multisig"
+	}
+	return fmt.Sprintf("scheme %d", flag)
+}
+
+// SuiMultiSig is a Sui MultiSig: the signatures of the keys set in the bitmap, and the weighted
+// keys and threshold its address is derived from.
+type SuiMultiSig struct {
+	Sigs      []SuiSignaturePart
+	Bitmap    uint16
+	Keys      []SuiPublicKey
+	Weights   []uint8
+	Threshold uint16
+}
+
+// SuiSignaturePart is a compressed signature of a MultiSig, its scheme and 64 bytes.
+type SuiSignaturePart struct {
+	Flag byte
+	Sig  []byte
+}
+
+// Address returns the address of the MultiSig public key: blake2b-256 of the multisig flag, the
+// threshold and every flag, key and weight.
+func (m *SuiMultiSig) Address() string {
+	b := []byte{SuiFlagMultiSig}
+	b = append(b, byte(m.Threshold), byte(m.Threshold>>8))
+	for i, k := range m.Keys {
+		b = append(append(append(b, k.Flag), k.Key...), m.Weights[i])
+	}
+	h := blake2b.Sum256(b)
+	return "0x" + hex.EncodeToString(h[:])
+}
+
+// Quorum returns the threshold of the total weight, e.g. 2-of-3.
+func (m *SuiMultiSig) Quorum() string {
+	total := 0
+	for _, w := range m.Weights {
+		total += int(w)
+	}
+	return fmt.Sprintf("%d-of-%d", m.Threshold, total)
+}
+
+// Verify verifies every signature with the key of its bitmap bit, and that their weight meets
+// the threshold.
+func (m *SuiMultiSig) Verify(digest []byte) error {
+	weight, sig := 0, 0
+	for i := range m.Keys {
+		if m.Bitmap&(1<<uint(i)) == 0 {
+			continue
+		}
+		if sig == len(m.Sigs) {
+			return errors.New("sui multisig bitmap has more keys than signatures")
+		}
+		part := m.Sigs[sig]
+		sig++
+		if part.Flag != m.Keys[i].Flag {
+			return fmt.Errorf("sui multisig signature %d is not of the scheme of key %d", sig, i)
+		}
+		if err := m.Keys[i].Verify(digest, part.Sig); err != nil {
+			return fmt.Errorf("sui multisig key %d: %w", i, err)
+		}
+		weight += int(m.Weights[i])
+	}
+	if sig != len(m.Sigs) || m.Bitmap>>uint(len(m.Keys)) != 0 {
+		return errors.New("sui multisig bitmap does not match its signatures")
+	}
+	if weight < int(m.Threshold) {
+		return withReason(ReasonBelowThreshold, fmt.Errorf("sui multisig signatures weigh %d, below the threshold %d", weight, m.Threshold))
+	}
+	return nil
+}
+
+// bcsReader reads the BCS encoding of a Sui signature.
+type bcsReader struct {
+	b   []byte
+	err error
+}
+
+func (r *bcsReader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || n > len(r.b) {
+		if r.err == nil {
+			r.err = errors.New("sui multisig is truncated")
+		}
+		return make([]byte, n)
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *bcsReader) uleb128() int {
+	v := uint64(0)
+	for shift := uint(0); shift < 32; shift += 7 {
+		b := r.bytes(1)[0]
+		v |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return int(v)
+		}
+	}
+	if r.err == nil {
+		r.err = errors.New("sui multisig length overflows")
+	}
+	return 0
+}
+
+func (r *bcsReader) u16() uint16 {
+	return binary.LittleEndian.Uint16(r.bytes(2))
+}
+
+// ParseSuiMultiSig decodes the BCS of a MultiSig, the serialized signature without its flag.
+func ParseSuiMultiSig(b []byte) (*SuiMultiSig, error) {
+	r := &bcsReader{b: b}
+	m := &SuiMultiSig{}
+	n := r.uleb128()
+	if n > maxSuiMultiSigKeys {
+		return nil, fmt.Errorf("sui multisig has %d signatures", n)
+	}
+	for i := 0; i < n && r.err == nil; i++ {
+		flag := byte(r.uleb128())
+		if flag > SuiFlagSecp256r1 {
+			return nil, fmt.Errorf("unsupported sui multisig signature scheme %d", flag)
+		}
+		m.Sigs = append(m.Sigs, SuiSignaturePart{Flag: flag, Sig: r.bytes(64)})
+	}
+	m.Bitmap = r.u16()
+	n = r.uleb128()
+	if n == 0 || n > maxSuiMultiSigKeys {
+		return nil, fmt.Errorf("sui multisig has %d keys", n)
+	}
+	for i := 0; i < n && r.err == nil; i++ {
+		flag := byte(r.uleb128())
+		size, err := suiKeySize(flag)
+		if err != nil {
+			return nil, err
+		}
+		m.Keys = append(m.Keys, SuiPublicKey{Flag: flag, Key: r.bytes(size)})
+		m.Weights = append(m.Weights, r.bytes(1)[0])
+	}
+	m.Threshold = r.u16()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.b) != 0 {
+		return nil, fmt.Errorf("sui multisig has %d trailing bytes", len(r.b))
+	}
+	return m, nil
+}
+
+// isSuiSerializedSignature reports whether the signature column holds a Sui serialized signature
+// in base64, flag || signature || public key or a MultiSig, rather than an ed25519 signature.
+func isSuiSerializedSignature(sign string) bool {
+	if b, err := Decode(sign); err == nil && len(b) == ed25519.SignatureSize {
+		return false
+	}
+	_, err := base64.StdEncoding.DecodeString(strings.TrimSpace(sign))
+	return err == nil
+}
+
+// VerifySuiPersonalMessage verifies a serialized signature of signPersonalMessage for the address,
+// and returns the m-of-n weight of a MultiSig.
+func VerifySuiPersonalMessage(addr, msg, sign string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(sign))
+	if err != nil || len(b) == 0 {
+		return "", withReason(ReasonBadSignature, fmt.Errorf("invalid sui signature %q", sign))
+	}
+	digest := SuiPersonalMessageDigest(msg)
+	var signer, quorum string
+	if b[0] == SuiFlagMultiSig {
+		m, err := ParseSuiMultiSig(b[1:])
+		if err != nil {
+			return "", withReason(ReasonBadSignature, err)
+		}
+		signer, quorum = m.Address(), m.Quorum()
+		if !strings.EqualFold(signer, addr) {
+			return quorum, withReason(ReasonAddressMismatch, fmt.Errorf("sui multisig address %s is not %s", signer, addr))
+		}
+		return quorum, m.Verify(digest)
+	}
+	size, err := suiKeySize(b[0])
+	if err != nil {
+		return "", withReason(ReasonBadSignature, err)
+	}
+	if len(b) != 1+64+size {
+		return "", withReason(ReasonBadSignature, fmt.Errorf("invalid sui %s signature length %d", suiSchemeName(b[0]), len(b)))
+	}
+	key := SuiPublicKey{Flag: b[0], Key: b[65:]}
+	if err = key.Verify(digest, b[1:65]); err != nil {
+		return "", err
+	}
+	if signer = key.Address(); !strings.EqualFold(signer, addr) {
+		return "", withReason(ReasonAddressMismatch, fmt.Errorf("sui %s key address %s is not %s", suiSchemeName(key.Flag), signer, addr))
+	}
+	return "", nil
+}
+
+// verifySuiRow verifies a SUI row signed with the PoR message header by an ed25519 key, or a
+// serialized signature of the personal message by a single key or a MultiSig.
+func verifySuiRow(row *CoinData) *SignatureResult {
+	result := &SignatureResult{Address: row.Address, Signer: SignerAddress}
+	if !isSuiSerializedSignature(row.Sign1) {
+		result.Err = VerifyEd25519Coin(row.Coin, row.Address, row.Message, row.Sign1, row.Script)
+		return result
+	}
+	result.Verifier = "+personal message"
+	if result.Quorum, result.Err = VerifySuiPersonalMessage(row.Address, row.Message, row.Sign1); result.Err != nil {
+		result.Err = fmt.Errorf("%w, coin:%s, addr:%s", result.Err, row.Coin, row.Address)
+	}
+	return result
+}
@@ -0,0 +1,147 @@
+package common
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/dchest/blake2b"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secp_ecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+func TestSuiPersonalMessageDigest(t *testing.T) {
+	expected := blake2b.Sum256(MustDecode("0x0300000548656c6c6f"))
+	if digest := SuiPersonalMessageDigest("Hello"); !bytes.Equal(digest, expected[:]) {
+		t.Fatalf("unexpected digest %x", digest)
+	}
+	if b := appendULEB128(nil, 300); !bytes.Equal(b, []byte{0xac, 0x02}) {
+		t.Fatalf("unexpected uleb128 %x", b)
+	}
+}
+
+// suiSigner signs Sui digests with a key of one scheme.
+type suiSigner struct {
+	pub  SuiPublicKey
+	sign func(digest []byte) []byte
+}
+
+func suiTestSigners(seed byte) []suiSigner {
+	edKey := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, 32))
+	k1Key := secp256k1.PrivKeyFromBytes(bytes.Repeat([]byte{seed}, 32))
+	r1Key, _ := ecdsa.GenerateKey(elliptic.P256(), bytes.NewReader(bytes.Repeat([]byte{seed}, 64)))
+	return []suiSigner{
+		{SuiPublicKey{SuiFlagEd25519, edKey.Public().(ed25519.PublicKey)}, func(digest []byte) []byte {
+			return ed25519.Sign(edKey, digest)
+		}},
+		{SuiPublicKey{SuiFlagSecp256k1, k1Key.PubKey().SerializeCompressed()}, func(digest []byte) []byte {
+			hash := sha256.Sum256(digest)
+			// the compact signature is recovery code || r || s, with s in the lower form
+			return secp_ecdsa.SignCompact(k1Key, hash[:], true)[1:]
+		}},
+		{SuiPublicKey{SuiFlagSecp256r1, elliptic.MarshalCompressed(elliptic.P256(), r1Key.X, r1Key.Y)}, func(digest []byte) []byte {
+			hash := sha256.Sum256(digest)
+			r, s, _ := ecdsa.Sign(bytes.NewReader(bytes.Repeat([]byte{seed}, 64)), r1Key, hash[:])
+			if n := elliptic.P256().Params().N; s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+				s.Sub(n, s)
+			}
+			sig := make([]byte, 64)
+			r.FillBytes(sig[:32])
+			s.FillBytes(sig[32:])
+			return sig
+		}},
+	}
+}
+
+// suiSerialize returns the serialized signature flag || signature || public key in base64.
+func suiSerialize(s suiSigner, msg string) string {
+	sig := append(append([]byte{s.pub.Flag}, s.sign(SuiPersonalMessageDigest(msg))...), s.pub.Key...)
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+// suiMultiSig returns the MultiSig of the signers with weight 1 each, signed by the keys in the bitmap.
+func suiMultiSig(signers []suiSigner, threshold uint16, bitmap uint16, msg string) (string, string) {
+	m := &SuiMultiSig{Bitmap: bitmap, Threshold: threshold}
+	var sigs []byte
+	count := byte(0)
+	for i, s := range signers {
+		m.Keys = append(m.Keys, s.pub)
+		m.Weights = append(m.Weights, 1)
+		if bitmap&(1<<uint(i)) != 0 {
+			sigs = append(append(sigs, s.pub.Flag), s.sign(SuiPersonalMessageDigest(msg))...)
+			count++
+		}
+	}
+	b := append([]byte{SuiFlagMultiSig, count}, sigs...)
+	b = append(b, byte(bitmap), byte(bitmap>>8), byte(len(signers)))
+	for _, s := range signers {
+		b = append(append(append(b, s.pub.Flag), s.pub.Key...), 1)
+	}
+	b = append(b, byte(threshold), byte(threshold>>8))
+	return base64.StdEncoding.EncodeToString(b), m.Address()
+}
+
+func TestVerifySuiRow(t *testing.T) {
+	signers := suiTestSigners(1)
+	others := suiTestSigners(2)
+	multisig, multisigAddr := suiMultiSig(signers, 2, 0b101, okxTestMessage)
+	single, _ := suiMultiSig(signers, 2, 0b010, okxTestMessage)
+	mixed := []suiSigner{signers[0], others[1], signers[2]}
+	wrongKey, _ := suiMultiSig(mixed, 2, 0b011, okxTestMessage)
+
+	edKey := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, 32))
+	legacy := Encode(ed25519.Sign(edKey, HashEd25519Msg(OKXMessageSignatureHeader, okxTestMessage)))
+	highS := signers[1].sign(SuiPersonalMessageDigest(okxTestMessage))
+	var s secp256k1.ModNScalar
+	s.SetByteSlice(highS[32:])
+	s.Negate()
+	sBytes := s.Bytes()
+	highS = append(append(append([]byte{SuiFlagSecp256k1}, highS[:32]...), sBytes[:]...), signers[1].pub.Key...)
+
+	tests := []struct {
+		name, addr, sign, script string
+		verifier, quorum, reason string
+	}{
+		{"legacy", signers[0].pub.Address(), legacy, hex.EncodeToString(signers[0].pub.Key), "", "", ""},
+		{"ed25519", signers[0].pub.Address(), suiSerialize(signers[0], okxTestMessage), "", "+personal message", "", ""},
+		{"secp256k1", signers[1].pub.Address(), suiSerialize(signers[1], okxTestMessage), "", "+personal message", "", ""},
+		{"secp256r1", signers[2].pub.Address(), suiSerialize(signers[2], okxTestMessage), "", "+personal message", "", ""},
+		{"multisig", multisigAddr, multisig, "", "+personal message", "2-of-3", ""},
+		{"other message", signers[1].pub.Address(), suiSerialize(signers[1], "OKC_DTT_AUP2024"), "", "+personal message", "", ReasonBadSignature},
+		{"other key", signers[1].pub.Address(), suiSerialize(others[1], okxTestMessage), "", "+personal message", "", ReasonAddressMismatch},
+		{"high s", signers[1].pub.Address(), base64.StdEncoding.EncodeToString(highS), "", "+personal message", "", ReasonBadSignature},
+		{"multisig below threshold", multisigAddr, single, "", "+personal message", "2-of-3", ReasonBelowThreshold},
+		{"multisig of other keys", multisigAddr, wrongKey, "", "+personal message", "2-of-3", ReasonAddressMismatch},
+	}
+	for _, test := range tests {
+		row := &CoinData{Coin: "SUI", Address: test.addr, Message: okxTestMessage, Sign1: test.sign, Script: test.script}
+		result := VerifyRowSignature(row)
+		if result.Reason() != test.reason || result.Verifier != Ed25519CoinType+test.verifier || result.Quorum != test.quorum {
+			t.Errorf("%s: expected %q %q %q, got %q %q %q (%v)", test.name, test.verifier, test.quorum, test.reason, result.Verifier, result.Quorum, result.Reason(), result.Err)
+		}
+	}
+}
+
+func TestParseSuiMultiSig(t *testing.T) {
+	multisig, addr := suiMultiSig(suiTestSigners(3), 2, 0b011, okxTestMessage)
+	b, _ := base64.StdEncoding.DecodeString(multisig)
+	m, err := ParseSuiMultiSig(b[1:])
+	if err != nil || m.Address() != addr || len(m.Sigs) != 2 || m.Bitmap != 0b011 || m.Threshold != 2 {
+		t.Fatalf("unexpected multisig %+v %v", m, err)
+	}
+	for _, bad := range [][]byte{nil, b[1 : len(b)-1], append(b[1:len(b):len(b)], 0)} {
+		if _, err = ParseSuiMultiSig(bad); err == nil {
+			t.Errorf("expected %x to fail", bad)
+		}
+	}
+	m.Bitmap = 0b111
+	if err = m.Verify(SuiPersonalMessageDigest(okxTestMessage)); err == nil {
+		t.Fatal("expected a bitmap of more keys than signatures to fail")
+	}
+}
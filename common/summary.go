@@ -0,0 +1,127 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+const porSummaryAllSuffix = "(ALL)"
+
+// PorSummaryRow is one aggregate row of the summary section at the top of a PoR file,
+// e.g. "ETH(ALL),-,6" for every ETH network or "USDT-TRC20,46095694,5436.9044" for one network.
+type PorSummaryRow struct {
+	Line           int
+	Coin           string
+	All            bool
+	SnapshotHeight string
+	Amount         decimal.Decimal
+	Raw            string
+}
+
+// Places returns the number of decimal places the amount is published with.
+func (s *PorSummaryRow) Places() int32 {
+	if exp := s.Amount.Exponent(); exp < 0 {
+		return -exp
+	}
+	return 0
+}
+
+// Tolerance returns half a unit of the last decimal place the amount is published with, e.g. 0.5
+// for "64" and 0.00005 for "0.3569". A rounded amount is that close to the exact sum.
+func (s *PorSummaryRow) Tolerance() decimal.Decimal {
+	return decimal.New(5, -s.Places()-1)
+}
+
+// Name returns the coin as written in the file, e.g. "ETH(ALL)".
+func (s *PorSummaryRow) Name() string {
+	if s.All {
+		return s.Coin + porSummaryAllSuffix
+	}
+	return s.Coin
+}
+
+// PorSummary is the typed summary section of a PoR file.
+type PorSummary struct {
+	Rows []*PorSummaryRow
+}
+
+// PorSummaryMismatch is a summary row that does not match the sum of its detail rows.
+type PorSummaryMismatch struct {
+	Row         *PorSummaryRow
+	DetailTotal decimal.Decimal
+	// Tolerance is the difference the comparison accepted, zero for an exact comparison
+	Tolerance decimal.Decimal
+}
+
+func (m *PorSummaryMismatch) Error() string {
+	if m.Tolerance.IsZero() {
+		return fmt.Sprintf("summary row %s at line %d is %s, but the detail rows sum to %s",
+			m.Row.Name(), m.Row.Line, m.Row.Amount.String(), m.DetailTotal.String())
+	}
+	return fmt.Sprintf("summary row %s at line %d is %s, but the detail rows sum to %s, more than %s apart",
+		m.Row.Name(), m.Row.Line, m.Row.Amount.String(), m.DetailTotal.String(), m.Tolerance.String())
+}
+
+// ParsePorSummaryRow parses a "coin,snapshot height,amount" summary row.
+func ParsePorSummaryRow(line int, fields []string) (*PorSummaryRow, error) {
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("summary line %d has %d columns, expected coin,snapshot height,amount", line, len(fields))
+	}
+	coin := strings.ToUpper(strings.TrimSpace(cleanout(strings.TrimSpace(fields[0]))))
+	row := &PorSummaryRow{
+		Line:           line,
+		Coin:           coin,
+		SnapshotHeight: strings.TrimSpace(cleanout(strings.TrimSpace(fields[1]))),
+		Raw:            strings.Join(fields, ","),
+	}
+	if strings.HasSuffix(coin, porSummaryAllSuffix) {
+		row.All = true
+		row.Coin = strings.TrimSpace(strings.TrimSuffix(coin, porSummaryAllSuffix))
+	}
+	if row.Coin == "" {
+		return nil, fmt.Errorf("summary line %d has an empty coin", line)
+	}
+	amount, err := decimal.NewFromString(strings.TrimSpace(cleanout(strings.TrimSpace(fields[2]))))
+	if err != nil {
+		return nil, fmt.Errorf("summary line %d has an invalid amount %q", line, fields[2])
+	}
+	row.Amount = amount
+	return row, nil
+}
+
+// Add appends a summary row.
+func (s *PorSummary) Add(row *PorSummaryRow) {
+	s.Rows = append(s.Rows, row)
+}
+
+// Reconcile compares every summary row with the detail rows. coinTotals holds the exact sum of
+// the detail rows per coin column value. An "X(ALL)" row is compared with the sum over every coin
+// whose PorCoinUnitMap unit is X, any other row with the sum of its own coin. The summary amounts
+// are rounded, so the sum may differ from an amount by its Tolerance, half a unit of the last
+// decimal place it is published with: "ETH,-,64" accepts a sum from 63.5 to 64.5. An exact
+// comparison accepts no difference.
+func (s *PorSummary) Reconcile(coinTotals map[string]decimal.Decimal, exact bool) []*PorSummaryMismatch {
+	mismatches := make([]*PorSummaryMismatch, 0)
+	for _, row := range s.Rows {
+		total := decimal.Zero
+		if row.All {
+			for coin, balance := range coinTotals {
+				if unit, exist := PorCoinUnitMap[coin]; exist && unit == row.Coin {
+					total = total.Add(balance)
+				}
+			}
+		} else {
+			total = coinTotals[row.Coin]
+		}
+		tolerance := decimal.Zero
+		if !exact {
+			tolerance = row.Tolerance()
+		}
+		if total.Sub(row.Amount).Abs().GreaterThan(tolerance) {
+			mismatches = append(mismatches, &PorSummaryMismatch{Row: row, DetailTotal: total, Tolerance: tolerance})
+		}
+	}
+	return mismatches
+}
@@ -0,0 +1,70 @@
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestPorSummaryReconcile(t *testing.T) {
+	summary := &PorSummary{}
+	for i, line := range []string{
+		"ETH(ALL),-,0.3569",
+		"USDT(ALL),-,5569",
+		"USDT-TRC20,46095694,5436.9044",
+		"ETH,16005122, 0.1",
+	} {
+		row, err := ParsePorSummaryRow(i+2, strings.Split(line, ","))
+		if err != nil {
+			t.Fatal(err)
+		}
+		summary.Add(row)
+	}
+
+	coinTotals := map[string]decimal.Decimal{
+		"ETH":          decimal.RequireFromString("0.148960774325814037"),
+		"ETH-ARBITRUM": decimal.RequireFromString("0.207920483175044365"),
+		"USDT-TRC20":   decimal.RequireFromString("5436.90441"),
+		"USDT-TON":     decimal.RequireFromString("132.0955"),
+	}
+	if mismatches := summary.Reconcile(coinTotals, false); len(mismatches) != 0 {
+		t.Fatalf("every row should reconcile, got %v", mismatches)
+	}
+
+	// a change at the fourth decimal breaks the per-network row, the (ALL) row is published in whole units
+	coinTotals["USDT-TRC20"] = decimal.RequireFromString("5436.90451")
+	mismatches := summary.Reconcile(coinTotals, false)
+	if len(mismatches) != 1 || mismatches[0].Row.Name() != "USDT-TRC20" || mismatches[0].Row.Line != 4 {
+		t.Fatalf("mismatches = %v", mismatches)
+	}
+	coinTotals["USDT-TON"] = decimal.RequireFromString("133")
+	if mismatches = summary.Reconcile(coinTotals, false); len(mismatches) != 2 || mismatches[0].Row.Name() != "USDT(ALL)" {
+		t.Fatalf("mismatches = %v", mismatches)
+	}
+	// an amount published in whole units is half a unit from the sum at most, or equal to it when exact
+	staking, err := ParsePorSummaryRow(2, strings.Split("ETH,-,64", ","))
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary = &PorSummary{Rows: []*PorSummaryRow{staking}}
+	coinTotals = map[string]decimal.Decimal{"ETH": decimal.RequireFromString("64.06")}
+	if mismatches = summary.Reconcile(coinTotals, false); len(mismatches) != 0 || staking.Tolerance().String() != "0.5" {
+		t.Fatalf("mismatches = %v, tolerance = %s", mismatches, staking.Tolerance())
+	}
+	if mismatches = summary.Reconcile(coinTotals, true); len(mismatches) != 1 || !mismatches[0].Tolerance.IsZero() {
+		t.Fatalf("expected the exact comparison to fail, got %v", mismatches)
+	}
+	coinTotals["ETH"] = decimal.RequireFromString("64.6")
+	if mismatches = summary.Reconcile(coinTotals, false); len(mismatches) != 1 || !strings.Contains(mismatches[0].Error(), "more than 0.5 apart") {
+		t.Fatalf("mismatches = %v", mismatches)
+	}
+}
+
+func TestParsePorSummaryRowInvalid(t *testing.T) {
+	for _, line := range []string{"ETH(ALL),-", "(ALL),-,1", "ETH,-,abc"} {
+		if _, err := ParsePorSummaryRow(1, strings.Split(line, ",")); err == nil {
+			t.Errorf("%q should not parse", line)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package common
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xssnick/tonutils-go/address"
+	tonWallet "github.com/xssnick/tonutils-go/ton/wallet"
+)
+
+// TonWalletContract is a wallet contract whose address is derived from the public key, the
+// contract version and a subwallet id.
+type TonWalletContract struct {
+	Name    string
+	Version tonWallet.VersionConfig
+	// Subwallets are the ids tried in addition to the configured ranges
+	Subwallets []uint32
+	// MaxSubwallet bounds the configured ids, the V5 wallet id holds a 15 bit subwallet number
+	MaxSubwallet uint32
+}
+
+// TonWalletContracts is the catalogue of the wallet contracts a TON address is identified with,
+// each with the default subwallet of the wallet apps.
+var TonWalletContracts = []TonWalletContract{
+	{Name: "v3r1", Version: tonWallet.V3R1, Subwallets: []uint32{tonWallet.DefaultSubwallet}, MaxSubwallet: 1<<32 - 1},
+	{Name: "v3r2", Version: tonWallet.V3R2, Subwallets: []uint32{tonWallet.DefaultSubwallet}, MaxSubwallet: 1<<32 - 1},
+	{Name: "v4r2", Version: tonWallet.V4R2, Subwallets: []uint32{tonWallet.DefaultSubwallet}, MaxSubwallet: 1<<32 - 1},
+	{Name: "v5r1", Version: tonWallet.ConfigV5R1Final{NetworkGlobalID: tonWallet.MainnetGlobalID}, Subwallets: []uint32{0}, MaxSubwallet: 1<<15 - 1},
+	{Name: "highload v2r2", Version: tonWallet.HighloadV2R2, Subwallets: []uint32{tonWallet.DefaultSubwallet}, MaxSubwallet: 1<<32 - 1},
+	{Name: "highload v3", Version: tonWallet.ConfigHighloadV3{MessageTTL: 60 * 60 * 12}, Subwallets: []uint32{4269}, MaxSubwallet: 1<<32 - 1},
+}
+
+// TonSubwalletRange is an inclusive range of subwallet ids.
+type TonSubwalletRange struct {
+	From, To uint32
+}
+
+// maxTonSubwallets bounds the configured ids, every id is tried with every contract of a row.
+const maxTonSubwallets = 4096
+
+var tonSubwallets = struct {
+	sync.RWMutex
+	ranges []TonSubwalletRange
+}{}
+
+// ParseTonSubwalletRanges reads comma separated ids and ranges, e.g. "0-9,4269".
+func ParseTonSubwalletRanges(s string) ([]TonSubwalletRange, error) {
+	var ranges []TonSubwalletRange
+	total := uint64(0)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to := part, part
+		if i := strings.Index(part, "-"); i > 0 {
+			from, to = part[:i], part[i+1:]
+		}
+		f, err := strconv.ParseUint(strings.TrimSpace(from), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subwallet range %q", part)
+		}
+		t, err := strconv.ParseUint(strings.TrimSpace(to), 10, 32)
+		if err != nil || t < f {
+			return nil, fmt.Errorf("invalid subwallet range %q", part)
+		}
+		if total += t - f + 1; total > maxTonSubwallets {
+			return nil, fmt.Errorf("subwallet ranges %q hold more than %d ids", s, maxTonSubwallets)
+		}
+		ranges = append(ranges, TonSubwalletRange{From: uint32(f), To: uint32(t)})
+	}
+	return ranges, nil
+}
+
+// SetTonSubwalletRanges sets the subwallet ids tried with every wallet contract, besides its
+// defaults. Call it before the rows are verified.
+func SetTonSubwalletRanges(ranges []TonSubwalletRange) {
+	tonSubwallets.Lock()
+	defer tonSubwallets.Unlock()
+	tonSubwallets.ranges = ranges
+}
+
+// subwallets returns the default and the configured subwallet ids of the contract.
+func (c TonWalletContract) subwallets() []uint32 {
+	tonSubwallets.RLock()
+	defer tonSubwallets.RUnlock()
+	ids := append([]uint32{}, c.Subwallets...)
+	for _, r := range tonSubwallets.ranges {
+		for id := uint64(r.From); id <= uint64(r.To) && id <= uint64(c.MaxSubwallet); id++ {
+			ids = append(ids, uint32(id))
+		}
+	}
+	return ids
+}
+
+// TonWallet is the wallet contract and subwallet that produce a TON address.
+type TonWallet struct {
+	Contract  string
+	Subwallet uint32
+}
+
+// ParseTonAddress reads a user friendly address, bounceable or not, or a raw 0:hex address.
+func ParseTonAddress(addr string) (*address.Address, error) {
+	if strings.Contains(addr, ":") {
+		return address.ParseRawAddr(addr)
+	}
+	return address.ParseAddr(addr)
+}
+
+// IdentifyTonWallet returns the wallet contract of the catalogue whose address, for the public
+// key, is addr.
+func IdentifyTonWallet(pubkey ed25519.PublicKey, addr string) (*TonWallet, error) {
+	if len(pubkey) != ed25519.PublicKeySize {
+		return nil, withReason(ReasonMissingScript, fmt.Errorf("invalid TON public key length %d", len(pubkey)))
+	}
+	want, err := ParseTonAddress(addr)
+	if err != nil {
+		return nil, withReason(ReasonUndecodableAddress, fmt.Errorf("invalid TON address %s: %v", addr, err))
+	}
+	var tried []string
+	for _, contract := range TonWalletContracts {
+		for _, subwallet := range contract.subwallets() {
+			got, err := tonWallet.AddressFromPubKey(pubkey, contract.Version, subwallet)
+			if err != nil {
+				return nil, fmt.Errorf("TON %s wallet address: %v", contract.Name, err)
+			}
+			if got.Workchain() == want.Workchain() && bytes.Equal(got.Data(), want.Data()) {
+				return &TonWallet{Contract: contract.Name, Subwallet: subwallet}, nil
+			}
+		}
+		tried = append(tried, contract.Name)
+	}
+	return nil, withReason(ReasonAddressMismatch, fmt.Errorf("no wallet contract of the public key has the address %s, tried %s", addr, strings.Join(tried, ", ")))
+}
+
+// TonProofItemPrefix and TonConnectPrefix are the prefixes of a TON Connect ton_proof message and
+// of the digest its wallet signs.
+const (
+	TonProofItemPrefix = "ton-proof-item-v2/"
+	TonConnectPrefix   = "ton-connect"
+)
+
+// TonProof is the ton_proof reply of a TON Connect wallet, the payload is the PoR message.
+type TonProof struct {
+	Timestamp int64 `json:"timestamp"`
+	Domain    struct {
+		LengthBytes uint32 `json:"lengthBytes"`
+		Value       string `json:"value"`
+	} `json:"domain"`
+	Signature string `json:"signature"`
+	Payload   string `json:"payload"`
+}
+
+// ParseTonProof reads a ton_proof, the proof object or the {"name":"ton_proof","proof":{...}} item.
+func ParseTonProof(s string) (*TonProof, error) {
+	var item struct {
+		Name  string    `json:"name"`
+		Proof *TonProof `json:"proof"`
+		TonProof
+	}
+	if err := json.Unmarshal([]byte(s), &item); err != nil {
+		return nil, fmt.Errorf("invalid ton_proof: %v", err)
+	}
+	if item.Proof != nil {
+		return item.Proof, nil
+	}
+	return &item.TonProof, nil
+}
+
+// IsTonProof reports whether the signature column holds a ton_proof rather than a signature.
+func IsTonProof(sign string) bool {
+	return strings.HasPrefix(strings.TrimSpace(sign), "{")
+}
+
+// Message returns the ton_proof message of the wallet address:
+// "ton-proof-item-v2/" ++ workchain ++ hash ++ domain length ++ domain ++ timestamp ++ payload.
+func (p *TonProof) Message(addr *address.Address) []byte {
+	var msg bytes.Buffer
+	msg.WriteString(TonProofItemPrefix)
+	_ = binary.Write(&msg, binary.BigEndian, addr.Workchain())
+	msg.Write(addr.Data())
+	_ = binary.Write(&msg, binary.LittleEndian, p.Domain.LengthBytes)
+	msg.WriteString(p.Domain.Value)
+	_ = binary.Write(&msg, binary.LittleEndian, uint64(p.Timestamp))
+	msg.WriteString(p.Payload)
+	return msg.Bytes()
+}
+
+// Digest returns what the wallet signs, sha256(0xffff ++ "ton-connect" ++ sha256(message)).
+func (p *TonProof) Digest(addr *address.Address) []byte {
+	msgHash := sha256.Sum256(p.Message(addr))
+	digest := sha256.Sum256(append(append([]byte{0xff, 0xff}, TonConnectPrefix...), msgHash[:]...))
+	return digest[:]
+}
+
+// TonProofPolicy binds a ton_proof to the domains it may be signed for and to a time window.
+type TonProofPolicy struct {
+	// Domains are accepted with their subdomains
+	Domains []string
+	// NotBefore and NotAfter bound the proof timestamp, a zero time is unbounded
+	NotBefore, NotAfter time.Time
+}
+
+// DefaultTonProofPolicy accepts the proofs signed for okx.com.
+var DefaultTonProofPolicy = TonProofPolicy{Domains: []string{"okx.com"}}
+
+var tonProofPolicy = struct {
+	sync.RWMutex
+	policy TonProofPolicy
+}{policy: DefaultTonProofPolicy}
+
+// SetTonProofPolicy sets the bindings the ton_proof rows are verified with. Call it before the
+// rows are verified.
+func SetTonProofPolicy(policy TonProofPolicy) {
+	tonProofPolicy.Lock()
+	defer tonProofPolicy.Unlock()
+	tonProofPolicy.policy = policy
+}
+
+// check returns the error of a proof signed for another domain or outside the window.
+func (policy TonProofPolicy) check(proof *TonProof) error {
+	if int(proof.Domain.LengthBytes) != len(proof.Domain.Value) {
+		return withReason(ReasonBadSignature, fmt.Errorf("ton_proof domain %q has length %d", proof.Domain.Value, proof.Domain.LengthBytes))
+	}
+	domain := strings.ToLower(proof.Domain.Value)
+	bound := false
+	for _, d := range policy.Domains {
+		d = strings.ToLower(d)
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			bound = true
+			break
+		}
+	}
+	if !bound {
+		return withReason(ReasonProofBinding, fmt.Errorf("ton_proof is signed for domain %s, not %s", proof.Domain.Value, strings.Join(policy.Domains, ", ")))
+	}
+	signedAt := time.Unix(proof.Timestamp, 0).UTC()
+	if proof.Timestamp <= 0 || !policy.NotBefore.IsZero() && signedAt.Before(policy.NotBefore) || !policy.NotAfter.IsZero() && signedAt.After(policy.NotAfter) {
+		return withReason(ReasonProofBinding, fmt.Errorf("ton_proof is signed at %s, outside the snapshot window", signedAt.Format(time.RFC3339)))
+	}
+	return nil
+}
+
+// VerifyTonProof verifies a ton_proof of the PoR message: the payload is the message, the proof
+// is bound to the policy's domains and window, the public key signs it and its wallet contract
+// has the address.
+func VerifyTonProof(addr, msg, sign, pubkey string) error {
+	proof, err := ParseTonProof(sign)
+	if err != nil {
+		return withReason(ReasonBadSignature, err)
+	}
+	if proof.Payload != msg {
+		return withReason(ReasonMessageMismatch, fmt.Errorf("ton_proof payload %q is not the message %q", proof.Payload, msg))
+	}
+	tonProofPolicy.RLock()
+	policy := tonProofPolicy.policy
+	tonProofPolicy.RUnlock()
+	if err = policy.check(proof); err != nil {
+		return err
+	}
+	wallet, err := ParseTonAddress(addr)
+	if err != nil {
+		return withReason(ReasonUndecodableAddress, fmt.Errorf("invalid TON address %s: %v", addr, err))
+	}
+	signature, err := base64.StdEncoding.DecodeString(proof.Signature)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return withReason(ReasonBadSignature, fmt.Errorf("invalid ton_proof signature %q", proof.Signature))
+	}
+	pub, _ := Decode(pubkey)
+	if len(pub) != ed25519.PublicKeySize {
+		return withReason(ReasonMissingScript, errors.New("ton_proof needs the public key of the wallet"))
+	}
+	if !ed25519.Verify(pub, proof.Digest(wallet), signature) {
+		return fmt.Errorf("ton_proof signature verification failed, addr:%s", addr)
+	}
+	_, err = IdentifyTonWallet(pub, addr)
+	return err
+}
+
+// verifyTonRow verifies a TON row signed with the PoR message header, or a ton_proof of the
+// message from a TON Connect wallet.
+func verifyTonRow(row *CoinData) *SignatureResult {
+	if IsTonProof(row.Sign1) {
+		return &SignatureResult{Address: row.Address, Signer: SignerAddress, Verifier: "+ton_proof", Err: VerifyTonProof(row.Address, row.Message, row.Sign1, row.Script)}
+	}
+	return &SignatureResult{Address: row.Address, Signer: SignerAddress, Err: VerifyEd25519Coin(row.Coin, row.Address, row.Message, row.Sign1, row.Script)}
+}
@@ -0,0 +1,113 @@
+package common
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	tonWallet "github.com/xssnick/tonutils-go/ton/wallet"
+)
+
+func TestIdentifyTonWallet(t *testing.T) {
+	// the TONCOIN-NEW vector of crypto_test.go
+	wallet, err := IdentifyTonWallet(MustDecode("0x3d2696e3d5cbc9047b338e6a56552db1d43ca6e063bc7aa667b18005984372d2"), "EQA5rifVSCc8qQfpCXvq4zJGJPsA0EPCDoWdtg234INftsWj")
+	if err != nil || wallet.Contract != "v3r2" || wallet.Subwallet != tonWallet.DefaultSubwallet {
+		t.Fatalf("expected the v3r2 wallet, got %+v %v", wallet, err)
+	}
+	// the final W5 wallet id of mainnet, the beta layout stores the network and workchain apart
+	if id := (tonWallet.V5R1ID{NetworkGlobalID: tonWallet.MainnetGlobalID}).Serialized(); id != 2147483409 {
+		t.Fatalf("unexpected v5r1 wallet id %d", id)
+	}
+
+	key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, 32))
+	pub := key.Public().(ed25519.PublicKey)
+	for _, contract := range TonWalletContracts {
+		addr, _ := tonWallet.AddressFromPubKey(pub, contract.Version, contract.Subwallets[0])
+		for _, form := range []string{addr.String(), addr.Bounce(false).String(), fmt.Sprintf("%d:%x", addr.Workchain(), addr.Data())} {
+			if wallet, err = IdentifyTonWallet(pub, form); err != nil || wallet.Contract != contract.Name {
+				t.Errorf("%s %s: expected the contract, got %+v %v", contract.Name, form, wallet, err)
+			}
+		}
+	}
+
+	custom, _ := tonWallet.AddressFromPubKey(pub, tonWallet.V4R2, 42)
+	if _, err = IdentifyTonWallet(pub, custom.String()); FailureReason(err) != ReasonAddressMismatch {
+		t.Fatalf("expected subwallet 42 to be unknown, got %v", err)
+	}
+	ranges, err := ParseTonSubwalletRanges("0-9, 40-45,4269")
+	if err != nil || len(ranges) != 3 || ranges[1] != (TonSubwalletRange{From: 40, To: 45}) {
+		t.Fatalf("unexpected ranges %v %v", ranges, err)
+	}
+	SetTonSubwalletRanges(ranges)
+	defer SetTonSubwalletRanges(nil)
+	if wallet, err = IdentifyTonWallet(pub, custom.String()); err != nil || *wallet != (TonWallet{Contract: "v4r2", Subwallet: 42}) {
+		t.Fatalf("expected the v4r2 subwallet 42, got %+v %v", wallet, err)
+	}
+	if _, err = IdentifyTonWallet(pub, "EQ-not-an-address"); FailureReason(err) != ReasonUndecodableAddress {
+		t.Fatalf("expected an undecodable address, got %v", err)
+	}
+
+	for _, s := range []string{"5-1", "a", "0-4096"} {
+		if _, err = ParseTonSubwalletRanges(s); err == nil {
+			t.Errorf("expected %q to fail", s)
+		}
+	}
+}
+
+// tonProofRow signs a ton_proof of the message for the v4r2 wallet of the key.
+func tonProofRow(key ed25519.PrivateKey, domain string, signedAt time.Time, payload string) *CoinData {
+	pub := key.Public().(ed25519.PublicKey)
+	addr, _ := tonWallet.AddressFromPubKey(pub, tonWallet.V4R2, tonWallet.DefaultSubwallet)
+	proof := &TonProof{Timestamp: signedAt.Unix(), Payload: payload}
+	proof.Domain.LengthBytes, proof.Domain.Value = uint32(len(domain)), domain
+	proof.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, proof.Digest(addr)))
+	sign, _ := json.Marshal(proof)
+	return &CoinData{Coin: "TONCOIN-NEW", Address: addr.String(), Message: okxTestMessage, Sign1: string(sign), Script: fmt.Sprintf("%x", pub)}
+}
+
+func TestVerifyTonProof(t *testing.T) {
+	key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, 32))
+	other := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{8}, 32))
+	signedAt := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	SetTonProofPolicy(TonProofPolicy{Domains: []string{"okx.com"}, NotBefore: signedAt.Add(-24 * time.Hour), NotAfter: signedAt.Add(24 * time.Hour)})
+	defer SetTonProofPolicy(DefaultTonProofPolicy)
+
+	wrapped := tonProofRow(key, "okx.com", signedAt, okxTestMessage)
+	wrapped.Sign1 = fmt.Sprintf(`{"name":"ton_proof","proof":%s}`, wrapped.Sign1)
+	badLength := tonProofRow(key, "okx.com", signedAt, okxTestMessage)
+	badLength.Sign1 = string(bytes.Replace([]byte(badLength.Sign1), []byte(`"lengthBytes":7`), []byte(`"lengthBytes":8`), 1))
+	otherWallet := tonProofRow(key, "okx.com", signedAt, okxTestMessage)
+	otherWallet.Address = tonProofRow(other, "okx.com", signedAt, okxTestMessage).Address
+	otherKey := tonProofRow(key, "okx.com", signedAt, okxTestMessage)
+	otherKey.Script = tonProofRow(other, "okx.com", signedAt, okxTestMessage).Script
+
+	tests := []struct {
+		name   string
+		row    *CoinData
+		reason string
+	}{
+		{"proof", tonProofRow(key, "okx.com", signedAt, okxTestMessage), ""},
+		{"subdomain", tonProofRow(key, "web3.okx.com", signedAt, okxTestMessage), ""},
+		{"ton_proof item", wrapped, ""},
+		{"other message", tonProofRow(key, "okx.com", signedAt, "OKC_DTT_AUP2024"), ReasonMessageMismatch},
+		{"other domain", tonProofRow(key, "notokx.com", signedAt, okxTestMessage), ReasonProofBinding},
+		{"before the window", tonProofRow(key, "okx.com", signedAt.Add(-48*time.Hour), okxTestMessage), ReasonProofBinding},
+		{"after the window", tonProofRow(key, "okx.com", signedAt.Add(48*time.Hour), okxTestMessage), ReasonProofBinding},
+		{"domain length", badLength, ReasonBadSignature},
+		{"signed for another wallet", otherWallet, ReasonBadSignature},
+		{"key of another wallet", otherKey, ReasonBadSignature},
+	}
+	for _, test := range tests {
+		result := VerifyRowSignature(test.row)
+		if result.Reason() != test.reason {
+			t.Errorf("%s: expected reason %q, got %q (%v)", test.name, test.reason, result.Reason(), result.Err)
+		}
+		if result.OK() && result.Verifier != Ed25519CoinType+"+ton_proof" {
+			t.Errorf("%s: unexpected verifier %s", test.name, result.Verifier)
+		}
+	}
+}
@@ -216,10 +216,10 @@ func GetZECMainNetParams() *chaincfg.Params {
 func GuessUtxoCoinAddressType(address string) string {
 	match1, _ := regexp.MatchString("^[1-9A-Za-z]{26,35}$", address)
 	if match1 {
-		if address[0:1] == "1" || address[0:1] == "L" || address[0:1] == "X" || address[0:1] == "G" || address[0:1] == "t1" || address[0:1] == "D" || address[0:1] == "Q" || address[0:1] == "R" {
+		if address[0:1] == "1" || address[0:1] == "L" || address[0:1] == "X" || address[0:1] == "G" || strings.HasPrefix(address, "t1") || address[0:1] == "D" || address[0:1] == "Q" || address[0:1] == "R" {
 			return "P2PKH"
 		}
-		if address[0:1] == "3" || address[0:1] == "M" || address[0:1] == "7" || address[0:1] == "A" || address[0:1] == "t3" || address[0:1] == "9" || address[0:1] == "P" || address[0:1] == "r" {
+		if address[0:1] == "3" || address[0:1] == "M" || address[0:1] == "7" || address[0:1] == "A" || strings.HasPrefix(address, "t3") || address[0:1] == "9" || address[0:1] == "P" || address[0:1] == "r" {
 			return "P2SH"
 		}
 	}
@@ -0,0 +1,348 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrMissingSignatureParams is returned for a row without address, message or signature1.
+	ErrMissingSignatureParams = errors.New("missing address, message or signature")
+	// ErrUnsupportedCoin is returned for a coin without a registered verifier.
+	ErrUnsupportedCoin = errors.New("unsupported coin")
+	// ErrVerifierPanic is returned when a verifier panics on a malformed row.
+	ErrVerifierPanic = errors.New("verifier panic")
+)
+
+// Reason codes of a failed row. They are part of the verification report and stay stable across
+// releases, the error messages do not.
+const (
+	ReasonBadSignature       = "bad_signature"
+	ReasonAddressMismatch    = "address_mismatch"
+	ReasonMissingScript      = "missing_script"
+	ReasonUndecodableAddress = "undecodable_address"
+	ReasonUnsupportedCoin    = "unsupported_coin"
+	ReasonPanic              = "panic"
+	// ReasonMissingField is a row without address, message or signature1
+	ReasonMissingField = "missing_field"
+	// ReasonInvalidRow is a row that cannot be read or has an invalid balance or coin name
+	ReasonInvalidRow = "invalid_row"
+	// ReasonRPCError is a contract the node could not be queried about
+	ReasonRPCError = "rpc_error"
+	// ReasonNotOwner is an EOA1/EOA2 signer that does not own the multisig address
+	ReasonNotOwner = "not_owner"
+	// ReasonBelowThreshold is a multisig address signed by fewer owners than its threshold
+	ReasonBelowThreshold = "below_threshold"
+	// ReasonMessageMismatch is a row that signs another message than the one of the snapshot
+	ReasonMessageMismatch = "message_mismatch"
+	// ReasonMessageReused is a row that signs the message of an earlier snapshot
+	ReasonMessageReused = "message_reused"
+	// ReasonUnboundAccount is a named account whose keys could not be looked up to bind the signer
+	ReasonUnboundAccount = "unbound_account"
+	// ReasonProofBinding is a ton_proof signed for another domain or outside the snapshot window
+	ReasonProofBinding = "proof_binding"
+	// ReasonMissingDeposit is a staking row whose validator key has no deposit in the deposit data
+	ReasonMissingDeposit = "missing_deposit"
+	// ReasonStateChanged is a contract account that changed after the snapshot, its state at the
+	// snapshot cannot be read
+	ReasonStateChanged = "state_changed"
+)
+
+// Signers of a row, the address itself or one of its published owners.
+const (
+	SignerAddress = "addr"
+	SignerEOA1    = "eoa1"
+	SignerEOA2    = "eoa2"
+)
+
+// reasonError attaches a reason code to a verification error, keeping its message.
+type reasonError struct {
+	reason string
+	err    error
+}
+
+func (e *reasonError) Error() string {
+	return e.err.Error()
+}
+
+func (e *reasonError) Unwrap() error {
+	return e.err
+}
+
+func withReason(reason string, err error) error {
+	return &reasonError{reason: reason, err: err}
+}
+
+// FailureReason returns the reason code of a verification error, bad_signature unless the verifier
+// reported a more specific one.
+func FailureReason(err error) string {
+	var re *reasonError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrVerifierPanic):
+		return ReasonPanic
+	case errors.Is(err, ErrUnsupportedCoin):
+		return ReasonUnsupportedCoin
+	case errors.Is(err, ErrMissingSignatureParams):
+		return ReasonMissingField
+	case errors.As(err, &re):
+		return re.reason
+	}
+	return ReasonBadSignature
+}
+
+// SignatureResult is the outcome of verifying the signatures of one PoR row.
+type SignatureResult struct {
+	Coin     string
+	CoinType string
+	// Verifier names the verifier that checked the row, the coin type unless the verifier sets it
+	Verifier string
+	// Address is the address whose signature was checked last, the failing one on error
+	Address string
+	// Signer is the column Address was taken from, addr, eoa1 or eoa2
+	Signer string
+	// Quorum is the m-of-n policy of a multisig address, e.g. 2-of-3, empty for other addresses
+	Quorum string
+	Err    error
+}
+
+func (r *SignatureResult) OK() bool {
+	return r.Err == nil
+}
+
+// Reason returns the reason code of a failed result.
+func (r *SignatureResult) Reason() string {
+	return FailureReason(r.Err)
+}
+
+// SignatureVerifier verifies the signatures of one PoR row of a coin type. Rows reach a verifier
+// with address, message and signature1 set and "null" placeholders cleared.
+type SignatureVerifier interface {
+	Verify(row *CoinData) *SignatureResult
+}
+
+// SignatureVerifierFunc adapts a function to SignatureVerifier.
+type SignatureVerifierFunc func(row *CoinData) *SignatureResult
+
+func (f SignatureVerifierFunc) Verify(row *CoinData) *SignatureResult {
+	return f(row)
+}
+
+var signatureVerifiers = struct {
+	sync.RWMutex
+	verifiers map[string]SignatureVerifier
+	coinTypes map[string]string
+}{
+	verifiers: make(map[string]SignatureVerifier),
+	coinTypes: make(map[string]string),
+}
+
+// RegisterSignatureVerifier registers the verifier of a coin type, replacing an earlier one. The
+// coins are mapped to the coin type in addition to PorCoinTypeMap, so a library user can add a
+// chain without changing this package.
+func RegisterSignatureVerifier(coinType string, v SignatureVerifier, coins ...string) {
+	signatureVerifiers.Lock()
+	defer signatureVerifiers.Unlock()
+	signatureVerifiers.verifiers[coinType] = v
+	for _, coin := range coins {
+		signatureVerifiers.coinTypes[coin] = coinType
+	}
+}
+
+// SignatureCoinType returns the coin type a coin is verified as.
+func SignatureCoinType(coin string) (string, bool) {
+	signatureVerifiers.RLock()
+	defer signatureVerifiers.RUnlock()
+	for _, c := range []string{coin, strings.ToUpper(coin)} {
+		if coinType, exist := signatureVerifiers.coinTypes[c]; exist {
+			return coinType, true
+		}
+		if coinType, exist := PorCoinTypeMap[c]; exist {
+			return coinType, true
+		}
+	}
+	return "", false
+}
+
+// RegisteredSignatureVerifier returns the verifier of a coin type, e.g. to wrap it before
+// registering the wrapper in its place.
+func RegisteredSignatureVerifier(coinType string) (SignatureVerifier, bool) {
+	return signatureVerifier(coinType)
+}
+
+func signatureVerifier(coinType string) (SignatureVerifier, bool) {
+	signatureVerifiers.RLock()
+	defer signatureVerifiers.RUnlock()
+	v, exist := signatureVerifiers.verifiers[coinType]
+	return v, exist
+}
+
+// VerifyRowSignature verifies the signatures of a PoR row with the verifier of its coin type. It
+// is the single dispatch used by VerifyAddress and the digitalAsset verification.
+func VerifyRowSignature(row *CoinData) (result *SignatureResult) {
+	r := *row
+	r.Sign2, r.Script, r.EOA1, r.EOA2 = presentValue(r.Sign2), presentValue(r.Script), presentValue(r.EOA1), presentValue(r.EOA2)
+	// Eigenlayer Staking rows fill EOA2 with the EigenPod contract address; a contract
+	// cannot produce a signature (signature2 is empty), so only EOA1 is verifiable. The pod is
+	// kept for the verifiers that check the withdrawal credentials.
+	if strings.EqualFold(r.Type, "Eigenlayer Staking") {
+		r.EigenPod, r.EOA2 = r.EOA2, ""
+	}
+
+	result = &SignatureResult{Coin: r.Coin, Address: r.Address, Signer: SignerAddress}
+	if r.Address == "" || r.Message == "" || r.Sign1 == "" {
+		result.Err = ErrMissingSignatureParams
+		return result
+	}
+	coinType, exist := SignatureCoinType(r.Coin)
+	result.CoinType, result.Verifier = coinType, coinType
+	v, hasVerifier := signatureVerifier(coinType)
+	if !exist || !hasVerifier {
+		result.Err = fmt.Errorf("%w %s", ErrUnsupportedCoin, r.Coin)
+		return result
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			result = &SignatureResult{Coin: r.Coin, CoinType: coinType, Verifier: coinType, Address: r.Address, Signer: SignerAddress, Err: fmt.Errorf("%w: %v", ErrVerifierPanic, p)}
+		}
+	}()
+	result = v.Verify(&r)
+	result.Coin, result.CoinType = r.Coin, coinType
+	// wrappers append to the name of a verifier that leaves it empty, e.g. "+owners"
+	if result.Verifier == "" || strings.HasPrefix(result.Verifier, "+") {
+		result.Verifier = coinType + result.Verifier
+	}
+	if result.Signer == "" {
+		result.Signer = SignerAddress
+	}
+	return result
+}
+
+// presentValue clears the placeholders exports use for an empty column.
+func presentValue(s string) string {
+	if s == "null" || s == `\N` {
+		return ""
+	}
+	return s
+}
+
+func init() {
+	RegisterSignatureVerifier(EvmCoinTye, ownerSignatureVerifier(VerifyEvmCoin, nil))
+	RegisterSignatureVerifier(EcdsaCoinType, cosmosSignatureVerifier(ownerSignatureVerifier(VerifyEcdsaCoin, VerifyEcdsaCoinWithPubAddress)))
+	RegisterSignatureVerifier(Ed25519CoinType, SignatureVerifierFunc(verifyEd25519Row))
+	RegisterSignatureVerifier(UTXOCoinType, SignatureVerifierFunc(verifyUtxoRow))
+	RegisterSignatureVerifier(StarkCoinType, SignatureVerifierFunc(func(row *CoinData) *SignatureResult {
+		return &SignatureResult{Address: row.Address, Err: VerifyStarkCoin(row.Coin, row.Address, row.Message, row.Sign1, row.Script)}
+	}))
+	RegisterSignatureVerifier(TrxCoinType, SignatureVerifierFunc(func(row *CoinData) *SignatureResult {
+		return &SignatureResult{Address: row.Address, Err: VerifyTRX(row.Address, row.Message, row.Sign1)}
+	}))
+	RegisterSignatureVerifier(BethCoinType, SignatureVerifierFunc(func(row *CoinData) *SignatureResult {
+		return &SignatureResult{Address: row.Address, Err: VerifyBETH(row.Address, row.Message, row.Sign1)}
+	}))
+	RegisterSignatureVerifier(EOSCoinType, SignatureVerifierFunc(verifyEOSRow))
+}
+
+// ownerSignatureVerifier verifies EVM and ECDSA rows. A contract or multisig address publishes its
+// owners in EOA1/EOA2, every published owner must sign (signature1 for EOA1, signature2 for EOA2),
+// otherwise the address signs itself, or the published public key of the address does when withPub
+// is set.
+func ownerSignatureVerifier(verify func(coin, addr, msg, sign string) error, withPub func(coin, addr, msg, sign, publicKey string) error) SignatureVerifier {
+	return SignatureVerifierFunc(func(row *CoinData) *SignatureResult {
+		if row.EOA1 == "" {
+			if withPub != nil && row.Script != "" {
+				return &SignatureResult{Address: row.Address, Verifier: EcdsaCoinType + "+publicKey", Err: withPub(row.Coin, row.Address, row.Message, row.Sign1, row.Script)}
+			}
+			return &SignatureResult{Address: row.Address, Err: verify(row.Coin, row.Address, row.Message, row.Sign1)}
+		}
+		if err := verify(row.Coin, row.EOA1, row.Message, row.Sign1); err != nil {
+			return &SignatureResult{Address: row.EOA1, Signer: SignerEOA1, Err: fmt.Errorf("owner1 verification failed: %w", err)}
+		}
+		if row.EOA2 == "" {
+			return &SignatureResult{Address: row.EOA1, Signer: SignerEOA1}
+		}
+		if err := verify(row.Coin, row.EOA2, row.Message, row.Sign2); err != nil {
+			return &SignatureResult{Address: row.EOA2, Signer: SignerEOA2, Err: fmt.Errorf("owner2 verification failed: %w", err)}
+		}
+		return &SignatureResult{Address: row.EOA2, Signer: SignerEOA2}
+	})
+}
+
+// cosmosSignatureVerifier verifies the ADR-036 signArbitrary signatures of a Cosmos SDK row, told
+// apart from the signature of the PoR message by their json, and every other row with v.
+func cosmosSignatureVerifier(v SignatureVerifier) SignatureVerifier {
+	return SignatureVerifierFunc(func(row *CoinData) *SignatureResult {
+		if IsCosmosSignArbitrary(row.Coin, row.Sign1) {
+			return verifyCosmosRow(row)
+		}
+		return v.Verify(row)
+	})
+}
+
+// verifyUtxoRow verifies a BIP-322 signature of a BTC or LTC address, told apart from a legacy
+// signmessage signature by its encoding, or the legacy signatures of a single key or multisig address.
+func verifyUtxoRow(row *CoinData) *SignatureResult {
+	if IsBip322Coin(row.Coin) && IsBip322Signature(row.Sign1) {
+		return &SignatureResult{Address: row.Address, Verifier: UTXOCoinType + "+BIP-322", Err: VerifyBip322(row.Coin, row.Address, row.Message, row.Sign1)}
+	}
+	quorum, err := VerifyUtxoCoinQuorum(row.Coin, row.Address, row.Message, row.Sign1, row.Sign2, row.Script)
+	return &SignatureResult{Address: row.Address, Quorum: quorum, Err: err}
+}
+
+// verifyEd25519Row verifies against EOA1, the current authentication key of a rotated account
+// (e.g. APTOS), when it is present, otherwise against the address. SOL rows are verified by
+// verifySolanaRow, TON rows by verifyTonRow, ADA rows by verifyCardanoRow and SUI rows by
+// verifySuiRow.
+func verifyEd25519Row(row *CoinData) *SignatureResult {
+	switch PorCoinAddressTypeMap[row.Coin] {
+	case "SOL":
+		return verifySolanaRow(row)
+	case "TON":
+		return verifyTonRow(row)
+	case "ADA":
+		return verifyCardanoRow(row)
+	case "SUI":
+		return verifySuiRow(row)
+	}
+	addr, signer := row.Address, SignerAddress
+	if row.EOA1 != "" {
+		addr, signer = row.EOA1, SignerEOA1
+	}
+	return &SignatureResult{Address: addr, Signer: signer, Err: VerifyEd25519Coin(row.Coin, addr, row.Message, row.Sign1, row.Script)}
+}
+
+// verifyEOSRow verifies an EOS account with one public key, or with two signatures when the
+// public key column is {"publicKey1":"...","publicKey2":"..."}.
+func verifyEOSRow(row *CoinData) *SignatureResult {
+	result := &SignatureResult{Address: row.Address}
+	publicKey := strings.TrimSpace(row.Script)
+	if publicKey == "" {
+		result.Err = withReason(ReasonMissingScript, fmt.Errorf("EOS coin %s missing public key", row.Coin))
+		return result
+	}
+	if !strings.HasPrefix(publicKey, "{") {
+		result.Err = VerifyEOSCoin(row.Coin, row.Address, row.Message, row.Sign1, publicKey)
+		return result
+	}
+
+	var pubKeys map[string]string
+	if err := json.Unmarshal([]byte(publicKey), &pubKeys); err != nil {
+		result.Err = withReason(ReasonMissingScript, fmt.Errorf("invalid JSON public key format"))
+		return result
+	}
+	err1 := VerifyEOSCoin(row.Coin, row.Address, row.Message, row.Sign1, pubKeys["publicKey1"])
+	err2 := VerifyEOSCoin(row.Coin, row.Address, row.Message, row.Sign2, pubKeys["publicKey2"])
+	if err1 != nil || err2 != nil {
+		reason := FailureReason(err1)
+		if err1 == nil {
+			reason = FailureReason(err2)
+		}
+		result.Err = withReason(reason, fmt.Errorf("EOS dual signature failed: sig1=%v, sig2=%v", err1, err2))
+	}
+	return result
+}
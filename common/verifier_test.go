@@ -0,0 +1,167 @@
+package common
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// registerTestVerifier registers a verifier for the test and restores the registry afterwards.
+func registerTestVerifier(t *testing.T, coinType string, v SignatureVerifier, coins ...string) {
+	t.Helper()
+	previous, hadPrevious := signatureVerifier(coinType)
+	previousCoinTypes := make(map[string]string)
+	signatureVerifiers.RLock()
+	for _, coin := range coins {
+		previousCoinTypes[coin] = signatureVerifiers.coinTypes[coin]
+	}
+	signatureVerifiers.RUnlock()
+
+	RegisterSignatureVerifier(coinType, v, coins...)
+	t.Cleanup(func() {
+		signatureVerifiers.Lock()
+		defer signatureVerifiers.Unlock()
+		if hadPrevious {
+			signatureVerifiers.verifiers[coinType] = previous
+		} else {
+			delete(signatureVerifiers.verifiers, coinType)
+		}
+		for coin, coinType := range previousCoinTypes {
+			if coinType == "" {
+				delete(signatureVerifiers.coinTypes, coin)
+			} else {
+				signatureVerifiers.coinTypes[coin] = coinType
+			}
+		}
+	})
+}
+
+func TestVerifyRowSignatureRegisteredChain(t *testing.T) {
+	registerTestVerifier(t, "TESTCHAIN", SignatureVerifierFunc(func(row *CoinData) *SignatureResult {
+		if row.Sign1 != "good" {
+			return &SignatureResult{Address: row.Address, Err: errors.New("bad signature")}
+		}
+		return &SignatureResult{Address: row.Address}
+	}), "TST")
+
+	row := &CoinData{Coin: "tst", Address: "addr", Message: "msg", Sign1: "good"}
+	result := VerifyRowSignature(row)
+	if !result.OK() || result.CoinType != "TESTCHAIN" {
+		t.Fatalf("expected TST to verify as TESTCHAIN, got %+v", result)
+	}
+	row.Sign1 = "bad"
+	if result = VerifyRowSignature(row); result.OK() {
+		t.Fatal("expected a bad signature to fail")
+	}
+}
+
+func TestVerifyRowSignatureWrappedVerifierName(t *testing.T) {
+	registerTestVerifier(t, "WRAPPEDCHAIN", SignatureVerifierFunc(func(row *CoinData) *SignatureResult {
+		return &SignatureResult{Address: row.Address, Verifier: "+owners"}
+	}), "WRP")
+
+	row := &CoinData{Coin: "WRP", Address: "addr", Message: "msg", Sign1: "good"}
+	if result := VerifyRowSignature(row); result.Verifier != "WRAPPEDCHAIN+owners" {
+		t.Fatalf("expected the wrapper to be named after the coin type, got %s", result.Verifier)
+	}
+}
+
+func TestVerifyRowSignatureErrors(t *testing.T) {
+	registerTestVerifier(t, "PANICCHAIN", SignatureVerifierFunc(func(row *CoinData) *SignatureResult {
+		panic("malformed row")
+	}), "PNC")
+
+	tests := []struct {
+		row *CoinData
+		err error
+	}{
+		{&CoinData{Coin: "ETH", Address: "0x01", Sign1: "0x02"}, ErrMissingSignatureParams},
+		{&CoinData{Coin: "NOSUCHCOIN", Address: "a", Message: "m", Sign1: "s"}, ErrUnsupportedCoin},
+		{&CoinData{Coin: "PNC", Address: "a", Message: "m", Sign1: "s"}, ErrVerifierPanic},
+	}
+	for _, test := range tests {
+		result := VerifyRowSignature(test.row)
+		if !errors.Is(result.Err, test.err) {
+			t.Errorf("coin %s: expected %v, got %v", test.row.Coin, test.err, result.Err)
+		}
+	}
+}
+
+func TestVerifyRowSignatureClearsPlaceholders(t *testing.T) {
+	var got *CoinData
+	registerTestVerifier(t, "PLACEHOLDERCHAIN", SignatureVerifierFunc(func(row *CoinData) *SignatureResult {
+		got = row
+		return &SignatureResult{Address: row.Address}
+	}), "PLH")
+
+	row := &CoinData{Coin: "PLH", Type: "Eigenlayer Staking", Address: "a", Message: "m", Sign1: "s", Sign2: "null", Script: `\N`, EOA1: "o1", EOA2: "o2"}
+	VerifyRowSignature(row)
+	if got.Sign2 != "" || got.Script != "" || got.EOA2 != "" || got.EOA1 != "o1" {
+		t.Fatalf("unexpected row passed to verifier: %+v", got)
+	}
+	if row.Sign2 != "null" || row.EOA2 != "o2" {
+		t.Fatal("the caller's row must not be modified")
+	}
+}
+
+func TestVerifyRowSignatureReason(t *testing.T) {
+	const (
+		msg  = "I am an OKX address"
+		addr = "0x0cdcdb19a857c2ac24818ca4fdfe38cce071483e"
+		sig  = "0x07f19879aa28d51c97cddfdfecffe7ed96525545d041aee4f4386b0bf4c1a26924b637fb02ccbb97305c13daa51a0f50b8896fb25ecbaf60020cde920d227a221b"
+		// a valid signature of 1DcT5Wij5tfb3oVViF8mA8p4WrG98ahZPT
+		btcSig = "IA1jDx3zkn4J4F6mCVU68Vm7TwNf+bCsp+hKo3LwV/Y+PlZEoNsajnAHqd/FrEmv5/VAGz7pPiWPOXjmCLRfxIM="
+	)
+	tests := []struct {
+		name   string
+		row    *CoinData
+		reason string
+		signer string
+	}{
+		{"ok", &CoinData{Coin: "ETH", Address: addr, Message: msg, Sign1: sig}, "", SignerAddress},
+		{"other address", &CoinData{Coin: "ETH", Address: "0x0000000000000000000000000000000000000001", Message: msg, Sign1: sig}, ReasonAddressMismatch, SignerAddress},
+		{"other owner", &CoinData{Coin: "ETH", Address: addr, Message: msg, Sign1: sig, EOA1: addr, EOA2: addr, Sign2: "0x00"}, ReasonBadSignature, SignerEOA2},
+		{"missing script", &CoinData{Coin: "EOS", Address: "okx", Message: msg, Sign1: "SIG_K1_x"}, ReasonMissingScript, SignerAddress},
+		{"undecodable utxo address", &CoinData{Coin: "BTC", Address: "notanaddress", Message: msg, Sign1: btcSig}, ReasonUndecodableAddress, SignerAddress},
+		{"P2WPKH without script", &CoinData{Coin: "BTC", Address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", Message: msg, Sign1: btcSig}, ReasonMissingScript, SignerAddress},
+		{"taproot without script", &CoinData{Coin: "BTC", Address: "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", Message: msg, Sign1: btcSig}, ReasonMissingScript, SignerAddress},
+		{"ed25519 without public key", &CoinData{Coin: "APTOS", Address: "0x1", Message: msg, Sign1: "0x" + strings.Repeat("00", 64)}, ReasonMissingScript, SignerAddress},
+		{"ed25519 short public key", &CoinData{Coin: "APTOS", Address: "0x1", Message: msg, Sign1: "0x" + strings.Repeat("00", 64), Script: "0x0102"}, ReasonUndecodableAddress, SignerAddress},
+		{"unsupported", &CoinData{Coin: "NOSUCHCOIN", Address: addr, Message: msg, Sign1: sig}, ReasonUnsupportedCoin, SignerAddress},
+		{"missing field", &CoinData{Coin: "ETH", Address: addr, Sign1: sig}, ReasonMissingField, SignerAddress},
+	}
+	for _, test := range tests {
+		result := VerifyRowSignature(test.row)
+		if result.Reason() != test.reason || result.Signer != test.signer {
+			t.Errorf("%s: expected reason %q signer %q, got %q %q (%v)", test.name, test.reason, test.signer, result.Reason(), result.Signer, result.Err)
+		}
+	}
+}
+
+func TestVerifyRowSignaturePublicKeyBinding(t *testing.T) {
+	keys := NewPorTestKeys("binding")
+	for i, coin := range []string{"FIL", "XRP", "ATOM"} {
+		row := &CoinData{Coin: coin, Message: "I am an OKX address"}
+		if err := SignPorRow(keys, i, row); err != nil {
+			t.Fatal(err)
+		}
+		if result := VerifyRowSignature(row); !result.OK() || result.Verifier != EcdsaCoinType+"+publicKey" {
+			t.Fatalf("%s: expected the published key of %s to verify, got %s %v", coin, row.Address, result.Verifier, result.Err)
+		}
+		// the key signs, but it is not the key of the address
+		row.Address = map[string]string{"FIL": "f1exchangeaddressnotmine", "XRP": "rHb9CJAWyB4rj91VRWn96DkukG4bwdtyTh", "ATOM": "cosmos1notmine"}[coin]
+		if result := VerifyRowSignature(row); result.Reason() != ReasonAddressMismatch {
+			t.Errorf("%s: expected %s, got %q (%v)", coin, ReasonAddressMismatch, result.Reason(), result.Err)
+		}
+	}
+	key := secp256k1.PrivKeyFromBytes(keys.Key(9))
+	nuls := &CoinData{Coin: "NULS", Address: "NULSd6HgexchangeAddress", Message: "I am an OKX address",
+		Script: hex.EncodeToString(key.PubKey().SerializeCompressed()),
+		Sign1:  Encode(signRecoverable(key, HashEcdsaMsg(OKXMessageSignatureHeader, "I am an OKX address"), false))}
+	if result := VerifyRowSignature(nuls); result.Reason() != ReasonUnsupportedCoin {
+		t.Fatalf("expected a key that cannot be bound to its address to fail, got %q (%v)", result.Reason(), result.Err)
+	}
+}
@@ -12,7 +12,6 @@ import (
 	"strings"
 
 	"github.com/Conflux-Chain/go-conflux-sdk/types/cfxaddress"
-	"github.com/martinboehm/btcd/txscript"
 	"github.com/martinboehm/btcutil"
 	"github.com/martinboehm/btcutil/base58"
 	"github.com/martinboehm/btcutil/bech32"
@@ -20,10 +19,10 @@ import (
 	"golang.org/x/crypto/blake2b"
 	"golang.org/x/crypto/ripemd160"
 
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	secp_ecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
 	"github.com/okx/go-wallet-sdk/coins/cosmos"
 	"github.com/okx/go-wallet-sdk/coins/stacks"
-	tonWallet "github.com/xssnick/tonutils-go/ton/wallet"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -36,7 +35,7 @@ func VerifyBETH(addr, msg, sign string) error {
 	coin := "BETH"
 	msgHeader, exist := PorCoinMessageSignatureHeaderMap[coin]
 	if !exist {
-		return fmt.Errorf("invalid coin type %s", coin)
+		return withReason(ReasonUnsupportedCoin, fmt.Errorf("invalid coin type %s", coin))
 	}
 	hash := HashEvmCoinTypeMsg(msgHeader, msg)
 	var p [48]byte
@@ -79,21 +78,24 @@ func verifyTRX(addr, msg, sign string, hashFunc func(string) []byte) error {
 	if err != nil {
 		return fmt.Errorf("failed to recover public key from TRX signature, error:%v", err)
 	}
-	pubKey := pub.SerializeUncompressed()
-	h := sha3.NewLegacyKeccak256()
-	h.Write(pubKey[1:])
-	newHash := h.Sum(nil)[12:]
-	newAddr := base58.CheckEncode(newHash, GetNetWork(), base58.Sha256D)
+	newAddr := TrxAddress(pub)
 	if addr != newAddr {
-		return fmt.Errorf("TRX address mismatch, expected:%s, recovered:%s", addr, newAddr)
+		return withReason(ReasonAddressMismatch, fmt.Errorf("TRX address mismatch, expected:%s, recovered:%s", addr, newAddr))
 	}
 	return nil
 }
 
+// TrxAddress returns the base58 TRX address of a public key.
+func TrxAddress(pub *secp256k1.PublicKey) string {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(pub.SerializeUncompressed()[1:])
+	return base58.CheckEncode(h.Sum(nil)[12:], GetNetWork(), base58.Sha256D)
+}
+
 func UtxoCoinSigToPubKey(coin, msg, sign string) ([]byte, error) {
 	msgHeader, exist := PorCoinMessageSignatureHeaderMap[coin]
 	if !exist {
-		return nil, fmt.Errorf("invalid coin type %s", coin)
+		return nil, withReason(ReasonUnsupportedCoin, fmt.Errorf("invalid coin type %s", coin))
 	}
 
 	// 0x hex signatures use EVM-style encoding (R|S|V) with OKX/ECDSA hash
@@ -145,150 +147,163 @@ func recoverPubKeyFromHexSign(msg, sign string) ([]byte, error) {
 }
 
 func VerifyUtxoCoin(coin, addr, msg, sign1, sign2, script string) error {
+	_, err := VerifyUtxoCoinQuorum(coin, addr, msg, sign1, sign2, script)
+	return err
+}
+
+// VerifyUtxoCoinQuorum verifies a UTXO row like VerifyUtxoCoin and returns the m-of-n quorum of a
+// multisig address, "" for a single key address.
+func VerifyUtxoCoinQuorum(coin, addr, msg, sign1, sign2, script string) (quorum string, err error) {
 	var pub1, pub2 []byte
-	var err error
 	// recover pub1 and pub2 from sign1 and sign2
 	if sign1 != "" && sign1 != "null" && sign1 != "\\N" {
 		pub1, err = UtxoCoinSigToPubKey(coin, msg, sign1)
 		if err != nil {
-			return err
+			return "", err
 		}
 	}
 	if sign2 != "" && sign2 != "null" && sign2 != "\\N" {
 		pub2, err = UtxoCoinSigToPubKey(coin, msg, sign2)
 		if err != nil {
-			return err
+			return "", err
 		}
 	}
 
-	return VerifyUtxoCoinSig(coin, addr, script, pub1, pub2)
+	return verifyUtxoCoinSig(coin, addr, script, pub1, pub2)
 }
 
+// VerifyUtxoCoinSig checks the recovered public keys against the address. A multisig address
+// needs m distinct keys of its redeem script, m is taken from the script.
 func VerifyUtxoCoinSig(coin, addr, script string, pub1, pub2 []byte) error {
-	mainNetParams := &chaincfg.Params{}
+	_, err := verifyUtxoCoinSig(coin, addr, script, pub1, pub2)
+	return err
+}
+
+func verifyUtxoCoinSig(coin, addr, script string, pub1, pub2 []byte) (string, error) {
 	coinAddressType := PorCoinAddressTypeMap[coin]
-	// get main net params
-	switch coinAddressType {
-	case "BTC":
-		mainNetParams = GetBTCMainNetParams()
-	case "BCH":
-		mainNetParams = GetBTCMainNetParams()
+	mainNetParams := UtxoMainNetParams(coinAddressType)
+	if coinAddressType == "BCH" && IsCashAddress(addr) {
 		// convert cash address to legacy address
-		if IsCashAddress(addr) {
-			legacyAddr, err := ConvertCashAddressToLegacy(addr)
-			if err != nil {
-				return fmt.Errorf("convertCashAddressToLegacy failed, invalid cash address: %s, error: %v", addr, err)
-			}
-			addr = legacyAddr
+		legacyAddr, err := ConvertCashAddressToLegacy(addr)
+		if err != nil {
+			return "", withReason(ReasonUndecodableAddress, fmt.Errorf("convertCashAddressToLegacy failed, invalid cash address: %s, error: %v", addr, err))
 		}
-	case "LTC":
-		mainNetParams = GetLTCMainNetParams()
-	case "DOGE":
-		mainNetParams = GetDOGEMainNetParams()
-	case "DASH":
-		mainNetParams = GetDASHMainNetParams()
-	case "BTG":
-		mainNetParams = GetBTGMainNetParams()
-	case "DGB":
-		mainNetParams = GetDGBMainNetParams()
-	case "QTUM":
-		mainNetParams = GetQTUMMainNetParams()
-	case "RVN":
-		mainNetParams = GetRVNMainNetParams()
-	case "ZEC":
-		mainNetParams = GetZECMainNetParams()
-	default:
-		mainNetParams = GetBTCMainNetParams()
+		addr = legacyAddr
 	}
 	if _, err := btcutil.DecodeAddress(addr, mainNetParams); err != nil {
-		return nil
+		return "", withReason(ReasonUndecodableAddress, fmt.Errorf("decode address failed, coin:%s, addr:%s, error:%v", coin, addr, err))
 	}
 	addrType := GuessUtxoCoinAddressType(addr)
 	switch addrType {
 	case "P2PKH":
 		addrPub, err := btcutil.NewAddressPubKey(pub1, mainNetParams)
-		if err != nil || addrPub.EncodeAddress() != addr {
-			return fmt.Errorf("address not match,coin: %s, addr: %s, recoverAddr: %s", coin, addr, addrPub.EncodeAddress())
+		if err != nil {
+			return "", fmt.Errorf("no public key recovered from the signature, coin: %s, addr: %s, error: %v", coin, addr, err)
+		}
+		if addrPub.EncodeAddress() != addr {
+			return "", withReason(ReasonAddressMismatch, fmt.Errorf("address not match,coin: %s, addr: %s, recoverAddr: %s", coin, addr, addrPub.EncodeAddress()))
 		}
+		return "", nil
 	case "P2SH":
 		if script == "" {
-			return fmt.Errorf("P2SH address requires script, but script is empty, coin:%s, addr:%s", coin, addr)
+			return "", withReason(ReasonMissingScript, fmt.Errorf("P2SH address requires script, but script is empty, coin:%s, addr:%s", coin, addr))
 		}
-		addrPub, err := btcutil.NewAddressScriptHash(MustDecode(script), mainNetParams)
+		redeemScript, err := Decode(script)
 		if err != nil {
-			return fmt.Errorf("get NewAddressScriptHash failed, coin:%s, addr:%s, error:%v", coin, addr, err)
+			return "", withReason(ReasonMissingScript, fmt.Errorf("decode script failed, coin:%s, addr:%s, error:%v", coin, addr, err))
 		}
-		if addrPub.EncodeAddress() != addr {
-			return fmt.Errorf("address not match, coin:%s, addr:%s, recoverAddr:%s", coin, addr, addrPub.EncodeAddress())
-		}
-		addrPub1, err := btcutil.NewAddressPubKey(pub1, mainNetParams)
+		addrPub, err := btcutil.NewAddressScriptHash(redeemScript, mainNetParams)
 		if err != nil {
-			return fmt.Errorf("get pub1 NewAddressPubKey failed, coin:%s, addr:%s, error: %v", coin, addr, err)
+			return "", withReason(ReasonMissingScript, fmt.Errorf("get NewAddressScriptHash failed, coin:%s, addr:%s, error:%v", coin, addr, err))
 		}
-		addr1 := addrPub1.EncodeAddress()
-		addrPub2, err := btcutil.NewAddressPubKey(pub2, mainNetParams)
-		if err != nil {
-			return fmt.Errorf("get pub2 NewAddressPubKey failed, coin:%s, addr:%s, error:%v", coin, addr, err)
+		if addrPub.EncodeAddress() != addr {
+			return "", withReason(ReasonAddressMismatch, fmt.Errorf("address not match, coin:%s, addr:%s, recoverAddr:%s", coin, addr, addrPub.EncodeAddress()))
 		}
-		addr2 := addrPub2.EncodeAddress()
-		typ, pubs, _, err := txscript.ExtractPkScriptAddrs(MustDecode(script), mainNetParams)
-		if typ != txscript.MultiSigTy {
-			return fmt.Errorf("script type not match, coin:%s, addr:%s, srcType:%d, type:%d", coin, addr, txscript.MultiSigTy, typ)
+		return verifyMultisigQuorum(coin, addr, script, pub1, pub2)
+	case "P2WSH":
+		if script == "" {
+			return "", withReason(ReasonMissingScript, fmt.Errorf("P2WSH address requires script, but script is empty, coin:%s, addr:%s", coin, addr))
 		}
+		pkScript, err := Decode(script)
 		if err != nil {
-			return fmt.Errorf("script ExtractPkScriptAddrs failed, coin:%s, addr:%s, error: %v", coin, addr, err)
-		}
-		m := map[string]struct{}{addr1: {}, addr: {}, addr2: {}}
-		for _, v := range pubs {
-			delete(m, v.EncodeAddress())
-		}
-		if len(m) > 1 {
-			return fmt.Errorf("script address not match the pubs, coin:%s, addr:%s", coin, addr)
+			return "", withReason(ReasonMissingScript, fmt.Errorf("decode script failed, coin:%s, addr:%s, error:%v", coin, addr, err))
 		}
-	case "P2WSH":
-		pkScript := MustDecode(script)
 		h := sha256.New()
 		h.Write(pkScript)
 		witnessProg := h.Sum(nil)
 		addressWitnessScriptHash, err := btcutil.NewAddressWitnessScriptHash(witnessProg, mainNetParams)
 		if err != nil {
-			return fmt.Errorf("get NewAddressWitnessScriptHash failed, coin:%s, addr:%s, error:%v", coin, addr, err)
+			return "", withReason(ReasonMissingScript, fmt.Errorf("get NewAddressWitnessScriptHash failed, coin:%s, addr:%s, error:%v", coin, addr, err))
 		}
 		if addressWitnessScriptHash.EncodeAddress() != addr {
-			return fmt.Errorf("address not match,coin: %s, addr: %s, recoverAddr: %s", coin, addr, addressWitnessScriptHash.EncodeAddress())
-		}
-		addrPub1, err := btcutil.NewAddressPubKey(pub1, mainNetParams)
-		if err != nil {
-			return fmt.Errorf("get pub1 NewAddressPubKey failed, coin:%s, addr:%s, error: %v", coin, addr, err)
+			return "", withReason(ReasonAddressMismatch, fmt.Errorf("address not match,coin: %s, addr: %s, recoverAddr: %s", coin, addr, addressWitnessScriptHash.EncodeAddress()))
 		}
-		addr1 := addrPub1.EncodeAddress()
-		addrPub2, err := btcutil.NewAddressPubKey(pub2, mainNetParams)
-		if err != nil {
-			return fmt.Errorf("get pub2 NewAddressPubKey failed, coin:%s, addr:%s, error: %v", coin, addr, err)
-		}
-		addr2 := addrPub2.EncodeAddress()
-		typ, pubs, _, err := txscript.ExtractPkScriptAddrs(MustDecode(script), mainNetParams)
-		if typ != txscript.MultiSigTy {
-			return fmt.Errorf("script type not match, coin:%s, addr:%s, srcType:%d, type:%d", coin, addr, txscript.MultiSigTy, typ)
-		}
-		if err != nil {
-			return fmt.Errorf("script ExtractPkScriptAddrs failed, coin:%s, addr:%s, error: %v", coin, addr, err)
+		return verifyMultisigQuorum(coin, addr, script, pub1, pub2)
+	}
+	return "", withReason(ReasonUndecodableAddress, fmt.Errorf("unsupported address type %q, coin:%s, addr:%s", addrType, coin, addr))
+}
+
+// UtxoMainNetParams returns the main net params of a UTXO address type, BTC's for the types
+// without their own.
+func UtxoMainNetParams(coinAddressType string) *chaincfg.Params {
+	switch coinAddressType {
+	case "LTC":
+		return GetLTCMainNetParams()
+	case "DOGE":
+		return GetDOGEMainNetParams()
+	case "DASH":
+		return GetDASHMainNetParams()
+	case "BTG":
+		return GetBTGMainNetParams()
+	case "DGB":
+		return GetDGBMainNetParams()
+	case "QTUM":
+		return GetQTUMMainNetParams()
+	case "RVN":
+		return GetRVNMainNetParams()
+	case "ZEC":
+		return GetZECMainNetParams()
+	default:
+		return GetBTCMainNetParams()
+	}
+}
+
+// verifyMultisigQuorum requires at least m distinct recovered keys of an m-of-n script, every
+// recovered key must be one of its keys.
+func verifyMultisigQuorum(coin, addr, script string, pubs ...[]byte) (string, error) {
+	ms, err := ParseMultisigScript(script)
+	if err != nil {
+		return "", withReason(ReasonMissingScript, fmt.Errorf("script is not a multisig script, coin:%s, addr:%s, error:%v", coin, addr, err))
+	}
+	// compare compressed keys, the signatures recover compressed keys only
+	scriptKeys := make(map[string]bool, ms.N)
+	for _, key := range ms.PubKeys {
+		b, _ := hex.DecodeString(key)
+		if pub, err := secp256k1.ParsePubKey(b); err == nil {
+			scriptKeys[hex.EncodeToString(pub.SerializeCompressed())] = true
 		}
-		m := map[string]struct{}{addr1: {}, addr: {}, addr2: {}}
-		for _, v := range pubs {
-			delete(m, v.EncodeAddress())
+	}
+	signed := make(map[string]bool)
+	for _, pub := range pubs {
+		if pub == nil {
+			continue
 		}
-		if len(m) > 1 {
-			return fmt.Errorf("script address not match the pubs, coin:%s, addr:%s", coin, addr)
+		key := hex.EncodeToString(pub)
+		if !scriptKeys[key] {
+			return ms.Quorum(), withReason(ReasonAddressMismatch, fmt.Errorf("script address not match the pubs, coin:%s, addr:%s, pub:%s", coin, addr, key))
 		}
+		signed[key] = true
 	}
-	return nil
+	if len(signed) < ms.M {
+		return ms.Quorum(), withReason(ReasonBelowThreshold, fmt.Errorf("%d distinct keys signed, the %s script needs %d, coin:%s, addr:%s", len(signed), ms.Quorum(), ms.M, coin, addr))
+	}
+	return ms.Quorum(), nil
 }
 
 func VerifyEvmCoin(coin, addr, msg, sign string) error {
 	msgHeader, exist := PorCoinMessageSignatureHeaderMap[coin]
 	if !exist {
-		return fmt.Errorf("invalid coin type %s, addr:%s", coin, addr)
+		return withReason(ReasonUnsupportedCoin, fmt.Errorf("invalid coin type %s, addr:%s", coin, addr))
 	}
 	hash := HashEvmCoinTypeMsg(msgHeader, msg)
 	s := MustDecode(sign)
@@ -302,7 +317,7 @@ func VerifyEvmCoin(coin, addr, msg, sign string) error {
 
 	addrType, exist := PorCoinAddressTypeMap[coin]
 	if !exist {
-		return fmt.Errorf("invalid coin type %s, addr:%s", coin, addr)
+		return withReason(ReasonUnsupportedCoin, fmt.Errorf("invalid coin type %s, addr:%s", coin, addr))
 	}
 	switch addrType {
 	case "FIL":
@@ -313,7 +328,7 @@ func VerifyEvmCoin(coin, addr, msg, sign string) error {
 			// f410 address, convert to filecoin address
 			filAddress, err := ConvertEthAddressToFilecoinAddress(PubkeyToAddress(*pubToEcdsa).Bytes())
 			if err != nil {
-				return fmt.Errorf("convert eth address to fil address failed, coin:%s, addr:%s, error:%v", coin, addr, err)
+				return withReason(ReasonUndecodableAddress, fmt.Errorf("convert eth address to fil address failed, coin:%s, addr:%s, error:%v", coin, addr, err))
 			}
 			recoverAddr = filAddress.String()
 		}
@@ -325,32 +340,61 @@ func VerifyEvmCoin(coin, addr, msg, sign string) error {
 		if !VerifySignAddr(HexToAddress(addr), hash, s) {
 			// 获取恢复出来的地址用于错误信息
 			recoveredAddr := PubkeyToAddress(*pubToEcdsa).String()
-			return fmt.Errorf("ETH address verification failed, coin:%s, expected:%s, recovered:%s", coin, addr, recoveredAddr)
+			return withReason(ReasonAddressMismatch, fmt.Errorf("ETH address verification failed, coin:%s, expected:%s, recovered:%s", coin, addr, recoveredAddr))
 		}
 	}
 
 	if !strings.EqualFold(addr, recoverAddr) {
-		return fmt.Errorf("recovery address not match, coin:%s, recoverAddr:%s, addr:%s", coin, recoverAddr, addr)
+		return withReason(ReasonAddressMismatch, fmt.Errorf("recovery address not match, coin:%s, recoverAddr:%s, addr:%s", coin, recoverAddr, addr))
 	}
 
 	return nil
 }
 
+var (
+	// nearImplicitAccount is a NEAR account named after its ed25519 public key
+	nearImplicitAccount = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+	// hederaAccountID is a Hedera shard.realm.num account id, with an optional checksum
+	hederaAccountID = regexp.MustCompile(`^\d+\.\d+\.\d+(-[a-z]{5})?$`)
+)
+
+// SubstrateNetworks are the SS58 network ids of the substrate address types.
+var SubstrateNetworks = map[string]uint16{
+	"DOT": 0, "ASSET-HUB": 0, "KSM": 2, "ENJIN": 2135,
+	"PHA": 30, "CLV": 42, "AVAIL": 42, "SDN": 5, "CFG": 36, "EFI": 1110,
+	"KARU": 8,
+}
+
+// hederaEd25519DerPrefix prefixes the DER encoding of an ed25519 public key on Hedera.
+const hederaEd25519DerPrefix = "302a300506032b6570032100"
+
 func VerifyEd25519Coin(coin, addr, msg, sign, pubkey string) error {
 	msgHeader, exist := PorCoinMessageSignatureHeaderMap[coin]
 	if !exist {
-		return fmt.Errorf("invalid coin type %s, addr:%s", coin, addr)
+		return withReason(ReasonUnsupportedCoin, fmt.Errorf("invalid coin type %s, addr:%s", coin, addr))
 	}
 	hash := HashEd25519Msg(msgHeader, msg)
 	res, _ := Decode(sign)
-	pubkeyBytes, _ := Decode(pubkey)
-	if ok := ed25519.Verify(pubkeyBytes, hash, res); !ok {
+	pubkeyBytes, err := Decode(pubkey)
+	if pubkey == "" {
+		return withReason(ReasonMissingScript, fmt.Errorf("ED25519 public key is empty, coin:%s, addr:%s", coin, addr))
+	}
+	if err != nil || len(pubkeyBytes) != ed25519.PublicKeySize {
+		return withReason(ReasonUndecodableAddress, fmt.Errorf("invalid ED25519 public key %q, coin:%s, addr:%s", pubkey, coin, addr))
+	}
+	if ok := verifyEd25519(pubkeyBytes, hash, res); !ok {
 		return fmt.Errorf("ED25519 signature verification failed, coin:%s, addr:%s", coin, addr)
 	}
+	return verifyEd25519Address(coin, addr, pubkey)
+}
 
+// verifyEd25519Address checks that the public key, whose signature has been verified, produces
+// the address.
+func verifyEd25519Address(coin, addr, pubkey string) error {
+	pubkeyBytes, _ := Decode(pubkey)
 	addrType, exist := PorCoinAddressTypeMap[coin]
 	if !exist {
-		return fmt.Errorf("invalid coin type %s, addr:%s", coin, addr)
+		return withReason(ReasonUnsupportedCoin, fmt.Errorf("invalid coin type %s, addr:%s", coin, addr))
 	}
 	var recoverAddrs []string
 	switch addrType {
@@ -358,7 +402,7 @@ func VerifyEd25519Coin(coin, addr, msg, sign, pubkey string) error {
 		out := [32]byte{}
 		byteCount := len(pubkeyBytes)
 		if byteCount == 0 {
-			return fmt.Errorf("empty public key for SOL address generation, coin:%s, addr:%s", coin, addr)
+			return withReason(ReasonMissingScript, fmt.Errorf("empty public key for SOL address generation, coin:%s, addr:%s", coin, addr))
 		}
 		max := 32
 		if byteCount < max {
@@ -385,26 +429,13 @@ func VerifyEd25519Coin(coin, addr, msg, sign, pubkey string) error {
 		address := "0x" + hex.EncodeToString(h)[0:64]
 		recoverAddrs = append(recoverAddrs, address)
 	case "TON":
-		walletV3, err := tonWallet.AddressFromPubKey(pubkeyBytes, tonWallet.V3, tonWallet.DefaultSubwallet)
-		if err != nil {
-			return fmt.Errorf("%s, coin: %s, addr: %s, error: %v", ErrInvalidSign, coin, addr, err)
-		}
-		recoverAddrs = append(recoverAddrs, walletV3.String())
-		recoverAddrs = append(recoverAddrs, walletV3.Bounce(false).String())
-
-		walletHighload, err := tonWallet.AddressFromPubKey(pubkeyBytes, tonWallet.ConfigHighloadV3{MessageTTL: 60 * 60 * 12}, 4269)
-		if err != nil {
-			return fmt.Errorf("%s, coin: %s, addr: %s, error: %v", ErrInvalidSign, coin, addr, err)
+		// the address of a wallet contract of the catalogue, for the public key
+		if _, err := IdentifyTonWallet(pubkeyBytes, addr); err != nil {
+			return fmt.Errorf("%w, coin:%s", err, coin)
 		}
-		recoverAddrs = append(recoverAddrs, walletHighload.String())
-		recoverAddrs = append(recoverAddrs, walletHighload.Bounce(false).String())
+		return nil
 	case "DOT", "ASSET-HUB", "KSM", "ENJIN", "PHA", "CLV", "AVAIL", "SDN", "CFG", "EFI", "KARU":
-		ss58Network := map[string]uint16{
-			"DOT": 0, "ASSET-HUB": 0, "KSM": 2, "ENJIN": 2135,
-			"PHA": 30, "CLV": 42, "AVAIL": 42, "SDN": 5, "CFG": 36, "EFI": 1110,
-			"KARU": 8,
-		}
-		netID := ss58Network[addrType]
+		netID := SubstrateNetworks[addrType]
 		rAddr, err := GetSubstrateAddressFromPublicKey(pubkey, netID)
 		if err != nil {
 			return fmt.Errorf("%s, coin: %s, addr: %s, error: %v", ErrInvalidSign, coin, addr, err)
@@ -420,14 +451,36 @@ func VerifyEd25519Coin(coin, addr, msg, sign, pubkey string) error {
 		}
 		recoverAddrs = append(recoverAddrs, rAddr)
 	case "ADA":
-		// ADA addresses use ed25519 + Blake2b-224 + Bech32 encoding
-		rAddr, err := GetAdaAddressFromPublicKey(pubkey)
+		// the key credential of an enterprise, base or pointer address, or of a reward address
+		if err := verifyCardanoAddressKey(addr, pubkeyBytes); err != nil {
+			return fmt.Errorf("%w, coin:%s", err, coin)
+		}
+		return nil
+	case "NEAR":
+		// an implicit account is the hex public key, a named account is bound through its access keys
+		if !nearImplicitAccount.MatchString(addr) {
+			return withReason(ReasonUnboundAccount, fmt.Errorf("NEAR named account needs an access key lookup, coin:%s, addr:%s", coin, addr))
+		}
+		recoverAddrs = append(recoverAddrs, hex.EncodeToString(pubkeyBytes))
+	case "HBAR":
+		// an account id 0.0.x is bound through its key, otherwise the address is the public key,
+		// raw or DER encoded
+		if hederaAccountID.MatchString(addr) {
+			return withReason(ReasonUnboundAccount, fmt.Errorf("HBAR account id needs an account key lookup, coin:%s, addr:%s", coin, addr))
+		}
+		recoverAddrs = append(recoverAddrs, hex.EncodeToString(pubkeyBytes), "0x"+hex.EncodeToString(pubkeyBytes), hederaEd25519DerPrefix+hex.EncodeToString(pubkeyBytes))
+	case "SC":
+		rAddr, err := GetSiaAddressFromPublicKey(pubkey)
 		if err != nil {
 			return fmt.Errorf("%s, coin: %s, addr: %s, error: %v", ErrInvalidSign, coin, addr, err)
 		}
 		recoverAddrs = append(recoverAddrs, rAddr)
-	case "NEAR", "HBAR", "SC", "IOTA":
-		return nil
+	case "IOTA":
+		rAddrs, err := GetIotaAddressesFromPublicKey(pubkey)
+		if err != nil {
+			return fmt.Errorf("%s, coin: %s, addr: %s, error: %v", ErrInvalidSign, coin, addr, err)
+		}
+		recoverAddrs = append(recoverAddrs, rAddrs...)
 	default:
 		return nil
 	}
@@ -438,13 +491,13 @@ func VerifyEd25519Coin(coin, addr, msg, sign, pubkey string) error {
 		}
 	}
 
-	return fmt.Errorf("recovery address not match, coin:%s, recoverAddrs:%v, addr:%s", coin, recoverAddrs, addr)
+	return withReason(ReasonAddressMismatch, fmt.Errorf("recovery address not match, coin:%s, recoverAddrs:%v, addr:%s", coin, recoverAddrs, addr))
 }
 
 func VerifyEcdsaCoin(coin, addr, msg, sign string) error {
 	msgHeader, exist := PorCoinMessageSignatureHeaderMap[coin]
 	if !exist {
-		return fmt.Errorf("invalid coin type %s, addr:%s", coin, addr)
+		return withReason(ReasonUnsupportedCoin, fmt.Errorf("invalid coin type %s, addr:%s", coin, addr))
 	}
 	hash := HashEcdsaMsg(msgHeader, msg)
 	s := MustDecode(sign)
@@ -452,14 +505,26 @@ func VerifyEcdsaCoin(coin, addr, msg, sign string) error {
 	if err != nil {
 		return fmt.Errorf("failed to recover public key from signature, coin:%s, addr:%s, error:%v", coin, addr, err)
 	}
+	addrType, exist := PorCoinAddressTypeMap[coin]
+	if !exist {
+		return withReason(ReasonUnsupportedCoin, fmt.Errorf("invalid coin type %s, addr:%s", coin, addr))
+	}
+	recoverAddr := EcdsaCoinAddress(addrType, addr, pub)
+
+	if !strings.EqualFold(recoverAddr, addr) {
+		return withReason(ReasonAddressMismatch, fmt.Errorf("recovery address not match, coin:%s, recoverAddr:%s, addr:%s", coin, recoverAddr, addr))
+	}
+
+	return nil
+}
+
+// EcdsaCoinAddress returns the address of a public key for an ECDSA address type, "" for a type
+// without one. addr tells apart the OKT ex addresses of the ETH type.
+func EcdsaCoinAddress(addrType, addr string, pub *secp256k1.PublicKey) string {
 	pubKey := pub.SerializeUncompressed()
 	pubKeyCompressed := pub.SerializeCompressed()
 
 	var recoverAddr string
-	addrType, exist := PorCoinAddressTypeMap[coin]
-	if !exist {
-		return fmt.Errorf("invalid coin type %s, addr:%s", coin, addr)
-	}
 	switch addrType {
 	case "FIL":
 		pubKeyHash := hash_cal(pubKey, payloadHashConfig)
@@ -476,7 +541,7 @@ func VerifyEcdsaCoin(coin, addr, msg, sign string) error {
 		cfxOldAddr := "0x1" + ethAddr[3:]
 		cfxAddr, err := cfxaddress.New(cfxOldAddr, 1029)
 		if err != nil {
-			return ErrInvalidSign
+			return ""
 		}
 		recoverAddr = cfxAddr.String()
 	case "ELF":
@@ -525,21 +590,69 @@ func VerifyEcdsaCoin(coin, addr, msg, sign string) error {
 		recoverAddr, _ = bech32.EncodeFromBase256("inj", addressByte[12:])
 	case "ONE":
 		recoverAddr, _ = GenerateONEAddress(pubKey)
+	case "XRP":
+		recoverAddr = XrpAddress(pubKeyCompressed)
 	}
 
-	if !strings.EqualFold(recoverAddr, addr) {
-		return fmt.Errorf("recovery address not match, coin:%s, recoverAddr:%s, addr:%s", coin, recoverAddr, addr)
-	}
+	return recoverAddr
+}
+
+// xrpAlphabet is the base58 alphabet of XRP Ledger addresses, base58Alphabet with its letters
+// in another order.
+const (
+	base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	xrpAlphabet    = "rpshnaf39wBUDNEGHJKLM4PQRST7VWXYZ2bcdeCg65jkm8oFqi1tuvAxyz"
+)
+
+// XrpAddress returns the classic address of a compressed secp256k1 public key, the account ID
+// RIPEMD160(SHA256(key)) base58check encoded with type prefix 0 in the XRP alphabet.
+func XrpAddress(pubKeyCompressed []byte) string {
+	payload := append([]byte{0}, btcutil.Hash160(pubKeyCompressed)...)
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	encoded := base58.Encode(append(payload, second[:4]...))
+	return strings.Map(func(r rune) rune {
+		return rune(xrpAlphabet[strings.IndexRune(base58Alphabet, r)])
+	}, encoded)
+}
 
+// VerifyEcdsaCoinWithPubAddress verifies a row that publishes the public key it signs with. The
+// key must sign the message with the OKX header and derive the address of the row, a key that
+// cannot be bound to the address (e.g. NULS) is not accepted.
+func VerifyEcdsaCoinWithPubAddress(coin, addr, msg, sign, publicKey string) error {
+	if err := VerifyEcdsaCoinWithPub(msg, sign, publicKey); err != nil {
+		return err
+	}
+	b, err := Decode(publicKey)
+	if err != nil {
+		return withReason(ReasonMissingScript, fmt.Errorf("invalid public key format: %v", err))
+	}
+	if len(b) == 64 {
+		b = append([]byte{0x04}, b...)
+	}
+	pub, err := secp256k1.ParsePubKey(b)
+	if err != nil {
+		return withReason(ReasonMissingScript, fmt.Errorf("invalid public key, coin:%s, addr:%s, error:%v", coin, addr, err))
+	}
+	addrType := PorCoinAddressTypeMap[coin]
+	keyAddr := EcdsaCoinAddress(addrType, addr, pub)
+	if keyAddr == "" {
+		return withReason(ReasonUnsupportedCoin, fmt.Errorf("no address derivation for coin %s, the public key cannot be bound to addr:%s", coin, addr))
+	}
+	if !strings.EqualFold(keyAddr, addr) {
+		return withReason(ReasonAddressMismatch, fmt.Errorf("public key address not match, coin:%s, keyAddr:%s, addr:%s", coin, keyAddr, addr))
+	}
 	return nil
 }
 
 func VerifyStarkCoin(coin, addr, msg, sign, publicKey string) error {
-	if VerifyStarknetEIP712(addr, msg, publicKey, sign) {
-		return nil
+	if publicKey == "" {
+		return withReason(ReasonMissingScript, fmt.Errorf("starknet coin %s missing public key, addr:%s", coin, addr))
 	}
-
-	return fmt.Errorf("recovery address not match, coin:%s, addr:%s", coin, addr)
+	if err := VerifyStarknetSignature(addr, msg, publicKey, sign); err != nil {
+		return fmt.Errorf("%w, coin:%s, addr:%s", err, coin, addr)
+	}
+	return nil
 }
 
 func VerifyEcdsaCoinWithPub(msg, sign, publicKey string) error {
@@ -556,7 +669,7 @@ func VerifyEcdsaCoinWithPub(msg, sign, publicKey string) error {
 	// Decode the provided public key
 	providedPubKey, err := Decode(publicKey)
 	if err != nil {
-		return fmt.Errorf("invalid public key format: %v", err)
+		return withReason(ReasonMissingScript, fmt.Errorf("invalid public key format: %v", err))
 	}
 
 	if len(providedPubKey) == 64 {
@@ -576,7 +689,7 @@ func VerifyEcdsaCoinWithPub(msg, sign, publicKey string) error {
 
 	// Compare the public keys directly
 	if !bytes.Equal(recoveredPubKey, providedPubKey) {
-		return fmt.Errorf("public key mismatch: recovered %x, provided %x", recoveredPubKey, providedPubKey)
+		return withReason(ReasonAddressMismatch, fmt.Errorf("public key mismatch: recovered %x, provided %x", recoveredPubKey, providedPubKey))
 	}
 
 	return nil
@@ -584,7 +697,7 @@ func VerifyEcdsaCoinWithPub(msg, sign, publicKey string) error {
 
 func VerifyEOSCoin(coin, addr, msg, sign, publicKey string) error {
 	if publicKey == "" || publicKey == "null" {
-		return fmt.Errorf("EOS coin %s missing public key", coin)
+		return withReason(ReasonMissingScript, fmt.Errorf("EOS coin %s missing public key", coin))
 	}
 
 	// Convert EOS signature to normal ECDSA format
@@ -605,7 +718,7 @@ func VerifyEOSCoin(coin, addr, msg, sign, publicKey string) error {
 	// Convert EOS public key to normal hex format
 	expectedPubKeyHex, err := eosPublicKeyToHex(publicKey)
 	if err != nil {
-		return fmt.Errorf("failed to convert EOS public key to hex, coin:%s, addr:%s, error:%v", coin, addr, err)
+		return withReason(ReasonMissingScript, fmt.Errorf("failed to convert EOS public key to hex, coin:%s, addr:%s, error:%v", coin, addr, err))
 	}
 
 	// Convert recovered public key to compressed hex format
@@ -613,7 +726,7 @@ func VerifyEOSCoin(coin, addr, msg, sign, publicKey string) error {
 
 	// Compare the public keys
 	if !strings.EqualFold(expectedPubKeyHex, recoveredPubKeyHex) {
-		return fmt.Errorf("EOS public key mismatch, coin:%s, expected:%s, recovered:%s", coin, expectedPubKeyHex, recoveredPubKeyHex)
+		return withReason(ReasonAddressMismatch, fmt.Errorf("EOS public key mismatch, coin:%s, expected:%s, recovered:%s", coin, expectedPubKeyHex, recoveredPubKeyHex))
 	}
 
 	return nil
@@ -733,12 +846,12 @@ func GenerateICXAddress(publicKey []byte) (string, error) {
 // ConvertETHToLATAddress
 func ConvertETHToLATAddress(ethAddress string) (string, error) {
 	if len(ethAddress) < 2 || ethAddress[:2] != "0x" {
-		return "", fmt.Errorf("invalid ETH address format: %s", ethAddress)
+		return "", withReason(ReasonUndecodableAddress, fmt.Errorf("invalid ETH address format: %s", ethAddress))
 	}
 
 	addressBytes, err := hex.DecodeString(ethAddress[2:])
 	if err != nil {
-		return "", fmt.Errorf("failed to decode ETH address: %v", err)
+		return "", withReason(ReasonUndecodableAddress, fmt.Errorf("failed to decode ETH address: %v", err))
 	}
 
 	latAddress, err := bech32.EncodeFromBase256("lat", addressBytes)
@@ -0,0 +1,106 @@
+package common
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultVerifyCacheSize is the number of signature checks the verification cache keeps, PoR files
+// repeat the same EOA1/EOA2 signers and message over many rows.
+const DefaultVerifyCacheSize = 1 << 16
+
+// verifyCache memoizes signature checks keyed by scheme, message and signature (and the public key
+// of a scheme that does not recover it). It keeps two generations of at most size entries each, the
+// older one is dropped when the recent one is full, so the cache stays bounded without tracking the
+// use of every entry.
+type verifyCache struct {
+	mu            sync.Mutex
+	size          int
+	recent, older map[string]interface{}
+	hits, misses  int64
+}
+
+var signatureCache = newVerifyCache(DefaultVerifyCacheSize)
+
+func newVerifyCache(size int) *verifyCache {
+	return &verifyCache{size: size, recent: make(map[string]interface{})}
+}
+
+// SetVerifyCacheSize sets the number of signature checks the verification cache keeps and clears
+// it, 0 disables the cache.
+func SetVerifyCacheSize(size int) {
+	signatureCache.mu.Lock()
+	defer signatureCache.mu.Unlock()
+	signatureCache.size = size
+	signatureCache.recent, signatureCache.older = make(map[string]interface{}), nil
+}
+
+// VerifyCacheStats returns the number of signature checks answered by the cache and computed.
+func VerifyCacheStats() (hits, misses int64) {
+	return atomic.LoadInt64(&signatureCache.hits), atomic.LoadInt64(&signatureCache.misses)
+}
+
+func (c *verifyCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size <= 0 {
+		return nil, false
+	}
+	v, exist := c.recent[key]
+	if !exist {
+		if v, exist = c.older[key]; exist {
+			c.add(key, v)
+		}
+	}
+	if exist {
+		atomic.AddInt64(&c.hits, 1)
+	} else {
+		atomic.AddInt64(&c.misses, 1)
+	}
+	return v, exist
+}
+
+func (c *verifyCache) put(key string, v interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size > 0 {
+		c.add(key, v)
+	}
+}
+
+func (c *verifyCache) add(key string, v interface{}) {
+	if len(c.recent) >= c.size {
+		c.recent, c.older = make(map[string]interface{}), c.recent
+	}
+	c.recent[key] = v
+}
+
+// verifyCacheKey joins the scheme and the length prefixed parts, so that no two inputs share a key.
+func verifyCacheKey(scheme string, parts ...[]byte) string {
+	var b strings.Builder
+	b.WriteString(scheme)
+	var n [binary.MaxVarintLen64]byte
+	for _, p := range parts {
+		b.Write(n[:binary.PutUvarint(n[:], uint64(len(p)))])
+		b.Write(p)
+	}
+	return b.String()
+}
+
+// verifyEd25519 is ed25519.Verify through the verification cache. A public key of the wrong
+// length does not verify, ed25519.Verify would panic on it.
+func verifyEd25519(pub, msg, sig []byte) bool {
+	if len(pub) != ed25519.PublicKeySize {
+		return false
+	}
+	key := verifyCacheKey("ed25519", pub, msg, sig)
+	if ok, hit := signatureCache.get(key); hit {
+		return ok.(bool)
+	}
+	ok := ed25519.Verify(pub, msg, sig)
+	signatureCache.put(key, ok)
+	return ok
+}
@@ -0,0 +1,125 @@
+package common
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+)
+
+func TestVerifyCache(t *testing.T) {
+	c := newVerifyCache(2)
+	c.put("a", 1)
+	c.put("b", 2)
+	// the third entry starts a generation, a and b are still found in the older one
+	c.put("c", 3)
+	if v, hit := c.get("a"); !hit || v != 1 {
+		t.Fatalf("expected a in the older generation, got %v %v", v, hit)
+	}
+	// a moved to the recent generation with c, the next entry drops b
+	c.put("d", 4)
+	if _, hit := c.get("b"); hit {
+		t.Fatal("expected b to be dropped")
+	}
+	_, older := c.older["a"]
+	_, recent := c.recent["d"]
+	if !older || !recent || c.hits != 1 || c.misses != 1 {
+		t.Fatalf("unexpected cache %+v", c)
+	}
+	if verifyCacheKey("s", []byte("ab"), []byte("c")) == verifyCacheKey("s", []byte("a"), []byte("bc")) {
+		t.Fatal("expected the parts to be length prefixed")
+	}
+}
+
+func TestSigToPubCache(t *testing.T) {
+	SetVerifyCacheSize(DefaultVerifyCacheSize)
+	hits, _ := VerifyCacheStats()
+	hash, sig := HashEcdsaMsg(OKXMessageSignatureHeader, okxTestMessage), bytes.Repeat([]byte{1}, SignatureLength)
+	sig[RecoveryIDOffset] = 27
+	pub, err := sigToPub(hash, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, err := sigToPub(hash, sig)
+	if err != nil || cached != pub {
+		t.Fatalf("expected the cached key, got %v %v", cached, err)
+	}
+	if h, _ := VerifyCacheStats(); h != hits+1 {
+		t.Fatalf("expected a cache hit, got %d", h-hits)
+	}
+	SetVerifyCacheSize(0)
+	defer SetVerifyCacheSize(DefaultVerifyCacheSize)
+	if uncached, _ := sigToPub(hash, sig); uncached == pub || !bytes.Equal(uncached.SerializeCompressed(), pub.SerializeCompressed()) {
+		t.Fatal("expected a disabled cache to recover the key again")
+	}
+}
+
+// aptosRows returns APTOS rows signed by n keys, the signature of row bad is of another message.
+func aptosRows(n, bad int) []*CoinData {
+	rows := make([]*CoinData, n)
+	for i := range rows {
+		key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{byte(i + 1)}, 32))
+		pub := key.Public().(ed25519.PublicKey)
+		msg := okxTestMessage
+		if i == bad {
+			msg = "OKC_DTT_AUP2024"
+		}
+		sig := ed25519.Sign(key, HashEd25519Msg(OKXMessageSignatureHeader, msg))
+		addr := "0x" + hex.EncodeToString(Sha256Hash(append(append([]byte{}, pub...), 0)))
+		rows[i] = &CoinData{Line: i + 1, Coin: "APTOS", Address: addr, Message: okxTestMessage, Sign1: Encode(sig), Script: Encode(pub)}
+	}
+	return rows
+}
+
+func TestWorkerPoolBatch(t *testing.T) {
+	SetVerifyCacheSize(DefaultVerifyCacheSize)
+	for _, batchSize := range []int{1, 3, 64} {
+		collector := NewResultCollector()
+		pool := NewWorkerPool(2, collector, nil)
+		pool.SetBatchSize(batchSize)
+		pool.Start()
+		for _, row := range aptosRows(10, 7) {
+			pool.AddJob(row)
+		}
+		pool.Wait()
+		success, fail, _, failed, _ := collector.GetStats()
+		if success != 9 || fail != 1 || failed[8].Reason != ReasonBadSignature {
+			t.Errorf("batch size %d: expected 9 verified rows and line 8 to fail, got %d %d %v", batchSize, success, fail, failed)
+		}
+		pool.Stop()
+		if rows, _, rowsPerSecond := collector.Throughput(); rows != 10 || rowsPerSecond <= 0 {
+			t.Errorf("batch size %d: unexpected throughput %d %f", batchSize, rows, rowsPerSecond)
+		}
+	}
+}
+
+// A key of small order lets anyone sign, a cofactored check accepts the signature below for any
+// message while crypto/ed25519 accepts it for one hash in eight. The row fails at any batch size.
+func TestWorkerPoolSmallOrderKey(t *testing.T) {
+	pub, _ := hex.DecodeString("c7176a703d4dd84fba3c0b760d10670f2a2053fa2c39ccc64ec7fd7792ac037a")
+	sig := make([]byte, ed25519.SignatureSize)
+	sig[0] = 1 // R is the identity, S is 0
+	if ed25519.Verify(pub, HashEd25519Msg(OKXMessageSignatureHeader, okxTestMessage), sig) {
+		t.Fatal("expected crypto/ed25519 to reject the signature of the message")
+	}
+	addr := "0x" + hex.EncodeToString(Sha256Hash(append(append([]byte{}, pub...), 0)))
+	forged := &CoinData{Line: 3, Coin: "APTOS", Address: addr, Message: okxTestMessage, Sign1: Encode(sig), Script: Encode(pub)}
+
+	defer SetVerifyCacheSize(DefaultVerifyCacheSize)
+	for _, batchSize := range []int{1, 64} {
+		SetVerifyCacheSize(DefaultVerifyCacheSize)
+		collector := NewResultCollector()
+		pool := NewWorkerPool(1, collector, nil)
+		pool.SetBatchSize(batchSize)
+		pool.Start()
+		rows := aptosRows(2, -1)
+		for _, row := range []*CoinData{rows[0], forged, rows[1]} {
+			pool.AddJob(row)
+		}
+		pool.Stop()
+		success, fail, _, failed, _ := collector.GetStats()
+		if success != 2 || fail != 1 || failed[3].Reason != ReasonBadSignature {
+			t.Errorf("batch size %d: expected the small order key to fail, got %d %d %v", batchSize, success, fail, failed)
+		}
+	}
+}